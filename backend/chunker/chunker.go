@@ -23,12 +23,14 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/asyncreader"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/fspath"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/sync/errgroup"
 )
 
 // Chunker's composite files have one or more chunks
@@ -264,6 +266,34 @@ If meta format is set to "none", rename transactions will always be used.
 This method is EXPERIMENTAL, don't use on production systems.`,
 				},
 			},
+		}, {
+			Name:     "upload_concurrency",
+			Advanced: true,
+			Default:  1,
+			Help: `Number of chunks of a file to upload at once.
+
+If this is more than 1 then the chunks of a file are read from the
+source separately and uploaded in parallel. This only works if the
+source is a file of known size which can be read from an offset,
+otherwise chunks are uploaded one after another.
+
+If the source can't quickly supply the hash chunker stores, for
+example a file on a local disk, the first chunk is hashed as it is
+uploaded and the rest of the file is read again in order to hash it
+while the other chunks are uploaded.
+
+Memory use doesn't depend on the chunk size as the chunks are streamed
+from the source.`,
+		}, {
+			Name:     "download_ahead",
+			Advanced: true,
+			Default:  0,
+			Help: `Number of chunks to open ahead when reading a file.
+
+When reading a chunked file from start to end, this many of the
+following chunks are opened in the background and up to --buffer-size
+of each is read into memory, so the next chunk is ready when the
+current one has been read.`,
 		}},
 	})
 }
@@ -346,14 +376,16 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote       string        `config:"remote"`
-	ChunkSize    fs.SizeSuffix `config:"chunk_size"`
-	NameFormat   string        `config:"name_format"`
-	StartFrom    int           `config:"start_from"`
-	MetaFormat   string        `config:"meta_format"`
-	HashType     string        `config:"hash_type"`
-	FailHard     bool          `config:"fail_hard"`
-	Transactions string        `config:"transactions"`
+	Remote            string        `config:"remote"`
+	ChunkSize         fs.SizeSuffix `config:"chunk_size"`
+	NameFormat        string        `config:"name_format"`
+	StartFrom         int           `config:"start_from"`
+	MetaFormat        string        `config:"meta_format"`
+	HashType          string        `config:"hash_type"`
+	FailHard          bool          `config:"fail_hard"`
+	Transactions      string        `config:"transactions"`
+	UploadConcurrency int           `config:"upload_concurrency"`
+	DownloadAhead     int           `config:"download_ahead"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -1146,7 +1178,11 @@ func (f *Fs) put(
 
 	// Prepare to upload
 	c := f.newChunkingReader(src)
-	wrapIn := c.wrapStream(ctx, in, src)
+	srcObj := c.parallelSource(ctx, src)
+	var wrapIn io.Reader
+	if srcObj == nil {
+		wrapIn = c.wrapStream(ctx, in, src)
+	}
 
 	var metaObject fs.Object
 	defer func() {
@@ -1162,6 +1198,12 @@ func (f *Fs) put(
 	}
 
 	// Transfer chunks data
+	if srcObj != nil {
+		err = f.putParallel(ctx, c, srcObj, in, src, baseRemote, xactID, options, basePut)
+		if err != nil {
+			return nil, err
+		}
+	}
 	for c.chunkNo = 0; !c.done; c.chunkNo++ {
 		if c.chunkNo > maxSafeChunkNumber {
 			return nil, ErrChunkOverflow
@@ -1350,9 +1392,149 @@ func (f *Fs) newChunkingReader(src fs.ObjectInfo) *chunkingReader {
 	return c
 }
 
-func (c *chunkingReader) wrapStream(ctx context.Context, in io.Reader, src fs.ObjectInfo) io.Reader {
-	baseIn, wrapBack := accounting.UnWrap(in)
+// parallelSource returns the source object to read chunks from if
+// they can be uploaded in parallel, or nil to upload them one after
+// another.
+//
+// The chunks are read from the source separately so it must be an
+// object of known size.
+func (c *chunkingReader) parallelSource(ctx context.Context, src fs.ObjectInfo) fs.Object {
+	f := c.fs
+	if f.opt.UploadConcurrency <= 1 || c.sizeTotal <= c.chunkSize {
+		return nil
+	}
+	srcObj := fs.UnWrapObjectInfo(src)
+	if or, ok := src.(*fs.OverrideRemote); ok {
+		// The source has been renamed, for example by
+		// operations.Copy, but holds the same data
+		srcObj = or.UnWrap()
+	}
+	if srcObj == nil {
+		return nil
+	}
+	c.setupHash(ctx, src)
+	return fs.UnWrapObject(srcObj)
+}
+
+// putParallel uploads the chunks of srcObj with up to
+// upload_concurrency of them at once.
+//
+// The first chunk is read from in and the others from the source
+// separately, each accounted to the transfer of in. If the hash has
+// to be calculated in transit the first chunk is hashed as it is
+// uploaded, then the rest of the source is read again in order and
+// hashed alongside the uploads of the other chunks.
+func (f *Fs) putParallel(ctx context.Context, c *chunkingReader, srcObj fs.Object, in io.Reader, src fs.ObjectInfo, baseRemote, xactID string, options []fs.OpenOption, basePut putFn) error {
+	nChunks := int((c.sizeTotal + c.chunkSize - 1) / c.chunkSize)
+	if nChunks-1 > maxSafeChunkNumber {
+		return ErrChunkOverflow
+	}
+	acc, _ := in.(*accounting.Account)
+	c.chunks = make([]fs.Object, nChunks)
+	var (
+		hashWg  sync.WaitGroup
+		hashErr error
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(f.opt.UploadConcurrency)
+	for chunkNo := 0; chunkNo < nChunks; chunkNo++ {
+		chunkNo := chunkNo
+		start := int64(chunkNo) * c.chunkSize
+		size := c.sizeTotal - start
+		if size > c.chunkSize {
+			size = c.chunkSize
+		}
+		g.Go(func() (err error) {
+			var chunkIn io.Reader
+			if chunkNo == 0 {
+				chunkIn = io.LimitReader(in, size)
+				if c.hasher != nil {
+					chunkIn = io.TeeReader(chunkIn, c.hasher)
+				}
+			} else {
+				rc, err := srcObj.Open(gCtx, &fs.RangeOption{Start: start, End: start + size - 1})
+				if err != nil {
+					return fmt.Errorf("failed to open source for chunk %d: %w", chunkNo, err)
+				}
+				defer fs.CheckClose(rc, &err)
+				chunkIn = rc
+				if acc != nil {
+					chunkIn = &chunkAccounter{in: rc, acc: acc}
+				}
+			}
+			tempRemote := f.makeChunkName(baseRemote, chunkNo, "", xactID)
+			chunk, err := basePut(gCtx, chunkIn, f.wrapInfo(src, tempRemote, size), options...)
+			if err != nil {
+				return err
+			}
+			c.chunks[chunkNo] = chunk
+			if chunk.Size() != size {
+				return fmt.Errorf("incorrect size of chunk %d: %d != %d", chunkNo, chunk.Size(), size)
+			}
+			if chunkNo == 0 && c.hasher != nil {
+				// Make sure all of the first chunk has been
+				// hashed then hash the rest of the source
+				if _, err = io.Copy(io.Discard, chunkIn); err != nil {
+					return fmt.Errorf("failed to read first chunk: %w", err)
+				}
+				hashWg.Add(1)
+				go func() {
+					defer hashWg.Done()
+					hashErr = c.hashRest(gCtx, srcObj, size)
+				}()
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+	hashWg.Wait()
+	if err == nil {
+		err = hashErr
+	}
+	c.readCount = c.sizeTotal
+	c.sizeLeft = 0
+	c.done = true
+	return err
+}
+
+// hashRest reads srcObj from offset to the end into the hasher
+func (c *chunkingReader) hashRest(ctx context.Context, srcObj fs.Object, offset int64) (err error) {
+	in, err := srcObj.Open(ctx, &fs.SeekOption{Offset: offset})
+	if err != nil {
+		return fmt.Errorf("failed to open source for hashing: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	n, err := io.Copy(c.hasher, in)
+	if err != nil {
+		return fmt.Errorf("failed to read source for hashing: %w", err)
+	}
+	if offset+n != c.sizeTotal {
+		return fmt.Errorf("source changed while hashing: read %d bytes but expected %d", offset+n, c.sizeTotal)
+	}
+	return nil
+}
+
+// chunkAccounter accounts the reads of a chunk opened from the source
+// separately to the Account of the transfer
+type chunkAccounter struct {
+	in  io.Reader
+	acc *accounting.Account
+}
 
+// Read from the chunk and account the bytes read
+func (r *chunkAccounter) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	if n > 0 {
+		if accErr := r.acc.AccountRead(n); accErr != nil && err == nil {
+			err = accErr
+		}
+	}
+	return n, err
+}
+
+// setupHash finds the hash of src to store, or sets up the hasher to
+// calculate it in transit if it isn't available or is slow to read
+func (c *chunkingReader) setupHash(ctx context.Context, src fs.ObjectInfo) {
 	switch {
 	case c.fs.useMD5:
 		srcObj := fs.UnWrapObjectInfo(src)
@@ -1383,7 +1565,11 @@ func (c *chunkingReader) wrapStream(ctx context.Context, in io.Reader, src fs.Ob
 			}
 		}
 	}
+}
 
+func (c *chunkingReader) wrapStream(ctx context.Context, in io.Reader, src fs.ObjectInfo) io.Reader {
+	baseIn, wrapBack := accounting.UnWrap(in)
+	c.setupHash(ctx, src)
 	if c.hasher != nil {
 		baseIn = io.TeeReader(baseIn, c.hasher)
 	}
@@ -1474,6 +1660,10 @@ func (c *chunkingReader) rollback(ctx context.Context, metaObject fs.Object) {
 		c.chunks = append(c.chunks, metaObject)
 	}
 	for _, chunk := range c.chunks {
+		if chunk == nil {
+			// not uploaded by a parallel upload
+			continue
+		}
 		if err := chunk.Remove(ctx); err != nil {
 			fs.Errorf(chunk, "Failed to remove temporary chunk: %v", err)
 		}
@@ -1946,6 +2136,33 @@ func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryT
 	do(ctx, wrappedNotifyFunc, pollIntervalChan)
 }
 
+// DirSetModTime sets the modification time of the directory dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	do := f.base.Features().DirSetModTime
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, dir, modTime)
+}
+
+// DirMetadata returns the metadata of the directory dir
+func (f *Fs) DirMetadata(ctx context.Context, dir string) (fs.Metadata, error) {
+	do := f.base.Features().DirMetadata
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	return do(ctx, dir)
+}
+
+// DirSetMetadata sets metadata on the directory dir
+func (f *Fs) DirSetMetadata(ctx context.Context, dir string, metadata fs.Metadata) error {
+	do := f.base.Features().DirSetMetadata
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, dir, metadata)
+}
+
 // Shutdown the backend, closing any background tasks and any
 // cached connections.
 func (f *Fs) Shutdown(ctx context.Context) error {
@@ -2185,7 +2402,8 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 	return o.newLinearReader(ctx, offset, limit, openOptions)
 }
 
-// linearReader opens and reads file chunks sequentially, without read-ahead
+// linearReader opens and reads file chunks sequentially,
+// optionally opening the next download_ahead chunks in the background
 type linearReader struct {
 	ctx     context.Context
 	chunks  []fs.Object
@@ -2195,6 +2413,17 @@ type linearReader struct {
 	pos     int
 	reader  io.ReadCloser
 	err     error
+	ahead   int                 // number of chunks to open ahead
+	buffers int                 // number of async buffers per chunk opened ahead
+	opened  map[int]*chunkAhead // chunks opened ahead by chunk number
+}
+
+// chunkAhead is a chunk being opened ahead of reading
+type chunkAhead struct {
+	count  int64         // number of bytes to read from the chunk
+	done   chan struct{} // closed when opened
+	reader io.ReadCloser
+	err    error
 }
 
 func (o *Object) newLinearReader(ctx context.Context, offset, limit int64, options []fs.OpenOption) (io.ReadCloser, error) {
@@ -2203,6 +2432,14 @@ func (o *Object) newLinearReader(ctx context.Context, offset, limit int64, optio
 		chunks:  o.chunks,
 		options: options,
 		limit:   limit,
+		ahead:   o.f.opt.DownloadAhead,
+	}
+	if r.ahead > 0 {
+		r.buffers = int(int64(fs.GetConfig(ctx).BufferSize) / asyncreader.BufferSize)
+		if r.buffers < 1 {
+			r.buffers = 1
+		}
+		r.opened = make(map[int]*chunkAhead, r.ahead)
 	}
 
 	// skip to chunk for given offset
@@ -2225,7 +2462,8 @@ func (r *linearReader) nextChunk(offset int64) (int64, error) {
 		return -1, io.EOF
 	}
 
-	chunk := r.chunks[r.pos]
+	chunkNo := r.pos
+	chunk := r.chunks[chunkNo]
 	count := chunk.Size()
 	r.pos++
 
@@ -2236,22 +2474,65 @@ func (r *linearReader) nextChunk(offset int64) (int64, error) {
 	if r.limit < count {
 		count = r.limit
 	}
-	options := append(r.options, &fs.RangeOption{Start: offset, End: offset + count - 1})
 
-	if err := r.Close(); err != nil {
+	if err := r.closeReader(); err != nil {
 		return -1, err
 	}
 
-	reader, err := chunk.Open(r.ctx, options...)
+	var reader io.ReadCloser
+	var err error
+	if a := r.opened[chunkNo]; a != nil && offset == 0 && a.count == count {
+		delete(r.opened, chunkNo)
+		<-a.done
+		reader, err = a.reader, a.err
+	} else {
+		options := append(r.options, &fs.RangeOption{Start: offset, End: offset + count - 1})
+		reader, err = chunk.Open(r.ctx, options...)
+	}
 	if err != nil {
 		return -1, err
 	}
 
 	r.reader = reader
 	r.count = count
+	r.openAhead(chunkNo, r.limit-count)
 	return offset, nil
 }
 
+// openAhead starts opening the chunks following chunkNo in the
+// background, given that left bytes remain to be read after it.
+func (r *linearReader) openAhead(chunkNo int, left int64) {
+	for chunkNo++; chunkNo <= r.pos+r.ahead-1 && chunkNo < len(r.chunks) && left > 0; chunkNo++ {
+		chunk := r.chunks[chunkNo]
+		count := chunk.Size()
+		if left < count {
+			count = left
+		}
+		left -= count
+		if count == 0 || r.opened[chunkNo] != nil {
+			continue
+		}
+		a := &chunkAhead{
+			count: count,
+			done:  make(chan struct{}),
+		}
+		r.opened[chunkNo] = a
+		options := append(r.options[:len(r.options):len(r.options)], &fs.RangeOption{Start: 0, End: count - 1})
+		go func() {
+			defer close(a.done)
+			in, err := chunk.Open(r.ctx, options...)
+			if err != nil {
+				a.err = err
+				return
+			}
+			a.reader, a.err = asyncreader.New(r.ctx, in, r.buffers)
+			if a.err != nil {
+				_ = in.Close()
+			}
+		}()
+	}
+}
+
 func (r *linearReader) Read(p []byte) (n int, err error) {
 	if r.err != nil {
 		return 0, r.err
@@ -2283,6 +2564,19 @@ func (r *linearReader) Read(p []byte) (n int, err error) {
 }
 
 func (r *linearReader) Close() (err error) {
+	err = r.closeReader()
+	for chunkNo, a := range r.opened {
+		delete(r.opened, chunkNo)
+		<-a.done
+		if a.reader != nil {
+			_ = a.reader.Close()
+		}
+	}
+	return
+}
+
+// closeReader closes the chunk being read
+func (r *linearReader) closeReader() (err error) {
 	if r.reader != nil {
 		err = r.reader.Close()
 		r.reader = nil
@@ -2535,22 +2829,25 @@ func (f *Fs) CanQuickRename() bool {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = (*Fs)(nil)
-	_ fs.Purger          = (*Fs)(nil)
-	_ fs.Copier          = (*Fs)(nil)
-	_ fs.Mover           = (*Fs)(nil)
-	_ fs.DirMover        = (*Fs)(nil)
-	_ fs.PutUncheckeder  = (*Fs)(nil)
-	_ fs.PutStreamer     = (*Fs)(nil)
-	_ fs.CleanUpper      = (*Fs)(nil)
-	_ fs.UnWrapper       = (*Fs)(nil)
-	_ fs.ListRer         = (*Fs)(nil)
-	_ fs.Abouter         = (*Fs)(nil)
-	_ fs.Wrapper         = (*Fs)(nil)
-	_ fs.ChangeNotifier  = (*Fs)(nil)
-	_ fs.Shutdowner      = (*Fs)(nil)
-	_ fs.ObjectInfo      = (*ObjectInfo)(nil)
-	_ fs.Object          = (*Object)(nil)
-	_ fs.ObjectUnWrapper = (*Object)(nil)
-	_ fs.IDer            = (*Object)(nil)
+	_ fs.Fs               = (*Fs)(nil)
+	_ fs.Purger           = (*Fs)(nil)
+	_ fs.Copier           = (*Fs)(nil)
+	_ fs.Mover            = (*Fs)(nil)
+	_ fs.DirMover         = (*Fs)(nil)
+	_ fs.PutUncheckeder   = (*Fs)(nil)
+	_ fs.PutStreamer      = (*Fs)(nil)
+	_ fs.CleanUpper       = (*Fs)(nil)
+	_ fs.UnWrapper        = (*Fs)(nil)
+	_ fs.ListRer          = (*Fs)(nil)
+	_ fs.Abouter          = (*Fs)(nil)
+	_ fs.Wrapper          = (*Fs)(nil)
+	_ fs.ChangeNotifier   = (*Fs)(nil)
+	_ fs.Shutdowner       = (*Fs)(nil)
+	_ fs.DirSetModTimer   = (*Fs)(nil)
+	_ fs.DirMetadataer    = (*Fs)(nil)
+	_ fs.DirSetMetadataer = (*Fs)(nil)
+	_ fs.ObjectInfo       = (*ObjectInfo)(nil)
+	_ fs.Object           = (*Object)(nil)
+	_ fs.ObjectUnWrapper  = (*Object)(nil)
+	_ fs.IDer             = (*Object)(nil)
 )
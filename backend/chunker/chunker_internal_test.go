@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/fspath"
 	"github.com/rclone/rclone/fs/hash"
@@ -899,6 +900,105 @@ func testMD5AllSlow(t *testing.T, f *Fs) {
 	require.NoError(t, operations.Purge(ctx, baseFs, ""))
 }
 
+// Test that chunks can be uploaded in parallel and read ahead
+func testParallel(t *testing.T, f *Fs) {
+	ctx := context.Background()
+	const size = 10000
+	contents := random.String(size)
+	// The source must have quick hashes to be read in parallel
+	srcFs, err := fs.NewFs(ctx, ":memory:chunker-parallel")
+	require.NoError(t, err)
+	srcObj := testPutFile(ctx, t, srcFs, "parallel-src", contents, "source must be put", true)
+	defer func() {
+		_ = srcObj.Remove(ctx)
+	}()
+
+	for _, transactions := range []string{"rename", "norename"} {
+		t.Run(transactions, func(t *testing.T) {
+			dir := "parallel-" + transactions
+			fsResult := deriveFs(ctx, t, f, dir, settings{
+				"chunk_size":         "1k",
+				"name_format":        "*.#",
+				"hash_type":          "md5",
+				"meta_format":        "simplejson",
+				"transactions":       transactions,
+				"upload_concurrency": 4,
+				"download_ahead":     3,
+			})
+			chunkFs, ok := fsResult.(*Fs)
+			require.True(t, ok, "fs must be a chunker remote")
+			baseFs := chunkFs.base
+			defer func() {
+				require.NoError(t, operations.Purge(ctx, baseFs, ""))
+			}()
+			require.NotNil(t, chunkFs.newChunkingReader(srcObj).parallelSource(ctx, srcObj), "source must allow parallel upload")
+			srcSum, err := srcObj.Hash(ctx, hash.MD5)
+			require.NoError(t, err)
+
+			// Sources with slow hashes are uploaded in parallel and
+			// hashed in transit
+			if baseFs.Features().SlowHash {
+				slowObj := testPutFile(ctx, t, baseFs, "parallel-slow", contents, "slow source must be put", true)
+				c := chunkFs.newChunkingReader(slowObj)
+				assert.NotNil(t, c.parallelSource(ctx, slowObj), "source with slow hashes must be uploaded in parallel")
+				assert.NotNil(t, c.hasher, "source with slow hashes must be hashed in transit")
+				obj, err := operations.Copy(ctx, chunkFs, nil, "slow", slowObj)
+				require.NoError(t, err)
+				sum, err := obj.Hash(ctx, hash.MD5)
+				assert.NoError(t, err)
+				assert.Equal(t, srcSum, sum)
+				require.NoError(t, obj.Remove(ctx))
+				require.NoError(t, slowObj.Remove(ctx))
+			}
+
+			// Each chunk is accounted once
+			statsCtx := accounting.WithStatsGroup(ctx, "chunker-parallel-"+transactions)
+			obj, err := operations.Copy(statsCtx, chunkFs, nil, "file", srcObj)
+			require.NoError(t, err)
+			assert.Equal(t, int64(size), obj.Size())
+			want := int64(size)
+			if transactions == "rename" {
+				// Temporary chunks are renamed by server-side moves
+				// which are accounted too
+				want *= 2
+			}
+			assert.Equal(t, want, accounting.StatsGroup(statsCtx, "chunker-parallel-"+transactions).GetBytes())
+
+			list, err := baseFs.List(ctx, "")
+			require.NoError(t, err)
+			assert.Equal(t, 11, len(list), "metadata and 10 chunks must be created")
+			if transactions == "rename" {
+				_, err = baseFs.NewObject(ctx, "file.10")
+				assert.NoError(t, err, "last chunk must be renamed")
+			}
+
+			obj, err = chunkFs.NewObject(ctx, "file")
+			require.NoError(t, err)
+			sum, err := obj.Hash(ctx, hash.MD5)
+			assert.NoError(t, err)
+			assert.Equal(t, srcSum, sum)
+
+			for _, r := range []struct{ start, end int64 }{{0, size - 1}, {1500, 7499}, {0, 1023}, {9990, size - 1}} {
+				in, err := obj.Open(ctx, &fs.RangeOption{Start: r.start, End: r.end})
+				require.NoError(t, err)
+				data, err := io.ReadAll(in)
+				assert.NoError(t, err)
+				assert.NoError(t, in.Close())
+				assert.Equal(t, contents[r.start:r.end+1], string(data))
+			}
+
+			// Close before reading everything
+			in, err := obj.Open(ctx)
+			require.NoError(t, err)
+			buf := make([]byte, 1500)
+			_, err = io.ReadFull(in, buf)
+			assert.NoError(t, err)
+			assert.NoError(t, in.Close())
+			assert.Equal(t, contents[:1500], string(buf))
+		})
+	}
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("PutLarge", func(t *testing.T) {
@@ -934,6 +1034,9 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("MD5AllSlow", func(t *testing.T) {
 		testMD5AllSlow(t, f)
 	})
+	t.Run("Parallel", func(t *testing.T) {
+		testParallel(t, f)
+	})
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
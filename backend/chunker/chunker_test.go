@@ -36,10 +36,13 @@ func TestIntegration(t *testing.T) {
 			"GetTier",
 			"SetTier",
 			"Metadata",
+			"SetMetadata",
 		},
 		UnimplementableFsMethods: []string{
 			"PublicLink",
 			"OpenWriterAt",
+			"HardLink",
+			"Shortcut",
 			"MergeDirs",
 			"DirCacheFlush",
 			"UserInfo",
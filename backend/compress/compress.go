@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"regexp"
 	"strings"
 	"time"
@@ -43,6 +44,7 @@ const (
 	minCompressionRatio = 1.1
 
 	gzFileExt           = ".gz"
+	zstdFileExt         = ".zst"
 	metaFileExt         = ".json"
 	uncompressedFileExt = ".bin"
 )
@@ -51,6 +53,7 @@ const (
 const (
 	Uncompressed = 0
 	Gzip         = 2
+	Zstd         = 3
 )
 
 var nameRegexp = regexp.MustCompile(`^(.+?)\.([A-Za-z0-9-_]{11})$`)
@@ -62,6 +65,9 @@ func init() {
 		{ // Default compression mode options {
 			Value: "gzip",
 			Help:  "Standard gzip compression with fastest parameters.",
+		}, {
+			Value: "zstd",
+			Help:  "Zstandard compression in seekable frames.",
 		},
 	}
 
@@ -84,15 +90,18 @@ func init() {
 			Examples: compressionModeOptions,
 		}, {
 			Name: "level",
-			Help: `GZIP compression level (-2 to 9).
+			Help: `GZIP compression level (-2 to 9) or zstd compression level (1 to 22).
+
+Generally -1 (default, equivalent to 5 for gzip and 3 for zstd) is
+recommended.
 
-Generally -1 (default, equivalent to 5) is recommended.
-Levels 1 to 9 increase compression at the cost of speed. Going past 6 
-generally offers very little return.
+For gzip, levels 1 to 9 increase compression at the cost of speed.
+Going past 6 generally offers very little return. Level -2 uses
+Huffman encoding only. Only use if you know what you are doing.
+Level 0 turns off compression.
 
-Level -2 uses Huffman encoding only. Only use if you know what you
-are doing.
-Level 0 turns off compression.`,
+For zstd, levels 1 to 22 are mapped onto the fastest, default, better
+and best compression speeds. Levels 0 and below use the default.`,
 			Default:  sgzip.DefaultCompression,
 			Advanced: true,
 		}, {
@@ -105,16 +114,56 @@ Files smaller than this limit will be cached in RAM, files larger than
 this limit will be cached on disk.`,
 			Default:  fs.SizeSuffix(20 * 1024 * 1024),
 			Advanced: true,
+		}, {
+			Name: "compress_extensions",
+			Help: `Comma separated list of file extensions to always compress.
+
+Files with these extensions are compressed without first checking
+whether they compress well, e.g. "txt,csv,log".`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name: "no_compress_extensions",
+			Help: `Comma separated list of file extensions to never compress.
+
+Files with these extensions are stored uncompressed without first
+checking whether they compress well. Use this for file types which are
+already compressed, e.g. "jpg,mp4,zip". This takes precedence over
+compress_extensions and compress_mime_types.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name: "compress_mime_types",
+			Help: `Comma separated list of MIME types to always compress.
+
+The MIME type is detected from the start of the file. A type may end
+in "/*" to match all the types in a group, e.g. "text/*".`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name: "no_compress_mime_types",
+			Help: `Comma separated list of MIME types to never compress.
+
+The MIME type is detected from the start of the file. A type may end
+in "/*" to match all the types in a group, e.g. "video/*,image/jpeg".
+This takes precedence over compress_extensions and
+compress_mime_types.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
 		}},
 	})
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote           string        `config:"remote"`
-	CompressionMode  string        `config:"mode"`
-	CompressionLevel int           `config:"level"`
-	RAMCacheLimit    fs.SizeSuffix `config:"ram_cache_limit"`
+	Remote           string          `config:"remote"`
+	CompressionMode  string          `config:"mode"`
+	CompressionLevel int             `config:"level"`
+	RAMCacheLimit    fs.SizeSuffix   `config:"ram_cache_limit"`
+	CompressExt      fs.CommaSepList `config:"compress_extensions"`
+	NoCompressExt    fs.CommaSepList `config:"no_compress_extensions"`
+	CompressMime     fs.CommaSepList `config:"compress_mime_types"`
+	NoCompressMime   fs.CommaSepList `config:"no_compress_mime_types"`
 }
 
 /*** FILESYSTEM FUNCTIONS ***/
@@ -202,6 +251,8 @@ func compressionModeFromName(name string) int {
 	switch name {
 	case "gzip":
 		return Gzip
+	case "zstd":
+		return Zstd
 	default:
 		return Uncompressed
 	}
@@ -244,7 +295,7 @@ func processFileName(compressedFileName string) (origFileName string, extension
 	if err != nil {
 		return "", "", 0, errors.New("could not decode size")
 	}
-	return match[1], gzFileExt, size, nil
+	return match[1], extension, size, nil
 }
 
 // Generates the file name for a metadata file
@@ -259,10 +310,13 @@ func isMetadataFile(filename string) bool {
 
 // makeDataName generates the file name for a data file with specified compression mode
 func makeDataName(remote string, size int64, mode int) (newRemote string) {
-	if mode != Uncompressed {
-		newRemote = remote + "." + int64ToBase64(size) + gzFileExt
-	} else {
+	switch mode {
+	case Uncompressed:
 		newRemote = remote + uncompressedFileExt
+	case Zstd:
+		newRemote = remote + "." + int64ToBase64(size) + zstdFileExt
+	default:
+		newRemote = remote + "." + int64ToBase64(size) + gzFileExt
 	}
 	return newRemote
 }
@@ -373,16 +427,61 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 		return nil, fmt.Errorf("error decoding metadata: %w", err)
 	}
 	// Create our Object
-	o, err := f.Fs.NewObject(ctx, makeDataName(remote, meta.CompressionMetadata.Size, meta.Mode))
+	o, err := f.Fs.NewObject(ctx, makeDataName(remote, meta.Size, meta.Mode))
 	if err != nil {
 		return nil, err
 	}
 	return f.newObject(o, mo, meta), nil
 }
 
+// matchMimeType returns true if mimeType matches one of the types in
+// list, which may end in "/*" to match a whole group
+func matchMimeType(list fs.CommaSepList, mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	for _, item := range list {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if strings.HasSuffix(item, "/*") {
+			if strings.HasPrefix(mimeType, item[:len(item)-1]) {
+				return true
+			}
+		} else if item == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExtension returns true if the extension of remote is in list
+func matchExtension(list fs.CommaSepList, remote string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(remote), "."))
+	if ext == "" {
+		return false
+	}
+	for _, item := range list {
+		if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(item), ".")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldCompress decides whether to compress remote from its name and
+// MIME type using the configured lists. It returns ok false if the
+// lists don't decide and the data needs to be checked.
+func (f *Fs) shouldCompress(remote, mimeType string) (compress bool, ok bool) {
+	if matchExtension(f.opt.NoCompressExt, remote) || matchMimeType(f.opt.NoCompressMime, mimeType) {
+		return false, true
+	}
+	if matchExtension(f.opt.CompressExt, remote) || matchMimeType(f.opt.CompressMime, mimeType) {
+		return true, true
+	}
+	return false, false
+}
+
 // checkCompressAndType checks if an object is compressible and determines it's mime type
 // returns a multireader with the bytes that were read to determine mime type
-func checkCompressAndType(in io.Reader) (newReader io.Reader, compressible bool, mimeType string, err error) {
+func (f *Fs) checkCompressAndType(in io.Reader, remote string) (newReader io.Reader, compressible bool, mimeType string, err error) {
 	in, wrap := accounting.UnWrap(in)
 	buf := make([]byte, heuristicBytes)
 	n, err := in.Read(buf)
@@ -391,9 +490,12 @@ func checkCompressAndType(in io.Reader) (newReader io.Reader, compressible bool,
 		return nil, false, "", err
 	}
 	mime := mimetype.Detect(buf)
-	compressible, err = isCompressible(bytes.NewReader(buf))
-	if err != nil {
-		return nil, false, "", err
+	compressible, ok := f.shouldCompress(remote, mime.String())
+	if !ok {
+		compressible, err = isCompressible(bytes.NewReader(buf))
+		if err != nil {
+			return nil, false, "", err
+		}
 	}
 	in = io.MultiReader(bytes.NewReader(buf), in)
 	return wrap(in), compressible, mime.String(), nil
@@ -441,6 +543,7 @@ type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ..
 
 type compressionResult struct {
 	err  error
+	size int64 // uncompressed size
 	meta sgzip.GzipMetadata
 }
 
@@ -504,17 +607,30 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	pipeReader, pipeWriter := io.Pipe()
 	results := make(chan compressionResult)
 	go func() {
-		gz, err := sgzip.NewWriterLevel(pipeWriter, f.opt.CompressionLevel)
+		var (
+			w   io.WriteCloser
+			gz  *sgzip.Writer
+			zw  *zstdWriter
+			err error
+		)
+		if f.mode == Zstd {
+			zw, err = newZstdWriter(pipeWriter, f.opt.CompressionLevel)
+			w = zw
+		} else {
+			gz, err = sgzip.NewWriterLevel(pipeWriter, f.opt.CompressionLevel)
+			w = gz
+		}
 		if err != nil {
+			_ = pipeWriter.CloseWithError(err)
 			results <- compressionResult{err: err, meta: sgzip.GzipMetadata{}}
 			return
 		}
-		_, err = io.Copy(gz, in)
-		gzErr := gz.Close()
-		if gzErr != nil {
-			fs.Errorf(nil, "Failed to close compress: %v", gzErr)
+		_, err = io.Copy(w, in)
+		wErr := w.Close()
+		if wErr != nil {
+			fs.Errorf(nil, "Failed to close compress: %v", wErr)
 			if err == nil {
-				err = gzErr
+				err = wErr
 			}
 		}
 		closeErr := pipeWriter.Close()
@@ -524,7 +640,11 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 				err = closeErr
 			}
 		}
-		results <- compressionResult{err: err, meta: gz.MetaData()}
+		if zw != nil {
+			results <- compressionResult{err: err, size: zw.size}
+		} else {
+			results <- compressionResult{err: err, size: gz.MetaData().Size, meta: gz.MetaData()}
+		}
 	}()
 	wrappedIn := wrap(bufio.NewReaderSize(pipeReader, bufferSize)) // Probably no longer needed as sgzip has it's own buffering
 
@@ -571,7 +691,7 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	}
 
 	// Generate metadata
-	meta := newMetadata(result.meta.Size, f.mode, result.meta, hex.EncodeToString(metaHasher.Sum(nil)), mimeType)
+	meta := newMetadata(result.size, f.mode, result.meta, hex.EncodeToString(metaHasher.Sum(nil)), mimeType)
 
 	// Check the hashes of the compressed data if we were comparing them
 	if ht != hash.None && hasher != nil {
@@ -696,7 +816,7 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 	o, err := f.NewObject(ctx, src.Remote())
 	if err == fs.ErrorObjectNotFound {
 		// Get our file compressibility
-		in, compressible, mimeType, err := checkCompressAndType(in)
+		in, compressible, mimeType, err := f.checkCompressAndType(in, src.Remote())
 		if err != nil {
 			return nil, err
 		}
@@ -716,7 +836,7 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 	}
 	found := err == nil
 
-	in, compressible, mimeType, err := checkCompressAndType(in)
+	in, compressible, mimeType, err := f.checkCompressAndType(in, src.Remote())
 	if err != nil {
 		return nil, err
 	}
@@ -930,6 +1050,33 @@ func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
 	return do(ctx)
 }
 
+// DirSetModTime sets the modification time of the directory dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	do := f.Fs.Features().DirSetModTime
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, dir, modTime)
+}
+
+// DirMetadata returns the metadata of the directory dir
+func (f *Fs) DirMetadata(ctx context.Context, dir string) (fs.Metadata, error) {
+	do := f.Fs.Features().DirMetadata
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	return do(ctx, dir)
+}
+
+// DirSetMetadata sets metadata on the directory dir
+func (f *Fs) DirSetMetadata(ctx context.Context, dir string, metadata fs.Metadata) error {
+	do := f.Fs.Features().DirSetMetadata
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, dir, metadata)
+}
+
 // UnWrap returns the Fs that this Fs is wrapping
 func (f *Fs) UnWrap() fs.Fs {
 	return f.Fs
@@ -1090,7 +1237,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 		return o.mo, o.mo.Update(ctx, in, src, options...)
 	}
 
-	in, compressible, mimeType, err := checkCompressAndType(in)
+	in, compressible, mimeType, err := o.f.checkCompressAndType(in, o.Remote())
 	if err != nil {
 		return err
 	}
@@ -1243,6 +1390,24 @@ func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
 	return do.Metadata(ctx)
 }
 
+// SetMetadata sets metadata for an Object
+//
+// The metadata is stored on the metadata object so that is where it
+// is set.
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	err := o.loadMetadataIfNotLoaded(ctx)
+	if err != nil {
+		return err
+	}
+	do, ok := o.mo.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
 // Hash returns the selected checksum of the file
 // If no checksum is available it returns ""
 func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
@@ -1309,14 +1474,20 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 	}
 	// Get a chunkedreader for the wrapped object
 	chunkedReader := chunkedreader.New(ctx, o.Object, initialChunkSize, maxChunkSize)
+	var closer io.Closer = chunkedReader
 	// Get file handle
 	var file io.Reader
-	if offset != 0 {
+	if o.meta.Mode == Zstd {
+		var zr io.ReadCloser
+		zr, err = o.openZstd(ctx, chunkedReader, offset)
+		file, closer = zr, zr
+	} else if offset != 0 {
 		file, err = sgzip.NewReaderAt(chunkedReader, &o.meta.CompressionMetadata, offset)
 	} else {
 		file, err = sgzip.NewReader(chunkedReader)
 	}
 	if err != nil {
+		_ = chunkedReader.Close()
 		return nil, err
 	}
 
@@ -1327,7 +1498,7 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		fileReader = file
 	}
 	// Return a ReadCloser
-	return ReadCloserWrapper{Reader: fileReader, Closer: chunkedReader}, nil
+	return ReadCloserWrapper{Reader: fileReader, Closer: closer}, nil
 }
 
 // ObjectInfo describes a wrapped fs.ObjectInfo for being the source
@@ -1470,22 +1641,25 @@ func (f *Fs) Precision() time.Duration {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = (*Fs)(nil)
-	_ fs.Purger          = (*Fs)(nil)
-	_ fs.Copier          = (*Fs)(nil)
-	_ fs.Mover           = (*Fs)(nil)
-	_ fs.DirMover        = (*Fs)(nil)
-	_ fs.PutStreamer     = (*Fs)(nil)
-	_ fs.CleanUpper      = (*Fs)(nil)
-	_ fs.UnWrapper       = (*Fs)(nil)
-	_ fs.ListRer         = (*Fs)(nil)
-	_ fs.Abouter         = (*Fs)(nil)
-	_ fs.Wrapper         = (*Fs)(nil)
-	_ fs.MergeDirser     = (*Fs)(nil)
-	_ fs.DirCacheFlusher = (*Fs)(nil)
-	_ fs.ChangeNotifier  = (*Fs)(nil)
-	_ fs.PublicLinker    = (*Fs)(nil)
-	_ fs.Shutdowner      = (*Fs)(nil)
-	_ fs.FullObjectInfo  = (*ObjectInfo)(nil)
-	_ fs.FullObject      = (*Object)(nil)
+	_ fs.Fs               = (*Fs)(nil)
+	_ fs.Purger           = (*Fs)(nil)
+	_ fs.Copier           = (*Fs)(nil)
+	_ fs.Mover            = (*Fs)(nil)
+	_ fs.DirMover         = (*Fs)(nil)
+	_ fs.PutStreamer      = (*Fs)(nil)
+	_ fs.CleanUpper       = (*Fs)(nil)
+	_ fs.UnWrapper        = (*Fs)(nil)
+	_ fs.ListRer          = (*Fs)(nil)
+	_ fs.Abouter          = (*Fs)(nil)
+	_ fs.Wrapper          = (*Fs)(nil)
+	_ fs.MergeDirser      = (*Fs)(nil)
+	_ fs.DirCacheFlusher  = (*Fs)(nil)
+	_ fs.ChangeNotifier   = (*Fs)(nil)
+	_ fs.PublicLinker     = (*Fs)(nil)
+	_ fs.Shutdowner       = (*Fs)(nil)
+	_ fs.DirSetModTimer   = (*Fs)(nil)
+	_ fs.DirMetadataer    = (*Fs)(nil)
+	_ fs.DirSetMetadataer = (*Fs)(nil)
+	_ fs.FullObjectInfo   = (*ObjectInfo)(nil)
+	_ fs.FullObject       = (*Object)(nil)
 )
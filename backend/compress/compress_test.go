@@ -21,6 +21,8 @@ func TestIntegration(t *testing.T) {
 		NilObject:  (*Object)(nil),
 		UnimplementableFsMethods: []string{
 			"OpenWriterAt",
+			"HardLink",
+			"Shortcut",
 			"MergeDirs",
 			"DirCacheFlush",
 			"PutUnchecked",
@@ -45,6 +47,8 @@ func TestRemoteGzip(t *testing.T) {
 		NilObject:  (*Object)(nil),
 		UnimplementableFsMethods: []string{
 			"OpenWriterAt",
+			"HardLink",
+			"Shortcut",
 			"MergeDirs",
 			"DirCacheFlush",
 			"PutUnchecked",
@@ -64,3 +68,39 @@ func TestRemoteGzip(t *testing.T) {
 		QuickTestOK: true,
 	})
 }
+
+// TestRemoteZstd tests zstd compression
+func TestRemoteZstd(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempdir := filepath.Join(os.TempDir(), "rclone-compress-test-zstd")
+	name := "TestCompressZstd"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*Object)(nil),
+		UnimplementableFsMethods: []string{
+			"OpenWriterAt",
+			"HardLink",
+			"Shortcut",
+			"MergeDirs",
+			"DirCacheFlush",
+			"PutUnchecked",
+			"PutStream",
+			"UserInfo",
+			"Disconnect",
+		},
+		UnimplementableObjectMethods: []string{
+			"GetTier",
+			"SetTier",
+		},
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "compress"},
+			{Name: name, Key: "remote", Value: tempdir},
+			{Name: name, Key: "mode", Value: "zstd"},
+			// the test data is random so force it to be compressed
+			{Name: name, Key: "compress_extensions", Value: "txt"},
+		},
+		QuickTestOK: true,
+	})
+}
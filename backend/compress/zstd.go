@@ -0,0 +1,321 @@
+// Seekable zstd compression
+
+package compress
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/chunkedreader"
+)
+
+// The data is compressed in the zstd seekable format described in
+// https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md
+//
+// The file is split into independently compressed frames followed by
+// a skippable frame with a seek table giving the compressed and
+// decompressed size of each frame. Standard zstd decoders skip the
+// seek table so the files can be decompressed with any zstd tool.
+const (
+	zstdFrameSize            = 1024 * 1024 // size of the uncompressed data in each frame
+	zstdSkippableMagic       = 0x184D2A5E  // magic number of the skippable frame with the seek table
+	zstdSeekableMagic        = 0x8F92EAB1  // magic number at the end of the seek table
+	zstdSkippableHeaderSize  = 8           // size of the skippable frame header
+	zstdSeekTableFooterSize  = 9           // size of the seek table footer
+	zstdSeekTableChecksumBit = 1 << 7      // set in the descriptor if the entries have checksums
+	zstdMaxFrames            = 1 << 27     // maximum number of frames we will read a seek table for
+)
+
+// zstdFrame describes one frame in the seek table
+type zstdFrame struct {
+	compressedSize   uint32
+	decompressedSize uint32
+}
+
+// zstdEncoderLevel converts the level option into a zstd encoder level
+func zstdEncoderLevel(level int) zstd.EncoderLevel {
+	if level <= 0 {
+		return zstd.SpeedDefault
+	}
+	return zstd.EncoderLevelFromZstd(level)
+}
+
+// zstdWriter compresses data written to it in the zstd seekable format
+type zstdWriter struct {
+	out    io.Writer
+	enc    *zstd.Encoder
+	buf    []byte      // uncompressed data for the current frame
+	frame  []byte      // compressed data for the current frame
+	frames []zstdFrame // frames written so far
+	size   int64       // total uncompressed size written
+}
+
+// newZstdWriter makes a zstdWriter writing to out at level
+func newZstdWriter(out io.Writer, level int) (*zstdWriter, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstdEncoderLevel(level)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdWriter{
+		out: out,
+		enc: enc,
+		buf: make([]byte, 0, zstdFrameSize),
+	}, nil
+}
+
+// flush compresses and writes the current frame if it has any data
+func (w *zstdWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	w.frame = w.enc.EncodeAll(w.buf, w.frame[:0])
+	_, err := w.out.Write(w.frame)
+	if err != nil {
+		return err
+	}
+	w.frames = append(w.frames, zstdFrame{
+		compressedSize:   uint32(len(w.frame)),
+		decompressedSize: uint32(len(w.buf)),
+	})
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Write compresses p
+func (w *zstdWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := zstdFrameSize - len(w.buf)
+		if chunk > len(p) {
+			chunk = len(p)
+		}
+		w.buf = append(w.buf, p[:chunk]...)
+		p = p[chunk:]
+		n += chunk
+		w.size += int64(chunk)
+		if len(w.buf) >= zstdFrameSize {
+			err = w.flush()
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the last frame and the seek table
+func (w *zstdWriter) Close() error {
+	err := w.flush()
+	if err != nil {
+		return err
+	}
+	_ = w.enc.Close()
+	tableSize := 8*len(w.frames) + zstdSeekTableFooterSize
+	table := make([]byte, 0, zstdSkippableHeaderSize+tableSize)
+	table = appendUint32(table, zstdSkippableMagic)
+	table = appendUint32(table, uint32(tableSize))
+	for _, frame := range w.frames {
+		table = appendUint32(table, frame.compressedSize)
+		table = appendUint32(table, frame.decompressedSize)
+	}
+	table = appendUint32(table, uint32(len(w.frames)))
+	table = append(table, 0) // descriptor - no checksums
+	table = appendUint32(table, zstdSeekableMagic)
+	_, err = w.out.Write(table)
+	return err
+}
+
+// appendUint32 appends v to b in little endian order
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// readRangeFn reads length bytes at offset from the compressed data
+type readRangeFn func(offset, length int64) ([]byte, error)
+
+// readZstdSeekTable reads the seek table from the end of compressed
+// data of size bytes
+func readZstdSeekTable(readRange readRangeFn, size int64) (frames []zstdFrame, err error) {
+	if size < zstdSkippableHeaderSize+zstdSeekTableFooterSize {
+		return nil, errors.New("zstd: file too short for seek table")
+	}
+	footer, err := readRange(size-zstdSeekTableFooterSize, zstdSeekTableFooterSize)
+	if err != nil {
+		return nil, fmt.Errorf("zstd: failed to read seek table footer: %w", err)
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != zstdSeekableMagic {
+		return nil, errors.New("zstd: seek table not found")
+	}
+	n := int64(binary.LittleEndian.Uint32(footer))
+	entrySize := int64(8)
+	if footer[4]&zstdSeekTableChecksumBit != 0 {
+		entrySize = 12
+	}
+	tableSize := n*entrySize + zstdSeekTableFooterSize
+	if n > zstdMaxFrames || zstdSkippableHeaderSize+tableSize > size {
+		return nil, errors.New("zstd: seek table is corrupted")
+	}
+	table, err := readRange(size-zstdSkippableHeaderSize-tableSize, zstdSkippableHeaderSize+tableSize)
+	if err != nil {
+		return nil, fmt.Errorf("zstd: failed to read seek table: %w", err)
+	}
+	if binary.LittleEndian.Uint32(table) != zstdSkippableMagic || int64(binary.LittleEndian.Uint32(table[4:])) != tableSize {
+		return nil, errors.New("zstd: seek table header is corrupted")
+	}
+	table = table[zstdSkippableHeaderSize:]
+	frames = make([]zstdFrame, n)
+	for i := range frames {
+		entry := table[int64(i)*entrySize:]
+		frames[i] = zstdFrame{
+			compressedSize:   binary.LittleEndian.Uint32(entry),
+			decompressedSize: binary.LittleEndian.Uint32(entry[4:]),
+		}
+	}
+	return frames, nil
+}
+
+// zstdFrameReader decompresses frames one at a time from a reader
+// positioned at the start of a frame
+type zstdFrameReader struct {
+	in      io.ReadCloser
+	dec     *zstd.Decoder
+	frames  []zstdFrame // the frames still to read
+	frame   []byte      // compressed data of the current frame
+	decoded []byte      // decompressed data of the current frame
+	buf     []byte      // decompressed data still to return
+	skip    int64       // bytes to discard from the start of the first frame
+}
+
+// zstdSeek finds the frame containing offset, returning the frames
+// from that one on, the offset of that frame in the compressed data
+// and how far into its decompressed data offset is.
+func zstdSeek(frames []zstdFrame, offset int64) (rest []zstdFrame, compressedOffset int64, skip int64) {
+	for i, frame := range frames {
+		if offset < int64(frame.decompressedSize) {
+			return frames[i:], compressedOffset, offset
+		}
+		offset -= int64(frame.decompressedSize)
+		compressedOffset += int64(frame.compressedSize)
+	}
+	return nil, compressedOffset, 0
+}
+
+// newZstdFrameReader reads frames from in which is positioned at the
+// start of the first of them, discarding skip bytes of decompressed
+// data.
+func newZstdFrameReader(in io.ReadCloser, frames []zstdFrame, skip int64) (*zstdFrameReader, error) {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdFrameReader{
+		in:     in,
+		dec:    dec,
+		frames: frames,
+		skip:   skip,
+	}, nil
+}
+
+// Read decompressed data into p
+func (r *zstdFrameReader) Read(p []byte) (n int, err error) {
+	for len(r.buf) == 0 {
+		if len(r.frames) == 0 {
+			return 0, io.EOF
+		}
+		frame := r.frames[0]
+		r.frames = r.frames[1:]
+		if cap(r.frame) < int(frame.compressedSize) {
+			r.frame = make([]byte, frame.compressedSize)
+		}
+		r.frame = r.frame[:frame.compressedSize]
+		_, err = io.ReadFull(r.in, r.frame)
+		if err != nil {
+			return 0, fmt.Errorf("zstd: failed to read frame: %w", err)
+		}
+		r.decoded, err = r.dec.DecodeAll(r.frame, r.decoded[:0])
+		if err != nil {
+			return 0, fmt.Errorf("zstd: failed to decompress frame: %w", err)
+		}
+		r.buf = r.decoded
+		if len(r.buf) != int(frame.decompressedSize) {
+			return 0, errors.New("zstd: frame size doesn't match seek table")
+		}
+		if r.skip > 0 {
+			r.buf = r.buf[r.skip:]
+			r.skip = 0
+		}
+	}
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close the decoder and the input
+func (r *zstdFrameReader) Close() error {
+	r.dec.Close()
+	return r.in.Close()
+}
+
+// zstdStreamReader decompresses a whole zstd stream
+type zstdStreamReader struct {
+	*zstd.Decoder
+	in io.ReadCloser
+}
+
+// newZstdStreamReader decompresses all of in
+func newZstdStreamReader(in io.ReadCloser) (*zstdStreamReader, error) {
+	dec, err := zstd.NewReader(in, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdStreamReader{Decoder: dec, in: in}, nil
+}
+
+// Close the decoder and the input
+func (r *zstdStreamReader) Close() error {
+	r.Decoder.Close()
+	return r.in.Close()
+}
+
+// openZstd returns a reader for the decompressed data from offset
+// reading the compressed data from in, which is closed when the
+// reader is closed.
+//
+// If offset isn't 0 the seek table is read to find the frame to start
+// from, so only the frames needed are read and decompressed.
+func (o *Object) openZstd(ctx context.Context, in *chunkedreader.ChunkedReader, offset int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		return newZstdStreamReader(in)
+	}
+	frames, err := readZstdSeekTable(objectReadRange(ctx, o.Object), o.Object.Size())
+	if err != nil {
+		return nil, err
+	}
+	frames, compressedOffset, skip := zstdSeek(frames, offset)
+	_, err = in.Seek(compressedOffset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return newZstdFrameReader(in, frames, skip)
+}
+
+// objectReadRange makes a readRangeFn for o
+func objectReadRange(ctx context.Context, o fs.Object) readRangeFn {
+	return func(offset, length int64) (buf []byte, err error) {
+		in, err := o.Open(ctx, &fs.RangeOption{Start: offset, End: offset + length - 1})
+		if err != nil {
+			return nil, err
+		}
+		defer fs.CheckClose(in, &err)
+		buf = make([]byte, length)
+		_, err = io.ReadFull(in, buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+}
@@ -0,0 +1,126 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeZstd compresses data in the seekable format
+func makeZstd(t *testing.T, data []byte) []byte {
+	var out bytes.Buffer
+	w, err := newZstdWriter(&out, -1)
+	require.NoError(t, err)
+	// write in odd sized pieces to cross the frame boundaries
+	for in := data; len(in) > 0; {
+		n := 100003
+		if n > len(in) {
+			n = len(in)
+		}
+		_, err = w.Write(in[:n])
+		require.NoError(t, err)
+		in = in[n:]
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, int64(len(data)), w.size)
+	return out.Bytes()
+}
+
+func TestZstdSeekable(t *testing.T) {
+	var data []byte
+	for i := 0; len(data) < 2*zstdFrameSize+12345; i++ {
+		data = append(data, fmt.Sprintf("line %d of some compressible text\n", i)...)
+	}
+	compressed := makeZstd(t, data)
+	assert.Less(t, len(compressed), len(data)/2)
+
+	// A standard decoder reads the whole file skipping the seek table
+	dec, err := zstd.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	got, err := io.ReadAll(dec)
+	dec.Close()
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// Read the seek table
+	readRange := func(offset, length int64) ([]byte, error) {
+		return compressed[offset : offset+length], nil
+	}
+	frames, err := readZstdSeekTable(readRange, int64(len(compressed)))
+	require.NoError(t, err)
+	require.Equal(t, 3, len(frames))
+	var total int64
+	for _, frame := range frames {
+		total += int64(frame.decompressedSize)
+	}
+	assert.Equal(t, int64(len(data)), total)
+
+	// Read from various offsets
+	for _, offset := range []int64{0, 1, zstdFrameSize - 1, zstdFrameSize, zstdFrameSize + 5, int64(len(data)) - 1, int64(len(data))} {
+		rest, compressedOffset, skip := zstdSeek(frames, offset)
+		r, err := newZstdFrameReader(io.NopCloser(bytes.NewReader(compressed[compressedOffset:])), rest, skip)
+		require.NoError(t, err)
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, data[offset:], got, fmt.Sprintf("offset %d", offset))
+	}
+
+	// Corrupt seek tables are detected
+	_, err = readZstdSeekTable(readRange, 10)
+	assert.Error(t, err)
+	_, err = readZstdSeekTable(readRange, int64(len(compressed)-1))
+	assert.Error(t, err)
+}
+
+func TestZstdEmpty(t *testing.T) {
+	compressed := makeZstd(t, nil)
+	readRange := func(offset, length int64) ([]byte, error) {
+		return compressed[offset : offset+length], nil
+	}
+	frames, err := readZstdSeekTable(readRange, int64(len(compressed)))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(frames))
+
+	r, err := newZstdStreamReader(io.NopCloser(bytes.NewReader(compressed)))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, 0, len(got))
+}
+
+func TestShouldCompress(t *testing.T) {
+	f := &Fs{opt: Options{
+		CompressExt:    fs.CommaSepList{"txt", ".LOG"},
+		NoCompressExt:  fs.CommaSepList{"jpg", "mp4"},
+		CompressMime:   fs.CommaSepList{"text/*"},
+		NoCompressMime: fs.CommaSepList{"video/*", "image/jpeg"},
+	}}
+	for _, test := range []struct {
+		remote   string
+		mimeType string
+		compress bool
+		ok       bool
+	}{
+		{"file.txt", "application/octet-stream", true, true},
+		{"dir/file.log", "application/octet-stream", true, true},
+		{"file.JPG", "text/plain", false, true},
+		{"file.mp4", "application/octet-stream", false, true},
+		{"file.dat", "video/webm", false, true},
+		{"file.txt", "image/jpeg", false, true},
+		{"file.dat", "text/plain; charset=utf-8", true, true},
+		{"file.dat", "application/octet-stream", false, false},
+		{"txt", "application/octet-stream", false, false},
+	} {
+		compress, ok := f.shouldCompress(test.remote, test.mimeType)
+		assert.Equal(t, test.compress, compress, test.remote)
+		assert.Equal(t, test.ok, ok, test.remote)
+	}
+}
@@ -0,0 +1,577 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/lib/env"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Constants for the age v1 file format
+const (
+	ageMagic          = "age-encryption.org/v1\n"
+	ageFooterPrefix   = "---"
+	ageStanzaPrefix   = "-> "
+	ageColumnsPerLine = 64
+	ageLastChunkFlag  = 0x01
+	ageNonceSize      = 16
+	ageTagSize        = 16
+	ageChunkSize      = 64 * 1024
+	ageEncChunkSize   = ageChunkSize + ageTagSize
+	ageMaxHeaderSize  = 64 * 1024
+)
+
+// Errors returned by the age cipher
+var (
+	ErrorAgeBadHeader     = errors.New("not an age encrypted file - bad header")
+	ErrorAgeFileTooShort  = errors.New("age encrypted file too short")
+	ErrorBadCipherFormat  = errors.New("cipher_format should be \"rclone\" or \"age\"")
+	ErrorAgeNoDataEncrypt = errors.New("no_data_encryption can't be used with cipher_format age")
+	ErrorAgeNoSizePadding = errors.New("size_padding can't be used with cipher_format age")
+)
+
+// ageCipher encrypts and decrypts file data in the age v1 format
+type ageCipher struct {
+	recipients []age.Recipient // encrypt to these
+	identities []age.Identity  // decrypt with these
+	headerSize int64           // size of the header written to recipients
+}
+
+// newAgeCipher makes an ageCipher which encrypts to the X25519
+// recipients given, or to password with scrypt if there are none, and
+// decrypts with the identities in identityFile, if set, and password.
+func newAgeCipher(password string, recipients []string, identityFile string) (*ageCipher, error) {
+	a := &ageCipher{}
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return nil, fmt.Errorf("bad age recipient %q: %w", recipient, err)
+		}
+		a.recipients = append(a.recipients, r)
+	}
+	if len(a.recipients) == 0 {
+		r, err := age.NewScryptRecipient(password)
+		if err != nil {
+			return nil, err
+		}
+		a.recipients = append(a.recipients, r)
+	}
+	if identityFile != "" {
+		in, err := os.Open(env.ShellExpand(identityFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open age identity file: %w", err)
+		}
+		identities, err := age.ParseIdentities(in)
+		_ = in.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read age identity file: %w", err)
+		}
+		a.identities = append(a.identities, identities...)
+	}
+	i, err := age.NewScryptIdentity(password)
+	if err != nil {
+		return nil, err
+	}
+	a.identities = append(a.identities, i)
+
+	// Find the size of the header by encrypting nothing, which
+	// leaves the header, the nonce and an empty final chunk.
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, a.recipients...)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	a.headerSize = int64(buf.Len()) - ageNonceSize - ageTagSize
+	return a, nil
+}
+
+// encryptedSize returns the size of size bytes of data when encrypted
+func (a *ageCipher) encryptedSize(size int64) int64 {
+	chunks := (size + ageChunkSize - 1) / ageChunkSize
+	if chunks == 0 {
+		// an empty file has an empty final chunk
+		chunks = 1
+	}
+	return a.headerSize + ageNonceSize + size + chunks*ageTagSize
+}
+
+// decryptedAgeSize returns the size of the data in an encrypted file of
+// size bytes with a header of headerSize bytes
+func decryptedAgeSize(size, headerSize int64) (int64, error) {
+	payload := size - headerSize - ageNonceSize
+	if payload < ageTagSize {
+		return 0, ErrorAgeFileTooShort
+	}
+	chunks := (payload + ageEncChunkSize - 1) / ageEncChunkSize
+	size = payload - chunks*ageTagSize
+	if chunks > 1 && payload-(chunks-1)*ageEncChunkSize <= ageTagSize {
+		// only the final chunk of an empty file may be empty
+		return 0, ErrorAgeFileTooShort
+	}
+	return size, nil
+}
+
+// readAgeHeaderSize reads the age header from in returning its size
+func readAgeHeaderSize(in io.Reader) (int64, error) {
+	r := bufio.NewReader(in)
+	var headerSize int64
+	for headerSize < ageMaxHeaderSize {
+		line, err := r.ReadString('\n')
+		if headerSize == 0 && line != ageMagic {
+			if err == io.EOF && strings.HasPrefix(ageMagic, line) {
+				return 0, ErrorAgeFileTooShort
+			}
+			return 0, ErrorAgeBadHeader
+		}
+		if err == io.EOF {
+			return 0, ErrorAgeFileTooShort
+		} else if err != nil {
+			return 0, err
+		}
+		headerSize += int64(len(line))
+		if strings.HasPrefix(line, ageFooterPrefix) {
+			return headerSize, nil
+		}
+	}
+	return 0, ErrorAgeBadHeader
+}
+
+// readSize reads the header of the encrypted object o to find the
+// size of the data in it
+func (a *ageCipher) readSize(ctx context.Context, o fs.Object) (size int64, err error) {
+	in, err := o.Open(ctx, &fs.RangeOption{Start: 0, End: ageMaxHeaderSize - 1})
+	if err != nil {
+		return 0, err
+	}
+	defer fs.CheckClose(in, &err)
+	headerSize, err := readAgeHeaderSize(in)
+	if err != nil {
+		return 0, err
+	}
+	return decryptedAgeSize(o.Size(), headerSize)
+}
+
+// ageEncrypter encrypts an io.Reader on the fly
+type ageEncrypter struct {
+	in      io.Reader
+	w       io.WriteCloser // encrypts into buf
+	buf     bytes.Buffer   // encrypted data not yet read
+	readBuf []byte         // buffer for reading from in
+	err     error          // error reading in
+}
+
+// encryptData encrypts the data stream
+func (a *ageCipher) encryptData(in io.Reader) (io.Reader, error) {
+	in, wrap := accounting.UnWrap(in) // unwrap the accounting off the Reader
+	fh := &ageEncrypter{
+		in:      in,
+		readBuf: make([]byte, ageChunkSize),
+	}
+	var err error
+	fh.w, err = age.Encrypt(&fh.buf, a.recipients...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(fh), nil
+}
+
+// Read as per io.Reader
+func (fh *ageEncrypter) Read(p []byte) (n int, err error) {
+	for fh.buf.Len() == 0 && fh.err == nil {
+		n, err = fh.in.Read(fh.readBuf)
+		if n > 0 {
+			_, writeErr := fh.w.Write(fh.readBuf[:n])
+			if writeErr != nil {
+				fh.err = writeErr
+				break
+			}
+		}
+		if err == io.EOF {
+			fh.err = fh.w.Close()
+			if fh.err == nil {
+				fh.err = io.EOF
+			}
+		} else if err != nil {
+			fh.err = err
+		}
+	}
+	if fh.buf.Len() > 0 {
+		return fh.buf.Read(p)
+	}
+	return 0, fh.err
+}
+
+// decrypt returns a stream decrypting rc
+func (a *ageCipher) decrypt(rc io.ReadCloser) (io.ReadCloser, error) {
+	r, err := age.Decrypt(rc, a.identities...)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, rc}, nil
+}
+
+// ageHeader is the parsed header of an age file
+type ageHeader struct {
+	stanzas []*age.Stanza // recipient stanzas
+	raw     []byte        // the header up to and including the "---" covered by the MAC
+	mac     []byte        // the header MAC
+	size    int64         // size of the header including the MAC line
+}
+
+// readAgeHeader reads and parses the age header from r
+func readAgeHeader(r *bufio.Reader) (h *ageHeader, err error) {
+	h = &ageHeader{}
+	var raw bytes.Buffer
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return "", ErrorAgeFileTooShort
+		} else if err != nil {
+			return "", err
+		}
+		h.size += int64(len(line))
+		if h.size > ageMaxHeaderSize {
+			return "", ErrorAgeBadHeader
+		}
+		return line, nil
+	}
+	line, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line != ageMagic {
+		return nil, ErrorAgeBadHeader
+	}
+	raw.WriteString(line)
+	for {
+		line, err = readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, ageFooterPrefix+" ") {
+			raw.WriteString(ageFooterPrefix)
+			h.raw = raw.Bytes()
+			h.mac, err = base64.RawStdEncoding.Strict().DecodeString(strings.TrimSuffix(line[len(ageFooterPrefix)+1:], "\n"))
+			if err != nil {
+				return nil, ErrorAgeBadHeader
+			}
+			return h, nil
+		}
+		if !strings.HasPrefix(line, ageStanzaPrefix) {
+			return nil, ErrorAgeBadHeader
+		}
+		raw.WriteString(line)
+		args := strings.Split(strings.TrimSuffix(line[len(ageStanzaPrefix):], "\n"), " ")
+		stanza := &age.Stanza{Type: args[0], Args: args[1:]}
+		// The body is wrapped base64 ending with a short line
+		for {
+			line, err = readLine()
+			if err != nil {
+				return nil, err
+			}
+			raw.WriteString(line)
+			line = strings.TrimSuffix(line, "\n")
+			body, err := base64.RawStdEncoding.Strict().DecodeString(line)
+			if err != nil {
+				return nil, ErrorAgeBadHeader
+			}
+			stanza.Body = append(stanza.Body, body...)
+			if len(line) < ageColumnsPerLine {
+				break
+			}
+		}
+		h.stanzas = append(h.stanzas, stanza)
+	}
+}
+
+// payloadKey finds the file key for the header h with the
+// identities, checks the header MAC and returns the key for the
+// payload with nonce.
+func (a *ageCipher) payloadKey(h *ageHeader, nonce []byte) ([]byte, error) {
+	var fileKey []byte
+	for _, identity := range a.identities {
+		var err error
+		fileKey, err = identity.Unwrap(h.stanzas)
+		if errors.Is(err, age.ErrIncorrectIdentity) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if fileKey == nil {
+		return nil, &age.NoIdentityMatchError{}
+	}
+	macKey := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, fileKey, nil, []byte("header")), macKey)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	_, _ = mac.Write(h.raw)
+	if !hmac.Equal(mac.Sum(nil), h.mac) {
+		return nil, errors.New("bad age header MAC")
+	}
+	key := make([]byte, chacha20poly1305.KeySize)
+	_, err = io.ReadFull(hkdf.New(sha256.New, fileKey, nonce, []byte("payload")), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ageDecrypter decrypts an age file on the fly
+//
+// It decrypts each chunk of the payload itself so that it can seek by
+// opening the file at the start of the chunk holding the offset.
+type ageDecrypter struct {
+	mu            sync.Mutex
+	open          OpenRangeSeek
+	aead          cipher.AEAD
+	payloadOffset int64         // offset of the first chunk in the file
+	in            io.ReadCloser // encrypted data from the start of chunk
+	chunk         uint64        // index of the next chunk to read from in
+	last          bool          // set if the last chunk has been read
+	readBuf       [ageEncChunkSize]byte
+	plainBuf      [ageChunkSize]byte
+	buf           []byte // decrypted data not yet returned
+	limit         int64  // bytes left to return or -1 for unlimited
+	err           error  // sticky error
+	closed        bool
+}
+
+// newDecrypterSeek creates a new file handle decrypting on the fly
+// from offset for limit bytes
+func (a *ageCipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offset, limit int64) (fh *ageDecrypter, err error) {
+	// Open the whole file if reading from the start, otherwise
+	// just enough to read the header then seek
+	headerLimit := int64(-1)
+	if offset != 0 {
+		headerLimit = ageMaxHeaderSize + ageNonceSize
+	}
+	rc, err := open(ctx, 0, headerLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = rc.Close()
+		}
+	}()
+	r := bufio.NewReader(rc)
+	h, err := readAgeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, ageNonceSize)
+	_, err = io.ReadFull(r, nonce)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrorAgeFileTooShort
+	} else if err != nil {
+		return nil, err
+	}
+	key, err := a.payloadKey(h, nonce)
+	if err != nil {
+		return nil, err
+	}
+	fh = &ageDecrypter{
+		open:          open,
+		payloadOffset: h.size + ageNonceSize,
+		limit:         limit,
+	}
+	fh.aead, err = chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if offset == 0 {
+		// carry on reading the opened file
+		fh.in = struct {
+			io.Reader
+			io.Closer
+		}{r, rc}
+		return fh, nil
+	}
+	_ = rc.Close()
+	_, err = fh.RangeSeek(ctx, offset, io.SeekStart, limit)
+	if err != nil {
+		return nil, err
+	}
+	return fh, nil
+}
+
+// readChunk reads and decrypts the next chunk into fh.buf
+func (fh *ageDecrypter) readChunk() error {
+	n, err := io.ReadFull(fh.in, fh.readBuf[:])
+	if err == io.EOF {
+		// the previous chunk should have been the last
+		return io.ErrUnexpectedEOF
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if n < ageTagSize {
+		return ErrorAgeFileTooShort
+	}
+	// A short chunk must be the last one. A full one is only the
+	// last one if it doesn't decrypt as any other. This decrypts
+	// into plainBuf as a failed Open clears its output.
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.BigEndian.PutUint64(nonce[3:11], fh.chunk)
+	last := n < ageEncChunkSize
+	if last {
+		nonce[len(nonce)-1] = ageLastChunkFlag
+	}
+	fh.buf, err = fh.aead.Open(fh.plainBuf[:0], nonce[:], fh.readBuf[:n], nil)
+	if err != nil && !last {
+		last = true
+		nonce[len(nonce)-1] = ageLastChunkFlag
+		fh.buf, err = fh.aead.Open(fh.plainBuf[:0], nonce[:], fh.readBuf[:n], nil)
+	}
+	if err != nil {
+		return ErrorEncryptedBadBlock
+	}
+	fh.chunk++
+	fh.last = last
+	return nil
+}
+
+// Read as per io.Reader
+func (fh *ageDecrypter) Read(p []byte) (n int, err error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.closed {
+		return 0, ErrorFileClosed
+	}
+	if fh.err != nil {
+		return 0, fh.err
+	}
+	if fh.limit == 0 {
+		return 0, io.EOF
+	}
+	if len(fh.buf) == 0 {
+		if fh.last {
+			return 0, io.EOF
+		}
+		err = fh.readChunk()
+		if err != nil {
+			fh.err = err
+			return 0, err
+		}
+	}
+	if fh.limit >= 0 && int64(len(p)) > fh.limit {
+		p = p[:fh.limit]
+	}
+	n = copy(p, fh.buf)
+	fh.buf = fh.buf[n:]
+	if fh.limit >= 0 {
+		fh.limit -= int64(n)
+	}
+	return n, nil
+}
+
+// RangeSeek behaves like a call to Seek(offset int64, whence
+// int) with the output wrapped in an io.LimitedReader
+// limiting the total length to limit.
+//
+// RangeSeek with a limit of < 0 is equivalent to a regular Seek.
+func (fh *ageDecrypter) RangeSeek(ctx context.Context, offset int64, whence int, limit int64) (int64, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.closed {
+		return 0, ErrorFileClosed
+	}
+	if whence != io.SeekStart {
+		return 0, errors.New("can only seek from the start")
+	}
+	if offset < 0 {
+		return 0, ErrorBadSeek
+	}
+	if fh.in != nil {
+		_ = fh.in.Close()
+		fh.in = nil
+	}
+	fh.buf, fh.err, fh.last, fh.limit = nil, nil, false, limit
+	// Open the file from the start of the chunk with offset in.
+	// At a chunk boundary start from the chunk before so reading
+	// it says whether it was the last.
+	chunk := offset / ageChunkSize
+	if offset > 0 && offset%ageChunkSize == 0 {
+		chunk--
+	}
+	underlyingLimit := int64(-1)
+	if limit >= 0 {
+		lastChunk := (offset + limit + ageChunkSize - 1) / ageChunkSize
+		underlyingLimit = (lastChunk - chunk + 1) * ageEncChunkSize
+	}
+	in, err := fh.open(ctx, fh.payloadOffset+chunk*ageEncChunkSize, underlyingLimit)
+	if err != nil {
+		fh.err = err
+		return 0, err
+	}
+	fh.in = in
+	fh.chunk = uint64(chunk)
+	// Discard the data in the chunk before offset
+	if discard := offset - chunk*ageChunkSize; discard > 0 {
+		err = fh.readChunk()
+		if err != nil {
+			fh.err = err
+			return 0, err
+		}
+		if discard > int64(len(fh.buf)) {
+			discard = int64(len(fh.buf))
+		}
+		fh.buf = fh.buf[discard:]
+	}
+	return offset, nil
+}
+
+// Seek implements the io.Seeker interface
+func (fh *ageDecrypter) Seek(offset int64, whence int) (int64, error) {
+	return fh.RangeSeek(context.TODO(), offset, whence, -1)
+}
+
+// Close as per io.Closer
+func (fh *ageDecrypter) Close() error {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.closed {
+		return ErrorFileClosed
+	}
+	fh.closed = true
+	if fh.in == nil {
+		return nil
+	}
+	err := fh.in.Close()
+	fh.in = nil
+	return err
+}
+
+// check interfaces
+var (
+	_ ReadSeekCloser = (*ageDecrypter)(nil)
+	_ io.Reader      = (*ageEncrypter)(nil)
+)
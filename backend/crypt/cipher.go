@@ -8,6 +8,7 @@ import (
 	"crypto/rand"
 	"encoding/base32"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -30,14 +31,18 @@ import (
 
 // Constants
 const (
-	nameCipherBlockSize = aes.BlockSize
-	fileMagic           = "RCLONE\x00\x00"
-	fileMagicSize       = len(fileMagic)
-	fileNonceSize       = 24
-	fileHeaderSize      = fileMagicSize + fileNonceSize
-	blockHeaderSize     = secretbox.Overhead
-	blockDataSize       = 64 * 1024
-	blockSize           = blockHeaderSize + blockDataSize
+	nameCipherBlockSize  = aes.BlockSize
+	fileMagic            = "RCLONE\x00\x00"
+	fileMagicPadded      = "RCLONE\x00\x02"
+	fileMagicSize        = len(fileMagic)
+	fileNonceSize        = 24
+	fileHeaderSize       = fileMagicSize + fileNonceSize
+	fileSizeDataSize     = 8
+	fileSizeHeaderSize   = secretbox.Overhead + fileSizeDataSize
+	filePaddedHeaderSize = fileHeaderSize + fileSizeHeaderSize
+	blockHeaderSize      = secretbox.Overhead
+	blockDataSize        = 64 * 1024
+	blockSize            = blockHeaderSize + blockDataSize
 )
 
 // Errors returned by cipher
@@ -56,13 +61,18 @@ var (
 	ErrorNotAnEncryptedFile      = errors.New("not an encrypted file - does not match suffix")
 	ErrorBadSeek                 = errors.New("Seek beyond end of file")
 	ErrorSuffixMissingDot        = errors.New("suffix config setting should include a '.'")
+	ErrorEncryptedBadSizeHeader  = errors.New("failed to authenticate decrypted size header - bad password?")
+	ErrorPaddingSizeMismatch     = errors.New("data read doesn't match the size given for padding")
+	ErrorBadSizePadding          = errors.New("size_padding should be \"off\", \"pow2\" or a size")
+	ErrorFlattenOldPasswords     = errors.New("can't use old_passwords with flatten_directories")
 	defaultSalt                  = []byte{0xA8, 0x0D, 0xF4, 0x3A, 0x8F, 0xBD, 0x03, 0x08, 0xA7, 0xCA, 0xB8, 0x3E, 0x58, 0x1F, 0x86, 0xB1}
 	obfuscQuoteRune              = '!'
 )
 
 // Global variables
 var (
-	fileMagicBytes = []byte(fileMagic)
+	fileMagicBytes       = []byte(fileMagic)
+	fileMagicPaddedBytes = []byte(fileMagicPadded)
 )
 
 // ReadSeekCloser is the interface of the read handles
@@ -181,6 +191,10 @@ type Cipher struct {
 	dirNameEncrypt  bool
 	passBadBlocks   bool // if set passed bad blocks as zeroed blocks
 	encryptedSuffix string
+	padPow2         bool       // if set pad file data to a power of 2
+	padGranularity  int64      // if > 0 pad file data to a multiple of this
+	oldCiphers      []*Cipher  // ciphers made from old keys, tried in order when decrypting
+	age             *ageCipher // if set file data is in the age format
 }
 
 // newCipher initialises the cipher.  If salt is "" then it uses a built in salt val
@@ -220,6 +234,100 @@ func (c *Cipher) setPassBadBlocks(passBadBlocks bool) {
 	c.passBadBlocks = passBadBlocks
 }
 
+// addOldKey adds an old password and salt which are tried in order
+// after the current key when decrypting file data.
+//
+// New data is always encrypted with the current key.
+func (c *Cipher) addOldKey(password, salt string) error {
+	oc, err := newCipher(c.mode, password, salt, c.dirNameEncrypt, c.fileNameEnc)
+	if err != nil {
+		return err
+	}
+	oc.encryptedSuffix = c.encryptedSuffix
+	oc.passBadBlocks = c.passBadBlocks
+	oc.padPow2 = c.padPow2
+	oc.padGranularity = c.padGranularity
+	c.oldCiphers = append(c.oldCiphers, oc)
+	return nil
+}
+
+// dataKeys returns the data keys to try when decrypting, the current
+// key first followed by the old keys in order
+func (c *Cipher) dataKeys() []*[32]byte {
+	keys := make([]*[32]byte, 0, 1+len(c.oldCiphers))
+	keys = append(keys, &c.dataKey)
+	for _, oc := range c.oldCiphers {
+		keys = append(keys, &oc.dataKey)
+	}
+	return keys
+}
+
+// keyCipher returns the cipher for the key with index i as returned
+// by dataKeys
+func (c *Cipher) keyCipher(i int) *Cipher {
+	if i == 0 {
+		return c
+	}
+	return c.oldCiphers[i-1]
+}
+
+// setSizePadding sets the size padding from the size_padding config
+// which may be "off", "pow2" or a size to round up to a multiple of
+func (c *Cipher) setSizePadding(padding string) error {
+	c.padPow2 = false
+	c.padGranularity = 0
+	switch strings.ToLower(padding) {
+	case "", "off":
+		return nil
+	case "pow2":
+		c.padPow2 = true
+		return nil
+	}
+	var granularity fs.SizeSuffix
+	err := granularity.Set(padding)
+	if err != nil || granularity <= 0 {
+		return ErrorBadSizePadding
+	}
+	c.padGranularity = int64(granularity)
+	return nil
+}
+
+// padding returns true if file data should be padded
+func (c *Cipher) padding() bool {
+	return c.padPow2 || c.padGranularity > 0
+}
+
+// paddedSize returns the size data of size bytes is padded to
+//
+// Empty files are padded like 1 byte files so they can't be told apart.
+func (c *Cipher) paddedSize(size int64) int64 {
+	if size < 1 {
+		size = 1
+	}
+	if c.padPow2 {
+		padded := int64(1)
+		for padded < size {
+			padded <<= 1
+		}
+		return padded
+	}
+	if c.padGranularity > 0 {
+		return (size + c.padGranularity - 1) / c.padGranularity * c.padGranularity
+	}
+	return size
+}
+
+// paddedSizeFor returns the size to pad new data of size bytes to or
+// -1 if it shouldn't be padded
+//
+// Data of unknown size can't be padded as the size is written first.
+func (c *Cipher) paddedSizeFor(size int64) int64 {
+	if !c.padding() || size < 0 {
+		return -1
+	}
+	return c.paddedSize(size)
+}
+
 // Key creates all the internal keys from the password passed in using
 // scrypt.
 //
@@ -585,7 +693,41 @@ func (c *Cipher) decryptFileName(in string) (string, error) {
 }
 
 // DecryptFileName decrypts a file path
+//
+// If it can't be decrypted with the current key then the old keys
+// are tried in order.
 func (c *Cipher) DecryptFileName(in string) (string, error) {
+	out, _, err := c.decryptFileNameKey(in)
+	return out, err
+}
+
+// oldNames returns true if names may be encrypted with old keys.
+//
+// Old keys are only used for names with standard name encryption as
+// the other modes can't tell whether a name was decrypted with the
+// right key.
+func (c *Cipher) oldNames() bool {
+	return len(c.oldCiphers) != 0 && c.mode == NameEncryptionStandard
+}
+
+// decryptFileNameKey decrypts a file path with the current key or
+// the old keys, returning the index of the key which decrypted it as
+// used by keyCipher.
+func (c *Cipher) decryptFileNameKey(in string) (out string, keyIndex int, err error) {
+	out, err = c.decryptFileNameCurrent(in)
+	if err == nil || !c.oldNames() {
+		return out, 0, err
+	}
+	for i, oc := range c.oldCiphers {
+		if oldOut, oldErr := oc.decryptFileNameCurrent(in); oldErr == nil {
+			return oldOut, i + 1, nil
+		}
+	}
+	return "", -1, err
+}
+
+// decryptFileNameCurrent decrypts a file path with the current key
+func (c *Cipher) decryptFileNameCurrent(in string) (string, error) {
 	if c.mode == NameEncryptionOff {
 		remainingLength := len(in) - len(c.encryptedSuffix)
 		if remainingLength == 0 || !strings.HasSuffix(in, c.encryptedSuffix) {
@@ -605,11 +747,57 @@ func (c *Cipher) DecryptFileName(in string) (string, error) {
 }
 
 // DecryptDirName decrypts a directory path
+//
+// If it can't be decrypted with the current key then the old keys
+// are tried in order.
 func (c *Cipher) DecryptDirName(in string) (string, error) {
 	if c.mode == NameEncryptionOff || !c.dirNameEncrypt {
 		return in, nil
 	}
-	return c.decryptFileName(in)
+	out, err := c.decryptFileName(in)
+	if err == nil || !c.oldNames() {
+		return out, err
+	}
+	for _, oc := range c.oldCiphers {
+		if oldOut, oldErr := oc.decryptFileName(in); oldErr == nil {
+			return oldOut, nil
+		}
+	}
+	return "", err
+}
+
+// encryptedFileNames returns the encryptions of the file path in
+// with the current key followed by any different ones with the old
+// keys
+func (c *Cipher) encryptedFileNames(in string) []string {
+	return c.encryptedNames(in, (*Cipher).EncryptFileName)
+}
+
+// encryptedDirNames returns the encryptions of the directory path in
+// with the current key followed by any different ones with the old
+// keys
+func (c *Cipher) encryptedDirNames(in string) []string {
+	return c.encryptedNames(in, (*Cipher).EncryptDirName)
+}
+
+// encryptedNames returns the distinct encryptions of in with encrypt
+// using the current key and then the old keys
+func (c *Cipher) encryptedNames(in string, encrypt func(*Cipher, string) string) []string {
+	names := []string{encrypt(c, in)}
+	if !c.oldNames() {
+		return names
+	}
+	for _, oc := range c.oldCiphers {
+		name := encrypt(oc, in)
+		found := false
+		for _, existing := range names {
+			found = found || existing == name
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 // NameEncryptionMode returns the encryption mode in use for names
@@ -677,6 +865,17 @@ func (n *nonce) add(x uint64) {
 	}
 }
 
+// sizeNonce returns the nonce used to seal the size header of a
+// padded file.
+//
+// This has the top bit flipped so it can't collide with the nonces of
+// the data blocks which count up from n.
+func (n *nonce) sizeNonce() (out nonce) {
+	out = *n
+	out[fileNonceSize-1] ^= 0x80
+	return out
+}
+
 // encrypter encrypts an io.Reader on the fly
 type encrypter struct {
 	mu       sync.Mutex
@@ -692,6 +891,15 @@ type encrypter struct {
 
 // newEncrypter creates a new file handle encrypting on the fly
 func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
+	return c.newPaddedEncrypter(in, nonce, -1, -1)
+}
+
+// newPaddedEncrypter creates a new file handle encrypting on the fly
+//
+// If paddedSize >= 0 then the data, which must be exactly size bytes
+// long, is padded with zeros to paddedSize and size is stored in an
+// encrypted header. Otherwise the data is encrypted without padding.
+func (c *Cipher) newPaddedEncrypter(in io.Reader, nonce *nonce, size, paddedSize int64) (*encrypter, error) {
 	fh := &encrypter{
 		in:      in,
 		c:       c,
@@ -708,13 +916,66 @@ func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
 			return nil, err
 		}
 	}
-	// Copy magic into buffer
-	copy((*fh.buf)[:], fileMagicBytes)
-	// Copy nonce into buffer
+	if paddedSize < 0 {
+		// Copy magic into buffer
+		copy((*fh.buf)[:], fileMagicBytes)
+		// Copy nonce into buffer
+		copy((*fh.buf)[fileMagicSize:], fh.nonce[:])
+		return fh, nil
+	}
+	fh.in = &padder{in: in, size: size, padding: paddedSize - size}
+	fh.bufSize = filePaddedHeaderSize
+	copy((*fh.buf)[:], fileMagicPaddedBytes)
 	copy((*fh.buf)[fileMagicSize:], fh.nonce[:])
+	// Seal the size into the buffer after the nonce
+	var sizeBuf [fileSizeDataSize]byte
+	binary.LittleEndian.PutUint64(sizeBuf[:], uint64(size))
+	sizeNonce := fh.nonce.sizeNonce()
+	secretbox.Seal((*fh.buf)[:fileHeaderSize], sizeBuf[:], sizeNonce.pointer(), &c.dataKey)
 	return fh, nil
 }
 
+// padder checks the data read from in is size bytes long then
+// returns padding zero bytes
+type padder struct {
+	in      io.Reader
+	size    int64 // expected size of in
+	read    int64 // bytes read from in so far
+	padding int64 // zero bytes still to return
+}
+
+// Read as per io.Reader
+func (p *padder) Read(buf []byte) (n int, err error) {
+	if p.in != nil {
+		n, err = p.in.Read(buf)
+		p.read += int64(n)
+		if p.read > p.size {
+			return n, fmt.Errorf("%w: expecting %d bytes but read more", ErrorPaddingSizeMismatch, p.size)
+		}
+		if err != io.EOF {
+			return n, err
+		}
+		if p.read != p.size {
+			return n, fmt.Errorf("%w: expecting %d bytes but read %d", ErrorPaddingSizeMismatch, p.size, p.read)
+		}
+		p.in = nil
+		if n > 0 {
+			return n, nil
+		}
+	}
+	if p.padding <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > p.padding {
+		buf = buf[:p.padding]
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+	p.padding -= int64(len(buf))
+	return len(buf), nil
+}
+
 // Read as per io.Reader
 func (fh *encrypter) Read(p []byte) (n int, err error) {
 	fh.mu.Lock()
@@ -757,19 +1018,26 @@ func (fh *encrypter) finish(err error) (int, error) {
 	return 0, err
 }
 
-// Encrypt data encrypts the data stream
-func (c *Cipher) encryptData(in io.Reader) (io.Reader, *encrypter, error) {
+// Encrypt data encrypts the data stream returning it and the nonce
+// used, which is zero for the age format
+//
+// If size padding is configured and size >= 0 the data is padded.
+func (c *Cipher) encryptData(in io.Reader, size int64) (io.Reader, nonce, error) {
+	if c.age != nil {
+		out, err := c.age.encryptData(in)
+		return out, nonce{}, err
+	}
 	in, wrap := accounting.UnWrap(in) // unwrap the accounting off the Reader
-	out, err := c.newEncrypter(in, nil)
+	out, err := c.newPaddedEncrypter(in, nil, size, c.paddedSizeFor(size))
 	if err != nil {
-		return nil, nil, err
+		return nil, nonce{}, err
 	}
-	return wrap(out), out, nil // and wrap the accounting back on
+	return wrap(out), out.nonce, nil // and wrap the accounting back on
 }
 
 // EncryptData encrypts the data stream
 func (c *Cipher) EncryptData(in io.Reader) (io.Reader, error) {
-	out, _, err := c.encryptData(in)
+	out, _, err := c.encryptData(in, -1)
 	return out, err
 }
 
@@ -787,16 +1055,22 @@ type decrypter struct {
 	err          error
 	limit        int64 // limit of bytes to read, -1 for unlimited
 	open         OpenRangeSeek
+	headerSize   int   // size of the file header
+	size         int64 // size of the data from the header of a padded file or -1
+	keyIndex     int   // index of the data key in use in c.dataKeys() or -1 if not found yet
 }
 
 // newDecrypter creates a new file handle decrypting on the fly
 func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 	fh := &decrypter{
-		rc:      rc,
-		c:       c,
-		buf:     c.getBlock(),
-		readBuf: c.getBlock(),
-		limit:   -1,
+		rc:         rc,
+		c:          c,
+		buf:        c.getBlock(),
+		readBuf:    c.getBlock(),
+		limit:      -1,
+		headerSize: fileHeaderSize,
+		size:       -1,
+		keyIndex:   -1,
 	}
 	// Read file header (magic + nonce)
 	readBuf := (*fh.readBuf)[:fileHeaderSize]
@@ -808,15 +1082,80 @@ func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 		return nil, fh.finishAndClose(err)
 	}
 	// check the magic
-	if !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
+	padded := bytes.Equal(readBuf[:fileMagicSize], fileMagicPaddedBytes)
+	if !padded && !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
 		return nil, fh.finishAndClose(ErrorEncryptedBadMagic)
 	}
 	// retrieve the nonce
 	fh.nonce.fromBuf(readBuf[fileMagicSize:])
 	fh.initialNonce = fh.nonce
+	if padded {
+		err = fh.readSizeHeader()
+		if err != nil {
+			return nil, fh.finishAndClose(err)
+		}
+	}
 	return fh, nil
 }
 
+// readSizeHeader reads the size header of a padded file which follows
+// the magic and nonce
+func (fh *decrypter) readSizeHeader() error {
+	readBuf := (*fh.readBuf)[:fileSizeHeaderSize]
+	n, err := readers.ReadFill(fh.rc, readBuf)
+	if n < fileSizeHeaderSize && err == io.EOF {
+		return ErrorEncryptedFileTooShort
+	} else if err != io.EOF && err != nil {
+		return err
+	}
+	sizeNonce := fh.nonce.sizeNonce()
+	sizeBuf, ok := fh.openBox((*fh.buf)[:0], readBuf, &sizeNonce)
+	if !ok {
+		return ErrorEncryptedBadSizeHeader
+	}
+	fh.headerSize = filePaddedHeaderSize
+	fh.size = int64(binary.LittleEndian.Uint64(sizeBuf))
+	fh.limit = fh.size
+	return nil
+}
+
+// openBox authenticates and decrypts box with nonce appending the
+// result to out.
+//
+// If the data key isn't known yet then the current key and the old
+// keys are tried in turn and the first one which works is used from
+// then on.
+func (fh *decrypter) openBox(out, box []byte, nonce *nonce) ([]byte, bool) {
+	keys := fh.c.dataKeys()
+	if fh.keyIndex >= 0 {
+		return secretbox.Open(out, box, nonce.pointer(), keys[fh.keyIndex])
+	}
+	for i, key := range keys {
+		decrypted, ok := secretbox.Open(out, box, nonce.pointer(), key)
+		if ok {
+			fh.keyIndex = i
+			return decrypted, true
+		}
+	}
+	return nil, false
+}
+
+// sizeLimit returns the limit for reading from offset with limit,
+// reduced so no padding is read if this is a padded file.
+func (fh *decrypter) sizeLimit(offset, limit int64) int64 {
+	if fh.size < 0 {
+		return limit
+	}
+	left := fh.size - offset
+	if left < 0 {
+		left = 0
+	}
+	if limit < 0 || limit > left {
+		return left
+	}
+	return limit
+}
+
 // newDecrypterSeek creates a new file handle decrypting on the fly
 func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offset, limit int64) (fh *decrypter, err error) {
 	var rc io.ReadCloser
@@ -832,8 +1171,9 @@ func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offse
 		rc, err = open(ctx, 0, int64(fileHeaderSize)+underlyingLimit)
 		setLimit = true
 	} else {
-		// Otherwise just read the header to start with
-		rc, err = open(ctx, 0, int64(fileHeaderSize))
+		// Otherwise just read the header to start with, which
+		// is longer if the file is padded
+		rc, err = open(ctx, 0, int64(filePaddedHeaderSize))
 		doRangeSeek = true
 	}
 	if err != nil {
@@ -845,6 +1185,11 @@ func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offse
 		return nil, err
 	}
 	fh.open = open // will be called by fh.RangeSeek
+	if setLimit && fh.headerSize != fileHeaderSize {
+		// The padded header is longer so we didn't open enough
+		// of the file - seek to reopen it
+		setLimit, doRangeSeek = false, true
+	}
 	if doRangeSeek {
 		_, err = fh.RangeSeek(ctx, offset, io.SeekStart, limit)
 		if err != nil {
@@ -853,7 +1198,7 @@ func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offse
 		}
 	}
 	if setLimit {
-		fh.limit = limit
+		fh.limit = fh.sizeLimit(0, limit)
 	}
 	return fh, nil
 }
@@ -877,7 +1222,7 @@ func (fh *decrypter) fillBuffer() (err error) {
 		return ErrorEncryptedFileBadHeader
 	}
 	// Decrypt the block using the nonce
-	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), &fh.c.dataKey)
+	_, ok := fh.openBox((*fh.buf)[:0], (*readBuf)[:n], &fh.nonce)
 	if !ok {
 		if err != nil && err != io.EOF {
 			return err // return pending error as it is likely more accurate
@@ -905,6 +1250,10 @@ func (fh *decrypter) Read(p []byte) (n int, err error) {
 	if fh.err != nil {
 		return 0, fh.err
 	}
+	if fh.limit == 0 && fh.size >= 0 {
+		// nothing left but padding
+		return 0, fh.finish(io.EOF)
+	}
 	if fh.bufIndex >= fh.bufSize {
 		err = fh.fillBuffer()
 		if err != nil {
@@ -987,7 +1336,16 @@ func (fh *decrypter) RangeSeek(ctx context.Context, offset int64, whence int, li
 		return 0, fh.err
 	}
 
+	// Don't read the padding of a padded file
+	limit = fh.sizeLimit(offset, limit)
+	if limit == 0 && fh.size >= 0 {
+		fh.bufIndex, fh.bufSize = 0, 0
+		fh.limit = 0
+		return offset, nil
+	}
+
 	underlyingOffset, underlyingLimit, discard, blocks := calculateUnderlying(offset, limit)
+	underlyingOffset += int64(fh.headerSize - fileHeaderSize)
 
 	// Move the nonce on the correct number of blocks from the start
 	fh.nonce = fh.initialNonce
@@ -1095,8 +1453,31 @@ func (fh *decrypter) finishAndClose(err error) error {
 	return err
 }
 
+// findKey returns the index in c.dataKeys() of the key the data read
+// from rc was encrypted with, or -1 if this can't be told because the
+// file is empty. rc will be closed.
+func (c *Cipher) findKey(rc io.ReadCloser) (keyIndex int, err error) {
+	fh, err := c.newDecrypter(rc)
+	if err != nil {
+		return -1, err
+	}
+	defer fs.CheckClose(fh, &err)
+	if fh.keyIndex < 0 {
+		// Read the first block to find the key
+		var buf [1]byte
+		_, err = fh.Read(buf[:])
+		if err != nil && err != io.EOF {
+			return -1, err
+		}
+	}
+	return fh.keyIndex, nil
+}
+
 // DecryptData decrypts the data stream
 func (c *Cipher) DecryptData(rc io.ReadCloser) (io.ReadCloser, error) {
+	if c.age != nil {
+		return c.age.decrypt(rc)
+	}
 	out, err := c.newDecrypter(rc)
 	if err != nil {
 		return nil, err
@@ -1110,6 +1491,9 @@ func (c *Cipher) DecryptData(rc io.ReadCloser) (io.ReadCloser, error) {
 //
 // You must use this form of DecryptData if you might want to Seek the file handle
 func (c *Cipher) DecryptDataSeek(ctx context.Context, open OpenRangeSeek, offset, limit int64) (ReadSeekCloser, error) {
+	if c.age != nil {
+		return c.age.newDecrypterSeek(ctx, open, offset, limit)
+	}
 	out, err := c.newDecrypterSeek(ctx, open, offset, limit)
 	if err != nil {
 		return nil, err
@@ -1118,7 +1502,21 @@ func (c *Cipher) DecryptDataSeek(ctx context.Context, open OpenRangeSeek, offset
 }
 
 // EncryptedSize calculates the size of the data when encrypted
+//
+// If size padding is configured this includes the padding.
 func (c *Cipher) EncryptedSize(size int64) int64 {
+	if c.age != nil {
+		return c.age.encryptedSize(size)
+	}
+	if c.padding() {
+		return fileSizeHeaderSize + encryptedSize(c.paddedSize(size))
+	}
+	return encryptedSize(size)
+}
+
+// encryptedSize calculates the size of the data when encrypted without
+// padding
+func encryptedSize(size int64) int64 {
 	blocks, residue := size/blockDataSize, size%blockDataSize
 	encryptedSize := int64(fileHeaderSize) + blocks*(blockHeaderSize+blockDataSize)
 	if residue != 0 {
@@ -1128,7 +1526,14 @@ func (c *Cipher) EncryptedSize(size int64) int64 {
 }
 
 // DecryptedSize calculates the size of the data when decrypted
+//
+// For a padded file this returns the padded size as the real size is
+// stored in its header. For the age format this assumes the file has a
+// header of the size written to the current recipients.
 func (c *Cipher) DecryptedSize(size int64) (int64, error) {
+	if c.age != nil {
+		return decryptedAgeSize(size, c.age.headerSize)
+	}
 	size -= int64(fileHeaderSize)
 	if size < 0 {
 		return 0, ErrorEncryptedFileTooShort
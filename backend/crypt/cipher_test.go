@@ -11,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"filippo.io/age"
 	"github.com/Max-Sum/base32768"
 	"github.com/rclone/rclone/backend/crypt/pkcs7"
 	"github.com/rclone/rclone/lib/readers"
@@ -1643,3 +1644,289 @@ func TestKey(t *testing.T) {
 	assert.Equal(t, [32]byte{}, c.nameKey)
 	assert.Equal(t, [16]byte{}, c.nameTweak)
 }
+
+func TestSizePadding(t *testing.T) {
+	c, err := newCipher(NameEncryptionStandard, "", "", true, nil)
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		padding string
+		in      int64
+		want    int64
+	}{
+		{"off", 0, -1},
+		{"off", 100, -1},
+		{"pow2", -1, -1},
+		{"pow2", 0, 1},
+		{"pow2", 1, 1},
+		{"pow2", 3, 4},
+		{"pow2", 4, 4},
+		{"pow2", 65537, 131072},
+		{"1Ki", 0, 1024},
+		{"1Ki", 1024, 1024},
+		{"1Ki", 1025, 2048},
+		{"1000B", 1, 1000},
+	} {
+		require.NoError(t, c.setSizePadding(test.padding))
+		what := fmt.Sprintf("padding=%q in=%d", test.padding, test.in)
+		assert.Equal(t, test.want, c.paddedSizeFor(test.in), what)
+		if test.want >= 0 {
+			assert.Equal(t, fileSizeHeaderSize+encryptedSize(test.want), c.EncryptedSize(test.in), what)
+		}
+	}
+
+	for _, padding := range []string{"potato", "0", "-1Mi"} {
+		assert.Equal(t, ErrorBadSizePadding, c.setSizePadding(padding), padding)
+	}
+}
+
+func TestPaddedEncryptDecrypt(t *testing.T) {
+	c, err := newCipher(NameEncryptionStandard, "", "", true, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.setSizePadding("pow2"))
+
+	for _, size := range []int{0, 1, 1000, blockDataSize, blockDataSize + 1, 150000} {
+		what := fmt.Sprintf("size=%d", size)
+		plaintext, err := io.ReadAll(newRandomSource(int64(size)))
+		require.NoError(t, err)
+
+		encrypted, err := c.EncryptData(bytes.NewBuffer(plaintext))
+		require.NoError(t, err)
+		unpadded, err := io.ReadAll(encrypted)
+		require.NoError(t, err)
+
+		encrypted, _, err = c.encryptData(bytes.NewBuffer(plaintext), int64(size))
+		require.NoError(t, err)
+		ciphertext, err := io.ReadAll(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, c.EncryptedSize(int64(size)), int64(len(ciphertext)), what)
+		assert.Equal(t, fileMagicPadded, string(ciphertext[:fileMagicSize]), what)
+
+		// Both padded and unpadded files decrypt to the real data
+		for _, in := range [][]byte{unpadded, ciphertext} {
+			decrypted, err := c.DecryptData(io.NopCloser(bytes.NewBuffer(in)))
+			require.NoError(t, err)
+			got, err := io.ReadAll(decrypted)
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, got, what)
+		}
+
+		// Seeking doesn't read the padding
+		open := func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
+			end := int64(len(ciphertext))
+			if underlyingLimit >= 0 && underlyingOffset+underlyingLimit < end {
+				end = underlyingOffset + underlyingLimit
+			}
+			if underlyingOffset > end {
+				underlyingOffset = end
+			}
+			return io.NopCloser(bytes.NewBuffer(ciphertext[underlyingOffset:end])), nil
+		}
+		for _, offset := range []int{0, 1, size / 2, size - 1, size, size + 1} {
+			if offset < 0 {
+				continue
+			}
+			for _, limit := range []int{-1, 0, 1, 1000} {
+				fh, err := c.DecryptDataSeek(context.Background(), open, int64(offset), int64(limit))
+				require.NoError(t, err)
+				got, err := io.ReadAll(fh)
+				require.NoError(t, err)
+				want := []byte{}
+				if offset < size {
+					want = plaintext[offset:]
+				}
+				if limit >= 0 && limit < len(want) {
+					want = want[:limit]
+				}
+				assert.Equal(t, want, append([]byte{}, got...), fmt.Sprintf("%s offset=%d limit=%d", what, offset, limit))
+				require.NoError(t, fh.Close())
+			}
+		}
+	}
+
+	// The size must match the data
+	encrypted, _, err := c.encryptData(bytes.NewBufferString("potato"), 5)
+	require.NoError(t, err)
+	_, err = io.ReadAll(encrypted)
+	assert.True(t, errors.Is(err, ErrorPaddingSizeMismatch))
+	encrypted, _, err = c.encryptData(bytes.NewBufferString("potato"), 7)
+	require.NoError(t, err)
+	_, err = io.ReadAll(encrypted)
+	assert.True(t, errors.Is(err, ErrorPaddingSizeMismatch))
+
+	// A corrupted size header is detected
+	encrypted, _, err = c.encryptData(bytes.NewBufferString("potato"), 6)
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(encrypted)
+	require.NoError(t, err)
+	ciphertext[fileHeaderSize] ^= 1
+	_, err = c.DecryptData(io.NopCloser(bytes.NewBuffer(ciphertext)))
+	assert.Equal(t, ErrorEncryptedBadSizeHeader, err)
+}
+
+func TestOldKeys(t *testing.T) {
+	oldCipher, err := newCipher(NameEncryptionStandard, "old", "", true, nil)
+	require.NoError(t, err)
+	c, err := newCipher(NameEncryptionStandard, "new", "", true, nil)
+	require.NoError(t, err)
+
+	plaintext := []byte("potato")
+	encrypt := func(c *Cipher, size int64) []byte {
+		encrypted, _, err := c.encryptData(bytes.NewBuffer(plaintext), size)
+		require.NoError(t, err)
+		ciphertext, err := io.ReadAll(encrypted)
+		require.NoError(t, err)
+		return ciphertext
+	}
+	decrypt := func(ciphertext []byte) ([]byte, int, error) {
+		fh, err := c.newDecrypter(io.NopCloser(bytes.NewBuffer(ciphertext)))
+		if err != nil {
+			return nil, -1, err
+		}
+		got, err := io.ReadAll(fh)
+		return got, fh.keyIndex, err
+	}
+
+	for _, padding := range []string{"off", "pow2"} {
+		require.NoError(t, oldCipher.setSizePadding(padding))
+		oldData := encrypt(oldCipher, int64(len(plaintext)))
+		newData := encrypt(c, int64(len(plaintext)))
+
+		// Without the old key the old data can't be read
+		_, _, err = decrypt(oldData)
+		assert.Error(t, err, padding)
+
+		require.NoError(t, c.addOldKey("older", ""))
+		require.NoError(t, c.addOldKey("old", ""))
+		for i, in := range [][]byte{newData, oldData} {
+			got, keyIndex, err := decrypt(in)
+			require.NoError(t, err, padding)
+			assert.Equal(t, plaintext, got, padding)
+			assert.Equal(t, 2*i, keyIndex, padding)
+
+			keyIndex, err = c.findKey(io.NopCloser(bytes.NewBuffer(in)))
+			require.NoError(t, err, padding)
+			assert.Equal(t, 2*i, keyIndex, padding)
+		}
+		c.oldCiphers = nil
+	}
+
+	// The key of an empty unpadded file can't be found
+	keyIndex, err := c.findKey(io.NopCloser(bytes.NewBuffer(encrypt(c, -1)[:fileHeaderSize])))
+	require.NoError(t, err)
+	assert.Equal(t, -1, keyIndex)
+}
+
+func TestAgeEncryptDecrypt(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	c, err := newCipher(NameEncryptionStandard, "", "", true, nil)
+	require.NoError(t, err)
+	c.age, err = newAgeCipher("potato", []string{identity.Recipient().String(), other.Recipient().String()}, "")
+	require.NoError(t, err)
+	c.age.identities = append(c.age.identities, identity)
+
+	for _, size := range []int{0, 1, 1000, ageChunkSize - 1, ageChunkSize, ageChunkSize + 1, 3*ageChunkSize + 17} {
+		what := fmt.Sprintf("size=%d", size)
+		plaintext, err := io.ReadAll(newRandomSource(int64(size)))
+		require.NoError(t, err)
+
+		encrypted, _, err := c.encryptData(bytes.NewBuffer(plaintext), int64(size))
+		require.NoError(t, err)
+		ciphertext, err := io.ReadAll(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, c.EncryptedSize(int64(size)), int64(len(ciphertext)), what)
+		decryptedSize, err := c.DecryptedSize(int64(len(ciphertext)))
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), decryptedSize, what)
+		headerSize, err := readAgeHeaderSize(bytes.NewBuffer(ciphertext))
+		require.NoError(t, err)
+		assert.Equal(t, c.age.headerSize, headerSize, what)
+
+		// Every recipient can decrypt it with the age library
+		for _, i := range []age.Identity{identity, other} {
+			r, err := age.Decrypt(bytes.NewBuffer(ciphertext), i)
+			require.NoError(t, err)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, got, what)
+		}
+
+		// Seeking opens the file at the chunk holding the offset
+		var opened int64
+		open := func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
+			end := int64(len(ciphertext))
+			if underlyingLimit >= 0 && underlyingOffset+underlyingLimit < end {
+				end = underlyingOffset + underlyingLimit
+			}
+			if underlyingOffset > end {
+				underlyingOffset = end
+			}
+			opened += end - underlyingOffset
+			return io.NopCloser(bytes.NewBuffer(ciphertext[underlyingOffset:end])), nil
+		}
+		for _, offset := range []int{0, 1, size / 2, size} {
+			if offset > size {
+				continue
+			}
+			for _, limit := range []int{-1, 0, 1, 1000} {
+				fh, err := c.DecryptDataSeek(context.Background(), open, int64(offset), int64(limit))
+				require.NoError(t, err)
+				got, err := io.ReadAll(fh)
+				require.NoError(t, err)
+				want := plaintext[offset:]
+				if limit >= 0 && limit < len(want) {
+					want = want[:limit]
+				}
+				assert.Equal(t, want, append([]byte{}, got...), fmt.Sprintf("%s offset=%d limit=%d", what, offset, limit))
+				require.NoError(t, fh.Close())
+			}
+		}
+
+		// Seeking in an open file only reads the chunks needed
+		if size > 2*ageChunkSize {
+			fh, err := c.DecryptDataSeek(context.Background(), open, 0, -1)
+			require.NoError(t, err)
+			for _, offset := range []int64{3 * ageChunkSize, ageChunkSize + 1, 2*ageChunkSize + 5} {
+				opened = 0
+				_, err = fh.RangeSeek(context.Background(), offset, io.SeekStart, 10)
+				require.NoError(t, err)
+				got, err := io.ReadAll(fh)
+				require.NoError(t, err)
+				assert.Equal(t, plaintext[offset:offset+10], got, what)
+				assert.LessOrEqual(t, opened, int64(2*ageEncChunkSize), what)
+			}
+			require.NoError(t, fh.Close())
+		}
+	}
+
+	// Files which aren't age files are rejected
+	_, err = readAgeHeaderSize(bytes.NewBufferString("RCLONE\x00\x00potato"))
+	assert.Equal(t, ErrorAgeBadHeader, err)
+	_, err = decryptedAgeSize(c.age.headerSize+ageNonceSize+ageTagSize-1, c.age.headerSize)
+	assert.Equal(t, ErrorAgeFileTooShort, err)
+	_, err = decryptedAgeSize(c.age.headerSize+ageNonceSize+ageEncChunkSize+ageTagSize, c.age.headerSize)
+	assert.Equal(t, ErrorAgeFileTooShort, err)
+}
+
+func TestAgeScrypt(t *testing.T) {
+	c, err := newCipher(NameEncryptionStandard, "", "", true, nil)
+	require.NoError(t, err)
+	c.age, err = newAgeCipher("potato", nil, "")
+	require.NoError(t, err)
+
+	encrypted, _, err := c.encryptData(bytes.NewBufferString("hello"), 5)
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, c.EncryptedSize(5), int64(len(ciphertext)))
+
+	decrypted, err := c.DecryptData(io.NopCloser(bytes.NewBuffer(ciphertext)))
+	require.NoError(t, err)
+	got, err := io.ReadAll(decrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+	require.NoError(t, decrypted.Close())
+}
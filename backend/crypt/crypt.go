@@ -8,6 +8,7 @@ import (
 	"io"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -18,6 +19,8 @@ import (
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/fspath"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/env"
+	"golang.org/x/sync/errgroup"
 )
 
 // Globals
@@ -161,6 +164,121 @@ Setting suffix to "none" will result in an empty suffix. This may be useful
 when the path length is critical.`,
 			Default:  ".bin",
 			Advanced: true,
+		}, {
+			Name: "size_padding",
+			Help: `Pad file data so the encrypted size doesn't reveal the real size.
+
+When set, new files are padded with zeros up to a size bucket before
+they are encrypted and the real size is stored in the encrypted file
+header. This can be "pow2" to pad to the next power of 2 or a size,
+e.g. "1Mi", to pad to the next multiple of that size.
+
+Reading the size of each padded file needs an extra request to read
+its header so listings are slower. The header is read once when the
+file is listed and if it can't be read an error is reported and the
+size shown as unknown. Leave this set while any padded files remain,
+otherwise their padded sizes will be shown.
+
+Files uploaded without a known size are not padded.`,
+			Default:  "off",
+			Advanced: true,
+			Examples: []fs.OptionExample{
+				{
+					Value: "off",
+					Help:  "Don't pad file data.",
+				}, {
+					Value: "pow2",
+					Help:  "Pad file data to the next power of 2.",
+				}, {
+					Value: "1Mi",
+					Help:  "Pad file data to the next multiple of 1 MiB.",
+				},
+			},
+		}, {
+			Name: "old_passwords",
+			Help: `Old passwords to try when decrypting file data and names.
+
+This is a comma separated list of passwords obscured with "rclone
+obscure", newest first. If the current password doesn't decrypt a
+file, or a name with standard filename encryption, then these are
+tried in order. New files are always encrypted with the current
+password.
+
+Use the "rotate" backend command to re-encrypt files written with an
+old password.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name: "old_passwords2",
+			Help: `Salts for the old passwords.
+
+A comma separated list of salts obscured with "rclone obscure", one
+for each of old_passwords. If this isn't set then password2 is used
+as the salt of all the old passwords.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name: "cipher_format",
+			Help: `The format to encrypt file data in.
+
+Files written in the age format can be decrypted with the standard age
+tools as well as rclone. File names are still encrypted as set by
+filename_encryption.
+
+All the files in the remote should use the same format.`,
+			Default:  "rclone",
+			Advanced: true,
+			Examples: []fs.OptionExample{
+				{
+					Value: "rclone",
+					Help:  "Encrypt file data in the rclone format.",
+				}, {
+					Value: "age",
+					Help:  "Encrypt file data in the age v1 format.",
+				},
+			},
+		}, {
+			Name: "age_recipients",
+			Help: `Public keys to encrypt file data to when cipher_format is age.
+
+This is a comma separated list of age X25519 public keys ("age1...").
+Any of the matching private keys can decrypt the files, so a machine
+which only writes files need not hold a private key.
+
+If this isn't set then file data is encrypted with the password using
+the age scrypt recipient. This is slow as each file needs its own
+scrypt key derivation.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name: "age_identity_file",
+			Help: `Path to an age identity file to decrypt file data with.
+
+This is a file of age X25519 private keys ("AGE-SECRET-KEY-1...") as
+written by age-keygen. File data encrypted with the password can be
+decrypted without it.` + env.ShellExpandHelp,
+			Advanced: true,
+		}, {
+			Name: "flatten_directories",
+			Help: `Hide the shape of the directory tree.
+
+When set, files are stored under names made from a keyed hash of
+their encrypted paths, spread over shard directories named after the
+first two characters of the hash. The directory tree is kept in an
+encrypted index for each directory which looks like any other file to
+the remote.
+
+Listing a directory reads its index then looks up each file in it so
+listings are slower. Moving a directory moves each file in it.
+
+Each index is read again and merged with rclone's changes when it is
+written, so several rclones can write to the remote, but changes made
+to the same directory at the same moment may still be lost. A file is
+added to its index before it is written, so a failed write can't leave
+a file out of the index. This can't be changed once files have been
+written and can't be used with old_passwords.`,
+			Default:  false,
+			Advanced: true,
 		}},
 	})
 }
@@ -195,6 +313,46 @@ func newCipherForConfig(opt *Options) (*Cipher, error) {
 	}
 	cipher.setEncryptedSuffix(opt.Suffix)
 	cipher.setPassBadBlocks(opt.PassBadBlocks)
+	err = cipher.setSizePadding(opt.SizePadding)
+	if err != nil {
+		return nil, err
+	}
+	if len(opt.OldPasswords2) != 0 && len(opt.OldPasswords2) != len(opt.OldPasswords) {
+		return nil, errors.New("old_passwords2 must have one entry for each of old_passwords")
+	}
+	for i, oldPassword := range opt.OldPasswords {
+		oldPassword, err = obscure.Reveal(oldPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt old_passwords: %w", err)
+		}
+		oldSalt := salt
+		if len(opt.OldPasswords2) != 0 {
+			oldSalt, err = obscure.Reveal(opt.OldPasswords2[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt old_passwords2: %w", err)
+			}
+		}
+		err = cipher.addOldKey(oldPassword, oldSalt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make cipher for old password: %w", err)
+		}
+	}
+	switch strings.ToLower(opt.CipherFormat) {
+	case "", "rclone":
+	case "age":
+		if opt.NoDataEncryption {
+			return nil, ErrorAgeNoDataEncrypt
+		}
+		if cipher.padding() {
+			return nil, ErrorAgeNoSizePadding
+		}
+		cipher.age, err = newAgeCipher(password, opt.AgeRecipients, opt.AgeIdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make age cipher: %w", err)
+		}
+	default:
+		return nil, ErrorBadCipherFormat
+	}
 	return cipher, nil
 }
 
@@ -229,9 +387,16 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	if path.Base(rpath) == "." {
 		rpath = strings.TrimSuffix(rpath, ".")
 	}
+	if opt.FlattenDirectories && len(opt.OldPasswords) != 0 {
+		return nil, ErrorFlattenOldPasswords
+	}
 	// Look for a file first
 	var wrappedFs fs.Fs
-	if rpath == "" {
+	var flat *flatFs
+	if opt.FlattenDirectories {
+		flat, err = newFlatFs(ctx, remote, cipher, rpath)
+		wrappedFs = flat
+	} else if rpath == "" {
 		wrappedFs, err = cache.Get(ctx, remote)
 	} else {
 		remotePath := fspath.JoinRootPath(remote, cipher.EncryptFileName(rpath))
@@ -252,7 +417,11 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		opt:    *opt,
 		cipher: cipher,
 	}
-	cache.PinUntilFinalized(f.Fs, f)
+	if flat != nil {
+		cache.PinUntilFinalized(flat.store.base, f)
+	} else {
+		cache.PinUntilFinalized(f.Fs, f)
+	}
 	// the features here are ones we could support, and they are
 	// ANDed with the ones from wrappedFs
 	f.features = (&fs.Features{
@@ -270,23 +439,35 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		UserMetadata:            true,
 		PartialUploads:          true,
 	}).Fill(ctx, f).Mask(ctx, wrappedFs).WrapsFs(f, wrappedFs)
+	if cipher.oldNames() && cipher.dirNameEncrypt {
+		// Names encrypted with old keys are in separate trees
+		// which ListR can't merge
+		f.features.ListR = nil
+	}
 
 	return f, err
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote                  string `config:"remote"`
-	FilenameEncryption      string `config:"filename_encryption"`
-	DirectoryNameEncryption bool   `config:"directory_name_encryption"`
-	NoDataEncryption        bool   `config:"no_data_encryption"`
-	Password                string `config:"password"`
-	Password2               string `config:"password2"`
-	ServerSideAcrossConfigs bool   `config:"server_side_across_configs"`
-	ShowMapping             bool   `config:"show_mapping"`
-	PassBadBlocks           bool   `config:"pass_bad_blocks"`
-	FilenameEncoding        string `config:"filename_encoding"`
-	Suffix                  string `config:"suffix"`
+	Remote                  string          `config:"remote"`
+	FilenameEncryption      string          `config:"filename_encryption"`
+	DirectoryNameEncryption bool            `config:"directory_name_encryption"`
+	NoDataEncryption        bool            `config:"no_data_encryption"`
+	Password                string          `config:"password"`
+	Password2               string          `config:"password2"`
+	ServerSideAcrossConfigs bool            `config:"server_side_across_configs"`
+	ShowMapping             bool            `config:"show_mapping"`
+	PassBadBlocks           bool            `config:"pass_bad_blocks"`
+	FilenameEncoding        string          `config:"filename_encoding"`
+	Suffix                  string          `config:"suffix"`
+	SizePadding             string          `config:"size_padding"`
+	OldPasswords            fs.CommaSepList `config:"old_passwords"`
+	OldPasswords2           fs.CommaSepList `config:"old_passwords2"`
+	CipherFormat            string          `config:"cipher_format"`
+	AgeRecipients           fs.CommaSepList `config:"age_recipients"`
+	AgeIdentityFile         string          `config:"age_identity_file"`
+	FlattenDirectories      bool            `config:"flatten_directories"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -361,9 +542,45 @@ func (f *Fs) encryptEntries(ctx context.Context, entries fs.DirEntries) (newEntr
 			return nil, fmt.Errorf("unknown object type %T", entry)
 		}
 	}
+	f.readSizes(ctx, newEntries)
 	return newEntries, nil
 }
 
+// sizeInHeader returns true if the size of objects needs to be read
+// from their headers
+func (f *Fs) sizeInHeader() bool {
+	return !f.opt.NoDataEncryption && (f.cipher.padding() || f.cipher.age != nil)
+}
+
+// readSizes reads the sizes of the objects in entries from their
+// headers if necessary so that Size doesn't have to.
+//
+// Objects whose size can't be read are logged and counted as errors
+// and have an unknown size.
+func (f *Fs) readSizes(ctx context.Context, entries fs.DirEntries) {
+	if !f.sizeInHeader() {
+		return
+	}
+	ci := fs.GetConfig(ctx)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(ci.Checkers)
+	for _, entry := range entries {
+		o, ok := entry.(*Object)
+		if !ok {
+			continue
+		}
+		g.Go(func() error {
+			_, err := o.readSize(gCtx)
+			if err != nil {
+				err = fs.CountError(err)
+				fs.Errorf(o, "Failed to read size from header: %v", err)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
+
 // List the objects and directories in dir into entries.  The
 // entries can be returned in any order but should be for a
 // complete directory.
@@ -373,12 +590,49 @@ func (f *Fs) encryptEntries(ctx context.Context, entries fs.DirEntries) (newEntr
 //
 // This should return ErrDirNotFound if the directory isn't
 // found.
+//
+// If old_passwords are set then the directory encrypted with each of
+// them is listed too, with entries named with the current key taking
+// precedence.
 func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
-	entries, err = f.Fs.List(ctx, f.cipher.EncryptDirName(dir))
-	if err != nil {
-		return nil, err
+	encryptedDirs := f.cipher.encryptedDirNames(dir)
+	if len(encryptedDirs) == 1 {
+		entries, err = f.Fs.List(ctx, encryptedDirs[0])
+		if err != nil {
+			return nil, err
+		}
+		return f.encryptEntries(ctx, entries)
+	}
+	found := false
+	seen := map[string]struct{}{}
+	for _, encryptedDir := range encryptedDirs {
+		dirEntries, err := f.Fs.List(ctx, encryptedDir)
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		found = true
+		dirEntries, err = f.encryptEntries(ctx, dirEntries)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range dirEntries {
+			key := entry.Remote()
+			if _, isDir := entry.(fs.Directory); isDir {
+				key += "/"
+			}
+			if _, duplicate := seen[key]; duplicate {
+				continue
+			}
+			seen[key] = struct{}{}
+			entries = append(entries, entry)
+		}
+	}
+	if !found {
+		return nil, fs.ErrorDirNotFound
 	}
-	return f.encryptEntries(ctx, entries)
+	return entries, nil
 }
 
 // ListR lists the objects and directories of the Fs starting
@@ -408,12 +662,29 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 }
 
 // NewObject finds the Object at remote.
+//
+// If old_passwords are set then the name encrypted with each of them
+// is tried if the current one isn't found.
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
-	o, err := f.Fs.NewObject(ctx, f.cipher.EncryptFileName(remote))
+	var o fs.Object
+	var err error
+	for _, encryptedRemote := range f.cipher.encryptedFileNames(remote) {
+		o, err = f.Fs.NewObject(ctx, encryptedRemote)
+		if !errors.Is(err, fs.ErrorObjectNotFound) {
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(o), nil
+	obj := f.newObject(o)
+	if f.sizeInHeader() {
+		_, err = obj.readSize(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read size from header: %w", err)
+		}
+	}
+	return obj, nil
 }
 
 type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error)
@@ -431,7 +702,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	}
 
 	// Encrypt the data into wrappedIn
-	wrappedIn, encrypter, err := f.cipher.encryptData(in)
+	wrappedIn, encNonce, err := f.cipher.encryptData(in, src.Size())
 	if err != nil {
 		return nil, err
 	}
@@ -458,7 +729,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	}
 
 	// Transfer the data
-	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce), options...)
+	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encNonce), options...)
 	if err != nil {
 		return nil, err
 	}
@@ -484,7 +755,15 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 		}
 	}
 
-	return f.newObject(o), nil
+	obj := f.newObject(o)
+	obj.setSize(src.Size())
+	if src.Size() < 0 && f.sizeInHeader() {
+		_, err = obj.readSize(ctx)
+		if err != nil {
+			return obj, fmt.Errorf("failed to read size from header: %w", err)
+		}
+	}
+	return obj, nil
 }
 
 // Put in to the remote path with the modTime given of the given size
@@ -516,8 +795,32 @@ func (f *Fs) Mkdir(ctx context.Context, dir string) error {
 // Rmdir removes the directory (container, bucket) if empty
 //
 // Return an error if it doesn't exist or isn't empty
+//
+// If old_passwords are set then the directory encrypted with each of
+// them is removed too.
 func (f *Fs) Rmdir(ctx context.Context, dir string) error {
-	return f.Fs.Rmdir(ctx, f.cipher.EncryptDirName(dir))
+	return f.forEachDir(dir, func(encryptedDir string) error {
+		return f.Fs.Rmdir(ctx, encryptedDir)
+	})
+}
+
+// forEachDir calls fn with the encryptions of dir with the current
+// and any old keys, succeeding if any of them succeed. If none do it
+// returns the error for the current key.
+func (f *Fs) forEachDir(dir string, fn func(encryptedDir string) error) (err error) {
+	succeeded := false
+	for i, encryptedDir := range f.cipher.encryptedDirNames(dir) {
+		dirErr := fn(encryptedDir)
+		if dirErr == nil {
+			succeeded = true
+		} else if i == 0 {
+			err = dirErr
+		}
+	}
+	if succeeded {
+		return nil
+	}
+	return err
 }
 
 // Purge all files in the directory specified
@@ -531,7 +834,9 @@ func (f *Fs) Purge(ctx context.Context, dir string) error {
 	if do == nil {
 		return fs.ErrorCantPurge
 	}
-	return do(ctx, f.cipher.EncryptDirName(dir))
+	return f.forEachDir(dir, func(encryptedDir string) error {
+		return do(ctx, encryptedDir)
+	})
 }
 
 // Copy src to this remote using server-side copy operations.
@@ -556,7 +861,9 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	newObj := f.newObject(oResult)
+	newObj.copySize(o)
+	return newObj, nil
 }
 
 // Move src to this remote using server-side move operations.
@@ -581,7 +888,9 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	newObj := f.newObject(oResult)
+	newObj.copySize(o)
+	return newObj, nil
 }
 
 // DirMove moves src, srcRemote to this remote at dstRemote
@@ -614,15 +923,17 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if do == nil {
 		return nil, errors.New("can't PutUnchecked")
 	}
-	wrappedIn, encrypter, err := f.cipher.encryptData(in)
+	wrappedIn, encNonce, err := f.cipher.encryptData(in, src.Size())
 	if err != nil {
 		return nil, err
 	}
-	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce))
+	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encNonce))
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(o), nil
+	obj := f.newObject(o)
+	obj.setSize(src.Size())
+	return obj, nil
 }
 
 // CleanUp the trash in the Fs
@@ -672,10 +983,11 @@ func (f *Fs) DecryptFileName(encryptedFileName string) (string, error) {
 }
 
 // computeHashWithNonce takes the nonce and encrypts the contents of
-// src with it, and calculates the hash given by HashType on the fly
+// src with it using the key of c, padded to paddedSize if >= 0, and
+// calculates the hash given by HashType on the fly
 //
 // Note that we break lots of encapsulation in this function.
-func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Object, hashType hash.Type) (hashStr string, err error) {
+func (f *Fs) computeHashWithNonce(ctx context.Context, c *Cipher, nonce nonce, paddedSize int64, src fs.Object, hashType hash.Type) (hashStr string, err error) {
 	// Open the src for input
 	in, err := src.Open(ctx)
 	if err != nil {
@@ -684,7 +996,7 @@ func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Objec
 	defer fs.CheckClose(in, &err)
 
 	// Now encrypt the src with the nonce
-	out, err := f.cipher.newEncrypter(in, &nonce)
+	out, err := c.newPaddedEncrypter(in, &nonce, src.Size(), paddedSize)
 	if err != nil {
 		return "", fmt.Errorf("failed to make encrypter: %w", err)
 	}
@@ -705,15 +1017,25 @@ func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Objec
 // ComputeHash takes the nonce from o, and encrypts the contents of
 // src with it, and calculates the hash given by HashType on the fly
 //
+// The contents are encrypted with the key o was encrypted with, which
+// may be one of the old keys.
+//
 // Note that we break lots of encapsulation in this function.
 func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType hash.Type) (hashStr string, err error) {
 	if f.opt.NoDataEncryption {
 		return src.Hash(ctx, hashType)
 	}
+	if f.cipher.age != nil {
+		// The file key can't be read so the data can't be
+		// encrypted in the same way
+		return "", errors.New("can't compute hash of files in the age format")
+	}
 
 	// Read the nonce - opening the file is sufficient to read the nonce in
-	// use a limited read so we only read the header
-	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(fileHeaderSize) - 1})
+	// use a limited read so we only read the header, which is
+	// longer if the file is padded, and the first block to find
+	// the key
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(filePaddedHeaderSize+blockSize) - 1})
 	if err != nil {
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
@@ -725,6 +1047,30 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 	nonce := d.nonce
 	// fs.Debugf(o, "Read nonce % 2x", nonce)
 
+	// Find the key unless the size header found it already
+	if d.keyIndex < 0 {
+		var buf [1]byte
+		_, err = d.Read(buf[:])
+		if err != nil && err != io.EOF {
+			_ = d.Close()
+			return "", fmt.Errorf("failed to find key: %w", err)
+		}
+	}
+	c := f.cipher
+	if d.keyIndex > 0 {
+		c = f.cipher.keyCipher(d.keyIndex)
+	}
+
+	// Pad the data to the same size if the file was padded
+	paddedSize := int64(-1)
+	if d.size >= 0 {
+		paddedSize, err = f.cipher.DecryptedSize(o.Object.Size() - fileSizeHeaderSize)
+		if err != nil {
+			_ = d.Close()
+			return "", fmt.Errorf("failed to read padded size: %w", err)
+		}
+	}
+
 	// Check nonce isn't all zeros
 	isZero := true
 	for i := range nonce {
@@ -742,7 +1088,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		return "", fmt.Errorf("failed to close nonce read: %w", err)
 	}
 
-	return f.computeHashWithNonce(ctx, nonce, src, hashType)
+	return f.computeHashWithNonce(ctx, c, nonce, paddedSize, src, hashType)
 }
 
 // MergeDirs merges the contents of all the directories passed
@@ -838,6 +1184,28 @@ Usage Example:
 
     rclone backend decode crypt: encryptedfile1 [encryptedfile2...]
     rclone rc backend/command command=decode fs=crypt: encryptedfile1 [encryptedfile2...]
+`,
+	},
+	{
+		Name:  "rotate",
+		Short: "Re-encrypt files written with an old password",
+		Long: `This re-encrypts every file which was encrypted with one of the
+old_passwords with the current password. Each file is downloaded,
+re-encrypted and uploaded then the old file is removed or replaced.
+
+Files already encrypted with the current password are skipped, so if
+the rotation is interrupted run it again to carry on where it left off.
+Any temporary files left by an interrupted rotation are removed.
+It returns the number of files rotated, already current and which
+failed, and the number of temporary files removed.
+
+Usage Example:
+
+    rclone backend rotate crypt:
+    rclone rc backend/command command=rotate fs=crypt:
+
+Run this on the root of the crypt remote as the encrypted name of any
+subdirectory changes with the password.
 `,
 	},
 }
@@ -870,6 +1238,8 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			out = append(out, encryptedFileName)
 		}
 		return out, nil
+	case "rotate":
+		return f.rotate(ctx)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -880,7 +1250,11 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 // This decrypts the remote name and decrypts the data
 type Object struct {
 	fs.Object
-	f *Fs
+	f        *Fs
+	mu       sync.Mutex
+	size     int64 // size read from the header, valid if sizeRead is set
+	sizeRead bool
+	sizeErr  error // error reading the size from the header
 }
 
 func (f *Fs) newObject(o fs.Object) *Object {
@@ -915,18 +1289,108 @@ func (o *Object) Remote() string {
 }
 
 // Size returns the size of the file
+//
+// If the size is stored in the header of the file it is read when
+// the object is listed or found, or recorded when it is uploaded. If
+// it couldn't be read then the size is unknown.
 func (o *Object) Size() int64 {
 	size := o.Object.Size()
-	if !o.f.opt.NoDataEncryption {
-		var err error
-		size, err = o.f.cipher.DecryptedSize(size)
-		if err != nil {
-			fs.Debugf(o, "Bad size for decrypt: %v", err)
+	if o.f.opt.NoDataEncryption {
+		return size
+	}
+	if o.f.sizeInHeader() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if !o.sizeRead && o.sizeErr == nil {
+			// Objects are normally made with their size so
+			// this shouldn't happen
+			o.sizeErr = o.readSizeLocked(context.Background())
+			if o.sizeErr != nil {
+				fs.Errorf(o, "Failed to read size from header: %v", o.sizeErr)
+			}
+		}
+		if o.sizeErr != nil {
+			return -1
 		}
+		return o.size
+	}
+	size, err := o.f.cipher.DecryptedSize(size)
+	if err != nil {
+		fs.Debugf(o, "Bad size for decrypt: %v", err)
 	}
 	return size
 }
 
+// setSize records the size of the data in the object, as known when
+// it was uploaded. Sizes < 0 are ignored as they will be read from
+// the header if necessary.
+func (o *Object) setSize(size int64) {
+	if size < 0 {
+		return
+	}
+	o.mu.Lock()
+	o.size, o.sizeRead, o.sizeErr = size, true, nil
+	o.mu.Unlock()
+}
+
+// copySize copies any size read from the header of src to o
+func (o *Object) copySize(src *Object) {
+	src.mu.Lock()
+	size, sizeRead := src.size, src.sizeRead
+	src.mu.Unlock()
+	if sizeRead {
+		o.setSize(size)
+	}
+}
+
+// readSize reads the size of the data from the header of the file
+// if it is padded or in the age format, caching the result.
+func (o *Object) readSize(ctx context.Context) (size int64, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.sizeRead {
+		o.sizeErr = o.readSizeLocked(ctx)
+	}
+	return o.size, o.sizeErr
+}
+
+// readSizeLocked reads the size from the header into o.size
+//
+// Call with o.mu held
+func (o *Object) readSizeLocked(ctx context.Context) (err error) {
+	var size int64
+	if o.f.cipher.age != nil {
+		size, err = o.f.cipher.age.readSize(ctx, o.Object)
+		if err != nil {
+			return err
+		}
+		o.size, o.sizeRead = size, true
+		return nil
+	}
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(filePaddedHeaderSize) - 1})
+	if err != nil {
+		return err
+	}
+	d, err := o.f.cipher.newDecrypter(in)
+	if err != nil {
+		return err
+	}
+	size = d.size
+	err = d.Close()
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		// not padded so calculate the size
+		size, err = o.f.cipher.DecryptedSize(o.Object.Size())
+		if err != nil {
+			return err
+		}
+	}
+	o.size, o.sizeRead = size, true
+	return nil
+}
+
 // Hash returns the selected checksum of the file
 // If no checksum is available it returns ""
 func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
@@ -985,7 +1449,20 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 		return o.Object, o.Object.Update(ctx, in, src, options...)
 	}
 	_, err := o.f.put(ctx, in, src, options, update)
-	return err
+	o.mu.Lock()
+	o.sizeRead, o.sizeErr = false, nil
+	o.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	o.setSize(src.Size())
+	if src.Size() < 0 && o.f.sizeInHeader() {
+		_, err = o.readSize(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read size from header: %w", err)
+		}
+	}
+	return nil
 }
 
 // newDir returns a dir with the Name decrypted
@@ -1019,6 +1496,33 @@ func (f *Fs) Disconnect(ctx context.Context) error {
 	return do(ctx)
 }
 
+// DirSetModTime sets the modification time of the directory dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	do := f.Fs.Features().DirSetModTime
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, f.cipher.EncryptDirName(dir), modTime)
+}
+
+// DirMetadata returns the metadata of the directory dir
+func (f *Fs) DirMetadata(ctx context.Context, dir string) (fs.Metadata, error) {
+	do := f.Fs.Features().DirMetadata
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	return do(ctx, f.cipher.EncryptDirName(dir))
+}
+
+// DirSetMetadata sets metadata on the directory dir
+func (f *Fs) DirSetMetadata(ctx context.Context, dir string, metadata fs.Metadata) error {
+	do := f.Fs.Features().DirSetMetadata
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, f.cipher.EncryptDirName(dir), metadata)
+}
+
 // Shutdown the backend, closing any background tasks and any
 // cached connections.
 func (f *Fs) Shutdown(ctx context.Context) error {
@@ -1084,10 +1588,10 @@ func (o *ObjectInfo) Hash(ctx context.Context, hash hash.Type) (string, error) {
 		return "", nil
 	}
 	// if this is wrapping a local object then we work out the hash
-	if srcObj.Fs().Features().IsLocal {
+	if srcObj.Fs().Features().IsLocal && o.f.cipher.age == nil {
 		// Read the data and encrypt it to calculate the hash
 		fs.Debugf(o, "Computing %v hash of encrypted source", hash)
-		return o.f.computeHashWithNonce(ctx, o.nonce, srcObj, hash)
+		return o.f.computeHashWithNonce(ctx, o.f.cipher, o.nonce, o.f.cipher.paddedSizeFor(srcObj.Size()), srcObj, hash)
 	}
 	return "", nil
 }
@@ -1175,6 +1679,17 @@ func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
 	return do.Metadata(ctx)
 }
 
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
 // MimeType returns the content type of the Object if
 // known, or "" if not
 //
@@ -1186,26 +1701,29 @@ func (o *Object) MimeType(ctx context.Context) string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = (*Fs)(nil)
-	_ fs.Purger          = (*Fs)(nil)
-	_ fs.Copier          = (*Fs)(nil)
-	_ fs.Mover           = (*Fs)(nil)
-	_ fs.DirMover        = (*Fs)(nil)
-	_ fs.Commander       = (*Fs)(nil)
-	_ fs.PutUncheckeder  = (*Fs)(nil)
-	_ fs.PutStreamer     = (*Fs)(nil)
-	_ fs.CleanUpper      = (*Fs)(nil)
-	_ fs.UnWrapper       = (*Fs)(nil)
-	_ fs.ListRer         = (*Fs)(nil)
-	_ fs.Abouter         = (*Fs)(nil)
-	_ fs.Wrapper         = (*Fs)(nil)
-	_ fs.MergeDirser     = (*Fs)(nil)
-	_ fs.DirCacheFlusher = (*Fs)(nil)
-	_ fs.ChangeNotifier  = (*Fs)(nil)
-	_ fs.PublicLinker    = (*Fs)(nil)
-	_ fs.UserInfoer      = (*Fs)(nil)
-	_ fs.Disconnecter    = (*Fs)(nil)
-	_ fs.Shutdowner      = (*Fs)(nil)
-	_ fs.FullObjectInfo  = (*ObjectInfo)(nil)
-	_ fs.FullObject      = (*Object)(nil)
+	_ fs.Fs               = (*Fs)(nil)
+	_ fs.Purger           = (*Fs)(nil)
+	_ fs.Copier           = (*Fs)(nil)
+	_ fs.Mover            = (*Fs)(nil)
+	_ fs.DirMover         = (*Fs)(nil)
+	_ fs.Commander        = (*Fs)(nil)
+	_ fs.PutUncheckeder   = (*Fs)(nil)
+	_ fs.PutStreamer      = (*Fs)(nil)
+	_ fs.CleanUpper       = (*Fs)(nil)
+	_ fs.UnWrapper        = (*Fs)(nil)
+	_ fs.ListRer          = (*Fs)(nil)
+	_ fs.Abouter          = (*Fs)(nil)
+	_ fs.Wrapper          = (*Fs)(nil)
+	_ fs.MergeDirser      = (*Fs)(nil)
+	_ fs.DirCacheFlusher  = (*Fs)(nil)
+	_ fs.ChangeNotifier   = (*Fs)(nil)
+	_ fs.PublicLinker     = (*Fs)(nil)
+	_ fs.UserInfoer       = (*Fs)(nil)
+	_ fs.Disconnecter     = (*Fs)(nil)
+	_ fs.Shutdowner       = (*Fs)(nil)
+	_ fs.DirSetModTimer   = (*Fs)(nil)
+	_ fs.DirMetadataer    = (*Fs)(nil)
+	_ fs.DirSetMetadataer = (*Fs)(nil)
+	_ fs.FullObjectInfo   = (*ObjectInfo)(nil)
+	_ fs.FullObject       = (*Object)(nil)
 )
@@ -6,12 +6,17 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/walk"
 	"github.com/rclone/rclone/lib/random"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -51,6 +56,9 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 	if wrap {
 		path = "_wrap"
 	}
+	if f.cipher.age != nil {
+		t.Skip("can't encrypt with a known nonce in the age format")
+	}
 
 	localFs := makeTempLocalFs(t)
 
@@ -59,7 +67,8 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 	// encrypt the data
 	inBuf := bytes.NewBufferString(contents)
 	var outBuf bytes.Buffer
-	enc, err := f.cipher.newEncrypter(inBuf, nil)
+	size := int64(len(contents))
+	enc, err := f.cipher.newPaddedEncrypter(inBuf, nil, size, f.cipher.paddedSizeFor(size))
 	require.NoError(t, err)
 	nonce := enc.nonce // read the nonce at the start
 	_, err = io.Copy(&outBuf, enc)
@@ -100,6 +109,9 @@ func testComputeHash(t *testing.T, f *Fs) {
 	if hashType == hash.None {
 		t.Skipf("%v: does not support hashes", f.Fs)
 	}
+	if f.cipher.age != nil {
+		t.Skip("can't compute hashes in the age format")
+	}
 
 	localFs := makeTempLocalFs(t)
 
@@ -125,3 +137,245 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("ObjectInfoWrap", func(t *testing.T) { testObjectInfo(t, f, true) })
 	t.Run("ComputeHash", func(t *testing.T) { testComputeHash(t, f) })
 }
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []string{"standard", "off"} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			newCryptFs := func(m configmap.Simple) *Fs {
+				m["remote"] = dir
+				m["filename_encryption"] = mode
+				m["filename_encoding"] = "base32"
+				m["directory_name_encryption"] = "true"
+				m["suffix"] = ".bin"
+				f, err := NewFs(ctx, "TestRotate", "", m)
+				require.NoError(t, err)
+				return f.(*Fs)
+			}
+			oldFs := newCryptFs(configmap.Simple{
+				"password": obscure.MustObscure("old"),
+			})
+			newFs := newCryptFs(configmap.Simple{
+				"password":      obscure.MustObscure("new"),
+				"old_passwords": obscure.MustObscure("older") + "," + obscure.MustObscure("old"),
+			})
+
+			contents := random.String(100)
+			t1 := time.Date(2012, time.December, 17, 18, 32, 31, 0, time.UTC)
+			for _, remote := range []string{"dir/file1", "file2"} {
+				_, err := oldFs.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo(remote, t1, int64(len(contents)), true, nil, nil))
+				require.NoError(t, err)
+			}
+
+			// The old files can be found and listed before rotating
+			for _, remote := range []string{"dir/file1", "file2"} {
+				o, err := newFs.NewObject(ctx, remote)
+				require.NoError(t, err, remote)
+				assert.Equal(t, remote, o.Remote())
+			}
+			entries, err := newFs.List(ctx, "")
+			require.NoError(t, err)
+			assert.Equal(t, "[dir file2]", fmt.Sprint(entries))
+			entries, err = newFs.List(ctx, "dir")
+			require.NoError(t, err)
+			assert.Equal(t, "[dir/file1]", fmt.Sprint(entries))
+
+			// cryptcheck can check the old files
+			localFs := makeTempLocalFs(t)
+			localObj := uploadFile(t, localFs, "file2", contents)
+			o, err := newFs.NewObject(ctx, "file2")
+			require.NoError(t, err)
+			computedHash, err := newFs.ComputeHash(ctx, o.(*Object), localObj, hash.MD5)
+			require.NoError(t, err)
+			wantHash, err := o.(*Object).Object.Hash(ctx, hash.MD5)
+			require.NoError(t, err)
+			assert.Equal(t, wantHash, computedHash)
+
+			stats, err := newFs.rotate(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, rotateStats{Rotated: 2}, *stats)
+
+			for _, remote := range []string{"dir/file1", "file2"} {
+				o, err := newFs.NewObject(ctx, remote)
+				require.NoError(t, err)
+				in, err := o.Open(ctx)
+				require.NoError(t, err)
+				got, err := io.ReadAll(in)
+				require.NoError(t, err)
+				require.NoError(t, in.Close())
+				assert.Equal(t, contents, string(got), remote)
+				assert.Equal(t, t1, o.ModTime(ctx).UTC(), remote)
+			}
+
+			// The old directory has gone
+			entries, err = newFs.Fs.List(ctx, "")
+			require.NoError(t, err)
+			assert.Equal(t, 2, len(entries))
+
+			// A temporary object left by an interrupted rotation
+			tempRemote := newFs.cipher.EncryptFileName("file2") + rotateTempSuffix
+			_, err = newFs.Fs.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo(tempRemote, t1, int64(len(contents)), true, nil, nil))
+			require.NoError(t, err)
+
+			// Running again removes it and finds nothing else to do
+			stats, err = newFs.rotate(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, rotateStats{Current: 2, Cleaned: 1}, *stats)
+			_, err = newFs.Fs.NewObject(ctx, tempRemote)
+			assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+			// A temporary object which has gone since it was
+			// listed isn't an error
+			temp, err := newFs.Fs.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo(tempRemote, t1, int64(len(contents)), true, nil, nil))
+			require.NoError(t, err)
+			require.NoError(t, temp.Remove(ctx))
+			removed, err := newFs.rotateRemoveTemp(ctx, temp)
+			require.NoError(t, err)
+			assert.False(t, removed)
+		})
+	}
+}
+
+func TestPaddedSize(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := NewFs(ctx, "TestPaddedSize", "", configmap.Simple{
+		"remote":              dir,
+		"password":            obscure.MustObscure("potato"),
+		"filename_encryption": "standard",
+		"filename_encoding":   "base32",
+		"suffix":              ".bin",
+		"size_padding":        "pow2",
+	})
+	require.NoError(t, err)
+	cf := f.(*Fs)
+
+	contents := random.String(100)
+	t1 := time.Date(2012, time.December, 17, 18, 32, 31, 0, time.UTC)
+	o, err := cf.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo("file", t1, int64(len(contents)), true, nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contents)), o.Size())
+
+	// The size is read while listing
+	entries, err := cf.List(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	listed := entries[0].(*Object)
+	assert.True(t, listed.sizeRead)
+	assert.Equal(t, int64(len(contents)), listed.Size())
+
+	// Corrupt the header of the underlying file
+	encrypted := cf.cipher.EncryptFileName("file")
+	underlying, err := cf.Fs.NewObject(ctx, encrypted)
+	require.NoError(t, err)
+	garbage := random.String(int(underlying.Size()))
+	require.NoError(t, underlying.Update(ctx, bytes.NewBufferString(garbage), object.NewStaticObjectInfo(encrypted, t1, int64(len(garbage)), true, nil, nil)))
+
+	// A size which can't be read is unknown and is an error for NewObject
+	entries, err = cf.List(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, int64(-1), entries[0].(*Object).Size())
+	_, err = cf.NewObject(ctx, "file")
+	assert.ErrorContains(t, err, "failed to read size from header")
+}
+
+func TestFlattenLayout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	newCryptFs := func(root string) *Fs {
+		f, err := NewFs(ctx, "TestFlattenLayout", root, configmap.Simple{
+			"remote":              dir,
+			"password":            obscure.MustObscure("potato"),
+			"filename_encryption": "standard",
+			"filename_encoding":   "base32",
+			"suffix":              ".bin",
+			"flatten_directories": "true",
+		})
+		if err != fs.ErrorIsFile {
+			require.NoError(t, err)
+		}
+		return f.(*Fs)
+	}
+	f := newCryptFs("")
+
+	contents := random.String(100)
+	t1 := time.Date(2012, time.December, 17, 18, 32, 31, 0, time.UTC)
+	for _, remote := range []string{"a/b/c/file1", "a/file2", "file3"} {
+		_, err := f.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo(remote, t1, int64(len(contents)), true, nil, nil))
+		require.NoError(t, err)
+	}
+
+	// The remote only has shard directories with files in
+	base := f.Fs.(*flatFs).store.base
+	require.NoError(t, walk.Walk(ctx, base, "", true, -1, func(path string, entries fs.DirEntries, err error) error {
+		require.NoError(t, err)
+		for _, entry := range entries {
+			depth := strings.Count(entry.Remote(), "/")
+			switch entry.(type) {
+			case fs.Directory:
+				assert.Equal(t, 0, depth, entry.Remote())
+				assert.Equal(t, 2, len(entry.Remote()), entry.Remote())
+			case fs.Object:
+				assert.Equal(t, 1, depth, entry.Remote())
+			}
+		}
+		return nil
+	}))
+
+	// The tree can be listed from the root and from a subdirectory
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, "[a file3]", fmt.Sprint(entries))
+	sub := newCryptFs("a")
+	entries, err = sub.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, "[b file2]", fmt.Sprint(entries))
+
+	// A file as the root gives its parent
+	fileFs := newCryptFs("a/file2")
+	o, err := fileFs.NewObject(ctx, "file2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contents)), o.Size())
+
+	// Changes through one Fs are seen by the other
+	o, err = sub.NewObject(ctx, "b/c/file1")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	require.NoError(t, f.Rmdir(ctx, "a/b/c"))
+	entries, err = f.List(ctx, "a/b")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+	assert.Equal(t, fs.ErrorDirectoryNotEmpty, f.Rmdir(ctx, "a"))
+
+	// Writers in other processes have their own indexes
+	other := newCryptFs("")
+	otherFlat := other.Fs.(*flatFs)
+	otherFlat.store = &flatStore{base: otherFlat.store.base, key: otherFlat.store.key, dirs: map[string]*flatDir{}}
+	put := func(f *Fs, remote string) {
+		_, err := f.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo(remote, t1, int64(len(contents)), true, nil, nil))
+		require.NoError(t, err)
+	}
+	list := func(f *Fs, dir string) string {
+		entries, err := f.List(ctx, dir)
+		require.NoError(t, err)
+		sort.Sort(entries)
+		return fmt.Sprint(entries)
+	}
+
+	// Each writer keeps the entries the other added or removed since
+	// it read the index
+	put(f, "d/a")
+	assert.Equal(t, "[d/a]", list(other, "d"))
+	put(f, "d/b")
+	put(other, "d/c")
+	assert.Equal(t, "[d/a d/b d/c]", list(f, "d"))
+	assert.Equal(t, "[d/a d/b d/c]", list(other, "d"))
+	o, err = other.NewObject(ctx, "d/a")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	put(f, "d/e")
+	assert.Equal(t, "[d/b d/c d/e]", list(other, "d"))
+	assert.Equal(t, "[d/b d/c d/e]", list(f, "d"))
+}
@@ -0,0 +1,736 @@
+// Flattening of the directory tree into hashed shards
+
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"golang.org/x/sync/errgroup"
+)
+
+// flatHashSize is the number of bytes of the HMAC used to name
+// objects in a flattened tree
+const flatHashSize = 20
+
+// flatEncoding encodes the hashed names
+var flatEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// flatIndex is the encrypted index of a directory in a flattened tree
+//
+// It holds the encrypted names of the entries in the directory.
+type flatIndex struct {
+	Dirs  []string `json:"dirs"`
+	Files []string `json:"files"`
+}
+
+// flatEntry is an entry in a directory index
+type flatEntry struct {
+	name  string
+	isDir bool
+}
+
+// flatDir is the in memory index of a directory
+//
+// The fields other than saveMu are protected by flatStore.mu
+type flatDir struct {
+	dirs    map[string]struct{}
+	files   map[string]struct{}
+	pending map[flatEntry]bool // changes not saved yet, true to add
+	missing bool               // set if the index hasn't been written
+	saveMu  sync.Mutex         // held while saving
+}
+
+// newFlatDir makes a new empty directory index which needs saving
+func newFlatDir() *flatDir {
+	return &flatDir{
+		dirs:    map[string]struct{}{},
+		files:   map[string]struct{}{},
+		pending: map[flatEntry]bool{},
+		missing: true,
+	}
+}
+
+// entries returns the names in the index, isDir selecting the
+// directories or the files
+func (d *flatDir) entries(isDir bool) map[string]struct{} {
+	if isDir {
+		return d.dirs
+	}
+	return d.files
+}
+
+// apply adds or removes e from the index returning true if it changed
+func (d *flatDir) apply(e flatEntry, add bool) bool {
+	entries := d.entries(e.isDir)
+	_, found := entries[e.name]
+	if found == add {
+		return false
+	}
+	if add {
+		entries[e.name] = struct{}{}
+	} else {
+		delete(entries, e.name)
+	}
+	return true
+}
+
+// change adds or removes e from the index and records it to be saved,
+// returning true if it changed
+func (d *flatDir) change(e flatEntry, add bool) bool {
+	if !d.apply(e, add) {
+		return false
+	}
+	d.pending[e] = add
+	return true
+}
+
+// refresh replaces the entries with those of other then applies the
+// unsaved changes again
+func (d *flatDir) refresh(other *flatDir) {
+	d.dirs, d.files = other.dirs, other.files
+	for e, add := range d.pending {
+		d.apply(e, add)
+	}
+}
+
+// sortedNames returns the keys of names sorted
+func sortedNames(names map[string]struct{}) []string {
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// index returns the index to save
+func (d *flatDir) index() flatIndex {
+	return flatIndex{
+		Dirs:  sortedNames(d.dirs),
+		Files: sortedNames(d.files),
+	}
+}
+
+// flatStore holds the directory indexes for a flattened tree. It is
+// shared between all the flatFs using the same remote and key so
+// they see the same indexes.
+type flatStore struct {
+	base fs.Fs    // the remote the tree is stored in
+	key  [32]byte // key for hashing the names
+	mu   sync.Mutex
+	dirs map[string]*flatDir // indexes read or written, by encrypted path
+}
+
+// flatStoreKey identifies a flatStore
+type flatStoreKey struct {
+	base string
+	key  [32]byte
+}
+
+var (
+	flatStoresMu sync.Mutex
+	flatStores   = map[flatStoreKey]*flatStore{}
+)
+
+// getFlatStore returns the flatStore for the tree in base
+func getFlatStore(base fs.Fs, key [32]byte) *flatStore {
+	flatStoresMu.Lock()
+	defer flatStoresMu.Unlock()
+	storeKey := flatStoreKey{base: fs.ConfigString(base), key: key}
+	s := flatStores[storeKey]
+	if s == nil {
+		s = &flatStore{
+			base: base,
+			key:  key,
+			dirs: map[string]*flatDir{},
+		}
+		flatStores[storeKey] = s
+	}
+	return s
+}
+
+// hashPath returns the path in base of the object of kind ('f' for
+// file or 'd' for directory index) for the encrypted path p
+func (s *flatStore) hashPath(kind byte, p string) string {
+	mac := hmac.New(sha256.New, s.key[:])
+	_, _ = mac.Write([]byte{kind, 0})
+	_, _ = mac.Write([]byte(p))
+	name := flatEncoding.EncodeToString(mac.Sum(nil)[:flatHashSize])
+	return name[:2] + "/" + name
+}
+
+// filePath returns the path in base of the file with encrypted path p
+func (s *flatStore) filePath(p string) string {
+	return s.hashPath('f', p)
+}
+
+// indexPath returns the path in base of the index of the directory
+// with encrypted path p
+func (s *flatStore) indexPath(p string) string {
+	return s.hashPath('d', p)
+}
+
+// splitPath splits p into its parent directory and leaf name
+func splitPath(p string) (dir, leaf string) {
+	dir, leaf = path.Split(p)
+	return strings.TrimSuffix(dir, "/"), leaf
+}
+
+// readDir reads the index of dir from base, returning
+// fs.ErrorDirNotFound if it doesn't exist
+func (s *flatStore) readDir(ctx context.Context, c *Cipher, dir string) (d *flatDir, err error) {
+	o, err := s.base.NewObject(ctx, s.indexPath(dir))
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil, fs.ErrorDirNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := c.DecryptData(in)
+	if err != nil {
+		_ = in.Close()
+		return nil, fmt.Errorf("failed to decrypt directory index: %w", err)
+	}
+	defer fs.CheckClose(rc, &err)
+	var index flatIndex
+	err = json.NewDecoder(rc).Decode(&index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory index: %w", err)
+	}
+	d = &flatDir{
+		dirs:    make(map[string]struct{}, len(index.Dirs)),
+		files:   make(map[string]struct{}, len(index.Files)),
+		pending: map[flatEntry]bool{},
+	}
+	for _, name := range index.Dirs {
+		d.dirs[name] = struct{}{}
+	}
+	for _, name := range index.Files {
+		d.files[name] = struct{}{}
+	}
+	return d, nil
+}
+
+// cacheDir stores d as the index of dir, returning the index to use.
+//
+// If there is one cached already it is used instead so everyone
+// changes the same index, but refreshed from d keeping its unsaved
+// changes.
+func (s *flatStore) cacheDir(dir string, d *flatDir) *flatDir {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.dirs[dir]
+	if old == nil {
+		s.dirs[dir] = d
+		return d
+	}
+	if !d.missing {
+		old.refresh(d)
+		old.missing = false
+	}
+	return old
+}
+
+// loadDir returns the index of dir, reading it if it isn't cached
+func (s *flatStore) loadDir(ctx context.Context, c *Cipher, dir string) (*flatDir, error) {
+	s.mu.Lock()
+	d := s.dirs[dir]
+	s.mu.Unlock()
+	if d != nil {
+		return d, nil
+	}
+	d, err := s.readDir(ctx, c, dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.cacheDir(dir, d), nil
+}
+
+// saveDir writes the unsaved changes to the index of dir.
+//
+// The index is read from the remote again and the changes applied to
+// it before it is written, so changes made by other writers since it
+// was read are kept. Changes made while another save is in progress
+// are written by the next save. If the write fails the changes are
+// kept to be written by the next save.
+func (s *flatStore) saveDir(ctx context.Context, c *Cipher, dir string, d *flatDir) (err error) {
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+	s.mu.Lock()
+	pending, missing := d.pending, d.missing
+	d.pending = map[flatEntry]bool{}
+	s.mu.Unlock()
+	if len(pending) == 0 && !missing {
+		return nil
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Put back the changes which haven't been made again
+		s.mu.Lock()
+		for e, add := range pending {
+			if _, found := d.pending[e]; !found {
+				d.pending[e] = add
+			}
+		}
+		s.mu.Unlock()
+	}()
+	merged, err := s.readDir(ctx, c, dir)
+	if err == fs.ErrorDirNotFound {
+		merged = newFlatDir()
+	} else if err != nil {
+		return err
+	}
+	for e, add := range pending {
+		merged.apply(e, add)
+	}
+	data, err := json.Marshal(merged.index())
+	if err != nil {
+		return err
+	}
+	in, _, err := c.encryptData(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	src := object.NewStaticObjectInfo(s.indexPath(dir), time.Now(), c.EncryptedSize(int64(len(data))), true, nil, s.base)
+	_, err = s.base.Put(ctx, in, src)
+	if err != nil {
+		return fmt.Errorf("failed to write directory index: %w", err)
+	}
+	s.mu.Lock()
+	d.refresh(merged)
+	d.missing = false
+	s.mu.Unlock()
+	return nil
+}
+
+// makeDir returns the index of dir, creating it and adding it to its
+// parent if it doesn't exist.
+func (s *flatStore) makeDir(ctx context.Context, c *Cipher, dir string) (*flatDir, error) {
+	d, err := s.loadDir(ctx, c, dir)
+	if err == nil {
+		return d, nil
+	} else if err != fs.ErrorDirNotFound {
+		return nil, err
+	}
+	d = s.cacheDir(dir, newFlatDir())
+	err = s.saveDir(ctx, c, dir, d)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		parent, leaf := splitPath(dir)
+		err = s.addEntry(ctx, c, parent, leaf, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// addEntry adds name to the index of dir, making dir if necessary
+func (s *flatStore) addEntry(ctx context.Context, c *Cipher, dir, name string, isDir bool) error {
+	d, err := s.makeDir(ctx, c, dir)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	changed := d.change(flatEntry{name: name, isDir: isDir}, true)
+	s.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return s.saveDir(ctx, c, dir, d)
+}
+
+// removeEntry removes name from the index of dir if it is there
+func (s *flatStore) removeEntry(ctx context.Context, c *Cipher, dir, name string, isDir bool) error {
+	d, err := s.loadDir(ctx, c, dir)
+	if err == fs.ErrorDirNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	changed := d.change(flatEntry{name: name, isDir: isDir}, false)
+	s.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return s.saveDir(ctx, c, dir, d)
+}
+
+// flatFs stores a directory tree as a flat set of objects named by a
+// keyed hash of their encrypted paths, spread over shard directories
+// by the first two characters of the hash.
+//
+// Each directory has an encrypted index holding the encrypted names
+// of its entries which is used for listing. The indexes look the same
+// as files to the remote.
+//
+// It is used as the remote wrapped by crypt when flatten_directories
+// is set, so it is given encrypted paths.
+type flatFs struct {
+	store    *flatStore
+	cipher   *Cipher
+	root     string // encrypted path of the root
+	features *fs.Features
+}
+
+// newFlatFs makes a flattened tree stored in remote with the root at
+// the decrypted path rpath.
+//
+// If rpath is a file it returns the Fs for its parent with
+// fs.ErrorIsFile.
+func newFlatFs(ctx context.Context, remote string, c *Cipher, rpath string) (*flatFs, error) {
+	base, err := cache.Get(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	f := &flatFs{
+		store:  getFlatStore(base, c.nameKey),
+		cipher: c,
+		root:   c.EncryptDirName(rpath),
+	}
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f)
+	baseFeatures := base.Features()
+	if baseFeatures.Copy == nil {
+		f.features.Copy = nil
+	}
+	if baseFeatures.Move == nil {
+		f.features.Move = nil
+	}
+	if baseFeatures.PutStream == nil {
+		f.features.PutStream = nil
+	}
+	if baseFeatures.About == nil {
+		f.features.About = nil
+	}
+	if rpath != "" {
+		// Check to see if the root is a file
+		_, err = base.NewObject(ctx, f.store.filePath(c.EncryptFileName(rpath)))
+		if err == nil {
+			parent, _ := splitPath(rpath)
+			f.root = c.EncryptDirName(parent)
+			return f, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// Name of the remote
+func (f *flatFs) Name() string {
+	return f.store.base.Name()
+}
+
+// Root of the remote
+func (f *flatFs) Root() string {
+	return f.store.base.Root()
+}
+
+// String returns a description of the Fs
+func (f *flatFs) String() string {
+	return fmt.Sprintf("Flattened %s", f.store.base)
+}
+
+// Precision of the remote
+func (f *flatFs) Precision() time.Duration {
+	return f.store.base.Precision()
+}
+
+// Hashes returns the supported hash types
+func (f *flatFs) Hashes() hash.Set {
+	return f.store.base.Hashes()
+}
+
+// Features returns the optional features of this Fs
+func (f *flatFs) Features() *fs.Features {
+	return f.features
+}
+
+// absPath returns the encrypted path of remote from the top of the tree
+func (f *flatFs) absPath(remote string) string {
+	return path.Join(f.root, remote)
+}
+
+// List the objects and directories in dir into entries.
+//
+// The index of dir is read from the remote each time.
+func (f *flatFs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	s := f.store
+	abs := f.absPath(dir)
+	d, err := s.readDir(ctx, f.cipher, abs)
+	if err != nil {
+		return nil, err
+	}
+	d = s.cacheDir(abs, d)
+	s.mu.Lock()
+	index := d.index()
+	s.mu.Unlock()
+	for _, name := range index.Dirs {
+		entries = append(entries, fs.NewDir(path.Join(dir, name), time.Time{}))
+	}
+	objects := make([]fs.Object, len(index.Files))
+	ci := fs.GetConfig(ctx)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(ci.Checkers)
+	for i, name := range index.Files {
+		i, name := i, name
+		g.Go(func() error {
+			remote := path.Join(dir, name)
+			o, err := f.NewObject(gCtx, remote)
+			if errors.Is(err, fs.ErrorObjectNotFound) {
+				fs.Debugf(f, "Skipping %q in directory index which is missing", remote)
+				return nil
+			} else if err != nil {
+				return err
+			}
+			objects[i] = o
+			return nil
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objects {
+		if o != nil {
+			entries = append(entries, o)
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote
+func (f *flatFs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.store.base.NewObject(ctx, f.store.filePath(f.absPath(remote)))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+// addEntry adds the file at the encrypted path abs to the index of
+// its directory.
+//
+// This is done before the file is written so a failure can't leave a
+// file which isn't in any index. An entry without a file is skipped
+// when listing.
+func (f *flatFs) addEntry(ctx context.Context, abs string) error {
+	dir, leaf := splitPath(abs)
+	return f.store.addEntry(ctx, f.cipher, dir, leaf, false)
+}
+
+// put adds src to the index of its directory and uploads it with put
+func (f *flatFs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption, put putFn) (fs.Object, error) {
+	remote := src.Remote()
+	abs := f.absPath(remote)
+	err := f.addEntry(ctx, abs)
+	if err != nil {
+		return nil, err
+	}
+	o, err := put(ctx, in, fs.NewOverrideRemote(src, f.store.filePath(abs)), options...)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (f *flatFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, options, f.store.base.Put)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *flatFs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, options, f.store.base.Features().PutStream)
+}
+
+// Mkdir makes the directory dir and its parents
+func (f *flatFs) Mkdir(ctx context.Context, dir string) error {
+	_, err := f.store.makeDir(ctx, f.cipher, f.absPath(dir))
+	return err
+}
+
+// Rmdir removes the directory dir if it is empty
+func (f *flatFs) Rmdir(ctx context.Context, dir string) error {
+	s := f.store
+	abs := f.absPath(dir)
+	// Read the index again to see entries added by other writers
+	d, err := s.readDir(ctx, f.cipher, abs)
+	if err != nil {
+		return err
+	}
+	d = s.cacheDir(abs, d)
+	s.mu.Lock()
+	empty := len(d.dirs) == 0 && len(d.files) == 0
+	s.mu.Unlock()
+	if !empty {
+		return fs.ErrorDirectoryNotEmpty
+	}
+	o, err := s.base.NewObject(ctx, s.indexPath(abs))
+	if err == nil {
+		err = o.Remove(ctx)
+	}
+	if err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+		return fmt.Errorf("failed to remove directory index: %w", err)
+	}
+	s.mu.Lock()
+	delete(s.dirs, abs)
+	s.mu.Unlock()
+	if abs != "" {
+		parent, leaf := splitPath(abs)
+		return s.removeEntry(ctx, f.cipher, parent, leaf, true)
+	}
+	// Removing the top of the tree so tidy up any empty shard
+	// directories and the remote itself
+	shards, err := s.base.List(ctx, "")
+	if err != nil {
+		return nil
+	}
+	for _, shard := range shards {
+		if _, ok := shard.(fs.Directory); ok {
+			_ = s.base.Rmdir(ctx, shard.Remote())
+		}
+	}
+	_ = s.base.Rmdir(ctx, "")
+	return nil
+}
+
+// Copy src to this remote using server-side copy operations.
+func (f *flatFs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*flatObject)
+	if !ok || srcObj.f.store != f.store {
+		return nil, fs.ErrorCantCopy
+	}
+	abs := f.absPath(remote)
+	err := f.addEntry(ctx, abs)
+	if err != nil {
+		return nil, err
+	}
+	o, err := f.store.base.Features().Copy(ctx, srcObj.Object, f.store.filePath(abs))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+// Move src to this remote using server-side move operations.
+func (f *flatFs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*flatObject)
+	if !ok || srcObj.f.store != f.store {
+		return nil, fs.ErrorCantMove
+	}
+	abs := f.absPath(remote)
+	err := f.addEntry(ctx, abs)
+	if err != nil {
+		return nil, err
+	}
+	o, err := f.store.base.Features().Move(ctx, srcObj.Object, f.store.filePath(abs))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), srcObj.removeEntry(ctx)
+}
+
+// About gets quota information from the remote
+func (f *flatFs) About(ctx context.Context) (*fs.Usage, error) {
+	return f.store.base.Features().About(ctx)
+}
+
+// flatObject is an object in a flattened tree
+type flatObject struct {
+	fs.Object
+	f      *flatFs
+	remote string // encrypted path relative to the root of f
+}
+
+// newObject wraps o stored at remote
+func (f *flatFs) newObject(o fs.Object, remote string) *flatObject {
+	return &flatObject{
+		Object: o,
+		f:      f,
+		remote: remote,
+	}
+}
+
+// Fs returns the Fs the object is part of
+func (o *flatObject) Fs() fs.Info {
+	return o.f
+}
+
+// Remote returns the encrypted path of the object
+func (o *flatObject) Remote() string {
+	return o.remote
+}
+
+// String returns a description of the Object
+func (o *flatObject) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// UnWrap returns the object in the remote
+func (o *flatObject) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Update the object with the contents of in
+func (o *flatObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	err := o.f.addEntry(ctx, o.f.absPath(o.remote))
+	if err != nil {
+		return err
+	}
+	return o.Object.Update(ctx, in, fs.NewOverrideRemote(src, o.Object.Remote()), options...)
+}
+
+// removeEntry removes the object from the index of its directory
+func (o *flatObject) removeEntry(ctx context.Context) error {
+	dir, leaf := splitPath(o.f.absPath(o.remote))
+	return o.f.store.removeEntry(ctx, o.f.cipher, dir, leaf, false)
+}
+
+// Remove the object
+func (o *flatObject) Remove(ctx context.Context) error {
+	err := o.Object.Remove(ctx)
+	if err != nil {
+		return err
+	}
+	return o.removeEntry(ctx)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*flatFs)(nil)
+	_ fs.Copier          = (*flatFs)(nil)
+	_ fs.Mover           = (*flatFs)(nil)
+	_ fs.PutStreamer     = (*flatFs)(nil)
+	_ fs.Abouter         = (*flatFs)(nil)
+	_ fs.Object          = (*flatObject)(nil)
+	_ fs.ObjectUnWrapper = (*flatObject)(nil)
+)
@@ -0,0 +1,348 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+// rotateTempSuffix is added to the name of the new copy of an object
+// while it is uploaded if it encrypts to the same name as the old one
+const rotateTempSuffix = ".rclone-rotate"
+
+// rotateStats is the result of the rotate command
+type rotateStats struct {
+	Rotated int64 `json:"rotated"` // objects re-encrypted with the current key
+	Current int64 `json:"current"` // objects already using the current key
+	Cleaned int64 `json:"cleaned"` // temporary objects left by an interrupted rotation removed
+	Errors  int64 `json:"errors"`  // objects which failed
+}
+
+// rotateTemps is the set of temporary objects being uploaded by this
+// rotation
+type rotateTemps struct {
+	mu    sync.Mutex
+	names map[string]struct{}
+}
+
+// add records the temporary object remote as being uploaded
+func (t *rotateTemps) add(remote string) {
+	t.mu.Lock()
+	t.names[remote] = struct{}{}
+	t.mu.Unlock()
+}
+
+// remove records the temporary object remote as finished with
+func (t *rotateTemps) remove(remote string) {
+	t.mu.Lock()
+	delete(t.names, remote)
+	t.mu.Unlock()
+}
+
+// has returns true if remote is being uploaded by this rotation
+func (t *rotateTemps) has(remote string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, found := t.names[remote]
+	return found
+}
+
+// rotateObjectInfo is the source for re-encrypting an object with
+// the current key. It reads everything except the decrypted name and
+// size from the wrapped Object.
+type rotateObjectInfo struct {
+	*Object
+	remote string
+	size   int64
+}
+
+// Remote returns the decrypted remote path
+func (o *rotateObjectInfo) Remote() string {
+	return o.remote
+}
+
+// Size returns the decrypted size of the file
+func (o *rotateObjectInfo) Size() int64 {
+	return o.size
+}
+
+// rotate re-encrypts every object under the root of f which was
+// encrypted with an old key using the current key.
+//
+// Objects already using the current key are skipped, so if the
+// rotation is interrupted it can be resumed by running it again.
+func (f *Fs) rotate(ctx context.Context) (out *rotateStats, err error) {
+	if f.cipher.age != nil {
+		return nil, errors.New("can't rotate files in the age format - add the new keys to age_recipients instead")
+	}
+	if len(f.cipher.oldCiphers) == 0 {
+		return nil, errors.New("no old_passwords configured to rotate from")
+	}
+	ci := fs.GetConfig(ctx)
+	var (
+		stats   rotateStats
+		mu      sync.Mutex
+		lastErr error
+		oldDirs = map[string]struct{}{}
+		temps   = &rotateTemps{names: map[string]struct{}{}}
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(ci.Transfers)
+	err = walk.ListR(ctx, f.Fs, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			if f.isRotateTemp(o.Remote()) {
+				if temps.has(o.Remote()) {
+					// being uploaded by this rotation
+					return
+				}
+				// Left by an interrupted rotation - the
+				// object it was made from is rotated again
+				removed, err := f.rotateRemoveTemp(ctx, o)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					fs.Errorf(o, "Failed to remove temporary object: %v", err)
+					stats.Errors++
+					lastErr = err
+				} else if removed {
+					fs.Infof(o, "Removed temporary object left by an interrupted rotation")
+					stats.Cleaned++
+				}
+				return
+			}
+			g.Go(func() error {
+				rotated, err := f.rotateObject(gCtx, o, temps)
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err != nil:
+					fs.Errorf(o, "Failed to rotate: %v", err)
+					stats.Errors++
+					lastErr = err
+				case rotated:
+					stats.Rotated++
+					if dir := path.Dir(o.Remote()); dir != "." {
+						oldDirs[dir] = struct{}{}
+					}
+				default:
+					stats.Current++
+				}
+				fs.Infof(f, "Rotate progress: %d rotated, %d already current, %d errors", stats.Rotated, stats.Current, stats.Errors)
+				return nil
+			})
+		})
+		return nil
+	})
+	_ = g.Wait()
+	if err != nil {
+		return &stats, err
+	}
+	f.rotateRmdirs(ctx, oldDirs)
+	if lastErr != nil {
+		return &stats, fmt.Errorf("failed to rotate %d objects: last error: %w", stats.Errors, lastErr)
+	}
+	return &stats, nil
+}
+
+// rotateRemoveTemp removes the temporary object o left by an
+// interrupted rotation, returning true if it was removed.
+//
+// It isn't an error if o has gone already as it may have been
+// uploaded and renamed by this rotation since it was listed.
+func (f *Fs) rotateRemoveTemp(ctx context.Context, o fs.Object) (removed bool, err error) {
+	err = o.Remove(ctx)
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// isRotateTemp returns true if the underlying object remote is a
+// temporary object made by rotating an object.
+//
+// These can't be told apart from files without name encryption or a
+// suffix.
+func (f *Fs) isRotateTemp(remote string) bool {
+	if f.cipher.mode == NameEncryptionOff && f.cipher.encryptedSuffix == "" {
+		return false
+	}
+	return strings.HasSuffix(remote, rotateTempSuffix)
+}
+
+// rotateKey returns the index of the key the underlying object o was
+// encrypted with as used by f.cipher.keyCipher
+func (f *Fs) rotateKey(ctx context.Context, o fs.Object) (int, error) {
+	if !f.opt.NoDataEncryption {
+		// Read the header and the first block to find the key
+		in, err := o.Open(ctx, &fs.RangeOption{Start: 0, End: int64(filePaddedHeaderSize+blockSize) - 1})
+		if err != nil {
+			return -1, err
+		}
+		keyIndex, err := f.cipher.findKey(in)
+		if err != nil {
+			return -1, err
+		}
+		if keyIndex >= 0 {
+			return keyIndex, nil
+		}
+	}
+	// Empty or unencrypted files can only be told by their names
+	if _, keyIndex, err := f.cipher.decryptFileNameKey(o.Remote()); err == nil {
+		return keyIndex, nil
+	}
+	return -1, errors.New("can't decrypt with any key")
+}
+
+// rotateObject re-encrypts the underlying object o with the current
+// key if it was encrypted with an old key, returning true if it was.
+//
+// Any temporary object it uploads is recorded in temps while it exists.
+func (f *Fs) rotateObject(ctx context.Context, o fs.Object, temps *rotateTemps) (rotated bool, err error) {
+	keyIndex, err := f.rotateKey(ctx, o)
+	if err != nil {
+		return false, err
+	}
+	if keyIndex == 0 {
+		return false, nil
+	}
+	oldCipher := f.cipher.keyCipher(keyIndex)
+	remote, err := oldCipher.DecryptFileName(o.Remote())
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt name: %w", err)
+	}
+	newRemote := f.cipher.EncryptFileName(remote)
+
+	// Open the object decrypting it with the old key
+	in, err := o.Open(ctx)
+	if err != nil {
+		return false, err
+	}
+	size := o.Size()
+	var d *decrypter
+	if !f.opt.NoDataEncryption {
+		d, err = oldCipher.newDecrypter(in)
+		if err != nil {
+			return false, err
+		}
+		in = d
+		if d.size >= 0 {
+			size = d.size
+		} else {
+			size, err = oldCipher.DecryptedSize(size)
+			if err != nil {
+				_ = in.Close()
+				return false, err
+			}
+		}
+	}
+	src := &rotateObjectInfo{
+		Object: f.newObject(o),
+		remote: remote,
+		size:   size,
+	}
+
+	// If the name doesn't change upload to a temporary name so the
+	// old object isn't overwritten while it is being read
+	put := f.Fs.Put
+	sameName := newRemote == o.Remote()
+	if sameName {
+		tempRemote := newRemote + rotateTempSuffix
+		temps.add(tempRemote)
+		defer temps.remove(tempRemote)
+		put = func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+			return f.Fs.Put(ctx, in, fs.NewOverrideRemote(src, tempRemote), options...)
+		}
+	}
+	tr := accounting.Stats(ctx).NewTransfer(src)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	acc := tr.Account(ctx, in)
+	newObj, err := f.put(ctx, acc, src, nil, put)
+	closeErr := acc.Close()
+	if err != nil {
+		return false, fmt.Errorf("failed to upload re-encrypted object: %w", err)
+	}
+	if closeErr != nil {
+		return false, fmt.Errorf("failed to read object: %w", closeErr)
+	}
+	uploaded := newObj.(*Object).Object
+
+	// Swap the new object for the old one
+	if sameName {
+		err = f.rotateReplace(ctx, uploaded, newRemote)
+		if err != nil {
+			return false, fmt.Errorf("failed to replace object: %w", err)
+		}
+	} else {
+		err = o.Remove(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to remove old object: %w", err)
+		}
+	}
+	fs.Infof(o, "Rotated to current key as %q", newRemote)
+	return true, nil
+}
+
+// rotateReplace replaces the object at remote with the uploaded
+// object using a server-side move or copy
+func (f *Fs) rotateReplace(ctx context.Context, uploaded fs.Object, remote string) error {
+	if do := f.Fs.Features().Move; do != nil {
+		_, err := do(ctx, uploaded, remote)
+		return err
+	}
+	if do := f.Fs.Features().Copy; do != nil {
+		_, err := do(ctx, uploaded, remote)
+		if err != nil {
+			return err
+		}
+		return uploaded.Remove(ctx)
+	}
+	removeErr := uploaded.Remove(ctx)
+	if removeErr != nil {
+		fs.Errorf(uploaded, "Failed to remove temporary object: %v", removeErr)
+	}
+	return errors.New("remote can't move or copy objects server-side")
+}
+
+// rotateRmdirs removes the directories of the objects which were
+// renamed by rotating them, and their parents, if they are now
+// empty
+func (f *Fs) rotateRmdirs(ctx context.Context, oldDirs map[string]struct{}) {
+	dirs := make([]string, 0, len(oldDirs))
+	for dir := range oldDirs {
+		for ; dir != "." && dir != "/"; dir = path.Dir(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	// Remove the deepest directories first
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+	done := map[string]struct{}{}
+	for _, dir := range dirs {
+		if _, found := done[dir]; found {
+			continue
+		}
+		done[dir] = struct{}{}
+		if name, err := f.cipher.DecryptDirName(dir); err == nil && f.cipher.EncryptDirName(name) == dir {
+			// named with the current key so still in use
+			continue
+		}
+		err := f.Fs.Rmdir(ctx, dir)
+		if err != nil {
+			fs.Debugf(f, "Not removing old directory %q: %v", dir, err)
+		}
+	}
+}
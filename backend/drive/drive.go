@@ -2551,6 +2551,23 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	return newObject, nil
 }
 
+// Shortcut makes a shortcut to src at remote on this remote,
+// replacing any existing object there.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantShortcut
+func (f *Fs) Shortcut(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't make shortcut - not same remote type")
+		return nil, fs.ErrorCantShortcut
+	}
+	return srcObj.fs.createShortcut(ctx, srcObj.remote, f, remote, true)
+}
+
 // Purge deletes all the files and the container
 //
 // Optional interface: Only implement this if you have a way of
@@ -3042,6 +3059,14 @@ func (f *Fs) changeServiceAccountFile(ctx context.Context, file string) (err err
 //
 // Will not overwrite existing files
 func (f *Fs) makeShortcut(ctx context.Context, srcPath string, dstFs *Fs, dstPath string) (o fs.Object, err error) {
+	return f.createShortcut(ctx, srcPath, dstFs, dstPath, false)
+}
+
+// Create a shortcut from (f, srcPath) to (dstFs, dstPath)
+//
+// If replace is set then an existing file at dstPath is removed once
+// the shortcut has been made, otherwise it won't be overwritten.
+func (f *Fs) createShortcut(ctx context.Context, srcPath string, dstFs *Fs, dstPath string, replace bool) (o fs.Object, err error) {
 	srcFs := f
 	srcPath = strings.Trim(srcPath, "/")
 	dstPath = strings.Trim(dstPath, "/")
@@ -3076,8 +3101,13 @@ func (f *Fs) makeShortcut(ctx context.Context, srcPath string, dstFs *Fs, dstPat
 	srcID = actualID(srcID) // link to underlying object not to shortcut
 
 	// Find destination
-	_, err = dstFs.NewObject(ctx, dstPath)
-	if err != fs.ErrorObjectNotFound {
+	existingObject, err := dstFs.NewObject(ctx, dstPath)
+	if err == nil && replace {
+		// Drive allows duplicate names so remove it afterwards
+		if do, ok := existingObject.(fs.IDer); ok && actualID(do.ID()) == srcID {
+			return nil, errors.New("not replacing shortcut source with a shortcut to itself")
+		}
+	} else if err != fs.ErrorObjectNotFound {
 		if err == nil {
 			err = errors.New("existing file")
 		} else if err == fs.ErrorIsDir {
@@ -3108,6 +3138,12 @@ func (f *Fs) makeShortcut(ctx context.Context, srcPath string, dstFs *Fs, dstPat
 	if err != nil {
 		return nil, fmt.Errorf("shortcut creation failed: %w", err)
 	}
+	if existingObject != nil {
+		err = existingObject.Remove(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove existing object after making shortcut: %w", err)
+		}
+	}
 	if isDir {
 		return nil, nil
 	}
@@ -4018,6 +4054,7 @@ var (
 	_ fs.CleanUpper      = (*Fs)(nil)
 	_ fs.PutStreamer     = (*Fs)(nil)
 	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Shortcutter     = (*Fs)(nil)
 	_ fs.Mover           = (*Fs)(nil)
 	_ fs.DirMover        = (*Fs)(nil)
 	_ fs.Commander       = (*Fs)(nil)
@@ -0,0 +1,462 @@
+// Package erasure implements a backend which stripes files over
+// several remotes with Reed-Solomon erasure coding
+package erasure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"golang.org/x/sync/errgroup"
+)
+
+// Register with Fs
+func init() {
+	fsi := &fs.RegInfo{
+		Name:        "erasure",
+		Description: "Stripe files over several remotes with erasure coding",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "upstreams",
+			Help: `Upstreams to store the shards of each file on.
+
+These should be in the form
+
+    remote:path remote2:path remote3:path
+
+Embedded spaces can be added using quotes
+
+    "remote:path with space" "remote2:path with space"
+
+Each file is split into one data shard for each upstream except for
+the last parity_shards which get the parity shards. The upstreams must
+not be reordered once files have been written.`,
+			Required: true,
+			Default:  fs.SpaceSepList(nil),
+		}, {
+			Name: "parity_shards",
+			Help: `Number of upstreams holding parity shards.
+
+Files can be read and written while up to this many upstreams are
+unavailable. The rest of the upstreams hold data shards so the space used is the size of
+the files multiplied by the number of upstreams divided by the number
+of data shards.`,
+			Default: 1,
+		}, {
+			Name: "block_size",
+			Help: `Size of the blocks files are split into on each upstream.
+
+Files are encoded in stripes of one block per data shard, so this is
+the smallest amount read from each upstream. Changing it only affects
+new files.`,
+			Default:  fs.SizeSuffix(64 * 1024),
+			Advanced: true,
+		}},
+	}
+	fs.Register(fsi)
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams    fs.SpaceSepList `config:"upstreams"`
+	ParityShards int             `config:"parity_shards"`
+	BlockSize    fs.SizeSuffix   `config:"block_size"`
+}
+
+// Fs represents files striped over several upstreams
+type Fs struct {
+	name      string       // name of this remote
+	root      string       // the path we are working on
+	opt       Options      // options for this Fs
+	features  *fs.Features // optional features
+	upstreams []fs.Fs      // upstreams, data shards first
+	k, m      int          // number of data and parity shards
+	codec     *rsCodec     // erasure code
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(opt.Upstreams) < 2 {
+		return nil, errors.New("erasure needs at least two upstreams - check the value of the upstreams setting")
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point erasure remote at itself - check the value of the upstreams setting")
+		}
+	}
+	if opt.ParityShards < 1 || opt.ParityShards >= len(opt.Upstreams) {
+		return nil, fmt.Errorf("parity_shards must be at least 1 and less than the %d upstreams", len(opt.Upstreams))
+	}
+	if opt.BlockSize <= 0 || opt.BlockSize > 1<<30 {
+		return nil, errors.New("block_size must be more than 0 and at most 1 GiB")
+	}
+	f := &Fs{
+		name: name,
+		root: strings.Trim(root, "/"),
+		opt:  *opt,
+		k:    len(opt.Upstreams) - opt.ParityShards,
+		m:    opt.ParityShards,
+	}
+	f.codec, err = newRSCodec(f.k, f.m)
+	if err != nil {
+		return nil, err
+	}
+	f.upstreams, err = f.newUpstreams(ctx, f.root)
+	var fserr error
+	if err == fs.ErrorIsFile {
+		// The root points to a file so use its parent
+		f.root = path.Dir(f.root)
+		if f.root == "." {
+			f.root = ""
+		}
+		f.upstreams, err = f.newUpstreams(ctx, f.root)
+		fserr = fs.ErrorIsFile
+	}
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, err
+	}
+	// Keep the upstreams in the cache while f is in use
+	for _, u := range f.upstreams {
+		cache.Pin(u)
+	}
+	upstreams := f.upstreams
+	runtime.SetFinalizer(f, func(*Fs) {
+		for _, u := range upstreams {
+			cache.Unpin(u)
+		}
+	})
+
+	f.features = (&fs.Features{
+		CaseInsensitive:         false,
+		DuplicateFiles:          false,
+		CanHaveEmptyDirectories: true,
+		BucketBased:             true,
+	}).Fill(ctx, f)
+	for _, u := range f.upstreams {
+		f.features = f.features.Mask(ctx, u)
+	}
+	// show that we wrap other backends
+	f.features.Overlay = true
+	return f, fserr
+}
+
+// newUpstreams makes the upstream Fs at root, returning
+// fs.ErrorIsFile if root is a file on any of them
+func (f *Fs) newUpstreams(ctx context.Context, root string) ([]fs.Fs, error) {
+	upstreams := make([]fs.Fs, len(f.opt.Upstreams))
+	isFile := make([]bool, len(upstreams))
+	g, gCtx := errgroup.WithContext(ctx)
+	for i, remote := range f.opt.Upstreams {
+		i, remote := i, remote
+		g.Go(func() error {
+			uFs, err := cache.Get(gCtx, fspath.JoinRootPath(remote, root))
+			if err == fs.ErrorIsFile {
+				isFile[i] = true
+			} else if err != nil {
+				return fmt.Errorf("failed to create upstream %q: %w", remote, err)
+			}
+			upstreams[i] = uFs
+			return nil
+		})
+	}
+	err := g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range isFile {
+		if file {
+			return upstreams, fs.ErrorIsFile
+		}
+	}
+	return upstreams, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("erasure root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the greatest precision of all the upstreams
+func (f *Fs) Precision() time.Duration {
+	var greatestPrecision time.Duration
+	for _, u := range f.upstreams {
+		if u.Precision() > greatestPrecision {
+			greatestPrecision = u.Precision()
+		}
+	}
+	return greatestPrecision
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (f *Fs) Hashes() hash.Set {
+	return hash.Set(hash.None)
+}
+
+// geometry returns the layout new files are written with
+func (f *Fs) geometry() geometry {
+	return geometry{k: f.k, m: f.m, block: int64(f.opt.BlockSize)}
+}
+
+// forEachUpstream runs fn on each upstream concurrently, returning
+// the errors by upstream
+func (f *Fs) forEachUpstream(fn func(i int, u fs.Fs) error) []error {
+	errs := make([]error, len(f.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range f.upstreams {
+		wg.Add(1)
+		go func(i int, u fs.Fs) {
+			defer wg.Done()
+			errs[i] = fn(i, u)
+		}(i, u)
+	}
+	wg.Wait()
+	return errs
+}
+
+// checkErrors returns the first error in errs which isn't ignored if
+// more than the number of parity shards failed, otherwise logging
+// them. It also returns how many errors were ignored.
+func (f *Fs) checkErrors(what string, errs []error, ignore error) (ignored int, err error) {
+	var failed []error
+	for i, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, ignore):
+			ignored++
+		default:
+			failed = append(failed, fmt.Errorf("%v: %w", f.upstreams[i], err))
+		}
+	}
+	if len(failed) > f.m {
+		return ignored, fmt.Errorf("%s failed on %d upstreams: %w", what, len(failed), failed[0])
+	}
+	for _, err := range failed {
+		fs.Errorf(f, "Ignoring failed upstream while %s: %v", what, err)
+	}
+	return ignored, nil
+}
+
+// List the objects and directories in dir into entries. The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	lists := make([]fs.DirEntries, len(f.upstreams))
+	errs := f.forEachUpstream(func(i int, u fs.Fs) (err error) {
+		lists[i], err = u.List(ctx, dir)
+		return err
+	})
+	notFound, err := f.checkErrors("listing", errs, fs.ErrorDirNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if notFound == len(f.upstreams) {
+		return nil, fs.ErrorDirNotFound
+	}
+
+	// Merge the listings, collecting the shards of each file
+	dirs := make(map[string]bool)
+	shards := make(map[string][]fs.Object)
+	var remotes []string
+	for i, list := range lists {
+		for _, entry := range list {
+			switch x := entry.(type) {
+			case fs.Object:
+				found := shards[x.Remote()]
+				if found == nil {
+					found = make([]fs.Object, len(f.upstreams))
+					shards[x.Remote()] = found
+					remotes = append(remotes, x.Remote())
+				}
+				found[i] = x
+			case fs.Directory:
+				if !dirs[x.Remote()] {
+					dirs[x.Remote()] = true
+					entries = append(entries, fs.NewDirCopy(ctx, x))
+				}
+			}
+		}
+	}
+	for _, remote := range remotes {
+		o, err := f.newObject(ctx, remote, shards[remote])
+		if err != nil {
+			fs.Errorf(remote, "Ignoring file: %v", err)
+			continue
+		}
+		entries = append(entries, o)
+	}
+	return entries, nil
+}
+
+// findShards finds the shards of remote on each upstream
+func (f *Fs) findShards(ctx context.Context, remote string) ([]fs.Object, error) {
+	shards := make([]fs.Object, len(f.upstreams))
+	errs := f.forEachUpstream(func(i int, u fs.Fs) (err error) {
+		shards[i], err = u.NewObject(ctx, remote)
+		return err
+	})
+	isDir := 0
+	for i, err := range errs {
+		if errors.Is(err, fs.ErrorIsDir) {
+			isDir++
+			errs[i] = fs.ErrorObjectNotFound
+		}
+	}
+	if isDir == len(f.upstreams) {
+		return nil, fs.ErrorIsDir
+	}
+	_, err := f.checkErrors("finding shards", errs, fs.ErrorObjectNotFound)
+	return shards, err
+}
+
+// NewObject finds the Object at remote. If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	shards, err := f.findShards(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(ctx, remote, shards)
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	// Overwrite any shards which are already there
+	shards, err := f.findShards(ctx, src.Remote())
+	if err != nil {
+		return nil, err
+	}
+	o := &Object{
+		f:      f,
+		remote: src.Remote(),
+	}
+	err = o.write(ctx, in, src, shards, options...)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	errs := f.forEachUpstream(func(i int, u fs.Fs) error {
+		return u.Mkdir(ctx, dir)
+	})
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%v: %w", f.upstreams[i], err)
+		}
+	}
+	return nil
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	errs := f.forEachUpstream(func(i int, u fs.Fs) error {
+		return u.Rmdir(ctx, dir)
+	})
+	notFound := 0
+	for i, err := range errs {
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			notFound++
+		} else if err != nil {
+			return fmt.Errorf("%v: %w", f.upstreams[i], err)
+		}
+	}
+	if notFound == len(f.upstreams) {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "repair",
+	Short: "Rebuild missing or damaged shards",
+	Long: `This reads every shard of every file in full and rebuilds the
+shards which are missing, the wrong size, left over from an older
+write or fail their block checksums from the remaining ones. Each file
+needs as many good shards as there are data shards to be repaired.
+
+Usage Example:
+
+    rclone backend repair erasure:
+    rclone rc backend/command command=repair fs=erasure:
+
+It returns a summary with the number of files checked, the number of
+files and shards repaired and a list of errors. Use --dry-run to see
+what would be repaired.
+`,
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "repair":
+		return f.repair(ctx)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs        = (*Fs)(nil)
+	_ fs.Commander = (*Fs)(nil)
+)
@@ -0,0 +1,315 @@
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeErasure makes an erasure Fs over n local directories
+func makeErasure(ctx context.Context, t *testing.T, n, parity int) *Fs {
+	var dirs []string
+	for i := 0; i < n; i++ {
+		dirs = append(dirs, t.TempDir())
+	}
+	f, err := fs.NewFs(ctx, fmt.Sprintf(":erasure,parity_shards=%d,block_size=10,upstreams='%s':", parity, strings.Join(dirs, " ")))
+	require.NoError(t, err)
+	return f.(*Fs)
+}
+
+// readAll reads o with the options
+func readAll(ctx context.Context, t *testing.T, o fs.Object, options ...fs.OpenOption) string {
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func TestHeader(t *testing.T) {
+	h := &header{k: 3, m: 2, index: 4, block: 65536, size: 1 << 40, gen: 0x0123456789abcdef}
+	buf := h.marshal()
+	assert.Equal(t, headerSize, len(buf))
+	got, err := parseHeader(buf)
+	require.NoError(t, err)
+	assert.Equal(t, h, got)
+
+	buf[20] ^= 1
+	_, err = parseHeader(buf)
+	assert.Error(t, err)
+	_, err = parseHeader([]byte("hello"))
+	assert.Error(t, err)
+}
+
+func TestGeometry(t *testing.T) {
+	g := geometry{k: 3, m: 2, block: 10}
+	for size := int64(0); size <= 100; size++ {
+		var data int64
+		for i := 0; i < g.k; i++ {
+			data += g.shardSize(size, i) - headerSize - g.stripes(size)*blockCRCSize
+		}
+		assert.Equal(t, size, data, "size %d", size)
+		for s := int64(0); s < g.stripes(size); s++ {
+			assert.LessOrEqual(t, g.blockLen(size, s), g.block)
+			assert.Equal(t, g.blockLen(size, s), g.shardLen(size, s, g.k))
+		}
+	}
+	assert.Equal(t, int64(0), g.stripes(0))
+	assert.Equal(t, int64(1), g.stripes(30))
+	assert.Equal(t, int64(2), g.stripes(31))
+	assert.Equal(t, int64(1), g.blockLen(31, 1))
+
+	// The size can be worked out from the shards
+	for size := int64(0); size <= 100; size++ {
+		sizes := []int64{g.shardSize(size, 0), g.shardSize(size, 1), g.shardSize(size, 2), -1, g.shardSize(size, 4)}
+		got, ok := g.sizeFromShards(sizes)
+		assert.True(t, ok, "size %d", size)
+		assert.Equal(t, size, got, "size %d", size)
+	}
+	_, ok := g.sizeFromShards([]int64{headerSize + 14, headerSize + 14, headerSize + 13, headerSize + 13, headerSize + 14})
+	assert.False(t, ok)
+}
+
+func TestDegraded(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeErasure(ctx, t, 5, 2)
+
+	contents := random.String(1000)
+	file := fstest.NewItem("dir/file.txt", contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+
+	// Remove a data and a parity shard
+	for _, i := range []int{1, 4} {
+		shard, err := f.upstreams[i].NewObject(ctx, file.Path)
+		require.NoError(t, err)
+		require.NoError(t, shard.Remove(ctx))
+	}
+	o, err := f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contents)), o.Size())
+	assert.Equal(t, contents, readAll(ctx, t, o))
+
+	// Ranges starting and ending part way through stripes
+	for _, r := range []struct{ start, end int64 }{{0, 0}, {5, 44}, {29, 30}, {123, 456}, {990, 999}, {995, -1}} {
+		want := contents[r.start:]
+		if r.end >= 0 {
+			want = contents[r.start : r.end+1]
+		}
+		assert.Equal(t, want, readAll(ctx, t, o, &fs.RangeOption{Start: r.start, End: r.end}), "%+v", r)
+	}
+	assert.Equal(t, contents[500:], readAll(ctx, t, o, &fs.SeekOption{Offset: 500}))
+
+	// One more and it can't be read
+	shard, err := f.upstreams[0].NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	require.NoError(t, shard.Remove(ctx))
+	_, err = f.NewObject(ctx, file.Path)
+	assert.Error(t, err)
+}
+
+func TestCorruptShard(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeErasure(ctx, t, 3, 1)
+
+	contents := random.String(100)
+	file := fstest.NewItem("file.txt", contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+
+	// Truncate a data shard so reading it fails part way through
+	shard, err := f.upstreams[0].NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	require.NoError(t, shard.Update(ctx, bytes.NewBufferString(""), object.NewStaticObjectInfo(file.Path, file.ModTime, 0, true, nil, nil)))
+
+	o, err := f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, contents, readAll(ctx, t, o))
+}
+
+// corruptShard flips a byte at offset in the shard of file on upstream i
+func corruptShard(ctx context.Context, t *testing.T, f *Fs, i int, file fstest.Item, offset int) {
+	shard, err := f.upstreams[i].NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	data := []byte(readAll(ctx, t, shard))
+	data[offset] ^= 0xff
+	require.NoError(t, shard.Update(ctx, bytes.NewBuffer(data), object.NewStaticObjectInfo(file.Path, file.ModTime, int64(len(data)), true, nil, nil)))
+}
+
+func TestCorruptBlock(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeErasure(ctx, t, 3, 1)
+
+	contents := random.String(100)
+	file := fstest.NewItem("file.txt", contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+
+	// Damage a data shard without changing its size
+	corruptShard(ctx, t, f, 1, file, headerSize+3)
+
+	o, err := f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, contents, readAll(ctx, t, o))
+
+	out, err := f.Command(ctx, "repair", nil, nil)
+	require.NoError(t, err)
+	res := out.(*repairResult)
+	assert.Equal(t, 1, res.Repaired)
+	assert.Equal(t, 1, res.Shards)
+	assert.Empty(t, res.Errors)
+
+	// The data shard is good again so it can be read without the other
+	o, err = f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	o.(*Object).shards[0] = nil
+	assert.Equal(t, contents, readAll(ctx, t, o))
+}
+
+func TestGenerations(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeErasure(ctx, t, 3, 1)
+
+	// Keep a shard of the first write
+	oldContents := random.String(100)
+	file := fstest.NewItem("file.txt", oldContents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &file, oldContents, true)
+	shard, err := f.upstreams[0].NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	oldShard := readAll(ctx, t, shard)
+
+	// Overwrite it with the same size and modification time then put
+	// the old shard back as a failed update would leave it
+	contents := random.String(100)
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+	shard, err = f.upstreams[0].NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	require.NoError(t, shard.Update(ctx, bytes.NewBufferString(oldShard), object.NewStaticObjectInfo(file.Path, file.ModTime, int64(len(oldShard)), true, nil, nil)))
+
+	o, err := f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, contents, readAll(ctx, t, o))
+
+	out, err := f.Command(ctx, "repair", nil, nil)
+	require.NoError(t, err)
+	res := out.(*repairResult)
+	assert.Equal(t, 1, res.Shards)
+	assert.Empty(t, res.Errors)
+	o, err = f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	o.(*Object).shards[1] = nil
+	assert.Equal(t, contents, readAll(ctx, t, o))
+}
+
+func TestFailedShardUpload(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeErasure(ctx, t, 3, 1)
+	modTime := fstest.Time("2001-02-03T04:05:06.499999999Z")
+
+	// A directory in the way makes the upload of a shard fail
+	require.NoError(t, f.upstreams[2].Mkdir(ctx, "file.txt"))
+	contents := random.String(100)
+	o, err := f.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo("file.txt", modTime, int64(len(contents)), true, nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, contents, readAll(ctx, t, o))
+	o, err = f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, contents, readAll(ctx, t, o))
+
+	// But more failures than parity shards fail the upload
+	for _, i := range []int{1, 2} {
+		require.NoError(t, f.upstreams[i].Mkdir(ctx, "file2.txt"))
+	}
+	_, err = f.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo("file2.txt", modTime, int64(len(contents)), true, nil, nil))
+	require.Error(t, err)
+	_, err = f.upstreams[0].NewObject(ctx, "file2.txt")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+}
+
+func TestRepair(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeErasure(ctx, t, 4, 2)
+
+	contents := random.String(123)
+	file := fstest.NewItem("dir/file.txt", contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+	empty := fstest.NewItem("empty.txt", "", fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &empty, "", true)
+
+	// Remove a shard and make another out of date
+	shard, err := f.upstreams[0].NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	require.NoError(t, shard.Remove(ctx))
+	old := fstest.NewItem(file.Path, "old", fstest.Time("2000-01-01T00:00:00Z"))
+	_ = fstests.PutTestContents(ctx, t, f.upstreams[3], &old, "old", true)
+
+	o, err := f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, contents, readAll(ctx, t, o))
+
+	out, err := f.Command(ctx, "repair", nil, nil)
+	require.NoError(t, err)
+	res := out.(*repairResult)
+	assert.Equal(t, 2, res.Checked)
+	assert.Equal(t, 1, res.Repaired)
+	assert.Equal(t, 2, res.Shards)
+	assert.Empty(t, res.Errors)
+
+	// Check each shard is now there and readable on its own
+	o, err = f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	for i, shard := range o.(*Object).shards {
+		require.NotNil(t, shard, i)
+		assert.Equal(t, file.ModTime, shard.ModTime(ctx).UTC(), i)
+		h, err := readShardHeader(ctx, shard)
+		require.NoError(t, err)
+		assert.Equal(t, i, h.index)
+	}
+	for i := range f.upstreams {
+		// Remove two of the other shards in turn
+		for j := range f.upstreams {
+			if j == i {
+				continue
+			}
+			o, err := f.NewObject(ctx, file.Path)
+			require.NoError(t, err)
+			obj := o.(*Object)
+			obj.shards[i], obj.shards[j] = nil, nil
+			assert.Equal(t, contents, readAll(ctx, t, obj), "without %d and %d", i, j)
+		}
+	}
+
+	// Nothing more to do
+	out, err = f.Command(ctx, "repair", nil, nil)
+	require.NoError(t, err)
+	res = out.(*repairResult)
+	assert.Equal(t, 0, res.Repaired)
+}
@@ -0,0 +1,78 @@
+// Test Erasure filesystem interface
+package erasure_test
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var (
+	unimplementableFsMethods     = []string{"UnWrap", "WrapFs", "SetWrapper", "UserInfo", "Disconnect", "OpenChunkWriter", "PublicLink", "Purge", "Copy", "Move", "DirMove", "PutStream", "ListR", "About", "CleanUp", "ChangeNotify", "PutUnchecked", "MergeDirs", "DirCacheFlush", "Shutdown", "DirSetModTime", "MkdirMetadata", "DirMetadata", "DirSetMetadata", "OpenWriterAt", "Shortcut", "HardLink"}
+	unimplementableObjectMethods = []string{"MimeType", "ID", "GetTier", "SetTier", "Metadata", "UnWrap"}
+)
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	fstests.Run(t, &fstests.Opt{
+		RemoteName:                   *fstest.RemoteName,
+		UnimplementableFsMethods:     unimplementableFsMethods,
+		UnimplementableObjectMethods: unimplementableObjectMethods,
+	})
+}
+
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	dirs := MakeTestDirs(t, 3)
+	upstreams := strings.Join(dirs, " ")
+	name := "TestErasureLocal"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "erasure"},
+			{Name: name, Key: "upstreams", Value: upstreams},
+			{Name: name, Key: "block_size", Value: "1Ki"},
+		},
+		QuickTestOK:                  true,
+		UnimplementableFsMethods:     unimplementableFsMethods,
+		UnimplementableObjectMethods: unimplementableObjectMethods,
+	})
+}
+
+func TestLocalParity(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	dirs := MakeTestDirs(t, 5)
+	upstreams := strings.Join(dirs, " ")
+	name := "TestErasureLocalParity"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "erasure"},
+			{Name: name, Key: "upstreams", Value: upstreams},
+			{Name: name, Key: "parity_shards", Value: "2"},
+			{Name: name, Key: "block_size", Value: "100"},
+		},
+		QuickTestOK:                  true,
+		UnimplementableFsMethods:     unimplementableFsMethods,
+		UnimplementableObjectMethods: unimplementableObjectMethods,
+	})
+}
+
+// MakeTestDirs makes directories in /tmp for testing
+func MakeTestDirs(t *testing.T, n int) (dirs []string) {
+	for i := 1; i <= n; i++ {
+		dir := t.TempDir()
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
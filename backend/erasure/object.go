@@ -0,0 +1,994 @@
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Each shard starts with a header
+const (
+	headerMagic   = "RCEC"
+	headerVersion = 1
+	headerSize    = 32
+)
+
+// Each block stored in a shard is followed by a checksum
+const blockCRCSize = 4
+
+// header describes the object a shard is part of
+type header struct {
+	k, m  int    // number of data and parity shards
+	index int    // index of this shard
+	block int64  // block size
+	size  int64  // size of the object
+	gen   uint64 // generation of the write, larger is newer
+}
+
+// newGeneration returns a generation for a new write
+//
+// It is the time of the write in the upper bits so later writes have
+// larger generations, and random in the lower bits so writes at the
+// same moment differ.
+func newGeneration() uint64 {
+	var buf [2]byte
+	_, _ = rand.Read(buf[:])
+	return uint64(time.Now().UnixNano())&^0xffff | uint64(binary.BigEndian.Uint16(buf[:]))
+}
+
+// marshal the header into headerSize bytes
+func (h *header) marshal() []byte {
+	buf := make([]byte, headerSize)
+	copy(buf, headerMagic)
+	buf[4] = headerVersion
+	buf[5] = byte(h.k - 1)
+	buf[6] = byte(h.m)
+	buf[7] = byte(h.index)
+	binary.BigEndian.PutUint32(buf[8:], uint32(h.block))
+	binary.BigEndian.PutUint64(buf[12:], uint64(h.size))
+	binary.BigEndian.PutUint64(buf[20:], h.gen)
+	binary.BigEndian.PutUint32(buf[28:], crc32.ChecksumIEEE(buf[:28]))
+	return buf
+}
+
+// parseHeader reads the header from the start of a shard
+func parseHeader(buf []byte) (*header, error) {
+	if len(buf) < headerSize || string(buf[:4]) != headerMagic {
+		return nil, errors.New("not an erasure shard")
+	}
+	if binary.BigEndian.Uint32(buf[28:]) != crc32.ChecksumIEEE(buf[:28]) {
+		return nil, errors.New("corrupted shard header")
+	}
+	if buf[4] != headerVersion {
+		return nil, fmt.Errorf("unsupported shard version %d", buf[4])
+	}
+	h := &header{
+		k:     int(buf[5]) + 1,
+		m:     int(buf[6]),
+		index: int(buf[7]),
+		block: int64(binary.BigEndian.Uint32(buf[8:])),
+		size:  int64(binary.BigEndian.Uint64(buf[12:])),
+		gen:   binary.BigEndian.Uint64(buf[20:]),
+	}
+	if h.block <= 0 || h.size < 0 {
+		return nil, errors.New("corrupted shard header")
+	}
+	return h, nil
+}
+
+// blockCRC returns the checksum of the data of the block of shard i
+// in stripe s of generation gen. Blocks from other writes or places
+// don't match even if their data is intact.
+func blockCRC(gen uint64, s int64, i int, data []byte) uint32 {
+	var buf [17]byte
+	binary.BigEndian.PutUint64(buf[0:], gen)
+	binary.BigEndian.PutUint64(buf[8:], uint64(s))
+	buf[16] = byte(i)
+	return crc32.Update(crc32.ChecksumIEEE(buf[:]), crc32.IEEETable, data)
+}
+
+// appendCRC appends the checksum of block to it, using the space
+// after it in the buffer
+func appendCRC(gen uint64, s int64, i int, block []byte) []byte {
+	crc := blockCRC(gen, s, i, block)
+	block = block[:len(block)+blockCRCSize]
+	binary.BigEndian.PutUint32(block[len(block)-blockCRCSize:], crc)
+	return block
+}
+
+// geometry describes how an object is laid out in its shards
+//
+// The object is split into stripes of k blocks, the last of which may
+// be shorter, and each stripe is encoded into k+m blocks, one for
+// each shard. The blocks of the last stripe are the length of the
+// remaining data divided by k rounded up. The data shards only store
+// the bytes of their blocks which hold data. Each block stored is
+// followed by its checksum.
+type geometry struct {
+	k, m  int   // number of data and parity shards
+	block int64 // block size
+}
+
+// stripeSize returns the amount of data in a full stripe
+func (g geometry) stripeSize() int64 {
+	return int64(g.k) * g.block
+}
+
+// stripes returns the number of stripes in an object of size
+func (g geometry) stripes(size int64) int64 {
+	return (size + g.stripeSize() - 1) / g.stripeSize()
+}
+
+// stripeLen returns the amount of data in stripe s of an object of size
+func (g geometry) stripeLen(size, s int64) int64 {
+	n := size - s*g.stripeSize()
+	if n > g.stripeSize() {
+		n = g.stripeSize()
+	}
+	return n
+}
+
+// blockLen returns the length of the blocks of stripe s
+func (g geometry) blockLen(size, s int64) int64 {
+	return (g.stripeLen(size, s) + int64(g.k) - 1) / int64(g.k)
+}
+
+// shardLen returns the number of bytes of data shard i stores for
+// stripe s, not including the checksum
+func (g geometry) shardLen(size, s int64, i int) int64 {
+	bl := g.blockLen(size, s)
+	if i >= g.k {
+		return bl
+	}
+	n := g.stripeLen(size, s) - int64(i)*bl
+	if n < 0 {
+		n = 0
+	} else if n > bl {
+		n = bl
+	}
+	return n
+}
+
+// shardOffset returns the offset of stripe s in a shard
+func (g geometry) shardOffset(s int64) int64 {
+	return headerSize + s*(g.block+blockCRCSize)
+}
+
+// shardSize returns the size of shard i of an object of size
+func (g geometry) shardSize(size int64, i int) int64 {
+	n := g.stripes(size)
+	if n == 0 {
+		return headerSize
+	}
+	return g.shardOffset(n-1) + g.shardLen(size, n-1, i) + blockCRCSize
+}
+
+// sizeFromShards works out the size of an object from the sizes of
+// its shards, returning false if they aren't consistent
+func (g geometry) sizeFromShards(sizes []int64) (size int64, ok bool) {
+	if len(sizes) < g.k || sizes[0] < headerSize {
+		return 0, false
+	}
+	// The first shard has data in every stripe
+	stripes := (sizes[0] - headerSize + g.block + blockCRCSize - 1) / (g.block + blockCRCSize)
+	for i := 0; i < g.k; i++ {
+		size += sizes[i] - headerSize - stripes*blockCRCSize
+	}
+	if size < 0 {
+		return 0, false
+	}
+	for i, shardSize := range sizes {
+		if shardSize >= 0 && shardSize != g.shardSize(size, i) {
+			return 0, false
+		}
+	}
+	return size, true
+}
+
+// Object describes a file striped over the upstreams
+type Object struct {
+	f       *Fs
+	remote  string
+	size    int64
+	modTime time.Time
+	shards  []fs.Object // shard on each upstream or nil if missing
+	stale   []fs.Object // out of date shard on each upstream or nil
+	mu      sync.Mutex  // protects the following
+	header  *header     // header of the newest generation if read
+	skip    []bool      // shards not of the newest generation if read
+}
+
+// newObject makes an Object from the shards found on each upstream
+//
+// Shards left behind by a failed update usually have a different
+// modification time, so it uses the newest set of shards with the
+// same modification time which has enough shards to read the object.
+// The generations in the shard headers decide which shards are read
+// when opening the object.
+func (f *Fs) newObject(ctx context.Context, remote string, found []fs.Object) (*Object, error) {
+	precision := f.Precision()
+	times := make([]time.Time, len(found))
+	present := 0
+	for i, shard := range found {
+		if shard != nil {
+			times[i] = shard.ModTime(ctx)
+			present++
+		}
+	}
+	if present == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	same := func(a, b time.Time) bool {
+		dt := a.Sub(b)
+		return -precision <= dt && dt <= precision
+	}
+	var (
+		modTime time.Time
+		ok      bool
+	)
+	for i, shard := range found {
+		if shard == nil {
+			continue
+		}
+		n := 0
+		for j, other := range found {
+			if other != nil && same(times[i], times[j]) {
+				n++
+			}
+		}
+		if n >= f.k && (!ok || times[i].After(modTime)) {
+			modTime, ok = times[i], true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("only %d shards found but %d are needed", present, f.k)
+	}
+
+	o := &Object{
+		f:       f,
+		remote:  remote,
+		modTime: modTime,
+		shards:  make([]fs.Object, len(found)),
+		stale:   make([]fs.Object, len(found)),
+	}
+	sizes := make([]int64, len(found))
+	for i, shard := range found {
+		sizes[i] = -1
+		if shard == nil {
+			continue
+		}
+		if same(times[i], modTime) {
+			o.shards[i] = shard
+			sizes[i] = shard.Size()
+		} else {
+			o.stale[i] = shard
+		}
+	}
+
+	// Work the size out from the sizes of the shards if they agree,
+	// otherwise read it from the headers
+	o.size, ok = f.geometry().sizeFromShards(sizes)
+	if !ok {
+		h, _, err := o.readHeaders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		o.size = h.size
+	}
+	return o, nil
+}
+
+// readHeaders reads the headers of all the shards found and picks the
+// newest generation with enough shards to read the object. It returns
+// its header and which shards aren't part of it.
+func (o *Object) readHeaders(ctx context.Context) (*header, []bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.header != nil {
+		return o.header, o.skip, nil
+	}
+	n := len(o.shards)
+	headers := make([]*header, n)
+	errs := o.f.forEachUpstream(func(i int, u fs.Fs) error {
+		shard := o.shards[i]
+		if shard == nil {
+			shard = o.stale[i]
+		}
+		if shard == nil {
+			return nil
+		}
+		h, err := readShardHeader(ctx, shard)
+		if err == nil && (h.k != o.f.k || h.m != o.f.m || h.index != i) {
+			err = fmt.Errorf("shard is %d of %d data and %d parity shards but expecting %d of %d and %d - check the upstreams setting", h.index, h.k, h.m, i, o.f.k, o.f.m)
+		}
+		if err != nil {
+			return err
+		}
+		headers[i] = h
+		return nil
+	})
+	var lastErr error
+	for i, err := range errs {
+		if err != nil {
+			fs.Errorf(o, "Failed to read header of shard %d: %v", i, err)
+			lastErr = err
+		}
+	}
+	var best *header
+	for _, h := range headers {
+		if h == nil || (best != nil && h.gen <= best.gen) {
+			continue
+		}
+		count := 0
+		for _, other := range headers {
+			if other != nil && other.gen == h.gen {
+				count++
+			}
+		}
+		if count >= o.f.k {
+			best = h
+		}
+	}
+	if best == nil {
+		err := fmt.Errorf("no write has the %d shards needed", o.f.k)
+		if lastErr != nil {
+			err = fmt.Errorf("%v: %w", err, lastErr)
+		}
+		return nil, nil, fmt.Errorf("failed to read shard headers: %w", err)
+	}
+	skip := make([]bool, n)
+	for i, h := range headers {
+		skip[i] = h == nil || h.gen != best.gen
+	}
+	o.header, o.skip = best, skip
+	return best, skip, nil
+}
+
+// readShardHeader reads the header of shard
+func readShardHeader(ctx context.Context, shard fs.Object) (*header, error) {
+	in, err := shard.Open(ctx, &fs.RangeOption{Start: 0, End: headerSize - 1})
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, headerSize)
+	_, err = io.ReadFull(in, buf)
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseHeader(buf)
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// ModTime returns the modification date of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.modTime
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// Hash returns the selected checksum of the file
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return "", hash.ErrUnsupported
+}
+
+// Storable returns whether object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, t time.Time) error {
+	errs := o.f.forEachUpstream(func(i int, u fs.Fs) error {
+		if o.shards[i] == nil {
+			return nil
+		}
+		return o.shards[i].SetModTime(ctx, t)
+	})
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%v: %w", o.f.upstreams[i], err)
+		}
+	}
+	o.modTime = t
+	return nil
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	errs := o.f.forEachUpstream(func(i int, u fs.Fs) error {
+		for _, shard := range []fs.Object{o.shards[i], o.stale[i]} {
+			if shard == nil {
+				continue
+			}
+			// A shard left for repair may already be gone
+			if err := shard.Remove(ctx); err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%v: %w", o.f.upstreams[i], err)
+		}
+	}
+	return nil
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+//
+// If existing is set then it updates the object rather than creating a new one.
+//
+// The new object may have been created if an error is returned
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	existing := make([]fs.Object, len(o.shards))
+	for i := range existing {
+		existing[i] = o.shards[i]
+		if existing[i] == nil {
+			existing[i] = o.stale[i]
+		}
+	}
+	return o.write(ctx, in, src, existing, options...)
+}
+
+// shardInfo describes a shard being uploaded
+type shardInfo struct {
+	fs.ObjectInfo
+	size int64
+}
+
+// Size returns the size of the shard
+func (s *shardInfo) Size() int64 {
+	return s.size
+}
+
+// Hash returns no hashes as they are for the whole object
+func (s *shardInfo) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return "", nil
+}
+
+// putShards uploads the shards of src with the indices given, writing
+// to the existing shard objects or making new ones. produce is called
+// to write the shards to the writers, which are nil for the shards
+// not being uploaded.
+//
+// It returns the objects and upload errors by shard, and the error
+// from produce.
+func (f *Fs) putShards(ctx context.Context, src fs.ObjectInfo, g geometry, size int64, indices []int, existing []fs.Object, produce func(out []io.Writer) error, options ...fs.OpenOption) (objs []fs.Object, errs []error, err error) {
+	n := len(f.upstreams)
+	out := make([]io.Writer, n)
+	pipes := make([]*io.PipeWriter, n)
+	objs = make([]fs.Object, n)
+	errs = make([]error, n)
+	var wg sync.WaitGroup
+	for _, i := range indices {
+		pr, pw := io.Pipe()
+		out[i], pipes[i] = pw, pw
+		info := &shardInfo{ObjectInfo: src, size: g.shardSize(size, i)}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if existing[i] != nil {
+				err = existing[i].Update(ctx, pr, info, options...)
+				if err == nil {
+					objs[i] = existing[i]
+				}
+			} else {
+				objs[i], err = f.upstreams[i].Put(ctx, pr, info, options...)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%v: %w", f.upstreams[i], err)
+			}
+			// Stop the producer writing to this shard if it failed
+			_ = pr.CloseWithError(err)
+		}(i)
+	}
+	err = produce(out)
+	for _, pw := range pipes {
+		if pw != nil {
+			_ = pw.CloseWithError(err)
+		}
+	}
+	wg.Wait()
+	return objs, errs, err
+}
+
+// failedShards returns the number of errs which are set and the
+// first of them
+func failedShards(errs []error) (failed int, err error) {
+	for _, shardErr := range errs {
+		if shardErr != nil {
+			if failed == 0 {
+				err = shardErr
+			}
+			failed++
+		}
+	}
+	return failed, err
+}
+
+// writeBlocks writes the blocks to the writers which aren't nil in
+// parallel. Writers which fail are set to nil as their uploads have
+// failed. It returns an error if fewer than need are left.
+func writeBlocks(out []io.Writer, blocks [][]byte, need int) error {
+	errs := make([]error, len(out))
+	var wg sync.WaitGroup
+	for i, w := range out {
+		if w == nil || len(blocks[i]) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, w io.Writer) {
+			defer wg.Done()
+			_, errs[i] = w.Write(blocks[i])
+		}(i, w)
+	}
+	wg.Wait()
+	left := 0
+	var lastErr error
+	for i, err := range errs {
+		if err != nil {
+			out[i] = nil
+			lastErr = err
+		}
+		if out[i] != nil {
+			left++
+		}
+	}
+	if left < need {
+		return fmt.Errorf("only %d shards left to write but %d are needed: %w", left, need, lastErr)
+	}
+	return nil
+}
+
+// write encodes in into shards overwriting the existing ones
+//
+// The write succeeds if no more than the number of parity shards
+// failed to upload. The shards which failed are left for repair.
+func (o *Object) write(ctx context.Context, in io.Reader, src fs.ObjectInfo, existing []fs.Object, options ...fs.OpenOption) error {
+	f := o.f
+	size := src.Size()
+	if size < 0 {
+		return errors.New("erasure can't upload files of unknown size")
+	}
+	g := f.geometry()
+	gen := newGeneration()
+	n := len(f.upstreams)
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	isNew := true
+	for _, shard := range existing {
+		isNew = isNew && shard == nil
+	}
+
+	objs, errs, err := f.putShards(ctx, src, g, size, indices, existing, func(out []io.Writer) error {
+		headers := make([][]byte, n)
+		for i := range headers {
+			headers[i] = (&header{k: g.k, m: g.m, index: i, block: g.block, size: size, gen: gen}).marshal()
+		}
+		if err := writeBlocks(out, headers, g.k); err != nil {
+			return err
+		}
+		data := make([]byte, g.stripeSize())
+		bufs := make([][]byte, n)
+		for i := range bufs {
+			bufs[i] = make([]byte, g.block+blockCRCSize)
+		}
+		blocks := make([][]byte, n)
+		for s := int64(0); s < g.stripes(size); s++ {
+			stripeLen := g.stripeLen(size, s)
+			_, err := io.ReadFull(in, data[:stripeLen])
+			if err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			bl := g.blockLen(size, s)
+			for i := range blocks {
+				blocks[i] = bufs[i][:bl]
+				if i < g.k {
+					copied := copy(blocks[i], data[min64(int64(i)*bl, stripeLen):min64(int64(i+1)*bl, stripeLen)])
+					for j := copied; j < len(blocks[i]); j++ {
+						blocks[i][j] = 0
+					}
+				}
+			}
+			f.codec.encode(blocks)
+			for i := range blocks {
+				blocks[i] = appendCRC(gen, s, i, blocks[i][:g.shardLen(size, s, i)])
+			}
+			err = writeBlocks(out, blocks, g.k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, options...)
+	failed, uploadErr := failedShards(errs)
+	if err == nil && failed > g.m {
+		err = fmt.Errorf("upload failed on %d upstreams but only %d may fail: %w", failed, g.m, uploadErr)
+	}
+	if err != nil {
+		if isNew {
+			// Don't leave the shards of a new object behind
+			for _, obj := range objs {
+				if obj != nil {
+					if removeErr := obj.Remove(ctx); removeErr != nil {
+						fs.Errorf(obj, "Failed to remove shard after failed upload: %v", removeErr)
+					}
+				}
+			}
+		}
+		return err
+	}
+	for _, shardErr := range errs {
+		if shardErr != nil {
+			fs.Errorf(o, "Ignoring failed upload of shard - run repair to rebuild it: %v", shardErr)
+		}
+	}
+
+	o.mu.Lock()
+	o.header, o.skip = nil, nil
+	o.mu.Unlock()
+	o.size = size
+	o.modTime = src.ModTime(ctx)
+	o.shards = objs
+	o.stale = make([]fs.Object, n)
+	for i := range objs {
+		if objs[i] == nil {
+			// may be left over from before
+			o.stale[i] = existing[i]
+		}
+	}
+	return nil
+}
+
+// min64 returns the smaller of a and b
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// stripeReader reads the blocks of stripes from k of the shards of
+// an object, replacing shards which fail with others
+type stripeReader struct {
+	ctx     context.Context
+	o       *Object
+	g       geometry
+	gen     uint64          // generation of the shards
+	want    int             // number of shards to read
+	next    int64           // next stripe to read
+	last    int64           // last stripe to read
+	readers []io.ReadCloser // open shards by index or nil
+	opened  []bool          // shards which have been opened
+	failed  []bool          // shards which failed or mustn't be read
+	bufs    [][]byte        // block buffer for each shard
+}
+
+// shard returns the shard of o on upstream i or nil
+func (o *Object) shard(i int) fs.Object {
+	if o.shards[i] != nil {
+		return o.shards[i]
+	}
+	return o.stale[i]
+}
+
+// newStripeReader opens want shards of o, or as many as possible if
+// fewer, to read stripes first to last, not using the shards in skip
+func newStripeReader(ctx context.Context, o *Object, h *header, first, last int64, skip []bool, want int) (*stripeReader, error) {
+	n := len(o.shards)
+	r := &stripeReader{
+		ctx:     ctx,
+		o:       o,
+		g:       geometry{k: h.k, m: h.m, block: h.block},
+		gen:     h.gen,
+		want:    want,
+		next:    first,
+		last:    last,
+		readers: make([]io.ReadCloser, n),
+		opened:  make([]bool, n),
+		failed:  make([]bool, n),
+		bufs:    make([][]byte, n),
+	}
+	for i := range r.bufs {
+		r.bufs[i] = make([]byte, h.block+blockCRCSize)
+		r.failed[i] = o.shard(i) == nil || skip[i]
+	}
+	if first > last {
+		// nothing to read
+		return r, nil
+	}
+	err := r.fill()
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// fill opens shards at the next stripe until want are open,
+// preferring the data shards as they don't need decoding
+func (r *stripeReader) fill() error {
+	open := 0
+	for i := range r.opened {
+		if r.opened[i] {
+			open++
+		}
+	}
+	for i := range r.opened {
+		if open >= r.want {
+			return nil
+		}
+		if r.opened[i] || r.failed[i] {
+			continue
+		}
+		err := r.openShard(i)
+		if err != nil {
+			fs.Errorf(r.o, "Failed to open shard %d: %v", i, err)
+			r.failed[i] = true
+			continue
+		}
+		open++
+	}
+	if open < r.g.k {
+		return fmt.Errorf("can only read %d shards but %d are needed", open, r.g.k)
+	}
+	return nil
+}
+
+// openShard opens shard i from the next stripe to the last
+func (r *stripeReader) openShard(i int) error {
+	size := r.o.size
+	start := r.g.shardOffset(r.next)
+	end := r.g.shardOffset(r.last) + r.g.shardLen(size, r.last, i) + blockCRCSize
+	in, err := r.o.shard(i).Open(r.ctx, &fs.RangeOption{Start: start, End: end - 1})
+	if err != nil {
+		return err
+	}
+	r.opened[i] = true
+	r.readers[i] = in
+	return nil
+}
+
+// closeShard closes shard i after it failed
+func (r *stripeReader) closeShard(i int) {
+	if r.readers[i] != nil {
+		_ = r.readers[i].Close()
+		r.readers[i] = nil
+	}
+	r.opened[i] = false
+	r.failed[i] = true
+}
+
+// readBlock reads the block of shard i in stripe s into block,
+// checking its checksum, and zeroes the rest of the block
+func (r *stripeReader) readBlock(s int64, i int, block []byte) error {
+	l := r.g.shardLen(r.o.size, s, i)
+	buf := r.bufs[i][:l+blockCRCSize]
+	_, err := io.ReadFull(r.readers[i], buf)
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(buf[l:]) != blockCRC(r.gen, s, i, buf[:l]) {
+		return fmt.Errorf("checksum mismatch in stripe %d", s)
+	}
+	for j := l; j < int64(len(block)); j++ {
+		block[j] = 0
+	}
+	return nil
+}
+
+// readStripe reads the next stripe returning its blocks. If all is
+// set all the blocks are returned otherwise only the data blocks are
+// valid. The blocks are only valid until the next call.
+func (r *stripeReader) readStripe(all bool) ([][]byte, error) {
+	if r.next > r.last {
+		return nil, io.EOF
+	}
+	size, s := r.o.size, r.next
+	bl := r.g.blockLen(size, s)
+	n := len(r.bufs)
+	blocks := make([][]byte, n)
+	for i := range blocks {
+		blocks[i] = r.bufs[i][:bl]
+	}
+	got := make([]bool, n)
+	for {
+		// Read the blocks of the stripe from the open shards
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := range r.opened {
+			if !r.opened[i] || got[i] {
+				continue
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = r.readBlock(s, i, blocks[i])
+			}(i)
+		}
+		wg.Wait()
+		count := 0
+		for i := range r.opened {
+			if !r.opened[i] || got[i] {
+				continue
+			}
+			if errs[i] != nil {
+				fs.Errorf(r.o, "Failed to read shard %d: %v", i, errs[i])
+				r.closeShard(i)
+				continue
+			}
+			got[i] = true
+		}
+		for i := range got {
+			if got[i] {
+				count++
+			}
+		}
+		if count >= r.g.k {
+			break
+		}
+		// Replace the failed shards starting at this stripe
+		err := r.fill()
+		if err != nil {
+			return nil, err
+		}
+	}
+	missing := make([]bool, n)
+	needDecode := false
+	for i := range missing {
+		missing[i] = !got[i]
+		if missing[i] && (all || i < r.g.k) {
+			needDecode = true
+		}
+	}
+	if needDecode {
+		err := r.o.f.codec.reconstruct(blocks, missing, !all)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.next++
+	return blocks, nil
+}
+
+// Close the open shards
+func (r *stripeReader) Close() error {
+	var err error
+	for i, in := range r.readers {
+		if in != nil {
+			if closeErr := in.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+			r.readers[i] = nil
+		}
+	}
+	return err
+}
+
+// objectReader reads a range of an object
+type objectReader struct {
+	r    *stripeReader
+	data []byte // data of the current stripe
+	buf  []byte // unread data of the current stripe
+	skip int64  // bytes to skip at the start of the first stripe
+	left int64  // bytes left to read
+}
+
+// Read data from the object
+func (r *objectReader) Read(p []byte) (n int, err error) {
+	for len(r.buf) == 0 {
+		if r.left <= 0 {
+			return 0, io.EOF
+		}
+		s := r.r.next
+		blocks, err := r.r.readStripe(false)
+		if err != nil {
+			return 0, err
+		}
+		g, size := r.r.g, r.r.o.size
+		stripeLen := 0
+		for i := 0; i < g.k; i++ {
+			stripeLen += copy(r.data[stripeLen:], blocks[i][:g.shardLen(size, s, i)])
+		}
+		r.buf = r.data[r.skip:stripeLen]
+		r.skip = 0
+		if int64(len(r.buf)) > r.left {
+			r.buf = r.buf[:r.left]
+		}
+		r.left -= int64(len(r.buf))
+	}
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close the object
+func (r *objectReader) Close() error {
+	return r.r.Close()
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.size)
+		case *fs.SeekOption:
+			offset = x.Offset
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if limit < 0 || offset+limit > o.size {
+		limit = o.size - offset
+	}
+	if limit <= 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	h, skip, err := o.readHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if h.size != o.size {
+		return nil, fmt.Errorf("shard header size %d doesn't match file size %d", h.size, o.size)
+	}
+	g := geometry{k: h.k, m: h.m, block: h.block}
+	first := offset / g.stripeSize()
+	last := (offset + limit - 1) / g.stripeSize()
+	r, err := newStripeReader(ctx, o, h, first, last, skip, g.k)
+	if err != nil {
+		return nil, err
+	}
+	return &objectReader{
+		r:    r,
+		data: make([]byte, g.stripeSize()),
+		skip: offset - first*g.stripeSize(),
+		left: limit,
+	}, nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object = (*Object)(nil)
+)
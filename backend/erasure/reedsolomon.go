@@ -0,0 +1,233 @@
+package erasure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Arithmetic in GF(2^8) with the polynomial x^8+x^4+x^3+x^2+1
+var (
+	gfExp [510]byte      // gfExp[i] is 2^i
+	gfLog [256]byte      // gfLog[x] is the i with 2^i == x for x != 0
+	gfMul [256][256]byte // gfMul[a][b] is a*b
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfExp[i+255] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			gfMul[a][b] = gfExp[int(gfLog[a])+int(gfLog[b])]
+		}
+	}
+}
+
+// gfInv returns the multiplicative inverse of a which must not be 0
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfPow returns a to the power n
+func gfPow(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])*n)%255]
+}
+
+// matrix is a matrix over GF(2^8) stored as rows
+type matrix [][]byte
+
+// newMatrix makes a rows x cols zero matrix
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for r := range m {
+		m[r] = make([]byte, cols)
+	}
+	return m
+}
+
+// mul returns m * n
+func (m matrix) mul(n matrix) matrix {
+	out := newMatrix(len(m), len(n[0]))
+	for r := range m {
+		for c := range n[0] {
+			var v byte
+			for i := range n {
+				v ^= gfMul[m[r][i]][n[i][c]]
+			}
+			out[r][c] = v
+		}
+	}
+	return out
+}
+
+// invert returns the inverse of the square matrix m using
+// Gauss-Jordan elimination
+func (m matrix) invert() (matrix, error) {
+	n := len(m)
+	// work on [m | I]
+	work := newMatrix(n, 2*n)
+	for r := range m {
+		copy(work[r], m[r])
+		work[r][n+r] = 1
+	}
+	for c := 0; c < n; c++ {
+		// find a pivot
+		p := c
+		for p < n && work[p][c] == 0 {
+			p++
+		}
+		if p == n {
+			return nil, errors.New("singular matrix")
+		}
+		work[c], work[p] = work[p], work[c]
+		// scale the pivot row to make the pivot 1
+		inv := gfInv(work[c][c])
+		for i := range work[c] {
+			work[c][i] = gfMul[inv][work[c][i]]
+		}
+		// eliminate the column from the other rows
+		for r := 0; r < n; r++ {
+			if r == c || work[r][c] == 0 {
+				continue
+			}
+			factor := work[r][c]
+			for i := range work[r] {
+				work[r][i] ^= gfMul[factor][work[c][i]]
+			}
+		}
+	}
+	out := make(matrix, n)
+	for r := range work {
+		out[r] = work[r][n:]
+	}
+	return out, nil
+}
+
+// mulAdd sets out ^= c * in
+func mulAdd(c byte, in, out []byte) {
+	if c == 0 {
+		return
+	}
+	row := &gfMul[c]
+	for i, b := range in {
+		out[i] ^= row[b]
+	}
+}
+
+// rsCodec is a systematic Reed-Solomon code making m parity shards
+// from k data shards so that any k of the k+m shards recover the data
+type rsCodec struct {
+	k, m int
+	enc  matrix // (k+m) x k encoding matrix, the first k rows the identity
+}
+
+// newRSCodec makes a codec for k data and m parity shards
+func newRSCodec(k, m int) (*rsCodec, error) {
+	if k < 1 || m < 0 || k+m > 256 {
+		return nil, fmt.Errorf("can't make a code with %d data and %d parity shards", k, m)
+	}
+	// Any k rows of a Vandermonde matrix are independent and stay so
+	// when it is multiplied by the inverse of its top k rows, which
+	// makes the code systematic.
+	vm := newMatrix(k+m, k)
+	for r := range vm {
+		for c := range vm[r] {
+			vm[r][c] = gfPow(byte(r), c)
+		}
+	}
+	top, err := vm[:k].invert()
+	if err != nil {
+		return nil, err
+	}
+	return &rsCodec{
+		k:   k,
+		m:   m,
+		enc: vm.mul(top),
+	}, nil
+}
+
+// encode computes the parity shards shards[k:] from the data shards
+// shards[:k] which must all be the same length
+func (c *rsCodec) encode(shards [][]byte) {
+	for p := c.k; p < c.k+c.m; p++ {
+		out := shards[p]
+		for i := range out {
+			out[i] = 0
+		}
+		for d := 0; d < c.k; d++ {
+			mulAdd(c.enc[p][d], shards[d], out)
+		}
+	}
+}
+
+// reconstruct fills in the missing shards, which are those with
+// missing[i] set, from k of the others. The buffers of the missing
+// shards are overwritten and must be the same length as the others.
+//
+// If dataOnly is set only the missing data shards are filled in.
+func (c *rsCodec) reconstruct(shards [][]byte, missing []bool, dataOnly bool) error {
+	var have []int
+	for i := range shards {
+		if !missing[i] && len(have) < c.k {
+			have = append(have, i)
+		}
+	}
+	if len(have) < c.k {
+		return fmt.Errorf("need %d shards to reconstruct but only have %d", c.k, len(have))
+	}
+	needData := false
+	for d := 0; d < c.k; d++ {
+		needData = needData || missing[d]
+	}
+	if needData {
+		sub := make(matrix, c.k)
+		for r, i := range have {
+			sub[r] = c.enc[i]
+		}
+		dec, err := sub.invert()
+		if err != nil {
+			return err
+		}
+		for d := 0; d < c.k; d++ {
+			if !missing[d] {
+				continue
+			}
+			out := shards[d]
+			for i := range out {
+				out[i] = 0
+			}
+			for r, i := range have {
+				mulAdd(dec[d][r], shards[i], out)
+			}
+		}
+	}
+	if dataOnly {
+		return nil
+	}
+	for p := c.k; p < c.k+c.m; p++ {
+		if !missing[p] {
+			continue
+		}
+		out := shards[p]
+		for i := range out {
+			out[i] = 0
+		}
+		for d := 0; d < c.k; d++ {
+			mulAdd(c.enc[p][d], shards[d], out)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package erasure
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGF(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		assert.Equal(t, byte(1), gfMul[a][gfInv(byte(a))], a)
+		assert.Equal(t, byte(0), gfMul[a][0])
+	}
+	assert.Equal(t, byte(1), gfPow(0, 0))
+	assert.Equal(t, byte(8), gfPow(2, 3))
+}
+
+func TestMatrixInvert(t *testing.T) {
+	m := matrix{{56, 23, 98}, {3, 100, 200}, {45, 201, 123}}
+	inv, err := m.invert()
+	require.NoError(t, err)
+	assert.Equal(t, matrix{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, m.mul(inv))
+
+	_, err = matrix{{1, 2}, {1, 2}}.invert()
+	assert.Error(t, err)
+}
+
+func TestRSCodec(t *testing.T) {
+	_, err := newRSCodec(0, 1)
+	assert.Error(t, err)
+	_, err = newRSCodec(200, 57)
+	assert.Error(t, err)
+
+	for _, test := range []struct{ k, m int }{{1, 1}, {2, 1}, {4, 2}, {3, 3}, {10, 4}} {
+		c, err := newRSCodec(test.k, test.m)
+		require.NoError(t, err)
+		n := test.k + test.m
+		shards := make([][]byte, n)
+		for i := range shards {
+			shards[i] = make([]byte, 100)
+			if i < test.k {
+				_, _ = rand.Read(shards[i])
+			}
+		}
+		c.encode(shards)
+		want := make([][]byte, n)
+		for i := range shards {
+			want[i] = append([]byte(nil), shards[i]...)
+		}
+
+		// Lose every combination of m shards and check they come back
+		for lose := 0; lose < 1<<n; lose++ {
+			missing := make([]bool, n)
+			count := 0
+			for i := range missing {
+				if lose&(1<<i) != 0 {
+					missing[i] = true
+					count++
+				}
+			}
+			if count > test.m {
+				continue
+			}
+			got := make([][]byte, n)
+			for i := range shards {
+				got[i] = append([]byte(nil), shards[i]...)
+				if missing[i] {
+					_, _ = rand.Read(got[i])
+				}
+			}
+			require.NoError(t, c.reconstruct(got, missing, false))
+			assert.Equal(t, want, got, "k=%d m=%d lose=%b", test.k, test.m, lose)
+		}
+
+		// Losing too many fails
+		missing := make([]bool, n)
+		for i := 0; i <= test.m; i++ {
+			missing[i] = true
+		}
+		assert.Error(t, c.reconstruct(shards, missing, true))
+	}
+}
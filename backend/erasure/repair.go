@@ -0,0 +1,207 @@
+package erasure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+// repairResult is the output of the repair command
+type repairResult struct {
+	Checked  int           `json:"checked"`  // files checked
+	Repaired int           `json:"repaired"` // files with shards rebuilt
+	Shards   int           `json:"shards"`   // shards rebuilt
+	Errors   []repairError `json:"errors"`   // files which couldn't be repaired
+}
+
+// repairError describes a file which couldn't be repaired
+type repairError struct {
+	Remote string `json:"remote"`
+	Error  string `json:"error"`
+}
+
+// repair rebuilds the missing or damaged shards of all the files
+func (f *Fs) repair(ctx context.Context) (*repairResult, error) {
+	res := &repairResult{
+		Errors: []repairError{},
+	}
+	var (
+		objs []*Object
+		mu   sync.Mutex
+	)
+	err := walk.ListR(ctx, f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			res.Checked++
+			objs = append(objs, o.(*Object))
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Transfers)
+	for _, o := range objs {
+		o := o
+		g.Go(func() error {
+			n, err := o.repair(gCtx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fs.Errorf(o, "Failed to repair: %v", err)
+				res.Errors = append(res.Errors, repairError{Remote: o.Remote(), Error: err.Error()})
+				return nil
+			}
+			if n > 0 {
+				res.Repaired++
+				res.Shards += n
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	fs.Infof(f, "Repair: %d files checked, %d repaired with %d shards rebuilt, %d errors",
+		res.Checked, res.Repaired, res.Shards, len(res.Errors))
+	return res, ctx.Err()
+}
+
+// badShards returns the indices of the shards of o which are
+// missing, out of date or the wrong size. skip marks the shards which
+// aren't part of the newest write.
+func (o *Object) badShards(g geometry, skip []bool) (bad []int) {
+	for i, shard := range o.shards {
+		if shard == nil || o.stale[i] != nil || skip[i] || shard.Size() != g.shardSize(o.size, i) {
+			bad = append(bad, i)
+		}
+	}
+	return bad
+}
+
+// damagedShards reads every block of the shards of o not already in
+// bad, returning the indices of those which fail their checksums or
+// can't be read
+func (o *Object) damagedShards(ctx context.Context, h *header, bad []int) (damaged []int, err error) {
+	g := geometry{k: h.k, m: h.m, block: h.block}
+	skip := make([]bool, len(o.shards))
+	for _, i := range bad {
+		skip[i] = true
+	}
+	last := g.stripes(o.size) - 1
+	r, err := newStripeReader(ctx, o, h, 0, last, skip, len(o.shards))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	for s := int64(0); s <= last; s++ {
+		_, err := r.readStripe(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range r.failed {
+		if r.failed[i] && !skip[i] {
+			damaged = append(damaged, i)
+		}
+	}
+	return damaged, nil
+}
+
+// repair rebuilds the bad shards of o from the good ones, returning
+// the number of shards rebuilt
+func (o *Object) repair(ctx context.Context) (int, error) {
+	f := o.f
+	h, skip, err := o.readHeaders(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if h.size != o.size {
+		return 0, fmt.Errorf("shard header size %d doesn't match file size %d", h.size, o.size)
+	}
+	g := geometry{k: h.k, m: h.m, block: h.block}
+	bad := o.badShards(g, skip)
+	damaged, err := o.damagedShards(ctx, h, bad)
+	if err != nil {
+		return 0, err
+	}
+	bad = append(bad, damaged...)
+	if len(bad) == 0 {
+		return 0, nil
+	}
+	sort.Ints(bad)
+	if operations.SkipDestructive(ctx, o, fmt.Sprintf("rebuild %d shards", len(bad))) {
+		return 0, nil
+	}
+	skip = make([]bool, len(o.shards))
+	existing := make([]fs.Object, len(o.shards))
+	for _, i := range bad {
+		skip[i] = true
+		existing[i] = o.shard(i)
+	}
+	var first, last int64 = 0, g.stripes(o.size) - 1
+	r, err := newStripeReader(ctx, o, h, first, last, skip, g.k)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	// Give the rebuilt shards the modification time and generation of
+	// the others so they are part of the same write
+	src := object.NewStaticObjectInfo(o.remote, o.modTime, o.size, true, nil, f)
+	objs, errs, err := f.putShards(ctx, src, g, o.size, bad, existing, func(out []io.Writer) error {
+		headers := make([][]byte, len(out))
+		for _, i := range bad {
+			headers[i] = (&header{k: g.k, m: g.m, index: i, block: g.block, size: o.size, gen: h.gen}).marshal()
+		}
+		if err := writeBlocks(out, headers, 1); err != nil {
+			return err
+		}
+		for s := first; s <= last; s++ {
+			blocks, err := r.readStripe(true)
+			if err != nil {
+				return err
+			}
+			for i := range blocks {
+				blocks[i] = appendCRC(h.gen, s, i, blocks[i][:g.shardLen(o.size, s, i)])
+			}
+			err = writeBlocks(out, blocks, 1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	rebuilt := 0
+	for _, i := range bad {
+		if errs[i] != nil {
+			fs.Errorf(o, "Failed to rebuild shard %d: %v", i, errs[i])
+			continue
+		}
+		o.shards[i] = objs[i]
+		o.stale[i] = nil
+		rebuilt++
+	}
+	o.mu.Lock()
+	o.header, o.skip = nil, nil
+	o.mu.Unlock()
+	fs.Infof(o, "Rebuilt %d shards", rebuilt)
+	if _, uploadErr := failedShards(errs); uploadErr != nil {
+		return rebuilt, uploadErr
+	}
+	return rebuilt, nil
+}
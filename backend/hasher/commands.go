@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
@@ -27,8 +28,14 @@ import (
 func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
 	switch name {
 	case "drop":
+		if f.db == nil {
+			return nil, errNoDB
+		}
 		return nil, f.db.Stop(true)
 	case "dump", "fulldump":
+		if f.db == nil {
+			return nil, errNoDB
+		}
 		return nil, f.dbDump(ctx, name == "fulldump", "")
 	case "import", "stickyimport":
 		sticky := name == "stickyimport"
@@ -36,6 +43,20 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			return nil, errors.New("please provide checksum type and path to sum file")
 		}
 		return nil, f.dbImport(ctx, arg[0], arg[1], sticky)
+	case "scrub":
+		var maxBytes fs.SizeSuffix
+		if s := opt["max-bytes"]; s != "" {
+			if err := maxBytes.Set(s); err != nil {
+				return nil, fmt.Errorf("bad max-bytes: %w", err)
+			}
+		}
+		var maxDuration time.Duration
+		if s := opt["max-duration"]; s != "" {
+			if maxDuration, err = fs.ParseDuration(s); err != nil {
+				return nil, fmt.Errorf("bad max-duration: %w", err)
+			}
+		}
+		return f.scrub(ctx, int64(maxBytes), maxDuration)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -70,6 +91,31 @@ Usage Example:
 Usage Example:
     rclone backend stickyimport hasher:subdir md5 remote:path/to/sum.md5
 `,
+}, {
+	Name:  "scrub",
+	Short: "Verify stored checksums against the data",
+	Long: `Read objects again and compare their checksums with the stored ones to
+detect corruption of the data.
+
+Objects are read least recently verified first, so repeated scrubs
+with a budget cover the whole remote over time. The time each object
+was verified is recorded with its checksums. Objects without stored
+checksums are skipped. Reads are limited by --bwlimit and run
+--checkers at a time.
+
+Usage Example:
+    rclone backend scrub hasher:subdir -o max-bytes=100G -o max-duration=1h
+
+The output is a JSON object listing the objects whose checksums didn't
+match and the ones which couldn't be read, along with counts of the
+objects verified, left for the next scrub and without checksums.
+Mismatching checksums are left as they are, so the objects are checked
+again by the next scrub.
+`,
+	Opts: map[string]string{
+		"max-bytes":    "Stop after reading this much data, e.g. 100G",
+		"max-duration": "Stop starting to read objects after this long, e.g. 1h",
+	},
 }}
 
 func (f *Fs) dbDump(ctx context.Context, full bool, root string) error {
@@ -134,11 +180,9 @@ func (f *Fs) dbImport(ctx context.Context, hashName, sumRemote string, sticky bo
 	}
 
 	if sticky {
-		rootPath := f.Fs.Root()
 		for remote, hashVal := range hashes {
-			key := path.Join(rootPath, remote)
 			hashSums := operations.HashSums{hashName: hashVal}
-			if err := f.putRawHashes(ctx, key, anyFingerprint, hashSums); err != nil {
+			if err := f.putRawHashes(ctx, remote, nil, anyFingerprint, hashSums); err != nil {
 				fs.Errorf(nil, "%s: failed to import: %v", remote, err)
 			}
 		}
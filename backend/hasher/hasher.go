@@ -50,16 +50,51 @@ func init() {
 			Advanced: true,
 			Default:  fs.SizeSuffix(0),
 			Help:     "Auto-update checksum for files smaller than this size (disabled by default).",
+		}, {
+			Name:     "storage",
+			Advanced: true,
+			Default:  "local",
+			Help:     "Where to keep the checksums.",
+			Examples: []fs.OptionExample{{
+				Value: "local",
+				Help:  "In a database on the local machine.",
+			}, {
+				Value: "sidecar",
+				Help:  "In a sidecar object in each directory of the remote, shared by all clients.",
+			}, {
+				Value: "metadata",
+				Help:  "In the metadata of the objects, shared by all clients.\nThe remote must support setting metadata on objects.",
+			}},
+		}, {
+			Name:     "sidecar_name",
+			Advanced: true,
+			Default:  ".rclone_hashes.json",
+			Help: `Name of the sidecar objects for storage "sidecar".
+
+They are hidden from listings.`,
+		}, {
+			Name:     "local_cache",
+			Advanced: true,
+			Default:  false,
+			Help: `Cache checksums kept on the remote in the local database.
+
+This saves reading them from the remote again, which is useful when
+the remote is slow to access. Checksums which another client changed
+are read from the remote again as they are checked against the file
+size, modification time and hash of the remote.`,
 		}},
 	})
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote   string          `config:"remote"`
-	Hashes   fs.CommaSepList `config:"hashes"`
-	AutoSize fs.SizeSuffix   `config:"auto_size"`
-	MaxAge   fs.Duration     `config:"max_age"`
+	Remote      string          `config:"remote"`
+	Hashes      fs.CommaSepList `config:"hashes"`
+	AutoSize    fs.SizeSuffix   `config:"auto_size"`
+	MaxAge      fs.Duration     `config:"max_age"`
+	Storage     string          `config:"storage"`
+	SidecarName string          `config:"sidecar_name"`
+	LocalCache  bool            `config:"local_cache"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -70,7 +105,9 @@ type Fs struct {
 	wrapper  fs.Fs
 	features *fs.Features
 	opt      *Options
-	db       *kv.DB
+	db       *kv.DB        // local database if used
+	store    remoteStore   // store on the remote if used
+	sidecar  *sidecarStore // set for storage "sidecar"
 	// fingerprinting
 	fpTime bool      // true if using time in fingerprints
 	fpHash hash.Type // hash type to use in fingerprints or None
@@ -86,9 +123,6 @@ var warnExperimental sync.Once
 
 // NewFs constructs an Fs from the remote:path string
 func NewFs(ctx context.Context, fsname, rpath string, cmap configmap.Mapper) (fs.Fs, error) {
-	if !kv.Supported() {
-		return nil, errors.New("hasher is not supported on this OS")
-	}
 	warnExperimental.Do(func() {
 		fs.Infof(nil, "Hasher is EXPERIMENTAL!")
 	})
@@ -98,6 +132,10 @@ func NewFs(ctx context.Context, fsname, rpath string, cmap configmap.Mapper) (fs
 	if err != nil {
 		return nil, err
 	}
+	useDB := opt.Storage == "local" || opt.LocalCache
+	if useDB && !kv.Supported() {
+		return nil, errors.New("hasher is not supported on this OS")
+	}
 
 	if strings.HasPrefix(opt.Remote, fsname+":") {
 		return nil, errors.New("can't point remote at itself")
@@ -147,7 +185,24 @@ func NewFs(ctx context.Context, fsname, rpath string, cmap configmap.Mapper) (fs
 		return nil, errors.New("configured hash_names have nothing to keep in cache")
 	}
 
-	if f.opt.MaxAge > 0 {
+	switch opt.Storage {
+	case "local":
+	case "sidecar":
+		if opt.SidecarName == "" || strings.Contains(opt.SidecarName, "/") {
+			return nil, fmt.Errorf("invalid sidecar_name %q", opt.SidecarName)
+		}
+		f.sidecar = newSidecarStore(f, opt.SidecarName)
+		f.store = f.sidecar
+	case "metadata":
+		if !baseFeatures.UserMetadata {
+			return nil, errors.New("storage \"metadata\" needs a remote which supports user metadata")
+		}
+		f.store = &metadataStore{f: f}
+	default:
+		return nil, fmt.Errorf("unknown storage %q", opt.Storage)
+	}
+
+	if f.opt.MaxAge > 0 && useDB {
 		gob.Register(hashRecord{})
 		db, err := kv.Start(ctx, "hasher", f.Fs)
 		if err != nil {
@@ -211,6 +266,9 @@ func (f *Fs) wrapEntries(baseEntries fs.DirEntries) (hashEntries fs.DirEntries,
 	for _, entry := range baseEntries {
 		switch x := entry.(type) {
 		case fs.Object:
+			if f.isSidecar(x.Remote()) {
+				continue
+			}
 			obj, err := f.wrapObject(x, nil)
 			if err != nil {
 				return nil, err
@@ -242,12 +300,43 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 	})
 }
 
+// isSidecar returns true if remote is reserved for sidecar objects
+func (f *Fs) isSidecar(remote string) bool {
+	return f.sidecar != nil && f.sidecar.isSidecar(remote)
+}
+
+// checkRemote returns an error if remote can't be used for files
+func (f *Fs) checkRemote(remote string) error {
+	if f.isSidecar(remote) {
+		return fmt.Errorf("can't use %q as it is reserved for hash sidecars", remote)
+	}
+	return nil
+}
+
+// Rmdir removes the directory dir, which must be empty apart from
+// the hash sidecar
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	if f.sidecar != nil {
+		if err := f.sidecar.prepareRmdir(ctx, dir); err != nil {
+			fs.Debugf(f, "Failed to remove hash sidecar from %q: %v", dir, err)
+		}
+	}
+	return f.Fs.Rmdir(ctx, dir)
+}
+
 // Purge a directory
 func (f *Fs) Purge(ctx context.Context, dir string) error {
 	if do := f.Fs.Features().Purge; do != nil {
 		if err := do(ctx, dir); err != nil {
 			return err
 		}
+		if f.sidecar != nil {
+			// sidecars are purged with the directory
+			f.sidecar.forget(dir)
+		}
+		if f.db == nil {
+			return nil
+		}
 		err := f.db.Do(true, &kvPurge{
 			dir: path.Join(f.Fs.Root(), dir),
 		})
@@ -262,7 +351,10 @@ func (f *Fs) Purge(ctx context.Context, dir string) error {
 // PutStream uploads to the remote path with undeterminate size.
 func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
 	if do := f.Fs.Features().PutStream; do != nil {
-		_ = f.pruneHash(src.Remote())
+		if err := f.checkRemote(src.Remote()); err != nil {
+			return nil, err
+		}
+		_ = f.pruneHash(ctx, src.Remote())
 		oResult, err := do(ctx, in, src, options...)
 		return f.wrapObject(oResult, err)
 	}
@@ -272,7 +364,10 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 // PutUnchecked uploads the object, allowing duplicates.
 func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
 	if do := f.Fs.Features().PutUnchecked; do != nil {
-		_ = f.pruneHash(src.Remote())
+		if err := f.checkRemote(src.Remote()); err != nil {
+			return nil, err
+		}
+		_ = f.pruneHash(ctx, src.Remote())
 		oResult, err := do(ctx, in, src, options...)
 		return f.wrapObject(oResult, err)
 	}
@@ -280,10 +375,16 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 }
 
 // pruneHash deletes hash for a path
-func (f *Fs) pruneHash(remote string) error {
-	return f.db.Do(true, &kvPrune{
-		key: path.Join(f.Fs.Root(), remote),
-	})
+func (f *Fs) pruneHash(ctx context.Context, remote string) (err error) {
+	if f.db != nil {
+		err = f.db.Do(true, &kvPrune{
+			key: path.Join(f.Fs.Root(), remote),
+		})
+	}
+	if f.store != nil {
+		err = f.store.prune(ctx, remote)
+	}
+	return err
 }
 
 // CleanUp the trash in the Fs
@@ -309,6 +410,33 @@ func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryT
 	}
 }
 
+// DirSetModTime sets the modification time of the directory dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	do := f.Fs.Features().DirSetModTime
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, dir, modTime)
+}
+
+// DirMetadata returns the metadata of the directory dir
+func (f *Fs) DirMetadata(ctx context.Context, dir string) (fs.Metadata, error) {
+	do := f.Fs.Features().DirMetadata
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	return do(ctx, dir)
+}
+
+// DirSetMetadata sets metadata on the directory dir
+func (f *Fs) DirSetMetadata(ctx context.Context, dir string, metadata fs.Metadata) error {
+	do := f.Fs.Features().DirSetMetadata
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx, dir, metadata)
+}
+
 // UserInfo returns info about the connected user
 func (f *Fs) UserInfo(ctx context.Context) (map[string]string, error) {
 	if do := f.Fs.Features().UserInfo; do != nil {
@@ -360,6 +488,43 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantCopy
 	}
+	if err := f.checkRemote(remote); err != nil {
+		return nil, err
+	}
+	oResult, err := do(ctx, o.Object, remote)
+	return f.wrapObject(oResult, err)
+}
+
+// HardLink makes a hard link to src at remote on this remote.
+func (f *Fs) HardLink(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().HardLink
+	if do == nil {
+		return nil, fs.ErrorCantHardLink
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantHardLink
+	}
+	if err := f.checkRemote(remote); err != nil {
+		return nil, err
+	}
+	oResult, err := do(ctx, o.Object, remote)
+	return f.wrapObject(oResult, err)
+}
+
+// Shortcut makes a server-side shortcut or link to src at remote on this remote.
+func (f *Fs) Shortcut(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Shortcut
+	if do == nil {
+		return nil, fs.ErrorCantShortcut
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantShortcut
+	}
+	if err := f.checkRemote(remote); err != nil {
+		return nil, err
+	}
 	oResult, err := do(ctx, o.Object, remote)
 	return f.wrapObject(oResult, err)
 }
@@ -374,16 +539,25 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantMove
 	}
+	if err := f.checkRemote(remote); err != nil {
+		return nil, err
+	}
 	oResult, err := do(ctx, o.Object, remote)
 	if err != nil {
 		return nil, err
 	}
-	_ = f.db.Do(true, &kvMove{
-		src: path.Join(f.Fs.Root(), src.Remote()),
-		dst: path.Join(f.Fs.Root(), remote),
-		dir: false,
-		fs:  f,
-	})
+	if f.db != nil {
+		_ = f.db.Do(true, &kvMove{
+			src: path.Join(f.Fs.Root(), src.Remote()),
+			dst: path.Join(f.Fs.Root(), remote),
+			dir: false,
+			fs:  f,
+		})
+	}
+	if f.store != nil && o.f.store != nil {
+		err = f.store.moveFrom(ctx, o.f.store, src.Remote(), remote)
+		fs.Debugf(f, "moving stored hash %s to %s (err: %v)", src.Remote(), remote, err)
+	}
 	return f.wrapObject(oResult, nil)
 }
 
@@ -398,7 +572,7 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 		return fs.ErrorCantDirMove
 	}
 	err := do(ctx, srcFs.Fs, srcRemote, dstRemote)
-	if err == nil {
+	if err == nil && f.db != nil {
 		_ = f.db.Do(true, &kvMove{
 			src: path.Join(srcFs.Fs.Root(), srcRemote),
 			dst: path.Join(f.Fs.Root(), dstRemote),
@@ -411,7 +585,14 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 
 // Shutdown the backend, closing any background tasks and any cached connections.
 func (f *Fs) Shutdown(ctx context.Context) (err error) {
-	err = f.db.Stop(false)
+	if f.sidecar != nil {
+		err = f.sidecar.flushAll(ctx)
+	}
+	if f.db != nil {
+		if err2 := f.db.Stop(false); err2 != nil {
+			err = err2
+		}
+	}
 	if do := f.Fs.Features().Shutdown; do != nil {
 		if err2 := do(ctx); err2 != nil {
 			err = err2
@@ -422,6 +603,9 @@ func (f *Fs) Shutdown(ctx context.Context) (err error) {
 
 // NewObject finds the Object at remote.
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if f.isSidecar(remote) {
+		return nil, fs.ErrorObjectNotFound
+	}
 	o, err := f.Fs.NewObject(ctx, remote)
 	return f.wrapObject(o, err)
 }
@@ -502,30 +686,55 @@ func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
 	if !ok {
 		return nil, nil
 	}
-	return do.Metadata(ctx)
+	metadata, err := do.Metadata(ctx)
+	if _, isMetadataStore := o.f.store.(*metadataStore); isMetadataStore && err == nil {
+		// hide the hashes kept in the metadata
+		for key := range metadata {
+			if strings.HasPrefix(key, metadataPrefix) {
+				delete(metadata, key)
+			}
+		}
+	}
+	return metadata, err
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
 }
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = (*Fs)(nil)
-	_ fs.Purger          = (*Fs)(nil)
-	_ fs.Copier          = (*Fs)(nil)
-	_ fs.Mover           = (*Fs)(nil)
-	_ fs.DirMover        = (*Fs)(nil)
-	_ fs.Commander       = (*Fs)(nil)
-	_ fs.PutUncheckeder  = (*Fs)(nil)
-	_ fs.PutStreamer     = (*Fs)(nil)
-	_ fs.CleanUpper      = (*Fs)(nil)
-	_ fs.UnWrapper       = (*Fs)(nil)
-	_ fs.ListRer         = (*Fs)(nil)
-	_ fs.Abouter         = (*Fs)(nil)
-	_ fs.Wrapper         = (*Fs)(nil)
-	_ fs.MergeDirser     = (*Fs)(nil)
-	_ fs.DirCacheFlusher = (*Fs)(nil)
-	_ fs.ChangeNotifier  = (*Fs)(nil)
-	_ fs.PublicLinker    = (*Fs)(nil)
-	_ fs.UserInfoer      = (*Fs)(nil)
-	_ fs.Disconnecter    = (*Fs)(nil)
-	_ fs.Shutdowner      = (*Fs)(nil)
-	_ fs.FullObject      = (*Object)(nil)
+	_ fs.Fs               = (*Fs)(nil)
+	_ fs.Purger           = (*Fs)(nil)
+	_ fs.Copier           = (*Fs)(nil)
+	_ fs.HardLinker       = (*Fs)(nil)
+	_ fs.Shortcutter      = (*Fs)(nil)
+	_ fs.Mover            = (*Fs)(nil)
+	_ fs.DirMover         = (*Fs)(nil)
+	_ fs.Commander        = (*Fs)(nil)
+	_ fs.PutUncheckeder   = (*Fs)(nil)
+	_ fs.PutStreamer      = (*Fs)(nil)
+	_ fs.CleanUpper       = (*Fs)(nil)
+	_ fs.UnWrapper        = (*Fs)(nil)
+	_ fs.ListRer          = (*Fs)(nil)
+	_ fs.Abouter          = (*Fs)(nil)
+	_ fs.Wrapper          = (*Fs)(nil)
+	_ fs.MergeDirser      = (*Fs)(nil)
+	_ fs.DirCacheFlusher  = (*Fs)(nil)
+	_ fs.ChangeNotifier   = (*Fs)(nil)
+	_ fs.PublicLinker     = (*Fs)(nil)
+	_ fs.UserInfoer       = (*Fs)(nil)
+	_ fs.Disconnecter     = (*Fs)(nil)
+	_ fs.Shutdowner       = (*Fs)(nil)
+	_ fs.DirSetModTimer   = (*Fs)(nil)
+	_ fs.DirMetadataer    = (*Fs)(nil)
+	_ fs.DirSetMetadataer = (*Fs)(nil)
+	_ fs.FullObject       = (*Object)(nil)
 )
@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
@@ -46,7 +49,7 @@ func (f *Fs) testUploadFromCrypt(t *testing.T) {
 	src := putFile(ctx, t, cryptFs, fileName, "doggy froggy")
 
 	// ensure that hash does not exist yet
-	_ = f.pruneHash(fileName)
+	_ = f.pruneHash(ctx, fileName)
 	hashType := f.keepHashes.GetOne()
 	hash, err := f.getRawHash(ctx, hashType, fileName, anyFingerprint, longTime)
 	assert.Error(t, err)
@@ -67,12 +70,188 @@ func (f *Fs) testUploadFromCrypt(t *testing.T) {
 	_ = operations.Purge(ctx, f, dirName)
 }
 
+func (f *Fs) testRemoteStore(t *testing.T) {
+	if f.store == nil {
+		t.Skip("checksums are not kept on the remote")
+	}
+	ctx := context.Background()
+	const dirName = "remote_store"
+	const fileName = dirName + "/file"
+	defer func() {
+		_ = operations.Purge(ctx, f, dirName)
+	}()
+	obj := putFile(ctx, t, f, fileName, "kept on the remote")
+	hashType := f.keepHashes.GetOne()
+	hash, err := obj.Hash(ctx, hashType)
+	require.NoError(t, err)
+	require.NotEmpty(t, hash)
+
+	if f.sidecar != nil {
+		// changes are written to the sidecar in batches
+		_, err = f.Fs.NewObject(ctx, dirName+"/"+f.opt.SidecarName)
+		assert.Equal(t, fs.ErrorObjectNotFound, err, "sidecar must not be written at once")
+		require.NoError(t, f.sidecar.flushAll(ctx))
+	}
+
+	// another client of the remote sees the checksum
+	remote := fmt.Sprintf(":hasher,remote=%q,storage=%s,sidecar_name=%q:", fs.ConfigString(f.Fs), f.opt.Storage, f.opt.SidecarName)
+	other, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	otherFs := other.(*Fs)
+	assert.Nil(t, otherFs.db)
+	otherObj, err := otherFs.NewObject(ctx, fileName)
+	require.NoError(t, err)
+	otherHash, err := otherFs.lookupHash(ctx, hashType, fileName, otherObj.(*Object).Object, otherObj.(*Object).fingerprint(ctx), time.Duration(fs.DurationOff))
+	assert.NoError(t, err)
+	assert.Equal(t, hash, otherHash)
+
+	if f.sidecar != nil {
+		_, err = f.Fs.NewObject(ctx, dirName+"/"+f.opt.SidecarName)
+		assert.NoError(t, err, "sidecar must be created")
+		entries, err := f.List(ctx, dirName)
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(entries), "sidecar must be hidden")
+		_, err = f.NewObject(ctx, dirName+"/"+f.opt.SidecarName)
+		assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+		// the record moves with the file and goes with it
+		moved, err := f.Move(ctx, obj, dirName+"/moved")
+		require.NoError(t, err)
+		_, err = f.sidecar.get(ctx, fileName, nil)
+		assert.Equal(t, errNoRecord, err)
+		_, err = f.sidecar.get(ctx, dirName+"/moved", nil)
+		assert.NoError(t, err)
+
+		// changes by other clients are seen once the cache expires
+		expire := func(s *sidecarStore) {
+			s.mu.Lock()
+			for _, d := range s.dirs {
+				d.read = time.Time{}
+			}
+			s.mu.Unlock()
+		}
+		require.NoError(t, f.sidecar.flushAll(ctx))
+		expire(otherFs.sidecar)
+		require.NoError(t, otherFs.sidecar.prune(ctx, dirName+"/moved"))
+		require.NoError(t, otherFs.sidecar.flushAll(ctx))
+		_, err = f.sidecar.get(ctx, dirName+"/moved", nil)
+		assert.NoError(t, err, "record must be cached")
+		expire(f.sidecar)
+		_, err = f.sidecar.get(ctx, dirName+"/moved", nil)
+		assert.Equal(t, errNoRecord, err, "record must be read again")
+
+		require.NoError(t, moved.Remove(ctx))
+		require.NoError(t, f.sidecar.flushAll(ctx))
+		_, err = f.Fs.NewObject(ctx, dirName+"/"+f.opt.SidecarName)
+		assert.Equal(t, fs.ErrorObjectNotFound, err, "empty sidecar must be removed")
+	}
+}
+
+func (f *Fs) testScrub(t *testing.T) {
+	if f.opt.MaxAge <= 0 {
+		t.Skip("checksums are not cached")
+	}
+	ctx := context.Background()
+	const dirName = "scrub"
+	subRemote := fmt.Sprintf("%s:%s", f.Name(), path.Join(f.Root(), dirName))
+	subFs, err := fs.NewFs(ctx, subRemote)
+	require.NoError(t, err)
+	sub := subFs.(*Fs)
+	defer func() {
+		_ = operations.Purge(ctx, f, dirName)
+	}()
+	hashType := sub.keepHashes.GetOne()
+	for _, name := range []string{"file1", "file2"} {
+		obj := putFile(ctx, t, sub, name, "scrub me "+name)
+		_, err := obj.Hash(ctx, hashType)
+		require.NoError(t, err)
+	}
+	obj := putFile(ctx, t, sub, "unhashed", "never hashed")
+	_ = sub.pruneHash(ctx, obj.Remote())
+
+	res, err := sub.scrub(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Verified)
+	assert.Equal(t, 1, res.Unhashed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Empty(t, res.Mismatches)
+
+	// least recently verified first within the budget
+	verified := func(name string) time.Time {
+		obj, err := sub.NewObject(ctx, name)
+		require.NoError(t, err)
+		o := obj.(*Object)
+		r, err := sub.getRecord(ctx, name, o.Object, o.fingerprint(ctx), time.Duration(sub.opt.MaxAge), "")
+		require.NoError(t, err)
+		require.False(t, r.Verified.IsZero())
+		return r.Verified
+	}
+	older, newer := "file1", "file2"
+	if verified(newer).Before(verified(older)) {
+		older, newer = newer, older
+	}
+	newerVerified := verified(newer)
+	res, err = sub.scrub(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Verified)
+	assert.Equal(t, 1, res.Remaining)
+	assert.True(t, verified(newer).Equal(newerVerified), "most recently verified must be left")
+	assert.True(t, verified(older).After(newerVerified), "least recently verified must be verified")
+
+	// corrupt the data keeping the fingerprint
+	if sub.fpHash != hash.None {
+		t.Skip("can't corrupt data without changing the fingerprint")
+	}
+	_ = putFile(ctx, t, sub.Fs, "file1", "SCRUB ME file1")
+	res, err = sub.scrub(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Verified)
+	require.NotEmpty(t, res.Mismatches)
+	for _, m := range res.Mismatches {
+		assert.Equal(t, "file1", m.Remote)
+		assert.NotEqual(t, m.Stored, m.Computed)
+	}
+}
+
+func (f *Fs) testHardLink(t *testing.T) {
+	if f.Fs.Features().HardLink == nil {
+		t.Skip("base remote does not support hard links")
+	}
+	ctx := context.Background()
+	obj := putFile(ctx, t, f, "hardlink-src", "linked content")
+	defer func() {
+		_ = obj.Remove(ctx)
+	}()
+	hashType := f.keepHashes.GetOne()
+	wantSum, err := obj.Hash(ctx, hashType)
+	require.NoError(t, err)
+
+	link, err := f.Features().HardLink(ctx, obj, "hardlink-dst")
+	require.NoError(t, err)
+	defer func() {
+		_ = link.Remove(ctx)
+	}()
+	_, ok := link.(*Object)
+	assert.True(t, ok, "hard link must be wrapped")
+	assert.Equal(t, "hardlink-dst", link.Remote())
+	gotSum, err := link.Hash(ctx, hashType)
+	require.NoError(t, err)
+	assert.Equal(t, wantSum, gotSum)
+
+	// Objects from other remotes can't be linked
+	_, err = f.Features().HardLink(ctx, obj.(*Object).Object, "hardlink-bad")
+	assert.ErrorIs(t, err, fs.ErrorCantHardLink)
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	if !kv.Supported() {
 		t.Skip("hasher is not supported on this OS")
 	}
 	t.Run("UploadFromCrypt", f.testUploadFromCrypt)
+	t.Run("RemoteStore", f.testRemoteStore)
+	t.Run("Scrub", f.testScrub)
+	t.Run("HardLink", f.testHardLink)
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
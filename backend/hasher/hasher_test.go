@@ -37,3 +37,49 @@ func TestIntegration(t *testing.T) {
 	}
 	fstests.Run(t, &opt)
 }
+
+// TestSidecar runs integration tests keeping checksums in sidecars
+func TestSidecar(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempDir := filepath.Join(os.TempDir(), "rclone-hasher-test-sidecar")
+	name := "TestHasherSidecar"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*hasher.Object)(nil),
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "hasher"},
+			{Name: name, Key: "remote", Value: tempDir},
+			{Name: name, Key: "storage", Value: "sidecar"},
+		},
+		UnimplementableFsMethods: []string{
+			"OpenWriterAt",
+		},
+		UnimplementableObjectMethods: []string{},
+		QuickTestOK:                  true,
+	})
+}
+
+// TestMetadata runs integration tests keeping checksums in metadata
+func TestMetadata(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempDir := filepath.Join(os.TempDir(), "rclone-hasher-test-metadata")
+	name := "TestHasherMetadata"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*hasher.Object)(nil),
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "hasher"},
+			{Name: name, Key: "remote", Value: tempDir},
+			{Name: name, Key: "storage", Value: "metadata"},
+		},
+		UnimplementableFsMethods: []string{
+			"OpenWriterAt",
+		},
+		UnimplementableObjectMethods: []string{},
+		QuickTestOK:                  true,
+	})
+}
@@ -23,9 +23,43 @@ const (
 type hashMap map[hash.Type]string
 
 type hashRecord struct {
-	Fp      string // fingerprint
-	Hashes  operations.HashSums
-	Created time.Time
+	Fp       string              `json:"fp"` // fingerprint
+	Hashes   operations.HashSums `json:"hashes"`
+	Created  time.Time           `json:"created"`
+	Verified time.Time           `json:"verified,omitempty"` // last verified by scrub
+}
+
+// check returns an error unless the record is for fingerprint fp and
+// not older than age
+func (r *hashRecord) check(fp string, age time.Duration) error {
+	if !(r.Fp == anyFingerprint || fp == anyFingerprint || r.Fp == fp) {
+		return errors.New("fingerprint changed")
+	}
+	if time.Since(r.Created) > age {
+		return errors.New("record timed out")
+	}
+	return nil
+}
+
+// update adds hashes to the record, starting afresh if the record is
+// for another fingerprint or older than age, and sets the verified
+// time if not zero
+func (r *hashRecord) update(fp string, hashes operations.HashSums, verified time.Time, age time.Duration) {
+	if r.Fp != fp || time.Since(r.Created) > age {
+		r.Hashes = nil
+	}
+	if len(r.Hashes) == 0 {
+		r.Created = time.Now()
+		r.Verified = time.Time{}
+		r.Hashes = operations.HashSums{}
+		r.Fp = fp
+	}
+	for hashType, hashVal := range hashes {
+		r.Hashes[hashType] = hashVal
+	}
+	if !verified.IsZero() {
+		r.Verified = verified
+	}
 }
 
 func (r *hashRecord) encode(key string) ([]byte, error) {
@@ -144,11 +178,12 @@ func moveHash(b kv.Bucket, src, dst string) error {
 
 // kvGet: get single hash from database
 type kvGet struct {
-	key  string
-	fp   string
-	hash string
-	val  string
-	age  time.Duration
+	key    string
+	fp     string
+	hash   string
+	val    string
+	age    time.Duration
+	record *hashRecord
 }
 
 func (op *kvGet) Do(ctx context.Context, b kv.Bucket) error {
@@ -160,44 +195,34 @@ func (op *kvGet) Do(ctx context.Context, b kv.Bucket) error {
 	if err := r.decode(op.key, data); err != nil {
 		return errors.New("invalid record")
 	}
-	if !(r.Fp == anyFingerprint || op.fp == anyFingerprint || r.Fp == op.fp) {
-		return errors.New("fingerprint changed")
-	}
-	if time.Since(r.Created) > op.age {
-		return errors.New("record timed out")
+	if err := r.check(op.fp, op.age); err != nil {
+		return err
 	}
 	if r.Hashes != nil {
 		op.val = r.Hashes[op.hash]
 	}
+	op.record = &r
 	return nil
 }
 
 // kvPut: set hashes for an object by key
 type kvPut struct {
-	key    string
-	fp     string
-	hashes operations.HashSums
-	age    time.Duration
+	key      string
+	fp       string
+	hashes   operations.HashSums
+	verified time.Time
+	age      time.Duration
 }
 
 func (op *kvPut) Do(ctx context.Context, b kv.Bucket) (err error) {
 	data := b.Get([]byte(op.key))
 	var r hashRecord
 	if len(data) > 0 {
-		err = r.decode(op.key, data)
-		if err != nil || r.Fp != op.fp || time.Since(r.Created) > op.age {
+		if err = r.decode(op.key, data); err != nil {
 			r.Hashes = nil
 		}
 	}
-	if len(r.Hashes) == 0 {
-		r.Created = time.Now()
-		r.Hashes = operations.HashSums{}
-		r.Fp = op.fp
-	}
-
-	for hashType, hashVal := range op.hashes {
-		r.Hashes[hashType] = hashVal
-	}
+	r.update(op.fp, op.hashes, op.verified, op.age)
 	if data, err = r.encode(op.key); err != nil {
 		return fmt.Errorf("marshal failed: %w", err)
 	}
@@ -207,6 +232,20 @@ func (op *kvPut) Do(ctx context.Context, b kv.Bucket) (err error) {
 	return err
 }
 
+// kvSet: store a record read from the remote by key
+type kvSet struct {
+	key    string
+	record *hashRecord
+}
+
+func (op *kvSet) Do(ctx context.Context, b kv.Bucket) error {
+	data, err := op.record.encode(op.key)
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	return b.Put([]byte(op.key), data)
+}
+
 // kvDump: dump the database.
 // Note: long dump can cause concurrent operations to fail.
 type kvDump struct {
@@ -23,20 +23,57 @@ func (o *Object) getHash(ctx context.Context, hashType hash.Type) (string, error
 	if fp == "" {
 		return "", errors.New("fingerprint failed")
 	}
-	return o.f.getRawHash(ctx, hashType, o.Remote(), fp, maxAge)
+	return o.f.lookupHash(ctx, hashType, o.Remote(), o.Object, fp, maxAge)
 }
 
 // obtain hash for a path
 func (f *Fs) getRawHash(ctx context.Context, hashType hash.Type, remote, fp string, age time.Duration) (string, error) {
+	return f.lookupHash(ctx, hashType, remote, nil, fp, age)
+}
+
+// obtain hash for a path from the local database, or from the remote
+// store if not found there. The base object obj may be nil.
+func (f *Fs) lookupHash(ctx context.Context, hashType hash.Type, remote string, obj fs.Object, fp string, age time.Duration) (string, error) {
+	r, err := f.getRecord(ctx, remote, obj, fp, age, hashType.String())
+	if err != nil {
+		return "", err
+	}
+	return r.Hashes[hashType.String()], nil
+}
+
+// obtain the record for a path from the local database, or from the
+// remote store if not found there or if it lacks the hash named need.
+// The base object obj may be nil.
+func (f *Fs) getRecord(ctx context.Context, remote string, obj fs.Object, fp string, age time.Duration, need string) (*hashRecord, error) {
 	key := path.Join(f.Fs.Root(), remote)
-	op := &kvGet{
-		key:  key,
-		fp:   fp,
-		hash: hashType.String(),
-		age:  age,
-	}
-	err := f.db.Do(false, op)
-	return op.val, err
+	if f.db != nil {
+		op := &kvGet{
+			key:  key,
+			fp:   fp,
+			hash: need,
+			age:  age,
+		}
+		err := f.db.Do(false, op)
+		if (err == nil && (need == "" || op.val != "")) || f.store == nil {
+			return op.record, err
+		}
+	}
+	if f.store == nil {
+		return nil, errNoRecord
+	}
+	r, err := f.store.get(ctx, remote, obj)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.check(fp, age); err != nil {
+		return nil, err
+	}
+	if f.db != nil {
+		if err := f.db.Do(true, &kvSet{key: key, record: r}); err != nil {
+			fs.Debugf(remote, "failed to cache hashes: %v", err)
+		}
+	}
+	return r, nil
 }
 
 // put new hashes for an object
@@ -48,22 +85,36 @@ func (o *Object) putHashes(ctx context.Context, rawHashes hashMap) error {
 	if fp == "" {
 		return nil
 	}
-	key := path.Join(o.f.Fs.Root(), o.Remote())
 	hashes := operations.HashSums{}
 	for hashType, hashVal := range rawHashes {
 		hashes[hashType.String()] = hashVal
 	}
-	return o.f.putRawHashes(ctx, key, fp, hashes)
+	return o.f.putRawHashes(ctx, o.Remote(), o.Object, fp, hashes)
 }
 
-// set hashes for a path without any validation
-func (f *Fs) putRawHashes(ctx context.Context, key, fp string, hashes operations.HashSums) error {
-	return f.db.Do(true, &kvPut{
-		key:    key,
-		fp:     fp,
-		hashes: hashes,
-		age:    time.Duration(f.opt.MaxAge),
-	})
+// set hashes for a path without any validation. The base object obj
+// may be nil.
+func (f *Fs) putRawHashes(ctx context.Context, remote string, obj fs.Object, fp string, hashes operations.HashSums) error {
+	return f.putRecord(ctx, remote, obj, fp, hashes, time.Time{})
+}
+
+// add hashes to the record for a path, setting the verified time if
+// not zero. The base object obj may be nil.
+func (f *Fs) putRecord(ctx context.Context, remote string, obj fs.Object, fp string, hashes operations.HashSums, verified time.Time) (err error) {
+	age := time.Duration(f.opt.MaxAge)
+	if f.db != nil {
+		err = f.db.Do(true, &kvPut{
+			key:      path.Join(f.Fs.Root(), remote),
+			fp:       fp,
+			hashes:   hashes,
+			verified: verified,
+			age:      age,
+		})
+	}
+	if f.store != nil {
+		err = f.store.put(ctx, remote, obj, fp, hashes, verified, age)
+	}
+	return err
 }
 
 // Hash returns the selected checksum of the file or "" if unavailable.
@@ -126,13 +177,13 @@ func (o *Object) updateHashes(ctx context.Context) error {
 
 // Update the object with the given data, time and size.
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
-	_ = o.f.pruneHash(src.Remote())
+	_ = o.f.pruneHash(ctx, src.Remote())
 	return o.Object.Update(ctx, in, src, options...)
 }
 
 // Remove an object.
 func (o *Object) Remove(ctx context.Context) error {
-	_ = o.f.pruneHash(o.Remote())
+	_ = o.f.pruneHash(ctx, o.Remote())
 	return o.Object.Remove(ctx)
 }
 
@@ -142,7 +193,7 @@ func (o *Object) Remove(ctx context.Context) error {
 // on backends that don't provide modTime with fingerprint.
 func (o *Object) SetModTime(ctx context.Context, mtime time.Time) error {
 	if mtime != o.Object.ModTime(ctx) {
-		_ = o.f.pruneHash(o.Remote())
+		_ = o.f.pruneHash(ctx, o.Remote())
 	}
 	return o.Object.SetModTime(ctx, mtime)
 }
@@ -188,6 +239,9 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 		rehash bool
 		hashes hashMap
 	)
+	if err := f.checkRemote(src.Remote()); err != nil {
+		return nil, err
+	}
 	if fsrc := src.Fs(); fsrc != nil {
 		common = fsrc.Hashes().Overlap(f.keepHashes)
 		// Rehash if source does not have all required hashes or hashing is slow
@@ -207,7 +261,7 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 		}
 	}
 
-	_ = f.pruneHash(src.Remote())
+	_ = f.pruneHash(ctx, src.Remote())
 	oResult, err := f.Fs.Put(ctx, wrapIn, src, options...)
 	o, err = f.wrapObject(oResult, err)
 	if err != nil {
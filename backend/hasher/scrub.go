@@ -0,0 +1,189 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/sync/errgroup"
+)
+
+// scrubResult is the output of the scrub command
+type scrubResult struct {
+	Verified   int             `json:"verified"`   // objects whose hashes matched
+	Bytes      int64           `json:"bytes"`      // bytes read
+	Unhashed   int             `json:"unhashed"`   // objects without stored hashes
+	Remaining  int             `json:"remaining"`  // objects left for the next scrub
+	Mismatches []scrubMismatch `json:"mismatches"` // objects whose hashes didn't match
+	Errors     []scrubError    `json:"errors"`     // objects which couldn't be read
+}
+
+// scrubMismatch describes an object whose hash doesn't match
+type scrubMismatch struct {
+	Remote   string `json:"remote"`
+	Hash     string `json:"hash"`
+	Stored   string `json:"stored"`
+	Computed string `json:"computed"`
+}
+
+// scrubError describes an object which couldn't be scrubbed
+type scrubError struct {
+	Remote string `json:"remote"`
+	Error  string `json:"error"`
+}
+
+// scrubItem is an object to scrub with its stored record
+type scrubItem struct {
+	o *Object
+	r *hashRecord
+}
+
+// scrub re-reads the objects with stored hashes, least recently
+// verified first, and compares their hashes with the stored ones
+// until maxBytes have been read or maxDuration has passed, if set.
+func (f *Fs) scrub(ctx context.Context, maxBytes int64, maxDuration time.Duration) (*scrubResult, error) {
+	maxAge := time.Duration(f.opt.MaxAge)
+	if maxAge <= 0 {
+		return nil, errors.New("checksums are not cached as max_age is 0")
+	}
+	start := time.Now()
+	res := &scrubResult{
+		Mismatches: []scrubMismatch{},
+		Errors:     []scrubError{},
+	}
+
+	// Find the objects with stored hashes
+	var (
+		items []scrubItem
+		mu    sync.Mutex
+	)
+	err := operations.ListFn(ctx, f, func(obj fs.Object) {
+		o, ok := obj.(*Object)
+		if !ok {
+			return
+		}
+		fp := o.fingerprint(ctx)
+		r, err := f.getRecord(ctx, o.Remote(), o.Object, fp, maxAge, "")
+		mu.Lock()
+		defer mu.Unlock()
+		if fp == "" || err != nil || len(r.Hashes) == 0 {
+			res.Unhashed++
+			return
+		}
+		items = append(items, scrubItem{o: o, r: r})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		ri, rj := items[i].r, items[j].r
+		if !ri.Verified.Equal(rj.Verified) {
+			return ri.Verified.Before(rj.Verified)
+		}
+		return ri.Created.Before(rj.Created)
+	})
+
+	// Verify them within the budget
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	var reserved int64
+	for i, item := range items {
+		size := item.o.Size()
+		if i > 0 && ((maxBytes > 0 && reserved+size > maxBytes) || (maxDuration > 0 && time.Since(start) > maxDuration)) {
+			res.Remaining = len(items) - i
+			break
+		}
+		reserved += size
+		item := item
+		g.Go(func() error {
+			mismatches, n, err := f.scrubObject(gCtx, item.o, item.r)
+			mu.Lock()
+			defer mu.Unlock()
+			res.Bytes += n
+			switch {
+			case err != nil:
+				fs.Errorf(item.o, "Scrub failed: %v", err)
+				res.Errors = append(res.Errors, scrubError{Remote: item.o.Remote(), Error: err.Error()})
+			case len(mismatches) > 0:
+				for _, m := range mismatches {
+					fs.Errorf(item.o, "Scrub found %s mismatch: stored %q, computed %q", m.Hash, m.Stored, m.Computed)
+				}
+				res.Mismatches = append(res.Mismatches, mismatches...)
+			default:
+				res.Verified++
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	fs.Infof(f, "Scrub: %d verified, %d mismatched, %d errors, %d left for the next scrub, %d without hashes",
+		res.Verified, len(res.Mismatches), len(res.Errors), res.Remaining, res.Unhashed)
+	return res, ctx.Err()
+}
+
+// scrubObject reads o comparing its hashes with the record r, and
+// records the time it was verified if they match. It returns the
+// mismatching hashes and the number of bytes read.
+func (f *Fs) scrubObject(ctx context.Context, o *Object, r *hashRecord) (mismatches []scrubMismatch, n int64, err error) {
+	var hashes hash.Set
+	for hashName := range r.Hashes {
+		var ht hash.Type
+		if ht.Set(hashName) == nil && f.keepHashes.Contains(ht) {
+			hashes.Add(ht)
+		}
+	}
+	if hashes.Count() == 0 {
+		return nil, 0, errors.New("no stored hashes to verify")
+	}
+	hasher, err := hash.NewMultiHasherTypes(hashes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Read the base object so the stored hashes aren't updated
+	in, err := o.Object.Open(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open: %w", err)
+	}
+	tr := accounting.Stats(ctx).NewTransfer(o)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	acc := tr.Account(ctx, in).WithBuffer()
+	n, err = io.Copy(hasher, acc)
+	closeErr := acc.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, n, fmt.Errorf("failed to read: %w", err)
+	}
+
+	for ht, sum := range hasher.Sums() {
+		if stored := r.Hashes[ht.String()]; stored != sum {
+			mismatches = append(mismatches, scrubMismatch{
+				Remote:   o.Remote(),
+				Hash:     ht.String(),
+				Stored:   stored,
+				Computed: sum,
+			})
+		}
+	}
+	if len(mismatches) > 0 {
+		// leave the record alone to be checked again
+		return mismatches, n, nil
+	}
+	err = f.putRecord(ctx, o.Remote(), o.Object, r.Fp, nil, time.Now())
+	if err != nil {
+		return nil, n, fmt.Errorf("failed to record verification: %w", err)
+	}
+	return nil, n, nil
+}
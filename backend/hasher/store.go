@@ -0,0 +1,567 @@
+package hasher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/sync/errgroup"
+)
+
+// Errors returned by the remote stores
+var (
+	errNoRecord = errors.New("no record")
+	errNoDB     = errors.New("no local database - storage is not \"local\" and local_cache is not set")
+)
+
+// remoteStore keeps hash records on the remote itself so they are
+// shared by every client of the remote
+//
+// The remote paths are relative to the root of the base remote. The
+// base object obj may be nil if it isn't known.
+type remoteStore interface {
+	// get the record for the object at remote
+	get(ctx context.Context, remote string, obj fs.Object) (*hashRecord, error)
+	// put hashes for the object at remote with fingerprint fp,
+	// setting the verified time if not zero
+	put(ctx context.Context, remote string, obj fs.Object, fp string, hashes operations.HashSums, verified time.Time, age time.Duration) error
+	// prune the record for remote
+	prune(ctx context.Context, remote string) error
+	// moveFrom moves the record for srcRemote in src to dstRemote
+	moveFrom(ctx context.Context, src remoteStore, srcRemote, dstRemote string) error
+}
+
+//
+// Sidecar objects
+//
+
+const (
+	sidecarVersion = 1
+	// sidecarFlushDelay is how long changes to a sidecar are
+	// gathered before it is written
+	sidecarFlushDelay = 5 * time.Second
+	// sidecarCacheTime is how long a sidecar is used from memory
+	// before it is read again
+	sidecarCacheTime = time.Minute
+)
+
+// sidecarFile is the content of a sidecar object, which holds the
+// records for the files in its directory by file name
+type sidecarFile struct {
+	Version int                    `json:"version"`
+	Files   map[string]*hashRecord `json:"files"`
+}
+
+// sidecarDir is the state of the sidecar of one directory
+type sidecarDir struct {
+	sc      *sidecarFile           // the sidecar with the pending changes, nil if not read
+	read    time.Time              // when sc was read from the remote
+	pending map[string]*hashRecord // changes to write by file name, nil to remove
+	timer   *time.Timer            // set while a flush of pending is due
+}
+
+// sidecarStore keeps hash records in a sidecar object per directory
+//
+// Sidecars are cached in memory for sidecarCacheTime. Changes are
+// gathered for sidecarFlushDelay then written in one go, reading the
+// sidecar again first so changes made by other clients aren't lost,
+// unless they are made at the same time. Any changes left are written
+// on Shutdown.
+type sidecarStore struct {
+	f       *Fs
+	name    string                 // name of the sidecar objects
+	mu      sync.Mutex             // protects the fields below and the sidecars
+	dirs    map[string]*sidecarDir // sidecars by directory
+	locks   map[string]*sync.Mutex // serialise reads and writes by directory
+	expired time.Time              // when dirs was last expired
+}
+
+func newSidecarStore(f *Fs, name string) *sidecarStore {
+	return &sidecarStore{
+		f:       f,
+		name:    name,
+		dirs:    map[string]*sidecarDir{},
+		locks:   map[string]*sync.Mutex{},
+		expired: time.Now(),
+	}
+}
+
+// isSidecar returns true if remote is the path of a sidecar object
+func (s *sidecarStore) isSidecar(remote string) bool {
+	return path.Base(remote) == s.name
+}
+
+// splitRemote returns the directory and file name of remote
+func splitRemote(remote string) (dir, leaf string) {
+	dir, leaf = path.Split(remote)
+	return strings.TrimSuffix(dir, "/"), leaf
+}
+
+// lock the directory dir for reads and writes returning the unlock
+// function
+func (s *sidecarStore) lock(dir string) func() {
+	s.mu.Lock()
+	mu := s.locks[dir]
+	if mu == nil {
+		mu = &sync.Mutex{}
+		s.locks[dir] = mu
+	}
+	s.mu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// load the sidecar in dir from the remote
+func (s *sidecarStore) load(ctx context.Context, dir string) (*sidecarFile, error) {
+	sc := &sidecarFile{
+		Version: sidecarVersion,
+		Files:   map[string]*hashRecord{},
+	}
+	obj, err := s.f.Fs.NewObject(ctx, path.Join(dir, s.name))
+	if err == fs.ErrorObjectNotFound {
+		return sc, nil
+	} else if err != nil {
+		return nil, err
+	}
+	in, err := obj.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = json.NewDecoder(in).Decode(sc)
+	_ = in.Close()
+	if err != nil || sc.Version > sidecarVersion || sc.Files == nil {
+		// It will be written afresh when updated
+		fs.Errorf(obj, "Ignoring bad hash sidecar (err: %v)", err)
+		sc.Version = sidecarVersion
+		sc.Files = map[string]*hashRecord{}
+	}
+	return sc, nil
+}
+
+// apply the pending changes to sc
+func (sc *sidecarFile) apply(pending map[string]*hashRecord) {
+	for leaf, r := range pending {
+		if r == nil {
+			delete(sc.Files, leaf)
+		} else {
+			sc.Files[leaf] = r
+		}
+	}
+}
+
+// dir returns the state of dir, making it if necessary
+//
+// Call with s.mu held.
+func (s *sidecarStore) dir(dir string) *sidecarDir {
+	d := s.dirs[dir]
+	if d == nil {
+		d = &sidecarDir{}
+		s.dirs[dir] = d
+	}
+	return d
+}
+
+// expire drops the sidecars which haven't been read recently and
+// have nothing to write
+//
+// Call with s.mu held.
+func (s *sidecarStore) expire(now time.Time) {
+	if now.Sub(s.expired) < sidecarCacheTime {
+		return
+	}
+	s.expired = now
+	for dir, d := range s.dirs {
+		if d.pending == nil && now.Sub(d.read) >= sidecarCacheTime {
+			delete(s.dirs, dir)
+		}
+	}
+}
+
+// read makes sure the sidecar for dir is in the cache and fresh,
+// reading it from the remote if necessary
+func (s *sidecarStore) read(ctx context.Context, dir string) error {
+	fresh := func() bool {
+		d := s.dirs[dir]
+		return d != nil && d.sc != nil && time.Since(d.read) < sidecarCacheTime
+	}
+	s.mu.Lock()
+	ok := fresh()
+	s.mu.Unlock()
+	if ok {
+		return nil
+	}
+	defer s.lock(dir)()
+	s.mu.Lock()
+	ok = fresh()
+	s.mu.Unlock()
+	if ok {
+		return nil
+	}
+	sc, err := s.load(ctx, dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	d := s.dir(dir)
+	sc.apply(d.pending)
+	d.sc, d.read = sc, now
+	return nil
+}
+
+// change the record for leaf in dir with fn, which returns the new
+// record, or nil to remove it, and false if nothing changed
+//
+// The change is written to the remote after sidecarFlushDelay.
+func (s *sidecarStore) change(ctx context.Context, dir, leaf string, fn func(old *hashRecord) (*hashRecord, bool)) error {
+	if err := s.read(ctx, dir); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.dir(dir)
+	if d.sc == nil {
+		// dropped since read so read again when next needed
+		d.sc = &sidecarFile{Version: sidecarVersion, Files: map[string]*hashRecord{}}
+	}
+	r, changed := fn(d.sc.Files[leaf])
+	if !changed {
+		return nil
+	}
+	d.sc.apply(map[string]*hashRecord{leaf: r})
+	if d.pending == nil {
+		d.pending = map[string]*hashRecord{}
+	}
+	d.pending[leaf] = r
+	if d.timer == nil {
+		d.timer = time.AfterFunc(sidecarFlushDelay, func() {
+			if err := s.flush(context.Background(), dir); err != nil {
+				// the changes are kept for the next flush
+				fs.Errorf(s.f, "Failed to write hash sidecar in %q: %v", dir, err)
+			}
+		})
+	}
+	return nil
+}
+
+// write the sidecar for dir to the remote, removing it if empty
+func (s *sidecarStore) write(ctx context.Context, dir string, sc *sidecarFile) error {
+	remote := path.Join(dir, s.name)
+	obj, err := s.f.Fs.NewObject(ctx, remote)
+	if err != nil && err != fs.ErrorObjectNotFound {
+		return err
+	}
+	if len(sc.Files) == 0 {
+		if obj == nil {
+			return nil
+		}
+		return obj.Remove(ctx)
+	}
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+	info := object.NewStaticObjectInfo(remote, time.Now(), int64(len(data)), true, nil, s.f.Fs)
+	if obj != nil {
+		return obj.Update(ctx, bytes.NewReader(data), info)
+	}
+	_, err = s.f.Fs.Put(ctx, bytes.NewReader(data), info)
+	return err
+}
+
+// flush writes the pending changes to the sidecar in dir
+func (s *sidecarStore) flush(ctx context.Context, dir string) (err error) {
+	defer s.lock(dir)()
+	s.mu.Lock()
+	d := s.dirs[dir]
+	if d == nil || d.pending == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	pending := d.pending
+	d.pending = nil
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	s.mu.Unlock()
+
+	sc, err := s.load(ctx, dir)
+	if err == nil {
+		sc.apply(pending)
+		err = s.write(ctx, dir, sc)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d != s.dirs[dir] {
+		// dropped by Purge while writing
+		return err
+	}
+	if err != nil {
+		// keep the changes unless superseded
+		if d.pending == nil {
+			d.pending = map[string]*hashRecord{}
+		}
+		for leaf, r := range pending {
+			if _, found := d.pending[leaf]; !found {
+				d.pending[leaf] = r
+			}
+		}
+		return err
+	}
+	// cache what was written with any changes made since
+	sc.apply(d.pending)
+	d.sc, d.read = sc, time.Now()
+	return nil
+}
+
+// flushAll writes the pending changes to all the sidecars
+func (s *sidecarStore) flushAll(ctx context.Context) error {
+	s.mu.Lock()
+	var dirs []string
+	for dir, d := range s.dirs {
+		if d.pending != nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	s.mu.Unlock()
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	for _, dir := range dirs {
+		dir := dir
+		g.Go(func() error {
+			if err := s.flush(gCtx, dir); err != nil {
+				return fmt.Errorf("failed to write hash sidecar in %q: %w", dir, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// forget the sidecars in dir and below without writing their changes
+func (s *sidecarStore) forget(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for scDir, d := range s.dirs {
+		if dir == "" || scDir == dir || strings.HasPrefix(scDir, dir+"/") {
+			if d.timer != nil {
+				d.timer.Stop()
+			}
+			delete(s.dirs, scDir)
+		}
+	}
+}
+
+func (s *sidecarStore) get(ctx context.Context, remote string, obj fs.Object) (*hashRecord, error) {
+	dir, leaf := splitRemote(remote)
+	if err := s.read(ctx, dir); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	var r *hashRecord
+	if d := s.dirs[dir]; d != nil && d.sc != nil {
+		r = d.sc.Files[leaf]
+	}
+	s.mu.Unlock()
+	if r == nil {
+		return nil, errNoRecord
+	}
+	return r, nil
+}
+
+func (s *sidecarStore) put(ctx context.Context, remote string, obj fs.Object, fp string, hashes operations.HashSums, verified time.Time, age time.Duration) error {
+	dir, leaf := splitRemote(remote)
+	return s.change(ctx, dir, leaf, func(old *hashRecord) (*hashRecord, bool) {
+		r := &hashRecord{}
+		if old != nil {
+			r.Fp, r.Created, r.Verified = old.Fp, old.Created, old.Verified
+			r.Hashes = operations.HashSums{}
+			for hashName, hashVal := range old.Hashes {
+				r.Hashes[hashName] = hashVal
+			}
+		}
+		r.update(fp, hashes, verified, age)
+		return r, true
+	})
+}
+
+func (s *sidecarStore) prune(ctx context.Context, remote string) error {
+	dir, leaf := splitRemote(remote)
+	return s.change(ctx, dir, leaf, func(old *hashRecord) (*hashRecord, bool) {
+		return nil, old != nil
+	})
+}
+
+func (s *sidecarStore) moveFrom(ctx context.Context, src remoteStore, srcRemote, dstRemote string) error {
+	srcStore, ok := src.(*sidecarStore)
+	if !ok {
+		return nil
+	}
+	r, err := srcStore.get(ctx, srcRemote, nil)
+	if err == errNoRecord {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = srcStore.prune(ctx, srcRemote); err != nil {
+		return err
+	}
+	dir, leaf := splitRemote(dstRemote)
+	return s.change(ctx, dir, leaf, func(old *hashRecord) (*hashRecord, bool) {
+		return r, true
+	})
+}
+
+// prepareRmdir removes the sidecar from dir if it is the only thing
+// left in it so the directory can be removed
+func (s *sidecarStore) prepareRmdir(ctx context.Context, dir string) error {
+	if err := s.flush(ctx, dir); err != nil {
+		return err
+	}
+	entries, err := s.f.Fs.List(ctx, dir)
+	if err != nil || len(entries) != 1 {
+		return err
+	}
+	obj, ok := entries[0].(fs.Object)
+	if !ok || !s.isSidecar(obj.Remote()) {
+		return nil
+	}
+	defer s.lock(dir)()
+	s.forget(dir)
+	return obj.Remove(ctx)
+}
+
+//
+// Object metadata
+//
+
+// Metadata keys used for hash records
+const (
+	metadataPrefix   = "hasher-"
+	metadataFp       = metadataPrefix + "fp"
+	metadataCreated  = metadataPrefix + "created"
+	metadataVerified = metadataPrefix + "verified"
+)
+
+// metadataStore keeps hash records in the user metadata of the
+// objects, so they move, copy and disappear with them
+type metadataStore struct {
+	f *Fs
+}
+
+// object returns obj or finds the base object at remote
+func (s *metadataStore) object(ctx context.Context, remote string, obj fs.Object) (fs.Object, error) {
+	if obj != nil {
+		return obj, nil
+	}
+	return s.f.Fs.NewObject(ctx, remote)
+}
+
+func (s *metadataStore) get(ctx context.Context, remote string, obj fs.Object) (*hashRecord, error) {
+	obj, err := s.object(ctx, remote, obj)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := fs.GetMetadata(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	fp, found := metadata[metadataFp]
+	if !found {
+		return nil, errNoRecord
+	}
+	r := &hashRecord{
+		Fp:     fp,
+		Hashes: operations.HashSums{},
+	}
+	if r.Created, err = time.Parse(time.RFC3339Nano, metadata[metadataCreated]); err != nil {
+		return nil, fmt.Errorf("invalid record: %w", err)
+	}
+	if verified := metadata[metadataVerified]; verified != "" {
+		if r.Verified, err = time.Parse(time.RFC3339Nano, verified); err != nil {
+			return nil, fmt.Errorf("invalid record: %w", err)
+		}
+	}
+	for key, val := range metadata {
+		if key != metadataFp && key != metadataCreated && key != metadataVerified && strings.HasPrefix(key, metadataPrefix) && val != "" {
+			r.Hashes[strings.TrimPrefix(key, metadataPrefix)] = val
+		}
+	}
+	return r, nil
+}
+
+func (s *metadataStore) put(ctx context.Context, remote string, obj fs.Object, fp string, hashes operations.HashSums, verified time.Time, age time.Duration) error {
+	obj, err := s.object(ctx, remote, obj)
+	if err != nil {
+		return err
+	}
+	do, ok := obj.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	r, err := s.get(ctx, remote, obj)
+	if err != nil {
+		r = &hashRecord{}
+	}
+	r.update(fp, hashes, verified, age)
+	metadata := fs.Metadata{
+		metadataFp:       r.Fp,
+		metadataCreated:  r.Created.Format(time.RFC3339Nano),
+		metadataVerified: "",
+	}
+	if !r.Verified.IsZero() {
+		metadata[metadataVerified] = r.Verified.Format(time.RFC3339Nano)
+	}
+	// Metadata keys can't be removed so blank out old hashes
+	for _, hashType := range s.f.keepHashes.Array() {
+		metadata[metadataPrefix+hashType.String()] = ""
+	}
+	for hashName, hashVal := range r.Hashes {
+		metadata[metadataPrefix+hashName] = hashVal
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// prune clears the fingerprint of the record as the metadata keys
+// can't be removed
+func (s *metadataStore) prune(ctx context.Context, remote string) error {
+	obj, err := s.f.Fs.NewObject(ctx, remote)
+	if err == fs.ErrorObjectNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r, err := s.get(ctx, remote, obj)
+	if err != nil || r.Fp == "" {
+		return nil
+	}
+	do, ok := obj.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, fs.Metadata{metadataFp: ""})
+}
+
+// moveFrom does nothing as the records move with the objects
+func (s *metadataStore) moveFrom(ctx context.Context, src remoteStore, srcRemote, dstRemote string) error {
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ remoteStore = (*sidecarStore)(nil)
+	_ remoteStore = (*metadataStore)(nil)
+)
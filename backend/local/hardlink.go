@@ -0,0 +1,190 @@
+// Hard link preservation
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// hardLinkKey identifies a file by device and inode
+type hardLinkKey struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkGroup is the destination of the first file copied from a
+// group of hard linked source files
+type hardLinkGroup struct {
+	done chan struct{} // closed when the first file has been written
+	path string        // path of the first file or "" on failure - protected by Fs.hardLinksMu
+}
+
+// linkInto makes a hard link to oldPath at newPath, replacing any
+// existing file at newPath atomically.
+func linkInto(oldPath, newPath string) error {
+	tmpPath := newPath + ".rclone-link-" + random.String(8)
+	err := os.Link(oldPath, tmpPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, newPath)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// srcHardLinkKey returns the key identifying the source of src if
+// it is a local file with more than one hard link to it.
+func srcHardLinkKey(src fs.ObjectInfo) (key hardLinkKey, ok bool) {
+	srcObj := unWrapLocal(src)
+	if srcObj == nil || srcObj.translatedLink {
+		return key, false
+	}
+	fi, err := os.Lstat(srcObj.path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return key, false
+	}
+	key, nlink, ok := readHardLink(fi)
+	if !ok || nlink <= 1 {
+		return key, false
+	}
+	return key, true
+}
+
+// claimHardLink finds the group for key. If this is the first file in
+// the group it returns first as true and the caller must call
+// finishHardLink when it has been written.
+func (f *Fs) claimHardLink(key hardLinkKey) (group *hardLinkGroup, first bool) {
+	f.hardLinksMu.Lock()
+	defer f.hardLinksMu.Unlock()
+	if group = f.hardLinks[key]; group != nil {
+		return group, false
+	}
+	group = &hardLinkGroup{done: make(chan struct{})}
+	f.hardLinks[key] = group
+	return group, true
+}
+
+// finishHardLink records path as the first file written for group,
+// or "" if writing it failed, releasing any waiters.
+func (f *Fs) finishHardLink(group *hardLinkGroup, path string) {
+	f.hardLinksMu.Lock()
+	group.path = path
+	if path != "" {
+		f.hardLinkPaths[path] = group
+	}
+	f.hardLinksMu.Unlock()
+	close(group.done)
+}
+
+// renameHardLink updates any group whose first file was at oldPath
+// after it has been renamed to newPath, e.g. from a partial file.
+func (f *Fs) renameHardLink(oldPath, newPath string) {
+	f.hardLinksMu.Lock()
+	defer f.hardLinksMu.Unlock()
+	group := f.hardLinkPaths[oldPath]
+	if group == nil {
+		return
+	}
+	delete(f.hardLinkPaths, oldPath)
+	group.path = newPath
+	f.hardLinkPaths[newPath] = group
+}
+
+// hardLinkPath returns the path of the first file in group
+func (f *Fs) hardLinkPath(group *hardLinkGroup) string {
+	f.hardLinksMu.Lock()
+	defer f.hardLinksMu.Unlock()
+	return group.path
+}
+
+// linkToGroup waits for the first file in group to be written then
+// hard links o to it if it still looks like src.
+//
+// It returns false if o couldn't be linked, in which case it should
+// be copied instead.
+func (o *Object) linkToGroup(ctx context.Context, group *hardLinkGroup, src fs.ObjectInfo) bool {
+	select {
+	case <-group.done:
+	case <-ctx.Done():
+		return false
+	}
+	// Try twice in case the first file is renamed while linking
+	var err error
+	for try := 0; try < 2; try++ {
+		path := o.fs.hardLinkPath(group)
+		if path == "" || path == o.path {
+			return false
+		}
+		// Check the first file hasn't been changed since it was written
+		var fi os.FileInfo
+		fi, err = os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil || fi.Size() != src.Size() {
+			return false
+		}
+		if !o.fs.opt.NoSetModTime && !fi.ModTime().Equal(src.ModTime(ctx)) {
+			return false
+		}
+		err = linkInto(path, o.path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			break
+		}
+		fs.Debugf(o, "Hard linked to %q", path)
+		return true
+	}
+	fs.Debugf(o, "Failed to hard link, copying instead: %v", err)
+	return false
+}
+
+// writePath returns the path to write the data of o to.
+//
+// If o is hard linked to other files then writing to it would change
+// them too, so this returns a temporary path next to it which
+// finishWrite renames over it once the data has been written. This
+// leaves the old file in place if the write fails. Otherwise it
+// returns o.path.
+//
+// If o has been read from disk then the link count read then is used
+// and the file is only looked at again if it has more than one link.
+func (o *Object) writePath() string {
+	o.fs.objectMetaMu.RLock()
+	nlink, known := o.nlink, !o.modTime.IsZero()
+	o.fs.objectMetaMu.RUnlock()
+	if known && nlink <= 1 {
+		return o.path
+	}
+	fi, err := os.Lstat(o.path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return o.path
+	}
+	_, nlink, ok := readHardLink(fi)
+	if !ok || nlink <= 1 {
+		return o.path
+	}
+	return o.path + ".rclone-write-" + random.String(8)
+}
+
+// finishWrite renames the data written to path over o.path if path
+// is a temporary file from writePath
+func (o *Object) finishWrite(path string) error {
+	if path == o.path {
+		return nil
+	}
+	err := os.Rename(path, o.path)
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to replace hard link: %w", err)
+	}
+	return nil
+}
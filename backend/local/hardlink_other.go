@@ -0,0 +1,17 @@
+// Hard link reading functions
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package local
+
+import "os"
+
+// readHardLink returns the device and inode identifying the file fi
+// and the number of hard links to it.
+//
+// ok is false if they can't be read which is always the case on
+// this OS.
+func readHardLink(fi os.FileInfo) (key hardLinkKey, nlink uint64, ok bool) {
+	return key, 0, false
+}
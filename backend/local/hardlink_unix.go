@@ -0,0 +1,27 @@
+// Hard link reading functions
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package local
+
+import (
+	"os"
+	"syscall"
+)
+
+// readHardLink returns the device and inode identifying the file fi
+// and the number of hard links to it.
+//
+// ok is false if they can't be read.
+func readHardLink(fi os.FileInfo) (key hardLinkKey, nlink uint64, ok bool) {
+	statT, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return key, 0, false
+	}
+	key = hardLinkKey{
+		dev: uint64(statT.Dev), // nolint: unconvert
+		ino: uint64(statT.Ino), // nolint: unconvert
+	}
+	return key, uint64(statT.Nlink), true // nolint: unconvert
+}
@@ -186,12 +186,33 @@ Use this flag to disable preallocation.`,
 			Advanced: true,
 		}, {
 			Name: "no_sparse",
-			Help: `Disable sparse files for multi-thread downloads.
+			Help: `Disable sparse files.
 
-On Windows platforms rclone will make sparse files when doing
+Rclone writes holes in files instead of blocks of zeros where it
+can. When copying from a local file it finds the holes in the source
+with SEEK_DATA and SEEK_HOLE (Linux, macOS and FreeBSD only) and
+leaves them unwritten, whether the file is copied with one stream or
+several.
+
+On Windows platforms rclone will also make sparse files when doing
 multi-thread downloads. This avoids long pauses on large files where
-the OS zeros the file. However sparse files may be undesirable as they
-cause disk fragmentation and can be slow to work with.`,
+the OS zeros the file.
+
+However sparse files may be undesirable as they cause disk
+fragmentation and can be slow to work with.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "no_hard_links",
+			Help: `Disable preserving hard links.
+
+Normally when rclone copies a group of hard linked local files to the
+local backend it copies the first one and hard links the others to it,
+so the group is recreated at the destination. It also removes any hard
+link at the destination before writing a file so the files it is
+linked to aren't changed.
+
+Use this flag to copy each file in full instead.`,
 			Default:  false,
 			Advanced: true,
 		}, {
@@ -228,6 +249,7 @@ type Options struct {
 	CaseInsensitive   bool                 `config:"case_insensitive"`
 	NoPreAllocate     bool                 `config:"no_preallocate"`
 	NoSparse          bool                 `config:"no_sparse"`
+	NoHardLinks       bool                 `config:"no_hard_links"`
 	NoSetModTime      bool                 `config:"no_set_modtime"`
 	Enc               encoder.MultiEncoder `config:"encoding"`
 }
@@ -248,6 +270,10 @@ type Fs struct {
 	// do os.Lstat or os.Stat
 	lstat        func(name string) (os.FileInfo, error)
 	objectMetaMu sync.RWMutex // global lock for Object metadata
+
+	hardLinksMu   sync.Mutex                     // protect hardLinks and hardLinkPaths
+	hardLinks     map[hardLinkKey]*hardLinkGroup // destinations of hard linked source files
+	hardLinkPaths map[string]*hardLinkGroup      // groups by the path of their first file
 }
 
 // Object represents a local filesystem object
@@ -259,6 +285,7 @@ type Object struct {
 	size    int64 // file metadata - always present
 	mode    os.FileMode
 	modTime time.Time
+	nlink   uint64               // number of hard links or 0 if unknown
 	hashes  map[hash.Type]string // Hashes
 	// these are read only and don't need the mutex held
 	translatedLink bool // Is this object a translated link
@@ -284,11 +311,13 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	}
 
 	f := &Fs{
-		name:   name,
-		opt:    *opt,
-		warned: make(map[string]struct{}),
-		dev:    devUnset,
-		lstat:  os.Lstat,
+		name:          name,
+		opt:           *opt,
+		warned:        make(map[string]struct{}),
+		dev:           devUnset,
+		lstat:         os.Lstat,
+		hardLinks:     make(map[hardLinkKey]*hardLinkGroup),
+		hardLinkPaths: make(map[string]*hardLinkGroup),
 	}
 	if xattrSupported {
 		f.xattrSupported = 1
@@ -644,6 +673,56 @@ func (f *Fs) Rmdir(ctx context.Context, dir string) error {
 	return os.Remove(f.localPath(dir))
 }
 
+// dirObject returns an Object for the directory dir so the Object
+// methods for reading and writing metadata can be used on it.
+//
+// It returns fs.ErrorDirNotFound if dir isn't a directory.
+func (f *Fs) dirObject(dir string) (*Object, error) {
+	o := &Object{
+		fs:     f,
+		remote: dir,
+		path:   f.localPath(dir),
+	}
+	fi, err := os.Stat(o.path)
+	if os.IsNotExist(err) || (err == nil && !fi.IsDir()) {
+		return nil, fs.ErrorDirNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// DirSetModTime sets the modification time of the directory dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	if f.opt.NoSetModTime {
+		return nil
+	}
+	o, err := f.dirObject(dir)
+	if err != nil {
+		return err
+	}
+	return o.setTimes(modTime, modTime)
+}
+
+// DirMetadata returns the metadata of the directory dir
+func (f *Fs) DirMetadata(ctx context.Context, dir string) (metadata fs.Metadata, err error) {
+	o, err := f.dirObject(dir)
+	if err != nil {
+		return nil, err
+	}
+	return o.Metadata(ctx)
+}
+
+// DirSetMetadata sets metadata on the directory dir
+func (f *Fs) DirSetMetadata(ctx context.Context, dir string, metadata fs.Metadata) error {
+	o, err := f.dirObject(dir)
+	if err != nil {
+		return err
+	}
+	return o.writeMetadata(metadata)
+}
+
 // Precision of the file system
 func (f *Fs) Precision() (precision time.Duration) {
 	if f.opt.NoSetModTime {
@@ -782,6 +861,65 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		fs.Debugf(src, "Can't move: %v: trying copy", err)
 		return nil, fs.ErrorCantMove
 	}
+	srcObj.fs.renameHardLink(srcObj.path, dstObj.path)
+
+	// Update the info
+	err = dstObj.lstat()
+	if err != nil {
+		return nil, err
+	}
+
+	return dstObj, nil
+}
+
+// HardLink makes a hard link to src at remote on this remote,
+// replacing any existing object there.
+//
+// # It returns the destination Object and a possible error
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantHardLink
+func (f *Fs) HardLink(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't hard link - not same remote type")
+		return nil, fs.ErrorCantHardLink
+	}
+
+	// Temporary Object under construction
+	dstObj := f.newObject(remote)
+
+	// Check it is a file if it exists
+	err := dstObj.lstat()
+	if os.IsNotExist(err) {
+		// OK
+	} else if err != nil {
+		return nil, err
+	} else {
+		dstObj.fs.objectMetaMu.RLock()
+		dstObjMode := dstObj.mode
+		dstObj.fs.objectMetaMu.RUnlock()
+		if !dstObj.fs.isRegular(dstObjMode) {
+			// It isn't a file
+			return nil, errors.New("can't hard link file onto non-file")
+		}
+	}
+
+	// Create destination
+	err = dstObj.mkdirAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Do the link
+	err = linkInto(srcObj.path, dstObj.path)
+	if err != nil {
+		// probably trying to link across file system boundaries
+		// or the file system doesn't support hard links
+		fs.Debugf(src, "Can't hard link: %v", err)
+		return nil, fs.ErrorCantHardLink
+	}
 
 	// Update the info
 	err = dstObj.lstat()
@@ -1193,18 +1331,40 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	// Wipe hashes before update
 	o.clearHashCache()
 
+	writePath := o.path
+	// If the source is one of a group of hard linked local files
+	// then link to the first one of the group copied if possible
+	if !o.translatedLink && !o.fs.opt.NoHardLinks {
+		if key, ok := srcHardLinkKey(src); ok {
+			group, first := o.fs.claimHardLink(key)
+			if first {
+				defer func() {
+					path := ""
+					if err == nil {
+						path = o.path
+					}
+					o.fs.finishHardLink(group, path)
+				}()
+			} else if o.linkToGroup(ctx, group, src) {
+				return o.lstat()
+			}
+		}
+		// Don't write through a hard link to other files
+		writePath = o.writePath()
+	}
+
 	var symlinkData bytes.Buffer
 	// If the object is a regular file, create it.
 	// If it is a translated link, just read in the contents, and
 	// then create a symlink
 	if !o.translatedLink {
-		f, err := file.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		f, err := file.OpenFile(writePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 		if err != nil {
 			if runtime.GOOS == "windows" && os.IsPermission(err) {
 				// If permission denied on Windows might be trying to update a
 				// hidden file, in which case try opening without CREATE
 				// See: https://stackoverflow.com/questions/13215716/ioerror-errno-13-permission-denied-when-trying-to-open-hidden-file-in-w-mod
-				f, err = file.OpenFile(o.path, os.O_WRONLY|os.O_TRUNC, 0666)
+				f, err = file.OpenFile(writePath, os.O_WRONLY|os.O_TRUNC, 0666)
 				if err != nil {
 					return err
 				}
@@ -1212,7 +1372,12 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 				return err
 			}
 		}
-		if !o.fs.opt.NoPreAllocate {
+		// Find any holes in the source to leave in the file
+		var holes []hole
+		if !o.fs.opt.NoSparse {
+			holes = srcHoles(src)
+		}
+		if !o.fs.opt.NoPreAllocate && len(holes) == 0 {
 			// Pre-allocate the file for performance reasons
 			err = file.PreAllocate(src.Size(), f)
 			if err != nil {
@@ -1223,7 +1388,12 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 				}
 			}
 		}
-		out = f
+		if len(holes) > 0 {
+			fs.Debugf(o, "Writing sparse file with %d holes", len(holes))
+			out = newSparseWriter(f, holes)
+		} else {
+			out = f
+		}
 	} else {
 		out = nopWriterCloser{&symlinkData}
 	}
@@ -1260,11 +1430,15 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 
 	if err != nil {
 		fs.Logf(o, "Removing partially written file on error: %v", err)
-		if removeErr := os.Remove(o.path); removeErr != nil {
+		if removeErr := os.Remove(writePath); removeErr != nil {
 			fs.Errorf(o, "Failed to remove partially written file: %v", removeErr)
 		}
 		return err
 	}
+	err = o.finishWrite(writePath)
+	if err != nil {
+		return err
+	}
 
 	// All successful so update the hashes
 	if hasher != nil {
@@ -1280,7 +1454,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	}
 
 	// Fetch and set metadata if --metadata is in use
-	meta, err := fs.GetMetadataOptions(ctx, src, options)
+	meta, err := fs.GetMetadataOptions(ctx, o.fs, src, options)
 	if err != nil {
 		return fmt.Errorf("failed to read metadata from source object: %w", err)
 	}
@@ -1313,17 +1487,16 @@ func (f *Fs) OpenWriterAt(ctx context.Context, remote string, size int64) (fs.Wr
 		return nil, errors.New("can't open a symlink for random writing")
 	}
 
-	out, err := file.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	path := o.path
+	if !f.opt.NoHardLinks {
+		// Don't write through a hard link to other files
+		path = o.writePath()
+	}
+
+	out, err := file.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return nil, err
 	}
-	// Pre-allocate the file for performance reasons
-	if !f.opt.NoPreAllocate {
-		err = file.PreAllocate(size, out)
-		if err != nil {
-			fs.Debugf(o, "Failed to pre-allocate: %v", err)
-		}
-	}
 	if !f.opt.NoSparse && file.SetSparseImplemented {
 		sparseWarning.Do(func() {
 			fs.Infof(nil, "Writing sparse files: use --local-no-sparse or --multi-thread-streams 0 to disable")
@@ -1334,8 +1507,32 @@ func (f *Fs) OpenWriterAt(ctx context.Context, remote string, size int64) (fs.Wr
 			fs.Errorf(o, "Failed to set sparse: %v", err)
 		}
 	}
+	return &writerAt{
+		File: out,
+		o:    o,
+		size: size,
+		path: path,
+	}, nil
+}
 
-	return out, nil
+// unWrapLocal returns the local Object src wraps or nil if it
+// isn't a local Object
+func unWrapLocal(src fs.ObjectInfo) *Object {
+	for src != nil {
+		if o, ok := src.(*Object); ok {
+			return o
+		}
+		u, ok := src.(fs.ObjectUnWrapper)
+		if !ok {
+			return nil
+		}
+		next := u.UnWrap()
+		if next == nil {
+			return nil
+		}
+		src = next
+	}
+	return nil
 }
 
 // setMetadata sets the file info from the os.FileInfo passed in
@@ -1348,6 +1545,7 @@ func (o *Object) setMetadata(info os.FileInfo) {
 	o.size = info.Size()
 	o.modTime = info.ModTime()
 	o.mode = info.Mode()
+	_, o.nlink, _ = readHardLink(info)
 	o.fs.objectMetaMu.Unlock()
 	// Read the size of the link.
 	//
@@ -1402,6 +1600,18 @@ func (o *Object) Metadata(ctx context.Context) (metadata fs.Metadata, err error)
 	return metadata, nil
 }
 
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	err := o.writeMetadata(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to set metadata: %w", err)
+	}
+	// ReRead info now that we have finished
+	return o.lstat()
+}
+
 // Write the metadata on the object
 func (o *Object) writeMetadata(metadata fs.Metadata) (err error) {
 	err = o.setXattr(metadata)
@@ -1443,13 +1653,18 @@ func cleanRootPath(s string, noUNC bool, enc encoder.MultiEncoder) string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs             = &Fs{}
-	_ fs.Purger         = &Fs{}
-	_ fs.PutStreamer    = &Fs{}
-	_ fs.Mover          = &Fs{}
-	_ fs.DirMover       = &Fs{}
-	_ fs.Commander      = &Fs{}
-	_ fs.OpenWriterAter = &Fs{}
-	_ fs.Object         = &Object{}
-	_ fs.Metadataer     = &Object{}
+	_ fs.Fs               = &Fs{}
+	_ fs.Purger           = &Fs{}
+	_ fs.PutStreamer      = &Fs{}
+	_ fs.Mover            = &Fs{}
+	_ fs.HardLinker       = &Fs{}
+	_ fs.DirMover         = &Fs{}
+	_ fs.Commander        = &Fs{}
+	_ fs.OpenWriterAter   = &Fs{}
+	_ fs.DirSetModTimer   = &Fs{}
+	_ fs.DirMetadataer    = &Fs{}
+	_ fs.DirSetMetadataer = &Fs{}
+	_ fs.Object           = &Object{}
+	_ fs.Metadataer       = &Object{}
+	_ fs.SetMetadataer    = &Object{}
 )
@@ -3,6 +3,7 @@ package local
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -22,6 +23,7 @@ import (
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/ranges"
 	"github.com/rclone/rclone/lib/readers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -555,3 +557,214 @@ func TestCopySymlink(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "file.txt", linkContents)
 }
+
+func TestHardLinkPreserve(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	fdst, ok := r.Fremote.(*Fs)
+	if !ok || runtime.GOOS == "windows" {
+		t.Skip("hard links not supported")
+	}
+	fsrc := r.Flocal.(*Fs)
+	modTime1 := fstest.Time("2001-02-03T04:05:10.123123123Z")
+	modTime2 := fstest.Time("2002-02-03T04:05:10.123123123Z")
+
+	// Make a group of two hard linked files and one other
+	r.WriteFile("a", "hello", modTime1)
+	require.NoError(t, os.Link(filepath.Join(fsrc.root, "a"), filepath.Join(fsrc.root, "b")))
+	r.WriteFile("c", "other", modTime1)
+
+	for _, remote := range []string{"a", "b", "c"} {
+		src, err := fsrc.NewObject(ctx, remote)
+		require.NoError(t, err)
+		_, err = operations.Copy(ctx, fdst, nil, remote, src)
+		require.NoError(t, err)
+	}
+
+	stat := func(remote string) os.FileInfo {
+		fi, err := os.Stat(filepath.Join(fdst.root, remote))
+		require.NoError(t, err)
+		return fi
+	}
+	assert.True(t, os.SameFile(stat("a"), stat("b")))
+	assert.False(t, os.SameFile(stat("a"), stat("c")))
+
+	// A failed update of one of the group leaves the group alone
+	dstB, err := fdst.NewObject(ctx, "b")
+	require.NoError(t, err)
+	contents := "changed"
+	src := object.NewStaticObjectInfo("b", modTime2, int64(len(contents)), true, nil, nil)
+	in := io.MultiReader(bytes.NewBufferString("chan"), readers.ErrorReader{Err: errors.New("potato")})
+	require.Error(t, dstB.Update(ctx, in, src))
+	assert.True(t, os.SameFile(stat("a"), stat("b")))
+	data, err := os.ReadFile(filepath.Join(fdst.root, "b"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	entries, err := os.ReadDir(fdst.root)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(entries), "temporary file left behind")
+
+	// Updating one of the group breaks the link
+	dstB, err = fdst.NewObject(ctx, "b")
+	require.NoError(t, err)
+	require.NoError(t, dstB.Update(ctx, bytes.NewBufferString(contents), src))
+	assert.False(t, os.SameFile(stat("a"), stat("b")))
+	data, err = os.ReadFile(filepath.Join(fdst.root, "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// Unless disabled
+	fdst.opt.NoHardLinks = true
+	defer func() { fdst.opt.NoHardLinks = false }()
+	require.NoError(t, os.Link(filepath.Join(fsrc.root, "c"), filepath.Join(fsrc.root, "d")))
+	for _, remote := range []string{"c", "d"} {
+		src, err := fsrc.NewObject(ctx, remote)
+		require.NoError(t, err)
+		_, err = operations.Copy(ctx, fdst, nil, remote, src)
+		require.NoError(t, err)
+	}
+	assert.False(t, os.SameFile(stat("c"), stat("d")))
+}
+
+// makeSparse makes a sparse file of size at path with data at the
+// end, returning its contents
+func makeSparse(t *testing.T, path string, size int64) []byte {
+	data := []byte("data at the end")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, out.Truncate(size))
+	_, err = out.WriteAt(data, size-int64(len(data)))
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+	contents := make([]byte, size)
+	copy(contents[size-int64(len(data)):], data)
+	return contents
+}
+
+func TestSparseWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sparse")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+
+	// The zeros in the holes are skipped but data written
+	holes := []hole{{start: 2, end: 6}, {start: 8, end: 12}}
+	w := newSparseWriter(out, holes)
+	contents := []byte("ab\x00\x00\x00\x00cdX\x00\x00\x00")
+	for i := 0; i < len(contents); i += 3 {
+		n, err := w.Write(contents[i : i+3])
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+	}
+	require.NoError(t, w.Close())
+
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, contents, got)
+}
+
+func TestSparseCopy(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	fdst, ok := r.Fremote.(*Fs)
+	if !ok {
+		t.Skip("remote not local")
+	}
+	fsrc := r.Flocal.(*Fs)
+
+	const size = 1024 * 1024
+	srcPath := filepath.Join(fsrc.root, "sparse")
+	contents := makeSparse(t, srcPath, size)
+	holes, err := findHoles(srcPath, size)
+	require.NoError(t, err)
+	if len(holes) == 0 {
+		t.Skip("file system doesn't support finding holes")
+	}
+
+	src, err := fsrc.NewObject(ctx, "sparse")
+	require.NoError(t, err)
+	_, err = operations.Copy(ctx, fdst, nil, "sparse", src)
+	require.NoError(t, err)
+
+	dstPath := filepath.Join(fdst.root, "sparse")
+	got, err := os.ReadFile(dstPath)
+	require.NoError(t, err)
+	assert.Equal(t, contents, got)
+	holes, err = findHoles(dstPath, size)
+	require.NoError(t, err)
+	assert.NotEmpty(t, holes)
+}
+
+func TestMultiThreadSparseCopy(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	fdst, ok := r.Fremote.(*Fs)
+	if !ok {
+		t.Skip("remote not local")
+	}
+	fsrc := r.Flocal.(*Fs)
+
+	const size = 1024 * 1024
+	srcPath := filepath.Join(fsrc.root, "sparse")
+	contents := makeSparse(t, srcPath, size)
+	holes, err := findHoles(srcPath, size)
+	require.NoError(t, err)
+	if len(holes) == 0 {
+		t.Skip("file system doesn't support finding holes")
+	}
+
+	// Sparse local files are copied with multiple streams without
+	// --multi-thread-streams being set
+	ci.MultiThreadCutoff = 64 * 1024
+	src, err := fsrc.NewObject(ctx, "sparse")
+	require.NoError(t, err)
+	_, err = operations.Copy(ctx, fdst, nil, "sparse", src)
+	require.NoError(t, err)
+
+	dstPath := filepath.Join(fdst.root, "sparse")
+	got, err := os.ReadFile(dstPath)
+	require.NoError(t, err)
+	assert.Equal(t, contents, got)
+	holes, err = findHoles(dstPath, size)
+	require.NoError(t, err)
+	assert.NotEmpty(t, holes)
+}
+
+func TestOpenWriterAtSparse(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	f := r.Flocal.(*Fs)
+
+	const size = 1024 * 1024
+	srcPath := filepath.Join(t.TempDir(), "sparse")
+	contents := makeSparse(t, srcPath, size)
+	srcHoles, err := findHoles(srcPath, size)
+	require.NoError(t, err)
+	if len(srcHoles) == 0 {
+		t.Skip("file system doesn't support finding holes")
+	}
+
+	// The holes are taken from the source even when pre-allocating
+	out, err := f.OpenWriterAt(ctx, "sparse", size)
+	require.NoError(t, err)
+	var holes []ranges.Range
+	for _, h := range srcHoles {
+		holes = append(holes, ranges.Range{Pos: h.start, Size: h.end - h.start})
+	}
+	out.(fs.HoleWriterAt).SetHoles(holes)
+	const chunkSize = 64 * 1024
+	for off := 0; off < size; off += chunkSize {
+		_, err = out.WriteAt(contents[off:off+chunkSize], int64(off))
+		require.NoError(t, err)
+	}
+	require.NoError(t, out.Close())
+
+	path := filepath.Join(f.root, "sparse")
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, contents, got)
+	dstHoles, err := findHoles(path, size)
+	require.NoError(t, err)
+	assert.NotEmpty(t, dstHoles)
+}
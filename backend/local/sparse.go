@@ -0,0 +1,222 @@
+// Sparse file writing
+
+package local
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/ranges"
+)
+
+// hole is a range [start, end) of a file which contains no data
+type hole struct {
+	start int64
+	end   int64
+}
+
+// srcHoles returns the holes in src if it is a local file
+func srcHoles(src fs.ObjectInfo) []hole {
+	srcObj := unWrapLocal(src)
+	if srcObj == nil || srcObj.translatedLink {
+		return nil
+	}
+	holes, err := findHoles(srcObj.path, src.Size())
+	if err != nil {
+		fs.Debugf(src, "Failed to find holes: %v", err)
+		return nil
+	}
+	return holes
+}
+
+// isAllZero returns true if p only contains zero bytes
+func isAllZero(p []byte) bool {
+	for _, b := range p {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sparseWriter writes a stream to a file, seeking over the holes
+// given instead of writing zeros there so they are left as holes in
+// the destination.
+//
+// Any data which isn't zero in the holes is written as normal in case
+// the source was changed after the holes were found.
+type sparseWriter struct {
+	out   *os.File
+	holes []hole // sorted holes in the source
+	off   int64  // current offset in the file
+}
+
+// newSparseWriter makes a sparseWriter writing to out
+func newSparseWriter(out *os.File, holes []hole) *sparseWriter {
+	return &sparseWriter{
+		out:   out,
+		holes: holes,
+	}
+}
+
+// nextChunk returns the start of p, which is at off in the file, up
+// to the next boundary of the holes, and whether it is in a hole
+func nextChunk(holes []hole, off int64, p []byte) (chunk []byte, inHole bool) {
+	chunk = p
+	i := sort.Search(len(holes), func(i int) bool {
+		return holes[i].end > off
+	})
+	if i >= len(holes) {
+		return chunk, false
+	}
+	h := holes[i]
+	if h.start <= off {
+		inHole = true
+		if remaining := h.end - off; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+	} else if remaining := h.start - off; int64(len(chunk)) > remaining {
+		chunk = chunk[:remaining]
+	}
+	return chunk, inHole
+}
+
+// Write p to the file skipping any zeros in holes
+func (w *sparseWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		// Discard holes we have passed
+		for len(w.holes) > 0 && w.holes[0].end <= w.off {
+			w.holes = w.holes[1:]
+		}
+		chunk, inHole := nextChunk(w.holes, w.off, p)
+		if inHole && isAllZero(chunk) {
+			_, err = w.out.Seek(int64(len(chunk)), io.SeekCurrent)
+		} else {
+			_, err = w.out.Write(chunk)
+		}
+		if err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		w.off += int64(len(chunk))
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close the file, making sure it is the correct length if it ends
+// in a hole
+func (w *sparseWriter) Close() error {
+	err := w.out.Truncate(w.off)
+	closeErr := w.out.Close()
+	if err != nil {
+		_ = closeErr
+		return err
+	}
+	return closeErr
+}
+
+// writerAt is the fs.WriterAtCloser returned by OpenWriterAt
+//
+// The file is pre-allocated, or extended to its final size if the
+// source has holes, just before the first write. This gives the
+// copier a chance to call SetHoles first.
+type writerAt struct {
+	*os.File
+	o        *Object
+	size     int64
+	path     string    // path being written, o.path or a temporary file
+	holes    []hole    // sorted holes in the source
+	allocate sync.Once // for allocating the file before the first write
+}
+
+// SetHoles sets the holes in the source to leave as holes in the
+// file. It must be called before anything is written.
+func (w *writerAt) SetHoles(holes []ranges.Range) {
+	if w.o.fs.opt.NoSparse || w.size <= 0 {
+		return
+	}
+	for _, r := range holes {
+		r.Clip(w.size)
+		if !r.IsEmpty() {
+			w.holes = append(w.holes, hole{start: r.Pos, end: r.End()})
+		}
+	}
+}
+
+// allocateFile pre-allocates the file or extends it to its final
+// size if it is going to have holes in
+func (w *writerAt) allocateFile() {
+	if len(w.holes) > 0 {
+		// Extend the file to its final size so that the holes
+		// not written read as zeros
+		err := w.File.Truncate(w.size)
+		if err == nil {
+			fs.Debugf(w.o, "Writing sparse file with %d holes", len(w.holes))
+			return
+		}
+		fs.Debugf(w.o, "Failed to extend file for sparse writing: %v", err)
+		w.holes = nil
+	}
+	if !w.o.fs.opt.NoPreAllocate {
+		// Pre-allocate the file for performance reasons
+		err := file.PreAllocate(w.size, w.File)
+		if err != nil {
+			fs.Debugf(w.o, "Failed to pre-allocate: %v", err)
+		}
+	}
+}
+
+// WriteAt writes p at off, skipping any zeros in the holes
+func (w *writerAt) WriteAt(p []byte, off int64) (n int, err error) {
+	w.allocate.Do(w.allocateFile)
+	if len(w.holes) == 0 {
+		return w.File.WriteAt(p, off)
+	}
+	for len(p) > 0 {
+		chunk, inHole := nextChunk(w.holes, off, p)
+		if !inHole || !isAllZero(chunk) {
+			_, err = w.File.WriteAt(chunk, off)
+			if err != nil {
+				return n, err
+			}
+		}
+		n += len(chunk)
+		off += int64(len(chunk))
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close the file, moving it into place if it was written to a
+// temporary file
+func (w *writerAt) Close() error {
+	w.allocate.Do(w.allocateFile)
+	err := w.File.Close()
+	if err != nil {
+		return err
+	}
+	return w.o.finishWrite(w.path)
+}
+
+// Holes returns the ranges of the file which hold no data.
+//
+// It returns nil if there are none or they can't be found.
+func (o *Object) Holes(ctx context.Context) []ranges.Range {
+	var holes []ranges.Range
+	for _, h := range srcHoles(o) {
+		holes = append(holes, ranges.Range{Pos: h.start, Size: h.end - h.start})
+	}
+	return holes
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.HoleFinder   = (*Object)(nil)
+	_ fs.HoleWriterAt = (*writerAt)(nil)
+)
@@ -0,0 +1,51 @@
+// Hole finding functions
+
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package local
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// findHoles returns the holes in the first size bytes of the file at
+// path using SEEK_DATA and SEEK_HOLE.
+//
+// It returns no holes if the file system doesn't support finding them.
+func findHoles(path string, size int64) (holes []hole, err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	var off int64
+	for off < size {
+		data, err := in.Seek(off, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// No more data so the rest of the file is a hole
+			holes = append(holes, hole{start: off, end: size})
+			break
+		} else if err != nil {
+			// SEEK_DATA not supported
+			return nil, nil
+		}
+		if data >= size {
+			holes = append(holes, hole{start: off, end: size})
+			break
+		}
+		if data > off {
+			holes = append(holes, hole{start: off, end: data})
+		}
+		off, err = in.Seek(data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, nil
+		}
+	}
+	return holes, nil
+}
@@ -124,6 +124,7 @@ func (bi *bucketsInfo) removeObjectData(bucketName, bucketPath string) (removed
 		od := b.objects[bucketPath]
 		if od != nil {
 			delete(b.objects, bucketPath)
+			b.pruneDirs(path.Dir(bucketPath))
 			removed = true
 		}
 		b.mu.Unlock()
@@ -135,14 +136,69 @@ func (bi *bucketsInfo) removeObjectData(bucketName, bucketPath string) (removed
 type bucketInfo struct {
 	mu      sync.RWMutex
 	objects map[string]*objectData
+	dirs    map[string]*dirData // directory info by path, "" for the bucket
 }
 
 func newBucketInfo() *bucketInfo {
 	return &bucketInfo{
 		objects: make(map[string]*objectData, 16),
+		dirs:    make(map[string]*dirData),
 	}
 }
 
+// dirExists returns true if the directory exists - call with lock held
+//
+// Directories other than the bucket only exist if they contain
+// objects.
+func (bi *bucketInfo) dirExists(dir string) bool {
+	if dir == "" {
+		return true
+	}
+	prefix := dir + "/"
+	for absPath := range bi.objects {
+		if strings.HasPrefix(absPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// getDirData returns the info for the directory, making it if
+// necessary, or nil if the directory doesn't exist - call with lock
+// held
+func (bi *bucketInfo) getDirData(dir string) *dirData {
+	if !bi.dirExists(dir) {
+		return nil
+	}
+	dd := bi.dirs[dir]
+	if dd == nil {
+		dd = &dirData{}
+		bi.dirs[dir] = dd
+	}
+	return dd
+}
+
+// pruneDirs removes the info for dir and its parents if they no
+// longer exist - call with lock held
+func (bi *bucketInfo) pruneDirs(dir string) {
+	for dir != "." && dir != "/" && dir != "" {
+		if bi.dirExists(dir) {
+			return
+		}
+		delete(bi.dirs, dir)
+		dir = path.Dir(dir)
+	}
+}
+
+// dirModTime returns the modification time of the directory or the
+// zero time if not set - call with lock held
+func (bi *bucketInfo) dirModTime(dir string) time.Time {
+	if dd := bi.dirs[dir]; dd != nil {
+		return dd.modTime
+	}
+	return time.Time{}
+}
+
 // getBucket gets a names bucket or nil
 func (bi *bucketInfo) getObjectData(name string) (od *objectData) {
 	bi.mu.RLock()
@@ -167,6 +223,12 @@ type objectData struct {
 	data     []byte
 }
 
+// the directory modification time and metadata if set
+type dirData struct {
+	modTime  time.Time
+	metadata fs.Metadata
+}
+
 // Object describes a memory object
 type Object struct {
 	fs     *Fs         // what this object is part of
@@ -297,13 +359,14 @@ func (f *Fs) list(ctx context.Context, bucket, directory, prefix string, addBuck
 				slash := strings.IndexRune(localPath, '/')
 				if slash >= 0 {
 					// send a directory if have a slash
-					dir := directory + localPath[:slash]
+					dirPath := directory + localPath[:slash]
+					dir := dirPath
 					if addBucket {
 						dir = path.Join(bucket, dir)
 					}
 					_, found := dirs[dir]
 					if !found {
-						err = fn(dir, fs.NewDir(dir, time.Time{}), true)
+						err = fn(dir, fs.NewDir(dir, b.dirModTime(dirPath)), true)
 						if err != nil {
 							return err
 						}
@@ -339,8 +402,11 @@ func (f *Fs) listDir(ctx context.Context, bucket, directory, prefix string, addB
 func (f *Fs) listBuckets(ctx context.Context) (entries fs.DirEntries, err error) {
 	buckets.mu.RLock()
 	defer buckets.mu.RUnlock()
-	for name := range buckets.buckets {
-		entries = append(entries, fs.NewDir(name, time.Time{}))
+	for name, b := range buckets.buckets {
+		b.mu.RLock()
+		modTime := b.dirModTime("")
+		b.mu.RUnlock()
+		entries = append(entries, fs.NewDir(name, modTime))
 	}
 	return entries, nil
 }
@@ -449,12 +515,65 @@ func (f *Fs) Mkdir(ctx context.Context, dir string) error {
 // Returns an error if it isn't empty
 func (f *Fs) Rmdir(ctx context.Context, dir string) error {
 	bucket, directory := f.split(dir)
-	if bucket == "" || directory != "" {
+	if bucket == "" {
+		return nil
+	}
+	if directory != "" {
+		// Forget the info of an empty directory
+		if b := buckets.getBucket(bucket); b != nil {
+			b.mu.Lock()
+			b.pruneDirs(directory)
+			b.mu.Unlock()
+		}
 		return nil
 	}
 	return buckets.deleteBucket(bucket)
 }
 
+// getDirData calls fn with the info for dir with the bucket locked
+//
+// It returns fs.ErrorDirNotFound if the directory doesn't exist.
+func (f *Fs) getDirData(dir string, fn func(dd *dirData)) error {
+	bucket, directory := f.split(dir)
+	if bucket == "" {
+		return fs.ErrorDirNotFound
+	}
+	b := buckets.getBucket(bucket)
+	if b == nil {
+		return fs.ErrorDirNotFound
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dd := b.getDirData(directory)
+	if dd == nil {
+		return fs.ErrorDirNotFound
+	}
+	fn(dd)
+	return nil
+}
+
+// DirSetModTime sets the modification time of the directory dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	return f.getDirData(dir, func(dd *dirData) {
+		dd.modTime = modTime
+	})
+}
+
+// DirMetadata returns the metadata of the directory dir
+func (f *Fs) DirMetadata(ctx context.Context, dir string) (metadata fs.Metadata, err error) {
+	err = f.getDirData(dir, func(dd *dirData) {
+		metadata.Merge(dd.metadata)
+	})
+	return metadata, err
+}
+
+// DirSetMetadata sets metadata on the directory dir
+func (f *Fs) DirSetMetadata(ctx context.Context, dir string, metadata fs.Metadata) error {
+	return f.getDirData(dir, func(dd *dirData) {
+		dd.metadata.Merge(metadata)
+	})
+}
+
 // Precision of the remote
 func (f *Fs) Precision() time.Duration {
 	return time.Nanosecond
@@ -613,10 +732,13 @@ func (o *Object) MimeType(ctx context.Context) string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Copier      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.ListRer     = &Fs{}
-	_ fs.Object      = &Object{}
-	_ fs.MimeTyper   = &Object{}
+	_ fs.Fs               = &Fs{}
+	_ fs.Copier           = &Fs{}
+	_ fs.PutStreamer      = &Fs{}
+	_ fs.ListRer          = &Fs{}
+	_ fs.DirSetModTimer   = &Fs{}
+	_ fs.DirMetadataer    = &Fs{}
+	_ fs.DirSetMetadataer = &Fs{}
+	_ fs.Object           = &Object{}
+	_ fs.MimeTyper        = &Object{}
 )
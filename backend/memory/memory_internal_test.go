@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneDirs(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFs(ctx, "memory", "pruneDirs", nil)
+	require.NoError(t, err)
+	t1 := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	file := fstest.NewItem("a/b/file.txt", "hello", t1)
+	o := fstests.PutTestContents(ctx, t, f, &file, "hello", true)
+	require.NoError(t, f.(*Fs).DirSetModTime(ctx, "a", t1))
+	require.NoError(t, f.(*Fs).DirSetModTime(ctx, "a/b", t1))
+	b := buckets.getBucket("pruneDirs")
+	assert.Len(t, b.dirs, 2)
+
+	// Removing the last object forgets the directories
+	require.NoError(t, o.Remove(ctx))
+	assert.Len(t, b.dirs, 0)
+
+	// As does removing an empty directory
+	b.mu.Lock()
+	b.dirs["c"] = &dirData{modTime: time.Now()}
+	b.mu.Unlock()
+	require.NoError(t, f.Rmdir(ctx, "c"))
+	assert.Len(t, b.dirs, 0)
+	require.NoError(t, f.Rmdir(ctx, ""))
+}
@@ -1311,6 +1311,26 @@ func (f *Fs) Rmdir(ctx context.Context, dir string) error {
 	return err
 }
 
+// DirSetModTime sets the modification time of the directory dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	if !f.opt.SetModTime {
+		return nil
+	}
+	c, err := f.getSftpConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("DirSetModTime: %w", err)
+	}
+	err = c.sftpClient.Chtimes(f.remotePath(dir), modTime, modTime)
+	f.putSftpConnection(&c, err)
+	if os.IsNotExist(err) {
+		return fs.ErrorDirNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("DirSetModTime failed: %w", err)
+	}
+	return nil
+}
+
 // Move renames a remote sftp file object
 func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
 	srcObj, ok := src.(*Object)
@@ -2056,11 +2076,12 @@ func (o *Object) Remove(ctx context.Context) error {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.Mover       = &Fs{}
-	_ fs.DirMover    = &Fs{}
-	_ fs.Abouter     = &Fs{}
-	_ fs.Shutdowner  = &Fs{}
-	_ fs.Object      = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.Mover          = &Fs{}
+	_ fs.DirMover       = &Fs{}
+	_ fs.Abouter        = &Fs{}
+	_ fs.Shutdowner     = &Fs{}
+	_ fs.DirSetModTimer = &Fs{}
+	_ fs.Object         = &Object{}
 )
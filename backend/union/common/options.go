@@ -14,4 +14,10 @@ type Options struct {
 	SearchPolicy string          `config:"search_policy"`
 	CacheTime    int             `config:"cache_time"`
 	MinFreeSpace fs.SizeSuffix   `config:"min_free_space"`
+	Mirror       bool            `config:"mirror"`
+	MirrorQuorum int             `config:"mirror_quorum"`
+	TierHot      string          `config:"tier_hot"`
+	TierCold     string          `config:"tier_cold"`
+	TierAge      fs.Duration     `config:"tier_age"`
+	TierPromote  bool            `config:"tier_promote"`
 }
@@ -17,8 +17,9 @@ import (
 // This is a wrapped object which returns the Union Fs as its parent
 type Object struct {
 	*upstream.Object
-	fs *Fs // what this object is part of
-	co []upstream.Entry
+	fs     *Fs // what this object is part of
+	co     []upstream.Entry
+	failed *sync.Map // upstreams which failed to read in mirror mode
 }
 
 // Directory describes a union Directory
@@ -58,6 +59,14 @@ func (d *Directory) candidates() []upstream.Entry {
 // But for unknown-sized objects (indicated by src.Size() == -1), Upload should either
 // return an error or update the object properly (rather than e.g. calling panic).
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	if o.fs.opt.Mirror {
+		newO, err := o.fs.mirrorPut(ctx, in, src, false, o.candidates(), options...)
+		if err != nil {
+			return err
+		}
+		*o = *newO
+		return nil
+	}
 	entries, err := o.fs.actionEntries(o.candidates()...)
 	if err == fs.ErrorPermissionDenied {
 		// There are no candidates in this object which can be written to
@@ -74,7 +83,11 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	}
 	if len(entries) == 1 {
 		obj := entries[0].(*upstream.Object)
-		return obj.Update(ctx, in, src, options...)
+		err := obj.Update(ctx, in, src, options...)
+		if err == nil {
+			o.fs.recordWrite(ctx, obj)
+		}
+		return err
 	}
 	// Multi-threading
 	readers, errChan := multiReader(len(entries), in)
@@ -97,6 +110,22 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	return errs.Err()
 }
 
+// Open opens the object for reading
+//
+// In mirror mode reads which fail are carried on from another copy
+// of the object. When tiering the object may be moved to the hot
+// upstream first.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	switch {
+	case o.fs.opt.Mirror:
+		return newMirrorReader(ctx, o, options...)
+	case o.fs.hot != nil:
+		return o.tierOpen(ctx, options...)
+	default:
+		return o.Object.Open(ctx, options...)
+	}
+}
+
 // Remove candidate objects selected by ACTION policy
 func (o *Object) Remove(ctx context.Context) error {
 	entries, err := o.fs.actionEntries(o.candidates()...)
@@ -139,6 +168,27 @@ func (o *Object) SetModTime(ctx context.Context, t time.Time) error {
 	return errs.Err()
 }
 
+// SetMetadata sets metadata on the candidate objects selected by
+// ACTION policy
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	entries, err := o.fs.actionEntries(o.candidates()...)
+	if err != nil {
+		return err
+	}
+	errs := Errors(make([]error, len(entries)))
+	multithread(len(entries), func(i int) {
+		if o, ok := entries[i].(*upstream.Object); ok {
+			err := o.SetMetadata(ctx, metadata)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", o.UpstreamFs().Name(), err)
+			}
+		} else {
+			errs[i] = fs.ErrorNotAFile
+		}
+	})
+	return errs.Err()
+}
+
 // GetTier returns storage tier or class of the Object
 func (o *Object) GetTier() string {
 	do, ok := o.Object.Object.(fs.GetTierer)
@@ -0,0 +1,512 @@
+package union
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+// mirrorTarget is an upstream written to in mirror mode along with
+// the existing object on it, if any
+type mirrorTarget struct {
+	u *upstream.Fs
+	o *upstream.Object
+}
+
+// writeQuorum returns the number of the n upstreams written to
+// which must succeed for a write in mirror mode to succeed
+func (f *Fs) writeQuorum(n int) int {
+	quorum := f.opt.MirrorQuorum
+	if quorum <= 0 {
+		quorum = n/2 + 1
+		if n == 2 {
+			// A majority of two is both so one upstream being
+			// unavailable would stop all the writes
+			quorum = 1
+		}
+	}
+	if quorum > n {
+		quorum = n
+	}
+	return quorum
+}
+
+// mirrorPut writes in to all the upstreams in mirror mode, updating
+// the existing objects and creating the object where it is missing.
+//
+// It succeeds if the write quorum of upstreams succeeded. Upstreams
+// which failed are logged and left to be repaired by resilver.
+//
+// If the quorum isn't reached the new copies are removed again.
+// Existing objects which were updated can't be rolled back so keep
+// the new data, which resilver copies to the others as the newest.
+func (f *Fs) mirrorPut(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, existing []upstream.Entry, options ...fs.OpenOption) (*Object, error) {
+	srcPath := src.Remote()
+	upstreams, err := f.create(ctx, srcPath)
+	if err != nil && err != fs.ErrorPermissionDenied {
+		return nil, err
+	}
+	var targets []mirrorTarget
+	for _, e := range existing {
+		if o, ok := e.(*upstream.Object); ok && o.UpstreamFs().IsWritable() {
+			targets = append(targets, mirrorTarget{u: o.UpstreamFs(), o: o})
+		}
+	}
+outer:
+	for _, u := range upstreams {
+		for _, t := range targets {
+			if t.u == u {
+				continue outer
+			}
+		}
+		targets = append(targets, mirrorTarget{u: u})
+	}
+	if len(targets) == 0 {
+		return nil, fs.ErrorPermissionDenied
+	}
+
+	readers, errChan := multiReader(len(targets), in)
+	errs := Errors(make([]error, len(targets)))
+	objs := make([]upstream.Entry, len(targets))
+	multithread(len(targets), func(i int) {
+		t := targets[i]
+		var err error
+		if t.o != nil {
+			err = t.o.Update(ctx, readers[i], src, options...)
+			if err == nil {
+				objs[i] = t.o
+			}
+		} else {
+			var o fs.Object
+			if stream {
+				o, err = t.u.PutStream(ctx, readers[i], src, options...)
+			} else {
+				o, err = t.u.Put(ctx, readers[i], src, options...)
+			}
+			if err == nil {
+				objs[i] = t.u.WrapObject(o)
+			}
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", t.u.Name(), err)
+			// Drain the input buffer to allow other uploads to continue
+			_, _ = io.Copy(io.Discard, readers[i])
+		}
+	})
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+	var written []upstream.Entry
+	for _, o := range objs {
+		if o != nil {
+			written = append(written, o)
+		}
+	}
+	quorum := f.writeQuorum(len(targets))
+	err = errs.Err()
+	if len(written) < quorum {
+		f.mirrorRollback(ctx, src, targets, objs)
+		return nil, fmt.Errorf("mirror write succeeded on %d of %d upstreams but needs %d: %w", len(written), len(targets), quorum, err)
+	}
+	if err != nil {
+		fs.Errorf(src, "Mirror write failed on %d of %d upstreams - run resilver to repair: %v", len(targets)-len(written), len(targets), err)
+	}
+	e, err := f.wrapEntries(written...)
+	if err != nil {
+		return nil, err
+	}
+	return e.(*Object), nil
+}
+
+// mirrorRollback removes the objects in objs which were created by a
+// mirror write which didn't reach its quorum
+func (f *Fs) mirrorRollback(ctx context.Context, src fs.ObjectInfo, targets []mirrorTarget, objs []upstream.Entry) {
+	for i, t := range targets {
+		if t.o != nil || objs[i] == nil {
+			continue
+		}
+		err := objs[i].(*upstream.Object).Remove(ctx)
+		if err != nil {
+			fs.Errorf(src, "Failed to remove copy on %s after failed mirror write: %v", t.u.Name(), err)
+		}
+	}
+}
+
+// mirrorReader reads an object in mirror mode, carrying on from
+// another copy of the object if reading one fails
+type mirrorReader struct {
+	ctx     context.Context
+	o       *Object
+	copies  []*upstream.Object // copies left to read from, current first
+	options []fs.OpenOption    // open options except for the range
+	offset  int64              // offset of the first byte wanted
+	limit   int64              // number of bytes wanted or -1 for the rest
+	read    int64              // number of bytes read so far
+	in      io.ReadCloser      // reader for the current copy
+	ht      hash.Type          // hash to verify a full read with
+	hasher  *hash.MultiHasher  // hasher for verifying or nil
+}
+
+// newMirrorReader opens o in mirror mode
+func newMirrorReader(ctx context.Context, o *Object, options ...fs.OpenOption) (*mirrorReader, error) {
+	r := &mirrorReader{
+		ctx:    ctx,
+		o:      o,
+		copies: o.mirrorCopies(),
+		limit:  -1,
+	}
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.RangeOption:
+			r.offset, r.limit = x.Decode(o.Size())
+		case *fs.SeekOption:
+			r.offset, r.limit = x.Offset, -1
+		default:
+			r.options = append(r.options, option)
+		}
+	}
+	// Only verify whole reads from upstreams which store the hash
+	// rather than computing it from the data read
+	r.ht = o.fs.hashSet.GetOne()
+	if r.offset == 0 && r.limit < 0 && r.ht != hash.None && !o.fs.features.SlowHash {
+		var err error
+		r.hasher, err = hash.NewMultiHasherTypes(hash.NewHashSet(r.ht))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// mirrorCopies returns the copies of o which can be read in mirror
+// mode, the one chosen by the search policy first, leaving out those
+// which have failed unless there are no others
+func (o *Object) mirrorCopies() []*upstream.Object {
+	var copies, failed []*upstream.Object
+	add := func(c *upstream.Object) {
+		if _, bad := o.failed.Load(c.UpstreamFs()); bad {
+			failed = append(failed, c)
+		} else {
+			copies = append(copies, c)
+		}
+	}
+	add(o.Object)
+	for _, e := range o.candidates() {
+		if c, ok := e.(*upstream.Object); ok && c != o.Object && c.Size() == o.Size() {
+			add(c)
+		}
+	}
+	if len(copies) == 0 {
+		return failed
+	}
+	return copies
+}
+
+// fail marks the current copy as failed and moves on to the next
+func (r *mirrorReader) fail(err error) {
+	c := r.copies[0]
+	r.o.failed.Store(c.UpstreamFs(), struct{}{})
+	r.copies = r.copies[1:]
+	if len(r.copies) > 0 {
+		fs.Errorf(r.o, "Read failed on %s, trying another upstream: %v", c.UpstreamFs().Name(), err)
+	}
+}
+
+// open opens the first copy which can be opened at the current offset
+func (r *mirrorReader) open() error {
+	var errs Errors
+	for len(r.copies) > 0 {
+		options := r.options
+		if r.offset+r.read > 0 || r.limit >= 0 {
+			rng := &fs.RangeOption{Start: r.offset + r.read, End: -1}
+			if r.limit >= 0 {
+				rng.End = r.offset + r.limit - 1
+			}
+			options = append(options[:len(options):len(options)], rng)
+		}
+		c := r.copies[0]
+		in, err := c.Open(r.ctx, options...)
+		if err == nil {
+			r.in = in
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", c.UpstreamFs().Name(), err))
+		r.fail(err)
+	}
+	return errs.Err()
+}
+
+// Read bytes from the current copy, switching copies on errors
+func (r *mirrorReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.limit >= 0 && r.read >= r.limit {
+			return 0, io.EOF
+		}
+		if r.in == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+		n, err = r.in.Read(p)
+		r.read += int64(n)
+		if r.hasher != nil {
+			_, _ = r.hasher.Write(p[:n])
+		}
+		if err != nil && err != io.EOF && len(r.copies) > 1 && r.ctx.Err() == nil {
+			_ = r.in.Close()
+			r.in = nil
+			r.fail(err)
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		if err == io.EOF {
+			if verifyErr := r.verify(); verifyErr != nil {
+				return n, verifyErr
+			}
+		}
+		return n, err
+	}
+}
+
+// verify checks the hash of a whole read against the hash stored on
+// the copy it finished on. On a mismatch the copy is marked as failed
+// so that retrying the read uses another one.
+func (r *mirrorReader) verify() error {
+	if r.hasher == nil || r.read != r.o.Size() {
+		return nil
+	}
+	c := r.copies[0]
+	want, err := c.Hash(r.ctx, r.ht)
+	if err != nil || want == "" {
+		return nil
+	}
+	got := r.hasher.Sums()[r.ht]
+	if got == want {
+		return nil
+	}
+	err = fmt.Errorf("%s: %v hash differs: stored %q, read %q", c.UpstreamFs().Name(), r.ht, want, got)
+	r.fail(err)
+	return fserrors.RetryError(err)
+}
+
+// Close the current copy
+func (r *mirrorReader) Close() error {
+	if r.in == nil {
+		return nil
+	}
+	err := r.in.Close()
+	r.in = nil
+	return err
+}
+
+// resilverResult is the output of the resilver command
+type resilverResult struct {
+	Checked int             `json:"checked"` // objects checked
+	Copied  int             `json:"copied"`  // copies of objects made or updated
+	Dirs    int             `json:"dirs"`    // directories created
+	Skipped int             `json:"skipped"` // objects and directories not on a write quorum
+	Errors  []resilverError `json:"errors"`  // copies which couldn't be made
+}
+
+// resilverError describes a copy which couldn't be made
+type resilverError struct {
+	Remote   string `json:"remote"`
+	Upstream string `json:"upstream"`
+	Error    string `json:"error"`
+}
+
+// resilver brings the upstreams in targets, or all of them if empty,
+// in sync with the newest copy of every object and directory
+func (f *Fs) resilver(ctx context.Context, targets []string) (*resilverResult, error) {
+	if !f.opt.Mirror {
+		return nil, errors.New("resilver needs mirror mode to be enabled")
+	}
+	upstreams := f.upstreams
+	if len(targets) > 0 {
+		upstreams = nil
+		for _, target := range targets {
+			u, err := f.findUpstream(ctx, target)
+			if err != nil {
+				return nil, err
+			}
+			upstreams = append(upstreams, u)
+		}
+	}
+	res := &resilverResult{
+		Errors: []resilverError{},
+	}
+
+	// Entries are only copied if they are on a write quorum of the
+	// upstreams not being repaired, so ones which were deleted, or
+	// whose write failed, aren't brought back
+	var voters, writable []*upstream.Fs
+	for _, u := range f.upstreams {
+		if !u.IsWritable() {
+			continue
+		}
+		writable = append(writable, u)
+		if len(targets) == 0 || !containsUpstream(upstreams, u) {
+			voters = append(voters, u)
+		}
+	}
+	if len(voters) == 0 {
+		voters = writable
+	}
+	quorum := f.writeQuorum(len(voters))
+	onQuorum := func(remote string, candidates []upstream.Entry) bool {
+		n := 0
+		for _, u := range voters {
+			if hasCandidate(candidates, u) != nil {
+				n++
+			}
+		}
+		if n >= quorum {
+			return true
+		}
+		fs.Logf(remote, "Resilver: not copying as only on %d of %d upstreams but a write needs %d - was it deleted?", n, len(voters), quorum)
+		return false
+	}
+
+	var (
+		dirs []*Directory
+		objs []*Object
+	)
+	err := walk.ListR(ctx, f, "", true, -1, walk.ListAll, func(entries fs.DirEntries) error {
+		for _, e := range entries {
+			switch e := e.(type) {
+			case *Directory:
+				dirs = append(dirs, e)
+			case *Object:
+				objs = append(objs, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	addError := func(remote string, u *upstream.Fs, err error) {
+		fs.Errorf(remote, "Resilver failed on %s: %v", u.Name(), err)
+		mu.Lock()
+		defer mu.Unlock()
+		res.Errors = append(res.Errors, resilverError{Remote: remote, Upstream: u.Name(), Error: err.Error()})
+	}
+
+	// Make the missing directories, parents first
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Remote() < dirs[j].Remote()
+	})
+	for _, d := range dirs {
+		if !onQuorum(d.Remote(), d.candidates()) {
+			res.Skipped++
+			continue
+		}
+		for _, u := range upstreams {
+			if !u.IsCreatable() || hasCandidate(d.candidates(), u) != nil {
+				continue
+			}
+			err := operations.Mkdir(ctx, u, d.Remote())
+			if err != nil {
+				addError(d.Remote(), u, err)
+				continue
+			}
+			res.Dirs++
+		}
+	}
+
+	// Copy the newest copy of each object over the missing or
+	// different ones
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Transfers)
+	for _, o := range objs {
+		o := o
+		res.Checked++
+		if !onQuorum(o.Remote(), o.candidates()) {
+			res.Skipped++
+			continue
+		}
+		g.Go(func() error {
+			src := newestCandidate(gCtx, o.candidates())
+			for _, u := range upstreams {
+				if u == src.UpstreamFs() || !u.IsWritable() {
+					continue
+				}
+				var dst fs.Object
+				if e := hasCandidate(o.candidates(), u); e != nil {
+					dst = e.(*upstream.Object).UnWrap()
+					if operations.Equal(gCtx, src.UnWrap(), dst) {
+						continue
+					}
+				} else if !u.IsCreatable() {
+					continue
+				}
+				_, err := operations.Copy(gCtx, u, dst, o.Remote(), src.UnWrap())
+				if err != nil {
+					addError(o.Remote(), u, err)
+					continue
+				}
+				mu.Lock()
+				res.Copied++
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	fs.Infof(f, "Resilver: %d objects checked, %d copied, %d directories made, %d skipped, %d errors",
+		res.Checked, res.Copied, res.Dirs, res.Skipped, len(res.Errors))
+	return res, ctx.Err()
+}
+
+// containsUpstream returns true if u is in upstreams
+func containsUpstream(upstreams []*upstream.Fs, u *upstream.Fs) bool {
+	for _, x := range upstreams {
+		if x == u {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCandidate returns the candidate stored on u or nil
+func hasCandidate(candidates []upstream.Entry, u *upstream.Fs) upstream.Entry {
+	for _, e := range candidates {
+		if e.UpstreamFs() == u {
+			return e
+		}
+	}
+	return nil
+}
+
+// newestCandidate returns the object candidate with the latest
+// modification time, preferring the earlier upstreams on a tie
+func newestCandidate(ctx context.Context, candidates []upstream.Entry) (newest *upstream.Object) {
+	for _, e := range candidates {
+		o, ok := e.(*upstream.Object)
+		if !ok {
+			continue
+		}
+		if newest == nil || o.ModTime(ctx).After(newest.ModTime(ctx)) {
+			newest = o
+		}
+	}
+	return newest
+}
@@ -0,0 +1,268 @@
+package union
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+// setTiers finds the hot and cold upstreams for tiering
+func (f *Fs) setTiers(ctx context.Context) (err error) {
+	if f.opt.TierHot == "" || f.opt.TierCold == "" {
+		return errors.New("tiering needs both tier_hot and tier_cold to be set")
+	}
+	if f.opt.Mirror {
+		return errors.New("tiering can't be used in mirror mode")
+	}
+	f.hot, err = f.findUpstream(ctx, f.opt.TierHot)
+	if err != nil {
+		return fmt.Errorf("bad tier_hot: %w", err)
+	}
+	f.cold, err = f.findUpstream(ctx, f.opt.TierCold)
+	if err != nil {
+		return fmt.Errorf("bad tier_cold: %w", err)
+	}
+	if f.hot == f.cold {
+		return errors.New("tier_hot and tier_cold must be different upstreams")
+	}
+	if !f.hot.IsCreatable() {
+		return errors.New("tier_hot must not be read only or no create")
+	}
+	if !f.cold.IsWritable() {
+		return errors.New("tier_cold must not be read only")
+	}
+	f.accessed = make(map[string]time.Time)
+	return nil
+}
+
+// tierAccessedKey is the metadata key the time a file on the hot
+// upstream was last written or read is kept in
+const tierAccessedKey = "union-accessed"
+
+// tierAccessedPrecision is how often reading a file records the time
+const tierAccessedPrecision = time.Hour
+
+// setAccessed records that o was used at t in its metadata
+func setAccessed(ctx context.Context, o fs.Object, t time.Time) {
+	do, ok := o.(fs.SetMetadataer)
+	if !ok {
+		return
+	}
+	err := do.SetMetadata(ctx, fs.Metadata{tierAccessedKey: t.Format(time.RFC3339Nano)})
+	if err != nil && err != fs.ErrorNotImplemented {
+		fs.Debugf(o, "Failed to record access time: %v", err)
+	}
+}
+
+// setUsed records that o was used at t
+//
+// The time is kept in the metadata of files on the hot upstream so
+// that the tier command sees it after a restart, and in memory.
+func (f *Fs) setUsed(ctx context.Context, o *upstream.Object, t time.Time) {
+	f.accessedMu.Lock()
+	f.accessed[o.Remote()] = t
+	f.accessedMu.Unlock()
+	if o.UpstreamFs() == f.hot {
+		setAccessed(ctx, o, t)
+	}
+}
+
+// lastUsed returns the time o was last used as recorded in memory
+func (f *Fs) lastUsed(remote string) (t time.Time, ok bool) {
+	f.accessedMu.Lock()
+	defer f.accessedMu.Unlock()
+	t, ok = f.accessed[remote]
+	return t, ok
+}
+
+// recordWrite records that o was written now when tiering, as its
+// modification time may be older
+func (f *Fs) recordWrite(ctx context.Context, o *upstream.Object) {
+	if f.hot == nil {
+		return
+	}
+	f.setUsed(ctx, o, time.Now())
+}
+
+// recordAccess records that o was read now
+//
+// It isn't recorded again for a while so that the metadata isn't
+// written on every read.
+func (f *Fs) recordAccess(ctx context.Context, o *upstream.Object) {
+	now := time.Now()
+	if t, ok := f.lastUsed(o.Remote()); ok && now.Sub(t) < tierAccessedPrecision {
+		return
+	}
+	f.setUsed(ctx, o, now)
+}
+
+// usedSince returns true if o was modified, written or read through
+// the union since cutoff
+func (f *Fs) usedSince(ctx context.Context, o fs.Object, cutoff time.Time) bool {
+	if o.ModTime(ctx).After(cutoff) {
+		return true
+	}
+	if t, ok := f.lastUsed(o.Remote()); ok && t.After(cutoff) {
+		return true
+	}
+	metadata, err := fs.GetMetadata(ctx, o)
+	if err != nil {
+		fs.Debugf(o, "Failed to read access time: %v", err)
+		return false
+	}
+	accessed, err := time.Parse(time.RFC3339Nano, metadata[tierAccessedKey])
+	return err == nil && accessed.After(cutoff)
+}
+
+// tierOpen opens o for reading when tiering. If it is on the cold
+// upstream and tier_promote is set it is moved to the hot one in the
+// background once read.
+func (o *Object) tierOpen(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	f := o.fs
+	f.recordAccess(ctx, o.Object)
+	in, err := o.Object.Open(ctx, options...)
+	if err != nil || !f.opt.TierPromote || o.UpstreamFs() != f.cold {
+		return in, err
+	}
+	return &promoteOnClose{ReadCloser: in, ctx: ctx, o: o}, nil
+}
+
+// promoteOnClose promotes the object read once it is closed
+type promoteOnClose struct {
+	io.ReadCloser
+	ctx context.Context
+	o   *Object
+}
+
+// Close the object and start promoting it
+func (p *promoteOnClose) Close() error {
+	err := p.ReadCloser.Close()
+	p.o.fs.promoteLater(p.ctx, p.o)
+	return err
+}
+
+// promoteLater moves o from the cold upstream to the hot one in the
+// background unless it is being moved already
+func (f *Fs) promoteLater(ctx context.Context, o *Object) {
+	if _, busy := f.promoting.LoadOrStore(o.Remote(), struct{}{}); busy {
+		return
+	}
+	ctx = fs.CopyConfig(context.Background(), ctx)
+	f.promotions.Add(1)
+	go func() {
+		defer f.promotions.Done()
+		defer f.promoting.Delete(o.Remote())
+		if err := f.promote(ctx, o); err != nil {
+			fs.Errorf(o, "Failed to move to the hot upstream: %v", err)
+		}
+	}()
+}
+
+// promote moves o from the cold upstream to the hot one
+func (f *Fs) promote(ctx context.Context, o *Object) error {
+	// It may have been written to the hot upstream since
+	_, err := f.hot.NewObject(ctx, o.Remote())
+	if err == nil {
+		return nil
+	}
+	if err != fs.ErrorObjectNotFound {
+		return err
+	}
+	hotObj, err := operations.Move(ctx, f.hot, nil, o.Remote(), o.UnWrapUpstream().UnWrap())
+	if err != nil {
+		return err
+	}
+	if hotObj == nil {
+		return errors.New("not moved in dry run mode")
+	}
+	setAccessed(ctx, hotObj, time.Now())
+	fs.Infof(o, "Moved to the hot upstream")
+	return nil
+}
+
+// tierResult is the output of the tier command
+type tierResult struct {
+	Checked int         `json:"checked"` // files checked on the hot upstream
+	Moved   int         `json:"moved"`   // files moved to the cold upstream
+	Bytes   int64       `json:"bytes"`   // size of the files moved
+	Errors  []tierError `json:"errors"`  // files which couldn't be moved
+}
+
+// tierError describes a file which couldn't be moved
+type tierError struct {
+	Remote string `json:"remote"`
+	Error  string `json:"error"`
+}
+
+// tier moves the files on the hot upstream which haven't been used
+// for age to the cold upstream
+func (f *Fs) tier(ctx context.Context, age time.Duration) (*tierResult, error) {
+	if f.hot == nil {
+		return nil, errors.New("tiering needs tier_hot and tier_cold to be set")
+	}
+	res := &tierResult{
+		Errors: []tierError{},
+	}
+	cutoff := time.Now().Add(-age)
+	var (
+		objs []fs.Object
+		mu   sync.Mutex
+	)
+	err := walk.ListR(ctx, f.hot, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			res.Checked++
+			if !f.usedSince(ctx, o, cutoff) {
+				objs = append(objs, o)
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Transfers)
+	for _, o := range objs {
+		o := o
+		g.Go(func() error {
+			err := f.demote(gCtx, o)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fs.Errorf(o, "Failed to move to the cold upstream: %v", err)
+				res.Errors = append(res.Errors, tierError{Remote: o.Remote(), Error: err.Error()})
+				return nil
+			}
+			res.Moved++
+			res.Bytes += o.Size()
+			return nil
+		})
+	}
+	_ = g.Wait()
+	fs.Infof(f, "Tier: %d files checked, %d moved to the cold upstream, %d errors",
+		res.Checked, res.Moved, len(res.Errors))
+	return res, ctx.Err()
+}
+
+// demote moves o from the hot upstream to the cold one, replacing
+// any copy already there
+func (f *Fs) demote(ctx context.Context, o fs.Object) error {
+	dst, err := f.cold.NewObject(ctx, o.Remote())
+	if err == fs.ErrorObjectNotFound {
+		dst = nil
+	} else if err != nil {
+		return err
+	}
+	_, err = operations.Move(ctx, f.cold, dst, o.Remote(), o)
+	return err
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/rclone/rclone/backend/union/policy"
 	"github.com/rclone/rclone/backend/union/upstream"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/hash"
@@ -30,6 +31,7 @@ func init() {
 		Name:        "union",
 		Description: "Union merges the contents of several upstream fs",
 		NewFs:       NewFs,
+		CommandHelp: commandHelp,
 		MetadataInfo: &fs.MetadataInfo{
 			Help: `Any metadata supported by the underlying remote is read and written.`,
 		},
@@ -61,6 +63,60 @@ If a remote has less than this much free space then it won't be
 considered for use in lfs or eplfs policies.`,
 			Advanced: true,
 			Default:  fs.Gibi,
+		}, {
+			Name: "mirror",
+			Help: `Keep a full copy of every file on each upstream.
+
+In mirror mode files and directories are written to all the writable
+upstreams, overriding action_policy and create_policy. A write succeeds
+if at least mirror_quorum upstreams succeeded. Reads which fail on one
+upstream are retried on another which holds a copy of the file.
+
+Use the resilver backend command to bring an upstream which missed
+writes back in sync.`,
+			Default: false,
+		}, {
+			Name: "mirror_quorum",
+			Help: `Number of upstreams a write must succeed on in mirror mode.
+
+If this is 0 then a majority of the upstreams written to must succeed,
+or one of them if there are two.
+
+If a write doesn't reach the quorum then any new copies of the file
+are removed, but existing copies which were updated keep the new data.`,
+			Advanced: true,
+			Default:  0,
+		}, {
+			Name: "tier_hot",
+			Help: `Upstream to write new files to when tiering.
+
+Setting this and tier_cold enables tiering. New files are written to
+this upstream, overriding create_policy, and the tier backend command
+moves the files which haven't been used for tier_age to tier_cold.
+
+Give the upstream as written in upstreams without any :ro or :nc
+suffix.`,
+		}, {
+			Name: "tier_cold",
+			Help: `Upstream to move unused files to when tiering.
+
+Give the upstream as written in upstreams without any :ro or :nc
+suffix.`,
+		}, {
+			Name: "tier_age",
+			Help: `Move files to tier_cold which haven't been used for this long.
+
+A file counts as used when it is modified, or when it is written or
+read through this union. Writes and reads are recorded in the metadata
+of the files on tier_hot if it can store metadata, otherwise only
+while the backend is running.`,
+			Advanced: true,
+			Default:  fs.Duration(30 * 24 * time.Hour),
+		}, {
+			Name:     "tier_promote",
+			Help:     `Move files on tier_cold back to tier_hot after they are read.`,
+			Advanced: true,
+			Default:  false,
 		}},
 	}
 	fs.Register(fsi)
@@ -68,15 +124,21 @@ considered for use in lfs or eplfs policies.`,
 
 // Fs represents a union of upstreams
 type Fs struct {
-	name         string         // name of this remote
-	features     *fs.Features   // optional features
-	opt          common.Options // options for this Fs
-	root         string         // the path we are working on
-	upstreams    []*upstream.Fs // slice of upstreams
-	hashSet      hash.Set       // intersection of hash types
-	actionPolicy policy.Policy  // policy for ACTION
-	createPolicy policy.Policy  // policy for CREATE
-	searchPolicy policy.Policy  // policy for SEARCH
+	name         string               // name of this remote
+	features     *fs.Features         // optional features
+	opt          common.Options       // options for this Fs
+	root         string               // the path we are working on
+	upstreams    []*upstream.Fs       // slice of upstreams
+	hashSet      hash.Set             // intersection of hash types
+	actionPolicy policy.Policy        // policy for ACTION
+	createPolicy policy.Policy        // policy for CREATE
+	searchPolicy policy.Policy        // policy for SEARCH
+	hot          *upstream.Fs         // upstream for new files when tiering
+	cold         *upstream.Fs         // upstream for unused files when tiering
+	accessedMu   sync.Mutex           // protects accessed
+	accessed     map[string]time.Time // time files were last used when tiering
+	promoting    sync.Map             // files being moved to the hot tier
+	promotions   sync.WaitGroup       // background moves to the hot tier
 }
 
 // Wrap candidate objects in to a union Object
@@ -91,6 +153,7 @@ func (f *Fs) wrapEntries(entries ...upstream.Entry) (entry, error) {
 			Object: e,
 			fs:     f,
 			co:     entries,
+			failed: new(sync.Map),
 		}, nil
 	case *upstream.Directory:
 		return &Directory{
@@ -247,7 +310,9 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if err != nil || co == nil {
 		return nil, err
 	}
-	wo, err := f.wrapEntries(du.WrapObject(co))
+	uo := du.WrapObject(co)
+	f.recordWrite(ctx, uo)
+	wo, err := f.wrapEntries(uo)
 	return wo.(*Object), err
 }
 
@@ -460,6 +525,9 @@ func multiReader(n int, in io.Reader) ([]io.Reader, <-chan error) {
 }
 
 func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, options ...fs.OpenOption) (fs.Object, error) {
+	if f.opt.Mirror {
+		return f.mirrorPut(ctx, in, src, stream, nil, options...)
+	}
 	srcPath := src.Remote()
 	upstreams, err := f.create(ctx, srcPath)
 	if err == fs.ErrorObjectNotFound {
@@ -480,7 +548,9 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bo
 		if err != nil {
 			return nil, err
 		}
-		e, err := f.wrapEntries(u.WrapObject(o))
+		uo := u.WrapObject(o)
+		f.recordWrite(ctx, uo)
+		e, err := f.wrapEntries(uo)
 		return e.(*Object), err
 	}
 	// Multi-threading
@@ -730,7 +800,13 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	if err != nil {
 		return nil, err
 	}
-	return e.(*Object), errs.Err()
+	err = errs.Err()
+	if err != nil && f.opt.Mirror {
+		// Read from the upstreams which are still working
+		fs.Errorf(remote, "Ignoring failed upstreams in mirror mode: %v", err)
+		err = nil
+	}
+	return e.(*Object), err
 }
 
 // Precision is the greatest Precision of all upstreams
@@ -753,6 +829,9 @@ func (f *Fs) actionEntries(entries ...upstream.Entry) ([]upstream.Entry, error)
 }
 
 func (f *Fs) create(ctx context.Context, path string) ([]*upstream.Fs, error) {
+	if f.hot != nil {
+		return []*upstream.Fs{f.hot}, nil
+	}
 	return f.createPolicy.Create(ctx, f.upstreams, path)
 }
 
@@ -785,9 +864,69 @@ func (f *Fs) mergeDirEntries(entriesList [][]upstream.Entry) (fs.DirEntries, err
 	return entries, nil
 }
 
+// dirAction runs fn on dir in each of the upstreams the action policy
+// selects for it
+func (f *Fs) dirAction(ctx context.Context, dir string, fn func(u *upstream.Fs) error) error {
+	upstreams, err := f.action(ctx, dir)
+	if err == fs.ErrorObjectNotFound {
+		return fs.ErrorDirNotFound
+	}
+	if err != nil {
+		return err
+	}
+	errs := Errors(make([]error, len(upstreams)))
+	multithread(len(upstreams), func(i int) {
+		err := fn(upstreams[i])
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", upstreams[i].Name(), err)
+		}
+	})
+	return errs.Err()
+}
+
+// DirSetModTime sets the modification time of the directory dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	return f.dirAction(ctx, dir, func(u *upstream.Fs) error {
+		do := u.Features().DirSetModTime
+		if do == nil {
+			return fs.ErrorNotImplemented
+		}
+		return do(ctx, dir, modTime)
+	})
+}
+
+// DirMetadata returns the metadata of the directory dir from the
+// first upstream it is found in
+func (f *Fs) DirMetadata(ctx context.Context, dir string) (fs.Metadata, error) {
+	for _, u := range f.upstreams {
+		do := u.Features().DirMetadata
+		if do == nil {
+			return nil, fs.ErrorNotImplemented
+		}
+		metadata, err := do(ctx, dir)
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			continue
+		}
+		return metadata, err
+	}
+	return nil, fs.ErrorDirNotFound
+}
+
+// DirSetMetadata sets metadata on the directory dir
+func (f *Fs) DirSetMetadata(ctx context.Context, dir string, metadata fs.Metadata) error {
+	return f.dirAction(ctx, dir, func(u *upstream.Fs) error {
+		do := u.Features().DirSetMetadata
+		if do == nil {
+			return fs.ErrorNotImplemented
+		}
+		return do(ctx, dir, metadata)
+	})
+}
+
 // Shutdown the backend, closing any background tasks and any
 // cached connections.
 func (f *Fs) Shutdown(ctx context.Context) error {
+	f.promotions.Wait()
 	errs := Errors(make([]error, len(f.upstreams)))
 	multithread(len(f.upstreams), func(i int) {
 		u := f.upstreams[i]
@@ -889,6 +1028,18 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	if err != nil {
 		return nil, err
 	}
+	if opt.Mirror {
+		// Write everything to all the upstreams
+		f.actionPolicy, _ = policy.Get("all")
+		f.createPolicy, _ = policy.Get("all")
+	}
+	// Tiering isn't needed if the root is a file
+	if (opt.TierHot != "" || opt.TierCold != "") && fserr == nil {
+		err = f.setTiers(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
 	fs.Debugf(f, "actionPolicy = %T, createPolicy = %T, searchPolicy = %T", f.actionPolicy, f.createPolicy, f.searchPolicy)
 	var features = (&fs.Features{
 		CaseInsensitive:         true,
@@ -948,6 +1099,97 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	return f, fserr
 }
 
+var commandHelp = []fs.CommandHelp{{
+	Name:  "resilver",
+	Short: "Bring the upstreams of a mirror back in sync",
+	Long: `This copies the newest copy of every file in the union to the
+upstreams where it is missing or different, and makes any missing
+directories. It needs mirror mode to be enabled.
+
+Pass the upstreams to repair as arguments, as written in the upstreams
+setting without any :ro or :nc suffix, otherwise all of them are
+repaired.
+
+Usage Example:
+
+    rclone backend resilver union: [upstream...]
+    rclone rc backend/command command=resilver fs=union: [upstream...]
+
+Files and directories are only copied if they are on as many of the
+other upstreams as a write needs to succeed (see mirror_quorum), so
+ones deleted while an upstream was unavailable aren't copied back from
+it. They are logged and left where they are to be removed by hand.
+Name the upstream to repair to copy everything on the others to it,
+for example after replacing it with an empty one.
+
+It returns a summary with the number of objects checked, the number of
+copies made, the number of directories made, the number of files and
+directories skipped and a list of errors. Use --dry-run to see what
+would be copied.
+`,
+}, {
+	Name:  "tier",
+	Short: "Move unused files to the cold upstream",
+	Long: `This moves the files on tier_hot which haven't been used for
+tier_age to tier_cold. Their paths in the union don't change. It needs
+tier_hot and tier_cold to be set.
+
+Usage Example:
+
+    rclone backend tier union:
+    rclone backend tier union: -o age=7d
+    rclone rc backend/command command=tier fs=union: -o age=7d
+
+It returns a summary with the number of files checked, the number of
+files and bytes moved and a list of errors. Use --dry-run to see what
+would be moved.
+`,
+	Opts: map[string]string{
+		"age": "Move files unused for longer than this instead of tier_age",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "resilver":
+		return f.resilver(ctx, arg)
+	case "tier":
+		age := time.Duration(f.opt.TierAge)
+		if s := opt["age"]; s != "" {
+			if age, err = fs.ParseDuration(s); err != nil {
+				return nil, fmt.Errorf("bad age: %w", err)
+			}
+		}
+		return f.tier(ctx, age)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// findUpstream returns the upstream with the root remote given, as
+// written in the upstreams setting without any :ro or :nc suffix
+func (f *Fs) findUpstream(ctx context.Context, remote string) (*upstream.Fs, error) {
+	rFs, err := cache.Get(ctx, remote)
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, err
+	}
+	for _, u := range f.upstreams {
+		if operations.Same(u.RootFs, rFs) {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not an upstream of this union", remote)
+}
+
 func parentDir(absPath string) string {
 	parent := path.Dir(strings.TrimRight(filepath.ToSlash(absPath), "/"))
 	if parent == "." {
@@ -971,16 +1213,20 @@ func multithread(num int, fn func(int)) {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = (*Fs)(nil)
-	_ fs.Purger          = (*Fs)(nil)
-	_ fs.PutStreamer     = (*Fs)(nil)
-	_ fs.Copier          = (*Fs)(nil)
-	_ fs.Mover           = (*Fs)(nil)
-	_ fs.DirMover        = (*Fs)(nil)
-	_ fs.DirCacheFlusher = (*Fs)(nil)
-	_ fs.ChangeNotifier  = (*Fs)(nil)
-	_ fs.Abouter         = (*Fs)(nil)
-	_ fs.ListRer         = (*Fs)(nil)
-	_ fs.Shutdowner      = (*Fs)(nil)
-	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.Fs               = (*Fs)(nil)
+	_ fs.Purger           = (*Fs)(nil)
+	_ fs.PutStreamer      = (*Fs)(nil)
+	_ fs.Copier           = (*Fs)(nil)
+	_ fs.Mover            = (*Fs)(nil)
+	_ fs.DirMover         = (*Fs)(nil)
+	_ fs.DirCacheFlusher  = (*Fs)(nil)
+	_ fs.ChangeNotifier   = (*Fs)(nil)
+	_ fs.Abouter          = (*Fs)(nil)
+	_ fs.ListRer          = (*Fs)(nil)
+	_ fs.Shutdowner       = (*Fs)(nil)
+	_ fs.DirSetModTimer   = (*Fs)(nil)
+	_ fs.DirMetadataer    = (*Fs)(nil)
+	_ fs.DirSetMetadataer = (*Fs)(nil)
+	_ fs.CleanUpper       = (*Fs)(nil)
+	_ fs.Commander        = (*Fs)(nil)
 )
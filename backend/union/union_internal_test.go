@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/rclone/rclone/backend/union/upstream"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/operations"
@@ -156,3 +158,278 @@ func TestMoveCopy(t *testing.T) {
 		})
 	})
 }
+
+// Make a mirror union of n local directories
+func makeMirror(ctx context.Context, t *testing.T, n int) *Fs {
+	dirs := MakeTestDirs(t, n)
+	f, err := fs.NewFs(ctx, fmt.Sprintf(":union,mirror,upstreams='%s':", strings.Join(dirs, " ")))
+	require.NoError(t, err)
+	return f.(*Fs)
+}
+
+func TestMirrorQuorum(t *testing.T) {
+	f := &Fs{}
+	for _, test := range []struct {
+		quorum int
+		n      int
+		want   int
+	}{
+		{0, 1, 1},
+		{0, 2, 1},
+		{0, 3, 2},
+		{0, 4, 3},
+		{1, 3, 1},
+		{5, 3, 3},
+	} {
+		f.opt.MirrorQuorum = test.quorum
+		assert.Equal(t, test.want, f.writeQuorum(test.n), fmt.Sprintf("%+v", test))
+	}
+}
+
+func TestMirrorRollback(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeMirror(ctx, t, 3)
+	f.opt.MirrorQuorum = 3
+
+	// Put a file where the directory should be so the write fails
+	// on one upstream
+	u0, u1, u2 := f.upstreams[0], f.upstreams[1], f.upstreams[2]
+	blocker := fstest.NewItem("dir", "blocker", fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, u2, &blocker, "blocker", true)
+
+	contents := random.String(100)
+	file := fstest.NewItem("dir/file.txt", contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	src := object.NewStaticObjectInfo(file.Path, file.ModTime, file.Size, true, nil, nil)
+	_, err := f.Put(ctx, bytes.NewBufferString(contents), src)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "succeeded on 2 of 3 upstreams but needs 3")
+
+	// Check the copies which were written have been removed
+	for _, u := range []*upstream.Fs{u0, u1} {
+		_, err := u.NewObject(ctx, file.Path)
+		assert.Equal(t, fs.ErrorObjectNotFound, err, u.Name())
+	}
+	fstest.CheckListingWithPrecision(t, u2, []fstest.Item{blocker}, nil, f.Precision())
+}
+
+func TestMirrorFailover(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeMirror(ctx, t, 3)
+
+	// Put a file through the union and check it is on every upstream
+	contents := random.String(100)
+	file := fstest.NewItem("dir/file.txt", contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	obj := fstests.PutTestContents(ctx, t, f, &file, contents, true)
+	for _, u := range f.upstreams {
+		fstest.CheckListingWithPrecision(t, u, []fstest.Item{file}, []string{"dir"}, f.Precision())
+	}
+
+	// Remove the copy the union reads from underneath it
+	primary := obj.(*Object).UnWrapUpstream()
+	require.NoError(t, primary.UnWrap().Remove(ctx))
+
+	// Check the read carries on from another copy
+	assert.Equal(t, contents, fstests.ReadObject(ctx, t, obj, -1))
+	assert.Equal(t, contents[10:20], fstests.ReadObject(ctx, t, obj, -1, &fs.RangeOption{Start: 10, End: 19}))
+	_, failed := obj.(*Object).failed.Load(primary.UpstreamFs())
+	assert.True(t, failed)
+
+	// Check the object can still be found with an upstream missing it
+	o, err := f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, file.Size, o.Size())
+}
+
+func TestMirrorResilver(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	f := makeMirror(ctx, t, 3)
+
+	contents := random.String(100)
+	file := fstest.NewItem("dir/file.txt", contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+	require.NoError(t, f.Mkdir(ctx, "empty"))
+
+	// Make the upstreams lag behind
+	u0, u1, u2 := f.upstreams[0], f.upstreams[1], f.upstreams[2]
+	o, err := u0.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	require.NoError(t, u0.Rmdir(ctx, "empty"))
+	oldContents := random.String(50)
+	old := fstest.NewItem(file.Path, oldContents, fstest.Time("2000-01-01T00:00:00Z"))
+	_ = fstests.PutTestContents(ctx, t, u1, &old, oldContents, true)
+
+	t.Run("NotUpstream", func(t *testing.T) {
+		_, err := f.Command(ctx, "resilver", []string{t.TempDir()}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("One", func(t *testing.T) {
+		out, err := f.Command(ctx, "resilver", []string{u0.RootFs.Root()}, nil)
+		require.NoError(t, err)
+		res := out.(*resilverResult)
+		assert.Equal(t, 1, res.Checked)
+		assert.Equal(t, 1, res.Copied)
+		assert.Equal(t, 1, res.Dirs)
+		assert.Empty(t, res.Errors)
+		fstest.CheckListingWithPrecision(t, u0, []fstest.Item{file}, []string{"dir", "empty"}, f.Precision())
+		fstest.CheckListingWithPrecision(t, u1, []fstest.Item{old}, []string{"dir", "empty"}, f.Precision())
+	})
+
+	t.Run("All", func(t *testing.T) {
+		out, err := f.Command(ctx, "resilver", nil, nil)
+		require.NoError(t, err)
+		res := out.(*resilverResult)
+		assert.Equal(t, 1, res.Copied)
+		assert.Equal(t, 0, res.Dirs)
+		for _, u := range []*upstream.Fs{u0, u1, u2} {
+			fstest.CheckListingWithPrecision(t, u, []fstest.Item{file}, []string{"dir", "empty"}, f.Precision())
+		}
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		// Delete a file and directory from all but one upstream
+		// as if it was unavailable at the time
+		for _, u := range []*upstream.Fs{u1, u2} {
+			o, err := u.NewObject(ctx, file.Path)
+			require.NoError(t, err)
+			require.NoError(t, o.Remove(ctx))
+			require.NoError(t, u.Rmdir(ctx, "empty"))
+		}
+		out, err := f.Command(ctx, "resilver", nil, nil)
+		require.NoError(t, err)
+		res := out.(*resilverResult)
+		assert.Equal(t, 0, res.Copied)
+		assert.Equal(t, 0, res.Dirs)
+		assert.Equal(t, 2, res.Skipped)
+		fstest.CheckListingWithPrecision(t, u0, []fstest.Item{file}, []string{"dir", "empty"}, f.Precision())
+		for _, u := range []*upstream.Fs{u1, u2} {
+			fstest.CheckListingWithPrecision(t, u, []fstest.Item{}, []string{"dir"}, f.Precision())
+		}
+	})
+
+	t.Run("NotMirror", func(t *testing.T) {
+		f.opt.Mirror = false
+		defer func() { f.opt.Mirror = true }()
+		_, err := f.Command(ctx, "resilver", nil, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestTier(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	dirs := MakeTestDirs(t, 2)
+	union := fmt.Sprintf(":union,upstreams='%s %s',tier_hot='%s',tier_cold='%s',tier_promote:", dirs[0], dirs[1], dirs[0], dirs[1])
+	fsi, err := fs.NewFs(ctx, union)
+	require.NoError(t, err)
+	f := fsi.(*Fs)
+	hot, cold := f.upstreams[0], f.upstreams[1]
+	require.Equal(t, hot, f.hot)
+	require.Equal(t, cold, f.cold)
+
+	t.Run("BadConfig", func(t *testing.T) {
+		_, err := fs.NewFs(ctx, fmt.Sprintf(":union,upstreams='%s %s',tier_hot='%s':", dirs[0], dirs[1], dirs[0]))
+		assert.Error(t, err)
+		_, err = fs.NewFs(ctx, fmt.Sprintf(":union,upstreams='%s %s',tier_hot='%s',tier_cold='%s':", dirs[0], dirs[1], dirs[0], t.TempDir()))
+		assert.Error(t, err)
+		_, err = fs.NewFs(ctx, fmt.Sprintf(":union,upstreams='%s %s',tier_hot='%s',tier_cold='%s':", dirs[0], dirs[1], dirs[0], dirs[0]))
+		assert.Error(t, err)
+	})
+
+	// New files are written to the hot upstream
+	newContents := random.String(50)
+	newFile := fstest.NewItem("dir/new.txt", newContents, time.Now())
+	_ = fstests.PutTestContents(ctx, t, f, &newFile, newContents, true)
+	oldContents := random.String(60)
+	oldFile := fstest.NewItem("dir/old.txt", oldContents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &oldFile, oldContents, true)
+	copiedContents := random.String(70)
+	copiedFile := fstest.NewItem("dir/copied.txt", copiedContents, fstest.Time("2019-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f, &copiedFile, copiedContents, true)
+	fstest.CheckListingWithPrecision(t, hot, []fstest.Item{newFile, oldFile, copiedFile}, []string{"dir"}, f.Precision())
+	fstest.CheckListingWithPrecision(t, cold, []fstest.Item{}, []string{}, f.Precision())
+
+	// Writing a file counts as using it whatever its modification time
+	for _, item := range []fstest.Item{oldFile, copiedFile} {
+		o, err := hot.NewObject(ctx, item.Path)
+		require.NoError(t, err)
+		metadata, err := fs.GetMetadata(ctx, o)
+		require.NoError(t, err)
+		written, err := time.Parse(time.RFC3339Nano, metadata[tierAccessedKey])
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), written, time.Minute)
+	}
+
+	// Make old.txt look written long ago and copied.txt yesterday
+	setWritten := func(item fstest.Item, when time.Time) {
+		o, err := hot.NewObject(ctx, item.Path)
+		require.NoError(t, err)
+		f.setUsed(ctx, hot.WrapObject(o), when)
+	}
+	setWritten(oldFile, time.Now().Add(-60*24*time.Hour))
+	setWritten(copiedFile, time.Now().Add(-24*time.Hour))
+
+	t.Run("Tier", func(t *testing.T) {
+		out, err := f.Command(ctx, "tier", nil, nil)
+		require.NoError(t, err)
+		res := out.(*tierResult)
+		assert.Equal(t, 3, res.Checked)
+		assert.Equal(t, 1, res.Moved)
+		assert.Equal(t, oldFile.Size, res.Bytes)
+		assert.Empty(t, res.Errors)
+		fstest.CheckListingWithPrecision(t, hot, []fstest.Item{newFile, copiedFile}, []string{"dir"}, f.Precision())
+		fstest.CheckListingWithPrecision(t, cold, []fstest.Item{oldFile}, []string{"dir"}, f.Precision())
+		fstest.CheckListingWithPrecision(t, f, []fstest.Item{newFile, oldFile, copiedFile}, []string{"dir"}, f.Precision())
+
+		// A union which didn't see the writes reads them from the metadata
+		fresh, err := fs.NewFs(ctx, strings.Replace(union, "tier_promote", "tier_age=720h", 1))
+		require.NoError(t, err)
+		out, err = fresh.(*Fs).Command(ctx, "tier", nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, out.(*tierResult).Moved)
+	})
+
+	t.Run("Promote", func(t *testing.T) {
+		o, err := f.NewObject(ctx, oldFile.Path)
+		require.NoError(t, err)
+		assert.Equal(t, oldContents, fstests.ReadObject(ctx, t, o, -1))
+		// It is moved in the background after the read
+		f.promotions.Wait()
+		fstest.CheckListingWithPrecision(t, hot, []fstest.Item{newFile, oldFile, copiedFile}, []string{"dir"}, f.Precision())
+		fstest.CheckListingWithPrecision(t, cold, []fstest.Item{}, []string{"dir"}, f.Precision())
+
+		// Reading it counts as using it
+		out, err := f.Command(ctx, "tier", nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, out.(*tierResult).Moved)
+
+		// Even for a union which didn't see it being read
+		fresh, err := fs.NewFs(ctx, strings.Replace(union, "tier_promote", "tier_age=720h", 1))
+		require.NoError(t, err)
+		out, err = fresh.(*Fs).Command(ctx, "tier", nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, out.(*tierResult).Moved)
+	})
+
+	t.Run("Age", func(t *testing.T) {
+		_, err := f.Command(ctx, "tier", nil, map[string]string{"age": "potato"})
+		assert.Error(t, err)
+		out, err := f.Command(ctx, "tier", nil, map[string]string{"age": "-1s"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, out.(*tierResult).Moved)
+		fstest.CheckListingWithPrecision(t, hot, []fstest.Item{}, []string{"dir"}, f.Precision())
+		fstest.CheckListingWithPrecision(t, f, []fstest.Item{newFile, oldFile, copiedFile}, []string{"dir"}, f.Precision())
+	})
+}
@@ -40,6 +40,7 @@ docs = [
     "compress.md",
     "combine.md",
     "dropbox.md",
+    "erasure.md",
     "filefabric.md",
     "ftp.md",
     "googlecloudstorage.md",
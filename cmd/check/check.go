@@ -3,9 +3,12 @@ package check
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/rclone/rclone/cmd"
@@ -28,6 +31,9 @@ var (
 	differ            = ""
 	errFile           = ""
 	checkFileHashType = ""
+	sample            = ""
+	sampleBytes       = fs.SizeSuffix(-1)
+	sampleSeed        = int64(0)
 )
 
 func init() {
@@ -35,6 +41,9 @@ func init() {
 	cmdFlags := commandDefinition.Flags()
 	flags.BoolVarP(cmdFlags, &download, "download", "", download, "Check by downloading rather than with hash")
 	flags.StringVarP(cmdFlags, &checkFileHashType, "checkfile", "C", checkFileHashType, "Treat source:path as a SUM file with hashes of given type")
+	flags.StringVarP(cmdFlags, &sample, "sample", "", sample, "Only check a random sample of this fraction of the files, e.g. 0.5% or 0.005")
+	flags.FVarP(cmdFlags, &sampleBytes, "sample-bytes", "", "Only check a random sample of files up to this size in total")
+	flags.Int64VarP(cmdFlags, &sampleSeed, "sample-seed", "", sampleSeed, "Seed for choosing the sample (default random)")
 	AddFlags(cmdFlags)
 }
 
@@ -157,6 +166,37 @@ to check all the data.
 
 If you supply the |--checkfile HASH| flag with a valid hash name,
 the |source:path| must point to a text file in the SUM format.
+
+### Sampling
+
+Checking all the data on a large remote can take too long, and
+checking hashes alone trusts the hashes the provider reports. With
+|--sample| and |--sample-bytes| rclone checks a random sample of the
+files present in both the source and destination by downloading them.
+
+- |--sample 0.5%| (or |--sample 0.005|) checks about 0.5% of the files.
+- |--sample-bytes 100G| checks as many files as fit in 100 GiB.
+
+If both are given the sample is the files chosen by |--sample| which
+fit in the |--sample-bytes| budget.
+
+The files in the sample are downloaded from the destination and their
+hashes recomputed and compared with the source hashes. If the source
+doesn't have hashes or |--download| is supplied both copies are
+downloaded and compared instead. Files not in the sample aren't
+checked, though files missing from either side are still reported.
+
+The sample is chosen from a hash of each file's path and a seed, so
+running again with the same |--sample-seed| checks the same files. If
+no seed is given a random one is used and logged so the run can be
+reproduced, and so that repeated runs, e.g. nightly, check different
+files.
+
+At the end rclone reports the size of the sample, the proportion of
+files in it which differ and an upper bound on the proportion of all
+the files which differ with 95% confidence. For example if 3,000
+files are checked and none differ then with 95% confidence fewer than
+0.13% of the files differ.
 `, "|", "`") + FlagsHelp,
 	RunE: func(command *cobra.Command, args []string) error {
 		cmd.CheckArgs(2, 2, command, args)
@@ -187,6 +227,22 @@ the |source:path| must point to a text file in the SUM format.
 				return operations.CheckSum(context.Background(), fsrc, fsum, sumFile, hashType, opt, download)
 			}
 
+			if sample != "" || sampleBytes >= 0 {
+				err = setSample(command, opt)
+				if err != nil {
+					return err
+				}
+				if download {
+					return operations.CheckDownload(context.Background(), opt)
+				}
+				if hashType := fsrc.Hashes().GetOne(); hashType == hash.None {
+					fs.Infof(nil, "No source hash - checking sample by downloading both copies")
+				} else {
+					fs.Infof(nil, "Checking sample by recomputing %v hashes", hashType)
+				}
+				return operations.Check(context.Background(), opt)
+			}
+
 			if download {
 				return operations.CheckDownload(context.Background(), opt)
 			}
@@ -201,3 +257,42 @@ the |source:path| must point to a text file in the SUM format.
 		return nil
 	},
 }
+
+// parseSampleFraction parses a --sample value like 0.5% or 0.005
+func parseSampleFraction(s string) (fraction float64, err error) {
+	value := strings.TrimSuffix(s, "%")
+	isPercent := value != s
+	fraction, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad --sample %q: %w", s, err)
+	}
+	if isPercent {
+		fraction /= 100
+	}
+	if fraction <= 0 || fraction > 1 {
+		return 0, fmt.Errorf("bad --sample %q: must be more than 0 and at most 100%%", s)
+	}
+	return fraction, nil
+}
+
+// setSample sets the sampling options in opt from the flags
+func setSample(command *cobra.Command, opt *operations.CheckOpt) (err error) {
+	if sample != "" {
+		opt.SampleFraction, err = parseSampleFraction(sample)
+		if err != nil {
+			return err
+		}
+	}
+	if sampleBytes >= 0 {
+		if sampleBytes == 0 {
+			return errors.New("--sample-bytes must be more than 0")
+		}
+		opt.SampleBytes = int64(sampleBytes)
+	}
+	opt.SampleSeed = sampleSeed
+	if !command.Flags().Changed("sample-seed") {
+		opt.SampleSeed = rand.Int63()
+	}
+	fs.Logf(nil, "Checking a sample using --sample-seed %d", opt.SampleSeed)
+	return nil
+}
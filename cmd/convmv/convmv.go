@@ -0,0 +1,158 @@
+// Package convmv provides the convmv command.
+package convmv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/transform"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "convmv remote:path",
+	Short: `Rename files and directories in place using --name-transform.`,
+	Long: `
+This renames the files and directories under remote:path in place
+according to the transformations given with ` + "`--name-transform`" + `.
+
+If remote:path is a file then only that file is renamed. Otherwise
+all the files under remote:path are renamed along with the
+directories they are in. Filters are supported and only the matching
+files are renamed.
+
+For example to convert all the names to lower case and Unicode NFC
+form
+
+    rclone convmv remote:path --name-transform all,lowercase --name-transform all,nfc
+
+Each ` + "`--name-transform`" + ` is of the form ` + "`[file,|dir,|all,]command[=ARG]`" + `
+and they are applied in the order given. The transformation applies
+to file names only unless it is prefixed with ` + "`dir,`" + ` for directory
+names only or ` + "`all,`" + ` for both. The commands available are
+
+` + transform.Help() + `
+The same transformations can be applied to the destination names in
+` + "`sync`, `copy` and `move`" + ` by using ` + "`--name-transform`" + ` with those
+commands.
+
+**Important**: Since this can cause data loss, test first with the
+` + "`--dry-run` or the `--interactive`/`-i`" + ` flag.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.64",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f, fileName := cmd.NewFsFile(args[0])
+		cmd.Run(true, true, command, func() error {
+			return ConvMv(context.Background(), f, fileName)
+		})
+	},
+}
+
+// ConvMv renames the object fileName on f with --name-transform, or
+// all the objects on f if fileName is empty.
+func ConvMv(ctx context.Context, f fs.Fs, fileName string) error {
+	ci := fs.GetConfig(ctx)
+	t, err := transform.New(ci.NameTransform)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errors.New("no --name-transform supplied")
+	}
+	if fileName != "" {
+		return rename(ctx, f, t, fileName)
+	}
+
+	// Find the files and directories to rename
+	var (
+		mu          sync.Mutex
+		remotes     []string
+		renamedDirs []string
+	)
+	err = walk.ListR(ctx, f, "", false, ci.MaxDepth, walk.ListAll, func(entries fs.DirEntries) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case fs.Object:
+				remotes = append(remotes, x.Remote())
+			case fs.Directory:
+				newRemote, err := t.Path(x.Remote(), true)
+				if err != nil {
+					err = fs.CountError(err)
+					fs.Errorf(fs.LogDirName(f, x.Remote()), "Can't rename directory: %v", err)
+				} else if newRemote != x.Remote() {
+					renamedDirs = append(renamedDirs, x.Remote())
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Rename the files
+	errCount := 0
+	for _, remote := range remotes {
+		err := rename(ctx, f, t, remote)
+		if err != nil {
+			err = fs.CountError(err)
+			fs.Errorf(fs.LogDirName(f, remote), "%v", err)
+			errCount++
+		}
+	}
+
+	// Make any renamed directories which are empty and remove the
+	// old ones, deepest first.
+	sort.Sort(sort.Reverse(sort.StringSlice(renamedDirs)))
+	for _, dir := range renamedDirs {
+		newDir, err := t.Path(dir, true)
+		if err == nil {
+			err = operations.Mkdir(ctx, f, newDir)
+		}
+		if err != nil {
+			fs.Errorf(fs.LogDirName(f, dir), "Failed to make renamed directory: %v", err)
+			continue
+		}
+		err = operations.TryRmdir(ctx, f, dir)
+		if err != nil {
+			fs.Debugf(fs.LogDirName(f, dir), "Failed to remove old directory: %v", err)
+		}
+	}
+	if errCount > 0 {
+		return fmt.Errorf("failed to rename %d files", errCount)
+	}
+	return nil
+}
+
+// rename renames the object at remote on f with t if its name changes
+func rename(ctx context.Context, f fs.Fs, t *transform.Transform, remote string) error {
+	newRemote, err := t.Path(remote, false)
+	if err != nil {
+		return err
+	}
+	if newRemote == remote {
+		fs.Debugf(fs.LogDirName(f, remote), "Name unchanged")
+		return nil
+	}
+	err = operations.MoveFile(ctx, f, f, newRemote, remote)
+	if err != nil {
+		return fmt.Errorf("failed to rename %q to %q: %w", remote, newRemote, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package convmv
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = fstest.Time("2017-02-03T04:05:06.499999999Z")
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+func TestConvMvNoTransform(t *testing.T) {
+	r := fstest.NewRun(t)
+	err := ConvMv(context.Background(), r.Fremote, "")
+	require.Error(t, err)
+}
+
+func TestConvMv(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	r.WriteObject(ctx, "Dir/File One.TXT", "one", t1)
+	r.WriteObject(ctx, "Dir/sub/file two", "two", t1)
+	r.WriteObject(ctx, "three", "three", t1)
+
+	ci.NameTransform = []string{"all,lowercase", "all,replace= :_"}
+	err := ConvMv(ctx, r.Fremote, "")
+	require.NoError(t, err)
+
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{
+		fstest.NewItem("dir/file_one.txt", "one", t1),
+		fstest.NewItem("dir/sub/file_two", "two", t1),
+		fstest.NewItem("three", "three", t1),
+	}, []string{
+		"dir",
+		"dir/sub",
+	}, fs.GetModifyWindow(ctx, r.Fremote))
+}
+
+func TestConvMvOneFile(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	r.WriteObject(ctx, "File", "one", t1)
+	r.WriteObject(ctx, "Other", "two", t1)
+
+	ci.NameTransform = []string{"prefix=new_"}
+	err := ConvMv(ctx, r.Fremote, "File")
+	require.NoError(t, err)
+
+	r.CheckRemoteItems(t,
+		fstest.NewItem("new_File", "one", t1),
+		fstest.NewItem("Other", "two", t1),
+	)
+}
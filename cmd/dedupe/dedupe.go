@@ -4,17 +4,22 @@ package dedupe
 import (
 	"context"
 	"log"
+	"os"
 
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/spf13/cobra"
 )
 
 var (
-	dedupeMode = operations.DeduplicateInteractive
-	byHash     = false
+	dedupeMode   = operations.DeduplicateInteractive
+	byHash       = false
+	byContent    = false
+	dedupeAction = operations.DedupeActionDelete
+	hashType     = hash.None
 )
 
 func init() {
@@ -22,10 +27,13 @@ func init() {
 	cmdFlag := commandDefinition.Flags()
 	flags.FVarP(cmdFlag, &dedupeMode, "dedupe-mode", "", "Dedupe mode interactive|skip|first|newest|oldest|largest|smallest|rename")
 	flags.BoolVarP(cmdFlag, &byHash, "by-hash", "", false, "Find identical hashes rather than names")
+	flags.BoolVarP(cmdFlag, &byContent, "by-content", "", false, "Find identical content by size and hash across all the remotes given")
+	flags.FVarP(cmdFlag, &dedupeAction, "dedupe-action", "", "What to do with extra copies found with --by-content delete|link")
+	flags.FVarP(cmdFlag, &hashType, "hash", "", "Use this hash with --by-content instead of one common to all the remotes")
 }
 
 var commandDefinition = &cobra.Command{
-	Use:   "dedupe [mode] remote:path",
+	Use:   "dedupe [mode] remote:path [remote:path...]",
 	Short: `Interactively find duplicate filenames and delete/rename them.`,
 	Long: `
 
@@ -134,11 +142,60 @@ For example, to rename all the identically named photos in your Google Photos di
 Or
 
     rclone dedupe rename "drive:Google Photos"
+
+### Deduping by content
+
+If ` + "`--by-content`" + ` is passed in then dedupe will find files with
+identical content anywhere in one or more remotes, not just files in
+the same directory. All the arguments are remotes to search, so the
+mode must be given with ` + "`--dedupe-mode`" + `. Files are compared by
+size first and then only files which share a size are hashed. Empty
+files are ignored.
+
+The hash used is one which all the remotes support, or the one given
+with ` + "`--hash`" + `. To avoid reading the hashes again on each run, or
+for remotes with slow or no hashes, wrap the remotes in a
+[hasher](/hasher/) remote and pass that to dedupe instead.
+
+The groups of identical files are printed to standard output as a
+JSON array, with one object per group giving the ` + "`Size`" + `, the
+` + "`Hashes`" + ` and the ` + "`Files`" + ` in the group. Each file has the
+` + "`Fs`" + ` it was found in, its ` + "`Path`" + `, ` + "`ModTime`" + ` and ` + "`ID`" + ` if the
+remote has one, and the ` + "`Action`" + ` taken on it, if any.
+
+    [
+    {"Size":6048320,"Hashes":{"md5":"1eedaa9fe86fd4b8632e2ac549403b36"},"Files":[
+      {"Fs":"drive:photos","Path":"one.jpg","ModTime":"2016-03-05T16:23:16.798Z","ID":"1a2b","Action":"keep"},
+      {"Fs":"drive:backup","Path":"2016/one.jpg","ModTime":"2016-03-05T16:22:46.185Z","ID":"3c4d","Action":"delete"}]}
+    ]
+
+The dedupe mode chooses which file in each group to keep
+
+  * ` + "`--dedupe-mode list`" + ` - lists the groups and changes nothing. This is the default as interactive mode is not supported.
+  * ` + "`--dedupe-mode skip`" + ` - the same as list.
+  * ` + "`--dedupe-mode first`" + ` - keeps the first file, taking the remotes in the order given then the paths in sorted order.
+  * ` + "`--dedupe-mode newest`" + ` - keeps the newest file.
+  * ` + "`--dedupe-mode oldest`" + ` - keeps the oldest file.
+
+and ` + "`--dedupe-action`" + ` chooses what happens to the other files
+
+  * ` + "`--dedupe-action delete`" + ` - deletes them. This is the default.
+  * ` + "`--dedupe-action link`" + ` - replaces them with hard links to the kept file on remotes which support them, such as local, or with server-side shortcuts on remotes which support those, such as Google Drive. A file can only be linked to a file on the same remote, so files which can't be linked are left alone.
+
+For example, to find the files which are duplicated between two
+directories and replace the copies in the second with hard links to
+the first
+
+    rclone dedupe --by-content --dedupe-mode first --dedupe-action link /data/photos /data/photos-backup
 `,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.27",
 	},
 	Run: func(command *cobra.Command, args []string) {
+		if byContent {
+			runByContent(command, args)
+			return
+		}
 		cmd.CheckArgs(1, 2, command, args)
 		if len(args) > 1 {
 			err := dedupeMode.Set(args[0])
@@ -156,3 +213,23 @@ Or
 		})
 	},
 }
+
+// runByContent runs dedupe --by-content on all the remotes in args
+func runByContent(command *cobra.Command, args []string) {
+	cmd.CheckArgs(1, 1e6, command, args)
+	if dedupeMode == operations.DeduplicateInteractive {
+		dedupeMode = operations.DeduplicateList
+	}
+	var fses []fs.Fs
+	for _, arg := range args {
+		fses = append(fses, cmd.NewFsSrc([]string{arg}))
+	}
+	cmd.Run(false, false, command, func() error {
+		return operations.DeduplicateContent(context.Background(), fses, &operations.DedupeContentOpt{
+			Mode:     dedupeMode,
+			Action:   dedupeAction,
+			HashType: hashType,
+			Out:      os.Stdout,
+		})
+	})
+}
@@ -0,0 +1,368 @@
+// Package prune provides the prune command.
+package prune
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keepWithin  fs.Duration
+	keepDaily   int
+	keepWeekly  int
+	keepMonthly int
+	at          fs.Time
+	dest        string
+	restoreTo   string
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.FVarP(cmdFlags, &keepWithin, "keep-within", "", "Keep all snapshots made within this duration of now")
+	flags.IntVarP(cmdFlags, &keepDaily, "keep-daily", "", 0, "Keep the newest snapshot of each of this many days")
+	flags.IntVarP(cmdFlags, &keepWeekly, "keep-weekly", "", 0, "Keep the newest snapshot of each of this many weeks")
+	flags.IntVarP(cmdFlags, &keepMonthly, "keep-monthly", "", 0, "Keep the newest snapshot of each of this many months")
+	flags.FVarP(cmdFlags, &at, "at", "", "List the files as they were at this time instead of pruning")
+	flags.StringVarP(cmdFlags, &dest, "dest", "", "", "The sync destination the snapshots were made from, used with --at")
+	flags.StringVarP(cmdFlags, &restoreTo, "restore-to", "", "", "Restore the files as they were at --at to this path instead of listing them")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "prune remote:backup-dir [path]",
+	Short: `Remove old snapshots made with --backup-snapshot or restore from them.`,
+	Long: `
+When ` + "`--backup-dir`" + ` is used with ` + "`--backup-snapshot`" + ` each run of
+rclone moves the files it replaces or deletes into a new directory in
+the backup dir named after the time the run started, e.g.
+` + "`2023-07-01T020000Z`" + `. This command manages those snapshots.
+
+### Pruning
+
+By default ` + "`prune`" + ` removes the snapshots in remote:backup-dir
+which aren't kept by any of the retention flags. This is the
+grandfather-father-son scheme used by many backup programs.
+
+- ` + "`--keep-within 14d`" + ` keeps all the snapshots made in the last 14 days.
+- ` + "`--keep-daily 7`" + ` keeps the newest snapshot of each of the last 7 days which have snapshots.
+- ` + "`--keep-weekly 4`" + ` keeps the newest snapshot of each of the last 4 weeks which have snapshots.
+- ` + "`--keep-monthly 12`" + ` keeps the newest snapshot of each of the last 12 months which have snapshots.
+
+A snapshot is kept if any of the flags keep it. Days, weeks and
+months are measured in UTC and weeks are ISO 8601 weeks. At least one
+of the flags must be given. For example
+
+    rclone sync --backup-dir remote:backup --backup-snapshot /home remote:current
+    rclone prune remote:backup --keep-daily 7 --keep-weekly 4 --keep-monthly 12
+
+Directories in remote:backup-dir which aren't named like snapshots
+are left alone. Use ` + "`--dry-run`" + ` to see what would be removed.
+
+### Listing and restoring
+
+With ` + "`--at TIME`" + ` rclone instead lists the files under path as they
+were at TIME. TIME may be a date, e.g. ` + "`2023-07-01`" + ` or
+` + "`\"2023-07-01 12:00:00\"`" + `, or a duration in the past, e.g. ` + "`3d`" + `.
+
+A snapshot holds the versions of the files which were replaced or
+deleted by its run, so the version of a file at TIME is found in the
+first snapshot made after TIME. Files which haven't changed since TIME
+are only in the sync destination, so pass that with ` + "`--dest`" + ` to
+include them. Files in the destination modified after TIME are left
+out. This relies on the destination and backup dir keeping the
+modification times of the files.
+
+    rclone prune remote:backup --at 2023-07-01 --dest remote:current documents
+
+Add ` + "`--restore-to DIR`" + ` to copy the files to DIR instead of listing them.
+
+    rclone prune remote:backup --at 2023-07-01 --dest remote:current documents --restore-to /tmp/restore
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.64",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 2, command, args)
+		fbackup := cmd.NewFsSrc(args[:1])
+		dir := ""
+		if len(args) > 1 {
+			dir = strings.Trim(args[1], "/")
+		}
+		if !at.IsSet() {
+			if dir != "" || dest != "" || restoreTo != "" {
+				log.Fatalf("path, --dest and --restore-to can only be used with --at")
+			}
+			cmd.Run(true, false, command, func() error {
+				return Prune(context.Background(), fbackup, Retention{
+					Within:  time.Duration(keepWithin),
+					Daily:   keepDaily,
+					Weekly:  keepWeekly,
+					Monthly: keepMonthly,
+				})
+			})
+			return
+		}
+		var fdest, frestore fs.Fs
+		if dest != "" {
+			fdest = cmd.NewFsSrc([]string{dest})
+		}
+		if restoreTo != "" {
+			frestore = cmd.NewFsDir([]string{restoreTo})
+		}
+		cmd.Run(frestore != nil, false, command, func() error {
+			ctx := context.Background()
+			versions, err := VersionsAt(ctx, fbackup, fdest, dir, time.Time(at))
+			if err != nil {
+				return err
+			}
+			if frestore == nil {
+				return List(ctx, os.Stdout, versions)
+			}
+			return Restore(ctx, frestore, versions)
+		})
+	},
+}
+
+// Snapshot is a directory made by --backup-snapshot
+type Snapshot struct {
+	Name string    // name of the directory
+	Time time.Time // time the run which made it started
+}
+
+// ListSnapshots returns the snapshots in f sorted oldest first
+func ListSnapshots(ctx context.Context, f fs.Fs) (snapshots []Snapshot, err error) {
+	entries, err := f.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	entries.ForDir(func(dir fs.Directory) {
+		name := dir.Remote()
+		t, err := operations.ParseBackupSnapshotName(name)
+		if err != nil {
+			fs.Debugf(dir, "Ignoring directory which isn't a snapshot")
+			return
+		}
+		snapshots = append(snapshots, Snapshot{Name: name, Time: t})
+	})
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Retention describes which snapshots to keep
+type Retention struct {
+	Within  time.Duration // keep all snapshots newer than this
+	Daily   int           // keep the newest snapshot in this many days
+	Weekly  int           // keep the newest snapshot in this many weeks
+	Monthly int           // keep the newest snapshot in this many months
+}
+
+// IsSet returns true if any retention is set
+func (r Retention) IsSet() bool {
+	return r.Within > 0 || r.Daily > 0 || r.Weekly > 0 || r.Monthly > 0
+}
+
+// bucket is a grandfather-father-son retention period
+type bucket struct {
+	name  string                 // for logging
+	count int                    // number of snapshots left to keep
+	key   func(time.Time) string // the period the time is in
+	last  string                 // the period of the last snapshot kept
+}
+
+// Reasons returns the reasons each snapshot is kept indexed by
+// snapshot name. Snapshots which aren't kept aren't in the map.
+//
+// snapshots should be sorted oldest first as returned by ListSnapshots.
+func (r Retention) Reasons(snapshots []Snapshot, now time.Time) map[string][]string {
+	buckets := []*bucket{
+		{name: "daily", count: r.Daily, key: func(t time.Time) string {
+			return t.Format("2006-01-02")
+		}},
+		{name: "weekly", count: r.Weekly, key: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%04d-W%02d", year, week)
+		}},
+		{name: "monthly", count: r.Monthly, key: func(t time.Time) string {
+			return t.Format("2006-01")
+		}},
+	}
+	reasons := make(map[string][]string)
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		t := snapshot.Time.UTC()
+		if r.Within > 0 && now.Sub(t) <= r.Within {
+			reasons[snapshot.Name] = append(reasons[snapshot.Name], "within")
+		}
+		for _, b := range buckets {
+			if b.count <= 0 {
+				continue
+			}
+			if key := b.key(t); key != b.last {
+				b.last = key
+				b.count--
+				reasons[snapshot.Name] = append(reasons[snapshot.Name], b.name)
+			}
+		}
+	}
+	return reasons
+}
+
+// Prune removes the snapshots in f which r doesn't keep
+func Prune(ctx context.Context, f fs.Fs, r Retention) error {
+	if !r.IsSet() {
+		return errors.New("no retention policy - use --keep-within, --keep-daily, --keep-weekly or --keep-monthly")
+	}
+	snapshots, err := ListSnapshots(ctx, f)
+	if err != nil {
+		return err
+	}
+	reasons := r.Reasons(snapshots, time.Now())
+	var errCount int
+	var lastErr error
+	for _, snapshot := range snapshots {
+		if why := reasons[snapshot.Name]; len(why) > 0 {
+			fs.Infof(snapshot.Name, "Keeping snapshot (%s)", strings.Join(why, ", "))
+			continue
+		}
+		fs.Infof(snapshot.Name, "Removing snapshot")
+		err := operations.Purge(ctx, f, snapshot.Name)
+		if err != nil {
+			fs.Errorf(snapshot.Name, "Failed to remove snapshot: %v", err)
+			errCount++
+			lastErr = err
+		}
+	}
+	if errCount > 0 {
+		return fmt.Errorf("failed to remove %d snapshots: last error: %w", errCount, lastErr)
+	}
+	return nil
+}
+
+// Version is a file as it was at a point in time
+type Version struct {
+	Remote   string    // path of the file relative to the sync destination
+	Object   fs.Object // the object holding the version
+	Snapshot string    // the snapshot it is in or "" for the destination
+}
+
+// listObjects calls fn with each object under dir on f, ignoring
+// missing directories
+func listObjects(ctx context.Context, f fs.Fs, dir string, fn func(o fs.Object)) error {
+	err := walk.ListR(ctx, f, dir, false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(fn)
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil
+	}
+	return err
+}
+
+// VersionsAt returns the versions of the files under dir as they
+// were at time at from the snapshots in fbackup and the sync
+// destination fdest, which may be nil.
+//
+// The versions are sorted by Remote.
+func VersionsAt(ctx context.Context, fbackup, fdest fs.Fs, dir string, at time.Time) (versions []Version, err error) {
+	snapshots, err := ListSnapshots(ctx, fbackup)
+	if err != nil {
+		return nil, err
+	}
+	// The version at time at is in the first snapshot after it
+	found := make(map[string]*Version)
+	for _, snapshot := range snapshots {
+		if !snapshot.Time.After(at) {
+			continue
+		}
+		snapshot := snapshot
+		err = listObjects(ctx, fbackup, path.Join(snapshot.Name, dir), func(o fs.Object) {
+			remote := strings.TrimPrefix(o.Remote(), snapshot.Name+"/")
+			if _, ok := found[remote]; !ok {
+				found[remote] = &Version{Remote: remote, Object: o, Snapshot: snapshot.Name}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snapshot %q: %w", snapshot.Name, err)
+		}
+	}
+	// Files which haven't changed since are in the destination
+	if fdest != nil {
+		err = listObjects(ctx, fdest, dir, func(o fs.Object) {
+			if _, ok := found[o.Remote()]; !ok {
+				found[o.Remote()] = &Version{Remote: o.Remote(), Object: o}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list destination: %w", err)
+		}
+	}
+	for _, version := range found {
+		// Leave out files which were created or replaced after at
+		if version.Object.ModTime(ctx).After(at) {
+			fs.Debugf(version.Object, "Ignoring as modified after %v", at)
+			continue
+		}
+		versions = append(versions, *version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Remote < versions[j].Remote
+	})
+	return versions, nil
+}
+
+// List writes the versions to out
+func List(ctx context.Context, out io.Writer, versions []Version) error {
+	for _, version := range versions {
+		from := version.Snapshot
+		if from == "" {
+			from = "current"
+		}
+		_, err := fmt.Fprintf(out, "%12d %s %-18s %s\n", version.Object.Size(), version.Object.ModTime(ctx).Local().Format("2006-01-02 15:04:05"), from, version.Remote)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore copies the versions to frestore
+func Restore(ctx context.Context, frestore fs.Fs, versions []Version) error {
+	var errCount int
+	var lastErr error
+	for _, version := range versions {
+		dst, err := frestore.NewObject(ctx, version.Remote)
+		if err != nil {
+			dst = nil
+		}
+		if dst != nil && operations.Equal(ctx, version.Object, dst) {
+			fs.Debugf(dst, "Already restored")
+			continue
+		}
+		_, err = operations.Copy(ctx, frestore, dst, version.Remote, version.Object)
+		if err != nil {
+			errCount++
+			lastErr = err
+		}
+	}
+	if errCount > 0 {
+		return fmt.Errorf("failed to restore %d files: last error: %w", errCount, lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package prune
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+// makeSnapshots makes a snapshot for each time
+func makeSnapshots(times ...string) (snapshots []Snapshot) {
+	for _, s := range times {
+		t := fstest.Time(s)
+		snapshots = append(snapshots, Snapshot{Name: operations.BackupSnapshotName(t), Time: t})
+	}
+	return snapshots
+}
+
+func TestRetentionReasons(t *testing.T) {
+	snapshots := makeSnapshots(
+		"2023-05-20T10:00:00Z",
+		"2023-06-01T10:00:00Z",
+		"2023-06-25T10:00:00Z",
+		"2023-06-30T10:00:00Z",
+		"2023-07-01T10:00:00Z",
+		"2023-07-02T09:00:00Z",
+		"2023-07-02T10:00:00Z",
+		"2023-07-03T10:00:00Z",
+	)
+	now := fstest.Time("2023-07-03T12:00:00Z")
+
+	assert.False(t, Retention{}.IsSet())
+	assert.Equal(t, map[string][]string{}, Retention{}.Reasons(snapshots, now))
+
+	r := Retention{
+		Within:  36 * time.Hour,
+		Daily:   3,
+		Weekly:  2,
+		Monthly: 3,
+	}
+	assert.True(t, r.IsSet())
+	assert.Equal(t, map[string][]string{
+		"2023-07-03T100000Z": {"within", "daily", "weekly", "monthly"},
+		"2023-07-02T100000Z": {"within", "daily", "weekly"},
+		"2023-07-02T090000Z": {"within"},
+		"2023-07-01T100000Z": {"daily"},
+		"2023-06-30T100000Z": {"monthly"},
+		"2023-05-20T100000Z": {"monthly"},
+	}, r.Reasons(snapshots, now))
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	t1 := fstest.Time("2023-01-01T00:00:00Z")
+	old1 := r.WriteObject(ctx, "2023-06-01T100000Z/file", "old1", t1)
+	old2 := r.WriteObject(ctx, "2023-07-01T100000Z/dir/file", "old2", t1)
+	newest := r.WriteObject(ctx, "2023-07-02T100000Z/file", "newest", t1)
+	other := r.WriteObject(ctx, "not-a-snapshot/file", "other", t1)
+	r.CheckRemoteItems(t, old1, old2, newest, other)
+
+	err := Prune(ctx, r.Fremote, Retention{})
+	require.Error(t, err)
+
+	err = Prune(ctx, r.Fremote, Retention{Monthly: 1})
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, newest, other)
+}
+
+func TestVersionsAt(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+
+	// The backup dir is on the remote with a snapshot made on 1 Feb
+	// replacing a.txt and deleting b.txt
+	aV1 := r.WriteObject(ctx, "2023-02-01T000000Z/docs/a.txt", "a version 1", fstest.Time("2023-01-10T00:00:00Z"))
+	b := r.WriteObject(ctx, "2023-02-01T000000Z/docs/b.txt", "b", fstest.Time("2023-01-05T00:00:00Z"))
+	r.CheckRemoteItems(t, aV1, b)
+
+	// The destination is local
+	aV2 := r.WriteFile("docs/a.txt", "a version 2", fstest.Time("2023-01-20T00:00:00Z"))
+	c := r.WriteFile("docs/c.txt", "c", fstest.Time("2023-01-03T00:00:00Z"))
+	d := r.WriteFile("docs/d.txt", "d", fstest.Time("2023-03-01T00:00:00Z"))
+	e := r.WriteFile("e.txt", "e", fstest.Time("2023-01-03T00:00:00Z"))
+	r.CheckLocalItems(t, aV2, c, d, e)
+
+	list := func(fdest fs.Fs, dir string, at string) string {
+		versions, err := VersionsAt(ctx, r.Fremote, fdest, dir, fstest.Time(at))
+		require.NoError(t, err)
+		var out bytes.Buffer
+		for _, version := range versions {
+			out.WriteString(version.Remote + " " + version.Snapshot + "\n")
+		}
+		return out.String()
+	}
+
+	assert.Equal(t, "docs/a.txt 2023-02-01T000000Z\ndocs/b.txt 2023-02-01T000000Z\ndocs/c.txt \n", list(r.Flocal, "docs", "2023-01-15T00:00:00Z"))
+	assert.Equal(t, "docs/a.txt 2023-02-01T000000Z\ndocs/b.txt 2023-02-01T000000Z\n", list(nil, "docs", "2023-01-15T00:00:00Z"))
+	assert.Equal(t, "docs/a.txt \ndocs/c.txt \ndocs/d.txt \ne.txt \n", list(r.Flocal, "", "2023-04-01T00:00:00Z"))
+	assert.Equal(t, "docs/a.txt \ndocs/c.txt \n", list(r.Flocal, "docs", "2023-02-15T00:00:00Z"))
+	assert.Equal(t, "docs/c.txt \ne.txt \n", list(r.Flocal, "", "2023-01-04T00:00:00Z"))
+
+	// Restore docs as it was on 15 Jan
+	versions, err := VersionsAt(ctx, r.Fremote, r.Flocal, "docs", fstest.Time("2023-01-15T00:00:00Z"))
+	require.NoError(t, err)
+	frestore, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, Restore(ctx, frestore, versions))
+	aV1.Path = "docs/a.txt"
+	b.Path = "docs/b.txt"
+	fstest.CheckListingWithPrecision(t, frestore, []fstest.Item{aV1, b, c}, nil, fs.GetModifyWindow(ctx, frestore))
+}
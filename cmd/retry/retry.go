@@ -0,0 +1,57 @@
+// Package retry provides the retry command.
+package retry
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "retry report.json",
+	Short: `Retry the failed operations recorded by --error-report.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`
+Reads a report written with the |--error-report| flag and runs the
+operations which failed again, with the same source and destination.
+
+For example, after
+
+    rclone sync --error-report failed.json /path/to/src remote:dst
+
+has finished with errors, this will retry just the objects which
+failed
+
+    rclone retry failed.json
+
+Objects which were copied or moved are checked against the
+destination again in the usual way, so any which have been
+transferred in the meantime will be skipped. Objects which failed to
+delete are deleted if they still exist, or moved to |--backup-dir| if
+that is set.
+
+Filters from the command line are not used as the report lists the
+objects to retry. Use |--error-report| again with this command to
+record anything which still fails.
+
+**Note**: Use the |--dry-run| or the |--interactive|/|-i| flag to test without copying anything.
+`, "|", "`"),
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		cmd.Run(true, true, command, func() error {
+			entries, err := operations.ReadErrorReport(args[0])
+			if err != nil {
+				return err
+			}
+			return sync.RetryErrorReport(context.Background(), entries)
+		})
+	},
+}
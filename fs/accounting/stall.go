@@ -0,0 +1,180 @@
+package accounting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+)
+
+// ErrorStalled is returned when a transfer is aborted because it
+// stalled as set by --stall-timeout or --min-speed
+var ErrorStalled = errors.New("transfer stalled as set by --stall-timeout or --min-speed")
+
+// ErrorStalledRetry is ErrorStalled marked so the transfer will be
+// retried
+var ErrorStalledRetry = fserrors.RetryError(ErrorStalled)
+
+// stallCheckInterval is how often transfers are checked for stalls
+var stallCheckInterval = time.Second
+
+// StallRecoverer is an optional interface for the reader passed to
+// Transfer.Account.
+//
+// If the transfer stalls then RecoverStall is called to give the
+// reader the chance to recover without aborting the transfer, for
+// example by reopening the source at the current offset. It should
+// return true if it has done something to unblock the transfer or
+// false if the transfer should be aborted.
+type StallRecoverer interface {
+	RecoverStall() bool
+}
+
+// stallWindow returns the period over which to look for stalls or 0
+// if stall detection is off
+func stallWindow(ci *fs.ConfigInfo) time.Duration {
+	if ci.StallTimeout > 0 {
+		return ci.StallTimeout
+	}
+	if ci.MinSpeed > 0 {
+		return time.Minute
+	}
+	return 0
+}
+
+// stallSample is the number of bytes transferred at a given time
+type stallSample struct {
+	when  time.Time
+	bytes int64
+}
+
+// stallDetector looks for stalls in a sliding window of samples
+type stallDetector struct {
+	window   time.Duration // period to measure over
+	minSpeed float64       // minimum speed in bytes/s or 0 for none
+	samples  []stallSample
+}
+
+// reset clears the history
+func (d *stallDetector) reset() {
+	d.samples = d.samples[:0]
+}
+
+// stalled adds the bytes transferred so far at now to the history
+// and returns true if the transfer has stalled.
+//
+// A transfer has stalled if it has transferred no bytes, or fewer
+// than minSpeed allows, over the whole window.
+func (d *stallDetector) stalled(now time.Time, bytes int64) bool {
+	if len(d.samples) > 0 && bytes < d.samples[len(d.samples)-1].bytes {
+		// the counters were reset so start again
+		d.reset()
+	}
+	d.samples = append(d.samples, stallSample{when: now, bytes: bytes})
+	// Discard samples older than the window, keeping the last one
+	// at or before the start of the window to measure from
+	start := now.Add(-d.window)
+	i := 0
+	for i+1 < len(d.samples) && !d.samples[i+1].when.After(start) {
+		i++
+	}
+	d.samples = d.samples[i:]
+	first := d.samples[0]
+	elapsed := now.Sub(first.when)
+	if elapsed < d.window {
+		// not enough history yet
+		return false
+	}
+	transferred := bytes - first.bytes
+	if transferred <= 0 {
+		return true
+	}
+	return d.minSpeed > 0 && float64(transferred)/elapsed.Seconds() < d.minSpeed
+}
+
+// WatchStall returns a context for an attempt at the transfer which
+// is cancelled if the transfer stalls as set by --stall-timeout and
+// --min-speed, and a function which must be called to stop watching
+// when the attempt has finished.
+//
+// If the reader passed to Account implements StallRecoverer then it
+// is given the chance to recover from the stall first.
+//
+// Use Stalled to find out whether the attempt was cancelled because
+// it stalled.
+func (tr *Transfer) WatchStall(ctx context.Context) (context.Context, func()) {
+	tr.mu.Lock()
+	tr.stalled = false
+	tr.mu.Unlock()
+	ci := fs.GetConfig(ctx)
+	window := stallWindow(ci)
+	if window <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	d := &stallDetector{
+		window:   window,
+		minSpeed: float64(ci.MinSpeed),
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tr.stallLoop(ctx, cancel, d, done)
+	}()
+	return ctx, func() {
+		close(done)
+		wg.Wait()
+		cancel()
+	}
+}
+
+// stallLoop checks the transfer for stalls until done is closed
+func (tr *Transfer) stallLoop(ctx context.Context, cancel func(), d *stallDetector, done <-chan struct{}) {
+	tick := time.NewTicker(stallCheckInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			tr.mu.RLock()
+			acc, recoverer := tr.acc, tr.recoverer
+			tr.mu.RUnlock()
+			if acc == nil {
+				// not transferring yet
+				d.reset()
+				continue
+			}
+			bytes, _ := acc.progress()
+			if !d.stalled(now, bytes) {
+				continue
+			}
+			if recoverer != nil && recoverer.RecoverStall() {
+				fs.Infof(tr.remote, "Transfer stalled after %d bytes - reopening source", bytes)
+				d.reset()
+				continue
+			}
+			fs.Errorf(tr.remote, "Transfer stalled after %d bytes - aborting", bytes)
+			tr.mu.Lock()
+			tr.stalled = true
+			tr.mu.Unlock()
+			cancel()
+			return
+		}
+	}
+}
+
+// Stalled returns true if the last attempt at the transfer was
+// cancelled by WatchStall because it stalled
+func (tr *Transfer) Stalled() bool {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	return tr.stalled
+}
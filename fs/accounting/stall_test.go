@@ -0,0 +1,135 @@
+package accounting
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStallWindow(t *testing.T) {
+	ci := &fs.ConfigInfo{}
+	assert.Equal(t, time.Duration(0), stallWindow(ci))
+	ci.MinSpeed = 1024
+	assert.Equal(t, time.Minute, stallWindow(ci))
+	ci.StallTimeout = 10 * time.Second
+	assert.Equal(t, 10*time.Second, stallWindow(ci))
+}
+
+func TestStallDetector(t *testing.T) {
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return t0.Add(time.Duration(seconds) * time.Second)
+	}
+
+	t.Run("NoProgress", func(t *testing.T) {
+		d := &stallDetector{window: 3 * time.Second}
+		assert.False(t, d.stalled(at(0), 100))
+		assert.False(t, d.stalled(at(1), 200))
+		assert.False(t, d.stalled(at(2), 200))
+		assert.False(t, d.stalled(at(3), 200))
+		// no progress since at(1)
+		assert.True(t, d.stalled(at(4), 200))
+	})
+
+	t.Run("Progress", func(t *testing.T) {
+		d := &stallDetector{window: 3 * time.Second}
+		for i := 0; i < 10; i++ {
+			assert.False(t, d.stalled(at(i), int64(i)))
+		}
+		assert.LessOrEqual(t, len(d.samples), 4)
+	})
+
+	t.Run("MinSpeed", func(t *testing.T) {
+		d := &stallDetector{window: 2 * time.Second, minSpeed: 100}
+		assert.False(t, d.stalled(at(0), 0))
+		assert.False(t, d.stalled(at(1), 150))
+		assert.False(t, d.stalled(at(2), 300))
+		assert.False(t, d.stalled(at(3), 350))
+		assert.True(t, d.stalled(at(4), 400))
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		d := &stallDetector{window: 2 * time.Second}
+		assert.False(t, d.stalled(at(0), 100))
+		assert.False(t, d.stalled(at(1), 100))
+		// counters going backwards starts again
+		assert.False(t, d.stalled(at(2), 0))
+		assert.False(t, d.stalled(at(3), 0))
+		assert.True(t, d.stalled(at(4), 0))
+	})
+}
+
+// stallReader never returns any data until it is closed
+type stallReader struct {
+	closed    chan struct{}
+	recovered int
+	recover   bool
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	<-r.closed
+	return 0, io.EOF
+}
+
+func (r *stallReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func (r *stallReader) RecoverStall() bool {
+	r.recovered++
+	return r.recover
+}
+
+func TestWatchStall(t *testing.T) {
+	oldInterval := stallCheckInterval
+	stallCheckInterval = 10 * time.Millisecond
+	defer func() {
+		stallCheckInterval = oldInterval
+	}()
+	ctx, ci := fs.AddConfig(context.Background())
+
+	t.Run("Off", func(t *testing.T) {
+		tr := newTransferRemoteSize(NewStats(ctx), "potato", 100, false, "")
+		attemptCtx, stop := tr.WatchStall(ctx)
+		assert.Equal(t, ctx, attemptCtx)
+		stop()
+		assert.False(t, tr.Stalled())
+	})
+
+	ci.StallTimeout = 50 * time.Millisecond
+
+	t.Run("Stalled", func(t *testing.T) {
+		tr := newTransferRemoteSize(NewStats(ctx), "potato", 100, false, "")
+		in := &stallReader{closed: make(chan struct{})}
+		attemptCtx, stop := tr.WatchStall(ctx)
+		tr.Account(ctx, in)
+		select {
+		case <-attemptCtx.Done():
+		case <-time.After(10 * time.Second):
+			t.Fatal("transfer wasn't aborted")
+		}
+		stop()
+		assert.True(t, tr.Stalled())
+		assert.Equal(t, 1, in.recovered)
+		tr.Done(ctx, nil)
+	})
+
+	t.Run("Recovered", func(t *testing.T) {
+		tr := newTransferRemoteSize(NewStats(ctx), "potato", 100, false, "")
+		in := &stallReader{closed: make(chan struct{}), recover: true}
+		attemptCtx, stop := tr.WatchStall(ctx)
+		tr.Account(ctx, in)
+		time.Sleep(250 * time.Millisecond)
+		require.NoError(t, attemptCtx.Err())
+		stop()
+		assert.False(t, tr.Stalled())
+		assert.Greater(t, in.recovered, 0)
+		tr.Done(ctx, nil)
+	})
+}
@@ -45,6 +45,8 @@ type StatsInfo struct {
 	transferring      *transferMap
 	transferQueue     int
 	transferQueueSize int64
+	largeQueue        int   // transfers queued in the large file lane
+	largeQueueSize    int64 // size of transfers queued in the large file lane
 	renames           int64
 	renameQueue       int
 	renameQueueSize   int64
@@ -109,6 +111,12 @@ func (s *StatsInfo) RemoteStats() (out rc.Params, err error) {
 	out["deletes"] = s.deletes
 	out["deletedDirs"] = s.deletedDirs
 	out["renames"] = s.renames
+	if s.ci.LargeFileCutoff >= 0 {
+		out["transferQueue"] = s.transferQueue
+		out["transferQueueSize"] = s.transferQueueSize
+		out["largeTransferQueue"] = s.largeQueue
+		out["largeTransferQueueSize"] = s.largeQueueSize
+	}
 	out["elapsedTime"] = time.Since(s.startTime).Seconds()
 	eta, etaOK := eta(s.bytes, ts.totalBytes, ts.speed)
 	if etaOK {
@@ -300,10 +308,10 @@ func (s *StatsInfo) calculateTransferStats() (ts transferStats) {
 	defer s.mu.RUnlock()
 
 	ts.totalChecks = int64(s.checkQueue) + s.checks + int64(checking)
-	ts.totalTransfers = int64(s.transferQueue) + s.transfers + int64(transferring)
+	ts.totalTransfers = int64(s.transferQueue+s.largeQueue) + s.transfers + int64(transferring)
 	// note that s.bytes already includes transferringBytesDone so
 	// we take it off here to avoid double counting
-	ts.totalBytes = s.transferQueueSize + s.bytes + transferringBytesTotal - transferringBytesDone
+	ts.totalBytes = s.transferQueueSize + s.largeQueueSize + s.bytes + transferringBytesTotal - transferringBytesDone
 	ts.speed = s.average.speed
 
 	return ts
@@ -387,7 +395,7 @@ func (s *StatsInfo) String() string {
 		_, _ = fmt.Fprintf(buf, "\nTransferred:   	")
 	} else {
 		xfrchk := []string{}
-		if ts.totalTransfers > 0 && s.transferQueue > 0 {
+		if ts.totalTransfers > 0 && s.transferQueue+s.largeQueue > 0 {
 			xfrchk = append(xfrchk, fmt.Sprintf("xfr#%d/%d", s.transfers, ts.totalTransfers))
 		}
 		if ts.totalChecks > 0 && s.checkQueue > 0 {
@@ -449,6 +457,11 @@ func (s *StatsInfo) String() string {
 			_, _ = fmt.Fprintf(buf, "Transferred:   %10d / %d, %s\n",
 				s.transfers, ts.totalTransfers, percent(s.transfers, ts.totalTransfers))
 		}
+		if s.ci.LargeFileCutoff >= 0 && (s.transferQueue != 0 || s.largeQueue != 0) {
+			_, _ = fmt.Fprintf(buf, "Queued:        %10d small (%s), %d large (%s)\n",
+				s.transferQueue, fs.SizeSuffix(s.transferQueueSize).ByteUnit(),
+				s.largeQueue, fs.SizeSuffix(s.largeQueueSize).ByteUnit())
+		}
 		_, _ = fmt.Fprintf(buf, "Elapsed time:  %10ss\n", strings.TrimRight(fs.Duration(elapsedTime.Truncate(time.Minute)).ReadableString(), "0s")+fmt.Sprintf("%.1f", elapsedTimeSecondsOnly.Seconds()))
 	}
 
@@ -780,6 +793,15 @@ func (s *StatsInfo) SetTransferQueue(n int, size int64) {
 	s.mu.Unlock()
 }
 
+// SetLargeTransferQueue sets the number of transfers queued in the
+// large file lane
+func (s *StatsInfo) SetLargeTransferQueue(n int, size int64) {
+	s.mu.Lock()
+	s.largeQueue = n
+	s.largeQueueSize = size
+	s.mu.Unlock()
+}
+
 // SetRenameQueue sets the number of queued transfers
 func (s *StatsInfo) SetRenameQueue(n int, size int64) {
 	s.mu.Lock()
@@ -94,6 +94,8 @@ Returns the following values:
 	"errors": number of errors,
 	"eta": estimated time in seconds until the group completes,
 	"fatalError": boolean whether there has been at least one fatal error,
+	"largeTransferQueue": number of transfers queued in the large file lane,
+	"largeTransferQueueSize": total size of transfers queued in the large file lane,
 	"lastError": last error string,
 	"renames" : number of files renamed,
 	"retryError": boolean showing whether there has been at least one non-NoRetryError,
@@ -101,6 +103,8 @@ Returns the following values:
 	"totalBytes": total number of bytes in the group,
 	"totalChecks": total number of checks in the group,
 	"totalTransfers": total number of transfers in the group,
+	"transferQueue": number of transfers queued in the small file lane,
+	"transferQueueSize": total size of transfers queued in the small file lane,
 	"transferTime" : total time spent on running jobs,
 	"transfers": number of transferred files,
 	"transferring": an array of currently active file transfers:
@@ -120,6 +124,8 @@ Returns the following values:
 }
 ` + "```" + `
 Values for "transferring", "checking" and "lastError" are only assigned if data is available.
+Values for "transferQueue", "transferQueueSize", "largeTransferQueue" and
+"largeTransferQueueSize" are only assigned if --large-file-cutoff is set.
 The value for "eta" is null if an eta cannot be determined.
 `,
 	})
@@ -379,6 +385,8 @@ func (sg *statsGroups) sum(ctx context.Context) *StatsInfo {
 			sum.transfers += stats.transfers
 			sum.transferring.merge(stats.transferring)
 			sum.transferQueueSize += stats.transferQueueSize
+			sum.largeQueue += stats.largeQueue
+			sum.largeQueueSize += stats.largeQueueSize
 			sum.renames += stats.renames
 			sum.renameQueue += stats.renameQueue
 			sum.renameQueueSize += stats.renameQueueSize
@@ -443,3 +443,28 @@ func TestPruneTransfers(t *testing.T) {
 		})
 	}
 }
+
+func TestStatsLargeTransferQueue(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	s := NewStats(ctx)
+	s.SetTransferQueue(3, 300)
+	s.SetLargeTransferQueue(2, 2000)
+
+	ts := s.calculateTransferStats()
+	assert.Equal(t, int64(5), ts.totalTransfers)
+	assert.Equal(t, int64(2300), ts.totalBytes)
+
+	// Lanes only shown if --large-file-cutoff is set
+	assert.NotContains(t, s.String(), "Queued:")
+	out, err := s.RemoteStats()
+	require.NoError(t, err)
+	assert.NotContains(t, out, "largeTransferQueue")
+
+	ci.LargeFileCutoff = 1000
+	assert.Contains(t, s.String(), "Queued:                 3 small (300 B), 2 large (1.953 KiB)")
+	out, err = s.RemoteStats()
+	require.NoError(t, err)
+	assert.Equal(t, 3, out["transferQueue"])
+	assert.Equal(t, 2, out["largeTransferQueue"])
+	assert.Equal(t, int64(2000), out["largeTransferQueueSize"])
+}
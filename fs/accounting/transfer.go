@@ -59,6 +59,8 @@ type Transfer struct {
 	// StatsInfo calls back into Transfer.
 	mu          sync.RWMutex
 	acc         *Account
+	recoverer   StallRecoverer // reader passed to Account if it can recover from stalls
+	stalled     bool           // set if the last attempt was cancelled by WatchStall
 	err         error
 	completedAt time.Time
 }
@@ -127,10 +129,11 @@ func (tr *Transfer) Done(ctx context.Context, err error) {
 
 // Reset allows to switch the Account to another transfer method.
 func (tr *Transfer) Reset(ctx context.Context) {
-	tr.mu.RLock()
+	tr.mu.Lock()
 	acc := tr.acc
 	tr.acc = nil
-	tr.mu.RUnlock()
+	tr.recoverer = nil
+	tr.mu.Unlock()
 	ci := fs.GetConfig(ctx)
 
 	if acc != nil {
@@ -149,6 +152,7 @@ func (tr *Transfer) Account(ctx context.Context, in io.ReadCloser) *Account {
 	} else {
 		tr.acc.UpdateReader(ctx, in)
 	}
+	tr.recoverer, _ = in.(StallRecoverer)
 	tr.mu.Unlock()
 	return tr.acc
 }
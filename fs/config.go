@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/rclone/rclone/fs/hash"
 )
 
 // Global
@@ -66,6 +68,8 @@ type ConfigInfo struct {
 	Transfers                  int
 	ConnectTimeout             time.Duration // Connect timeout
 	Timeout                    time.Duration // Data channel timeout
+	StallTimeout               time.Duration // Abort transfers which make no progress for this long
+	MinSpeed                   SizeSuffix    // Abort transfers slower than this over StallTimeout
 	ExpectContinueTimeout      time.Duration
 	Dump                       DumpFlags
 	InsecureSkipVerify         bool // Skip server certificate verification
@@ -89,7 +93,9 @@ type ConfigInfo struct {
 	DataRateUnit               string
 	CompareDest                []string
 	CopyDest                   []string
+	LinkDest                   []string
 	BackupDir                  string
+	BackupSnapshot             bool
 	Suffix                     string
 	SuffixKeepExtension        bool
 	UseListR                   bool
@@ -118,6 +124,7 @@ type ConfigInfo struct {
 	StatsOneLineDate           bool   // If we want a date prefix at all
 	StatsOneLineDateFormat     string // If we want to customize the prefix
 	ErrorOnNoTransfer          bool   // Set appropriate exit code if no files transferred
+	ErrorReport                string // File to write a JSON report of failed objects to
 	Progress                   bool
 	ProgressTerminalTitle      bool
 	Cookie                     bool
@@ -127,12 +134,17 @@ type ConfigInfo struct {
 	ClientKey                  string   // Client Side Key
 	MultiThreadCutoff          SizeSuffix
 	MultiThreadStreams         int
-	MultiThreadSet             bool   // whether MultiThreadStreams was set (set in fs/config/configflags)
-	OrderBy                    string // instructions on how to order the transfer
+	MultiThreadSet             bool       // whether MultiThreadStreams was set (set in fs/config/configflags)
+	OrderBy                    string     // instructions on how to order the transfer
+	LargeFileCutoff            SizeSuffix // files this size or larger are transferred in the large file lane
+	LargeTransfers             int        // number of transfers to run in parallel in the large file lane
 	UploadHeaders              []*HTTPOption
 	DownloadHeaders            []*HTTPOption
 	Headers                    []*HTTPOption
-	MetadataSet                Metadata // extra metadata to write when uploading
+	MetadataSet                Metadata     // extra metadata to write when uploading
+	MetadataMapper             SpaceSepList // program to run to translate metadata when uploading
+	StoreHash                  hash.Type    // hash to store on destinations which don't support it
+	NameTransform              []string     // transformations to apply to destination names
 	RefreshTimes               bool
 	NoConsole                  bool
 	TrafficClass               uint8
@@ -184,6 +196,8 @@ func NewConfig() *ConfigInfo {
 	//	c.StatsOneLineDateFormat = "2006/01/02 15:04:05 - "
 	c.MultiThreadCutoff = SizeSuffix(250 * 1024 * 1024)
 	c.MultiThreadStreams = 4
+	c.LargeFileCutoff = -1
+	c.LargeTransfers = 2
 
 	c.TrackRenamesStrategy = "hash"
 	c.FsCacheExpireDuration = 300 * time.Second
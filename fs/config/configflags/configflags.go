@@ -15,6 +15,7 @@ import (
 	"github.com/rclone/rclone/fs/config/flags"
 	fsLog "github.com/rclone/rclone/fs/log"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/transform"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 )
@@ -61,6 +62,8 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &ci.Interactive, "interactive", "i", ci.Interactive, "Enable interactive mode")
 	flags.DurationVarP(flagSet, &ci.ConnectTimeout, "contimeout", "", ci.ConnectTimeout, "Connect timeout")
 	flags.DurationVarP(flagSet, &ci.Timeout, "timeout", "", ci.Timeout, "IO idle timeout")
+	flags.DurationVarP(flagSet, &ci.StallTimeout, "stall-timeout", "", ci.StallTimeout, "Abort and retry transfers which make no progress for this long (0 to disable)")
+	flags.FVarP(flagSet, &ci.MinSpeed, "min-speed", "", "Abort and retry transfers slower than this over --stall-timeout, or 1m if that isn't set (0 to disable)")
 	flags.DurationVarP(flagSet, &ci.ExpectContinueTimeout, "expect-continue-timeout", "", ci.ExpectContinueTimeout, "Timeout when using expect / 100-continue in HTTP")
 	flags.BoolVarP(flagSet, &dumpHeaders, "dump-headers", "", false, "Dump HTTP headers - may contain sensitive info")
 	flags.BoolVarP(flagSet, &dumpBodies, "dump-bodies", "", false, "Dump HTTP headers and bodies - may contain sensitive info")
@@ -89,7 +92,9 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &ci.NoUpdateModTime, "no-update-modtime", "", ci.NoUpdateModTime, "Don't update destination mod-time if files identical")
 	flags.StringArrayVarP(flagSet, &ci.CompareDest, "compare-dest", "", nil, "Include additional comma separated server-side paths during comparison")
 	flags.StringArrayVarP(flagSet, &ci.CopyDest, "copy-dest", "", nil, "Implies --compare-dest but also copies files from paths into destination")
+	flags.StringArrayVarP(flagSet, &ci.LinkDest, "link-dest", "", nil, "Implies --compare-dest but also hard links files from paths into destination")
 	flags.StringVarP(flagSet, &ci.BackupDir, "backup-dir", "", ci.BackupDir, "Make backups into hierarchy based in DIR")
+	flags.BoolVarP(flagSet, &ci.BackupSnapshot, "backup-snapshot", "", ci.BackupSnapshot, "Make the backups from each run in a new timestamped directory in --backup-dir")
 	flags.StringVarP(flagSet, &ci.Suffix, "suffix", "", ci.Suffix, "Suffix to add to changed files")
 	flags.BoolVarP(flagSet, &ci.SuffixKeepExtension, "suffix-keep-extension", "", ci.SuffixKeepExtension, "Preserve the extension when using --suffix")
 	flags.BoolVarP(flagSet, &ci.UseListR, "fast-list", "", ci.UseListR, "Use recursive list if available; uses more memory but fewer transactions")
@@ -117,6 +122,7 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &ci.StatsOneLineDate, "stats-one-line-date", "", ci.StatsOneLineDate, "Enable --stats-one-line and add current date/time prefix")
 	flags.StringVarP(flagSet, &ci.StatsOneLineDateFormat, "stats-one-line-date-format", "", ci.StatsOneLineDateFormat, "Enable --stats-one-line-date and use custom formatted date: Enclose date string in double quotes (\"), see https://golang.org/pkg/time/#Time.Format")
 	flags.BoolVarP(flagSet, &ci.ErrorOnNoTransfer, "error-on-no-transfer", "", ci.ErrorOnNoTransfer, "Sets exit code 9 if no files are transferred, useful in scripts")
+	flags.StringVarP(flagSet, &ci.ErrorReport, "error-report", "", ci.ErrorReport, "Write a JSON report of objects which failed to this file")
 	flags.BoolVarP(flagSet, &ci.Progress, "progress", "P", ci.Progress, "Show progress during transfer")
 	flags.BoolVarP(flagSet, &ci.ProgressTerminalTitle, "progress-terminal-title", "", ci.ProgressTerminalTitle, "Show progress on the terminal title (requires -P/--progress)")
 	flags.BoolVarP(flagSet, &ci.Cookie, "use-cookies", "", ci.Cookie, "Enable session cookiejar")
@@ -129,6 +135,8 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.FVarP(flagSet, &ci.MultiThreadWriteBufferSize, "multi-thread-write-buffer-size", "", "In memory buffer size for writing when in multi-thread mode")
 	flags.BoolVarP(flagSet, &ci.UseJSONLog, "use-json-log", "", ci.UseJSONLog, "Use json log format")
 	flags.StringVarP(flagSet, &ci.OrderBy, "order-by", "", ci.OrderBy, "Instructions on how to order the transfers, e.g. 'size,descending'")
+	flags.FVarP(flagSet, &ci.LargeFileCutoff, "large-file-cutoff", "", "Transfer files this size or larger in a separate lane with --large-transfers")
+	flags.IntVarP(flagSet, &ci.LargeTransfers, "large-transfers", "", ci.LargeTransfers, "Number of large file transfers to run in parallel if --large-file-cutoff is set")
 	flags.StringArrayVarP(flagSet, &uploadHeaders, "header-upload", "", nil, "Set HTTP header for upload transactions")
 	flags.StringArrayVarP(flagSet, &downloadHeaders, "header-download", "", nil, "Set HTTP header for download transactions")
 	flags.StringArrayVarP(flagSet, &headers, "header", "", nil, "Set HTTP header for all transactions")
@@ -143,6 +151,9 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.DurationVarP(flagSet, &ci.KvLockTime, "kv-lock-time", "", ci.KvLockTime, "Maximum time to keep key-value database locked by process")
 	flags.BoolVarP(flagSet, &ci.DisableHTTPKeepAlives, "disable-http-keep-alives", "", ci.DisableHTTPKeepAlives, "Disable HTTP keep-alives and use each connection once.")
 	flags.BoolVarP(flagSet, &ci.Metadata, "metadata", "M", ci.Metadata, "If set, preserve metadata when copying objects")
+	flags.FVarP(flagSet, &ci.MetadataMapper, "metadata-mapper", "", "Program to run to transform metadata before upload")
+	flags.FVarP(flagSet, &ci.StoreHash, "store-hash", "", "Store this hash of the source on destinations which don't support it")
+	flags.StringArrayVarP(flagSet, &ci.NameTransform, "name-transform", "", nil, "Transform names of files and directories on the destination, e.g. all,lowercase")
 	flags.BoolVarP(flagSet, &ci.ServerSideAcrossConfigs, "server-side-across-configs", "", ci.ServerSideAcrossConfigs, "Allow server-side operations (e.g. copy) to work across different configs")
 	flags.FVarP(flagSet, &ci.TerminalColorMode, "color", "", "When to show colors (and other ANSI codes) AUTO|NEVER|ALWAYS")
 	flags.FVarP(flagSet, &ci.DefaultTime, "default-time", "", "Time to show if modtime is unknown for files and directories")
@@ -244,6 +255,14 @@ func SetFlags(ci *fs.ConfigInfo) {
 		log.Fatalf(`Can't use --compare-dest with --copy-dest.`)
 	}
 
+	if len(ci.LinkDest) > 0 && (len(ci.CompareDest) > 0 || len(ci.CopyDest) > 0) {
+		log.Fatalf(`Can't use --link-dest with --compare-dest or --copy-dest.`)
+	}
+
+	if ci.BackupSnapshot && ci.BackupDir == "" {
+		log.Fatalf(`Can't use --backup-snapshot without --backup-dir.`)
+	}
+
 	switch {
 	case len(ci.StatsOneLineDateFormat) > 0:
 		ci.StatsOneLineDate = true
@@ -294,6 +313,11 @@ func SetFlags(ci *fs.ConfigInfo) {
 		}
 		fs.Debugf(nil, "MetadataUpload %v", ci.MetadataSet)
 	}
+	if len(ci.NameTransform) != 0 {
+		if _, err := transform.New(ci.NameTransform); err != nil {
+			log.Fatalf("--name-transform: %v", err)
+		}
+	}
 	if len(dscp) != 0 {
 		if value, ok := parseDSCP(dscp); ok {
 			ci.TrafficClass = value << 2
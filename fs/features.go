@@ -8,6 +8,8 @@ import (
 	"reflect"
 	"strings"
 	"time"
+
+	"github.com/rclone/rclone/lib/ranges"
 )
 
 // Features describe the optional features of the Fs
@@ -53,6 +55,26 @@ type Features struct {
 	// If it isn't possible then return fs.ErrorCantCopy
 	Copy func(ctx context.Context, src Object, remote string) (Object, error)
 
+	// HardLink makes a hard link to src at remote on this
+	// remote, replacing any existing object there.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantHardLink
+	HardLink func(ctx context.Context, src Object, remote string) (Object, error)
+
+	// Shortcut makes a server-side shortcut or link to src at
+	// remote on this remote, replacing any existing object there.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantShortcut
+	Shortcut func(ctx context.Context, src Object, remote string) (Object, error)
+
 	// Move src to this remote using server-side move operations.
 	//
 	// This is stored with the remote path given
@@ -150,6 +172,25 @@ type Features struct {
 	// It truncates any existing object
 	OpenWriterAt func(ctx context.Context, remote string, size int64) (WriterAtCloser, error)
 
+	// DirSetModTime sets the modification time of the directory dir
+	//
+	// This should return ErrorDirNotFound if the directory isn't
+	// found.
+	DirSetModTime func(ctx context.Context, dir string, modTime time.Time) error
+
+	// DirMetadata returns the metadata of the directory dir
+	//
+	// This should return ErrorDirNotFound if the directory isn't
+	// found.
+	DirMetadata func(ctx context.Context, dir string) (Metadata, error)
+
+	// DirSetMetadata sets metadata on the directory dir
+	//
+	// Only the keys in metadata are set - any others are left
+	// alone. This should return ErrorDirNotFound if the directory
+	// isn't found.
+	DirSetMetadata func(ctx context.Context, dir string, metadata Metadata) error
+
 	// UserInfo returns info about the connected user
 	UserInfo func(ctx context.Context) (map[string]string, error)
 
@@ -257,6 +298,12 @@ func (ft *Features) Fill(ctx context.Context, f Fs) *Features {
 	if do, ok := f.(Copier); ok {
 		ft.Copy = do.Copy
 	}
+	if do, ok := f.(HardLinker); ok {
+		ft.HardLink = do.HardLink
+	}
+	if do, ok := f.(Shortcutter); ok {
+		ft.Shortcut = do.Shortcut
+	}
 	if do, ok := f.(Mover); ok {
 		ft.Move = do.Move
 	}
@@ -301,6 +348,15 @@ func (ft *Features) Fill(ctx context.Context, f Fs) *Features {
 	if do, ok := f.(OpenWriterAter); ok {
 		ft.OpenWriterAt = do.OpenWriterAt
 	}
+	if do, ok := f.(DirSetModTimer); ok {
+		ft.DirSetModTime = do.DirSetModTime
+	}
+	if do, ok := f.(DirMetadataer); ok {
+		ft.DirMetadata = do.DirMetadata
+	}
+	if do, ok := f.(DirSetMetadataer); ok {
+		ft.DirSetMetadata = do.DirSetMetadata
+	}
 	if do, ok := f.(UserInfoer); ok {
 		ft.UserInfo = do.UserInfo
 	}
@@ -351,6 +407,12 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	if mask.Copy == nil {
 		ft.Copy = nil
 	}
+	if mask.HardLink == nil {
+		ft.HardLink = nil
+	}
+	if mask.Shortcut == nil {
+		ft.Shortcut = nil
+	}
 	if mask.Move == nil {
 		ft.Move = nil
 	}
@@ -393,6 +455,15 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	if mask.OpenWriterAt == nil {
 		ft.OpenWriterAt = nil
 	}
+	if mask.DirSetModTime == nil {
+		ft.DirSetModTime = nil
+	}
+	if mask.DirMetadata == nil {
+		ft.DirMetadata = nil
+	}
+	if mask.DirSetMetadata == nil {
+		ft.DirSetMetadata = nil
+	}
 	if mask.UserInfo == nil {
 		ft.UserInfo = nil
 	}
@@ -455,6 +526,32 @@ type Copier interface {
 	Copy(ctx context.Context, src Object, remote string) (Object, error)
 }
 
+// HardLinker is an optional interface for Fs
+type HardLinker interface {
+	// HardLink makes a hard link to src at remote on this
+	// remote, replacing any existing object there.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantHardLink
+	HardLink(ctx context.Context, src Object, remote string) (Object, error)
+}
+
+// Shortcutter is an optional interface for Fs
+type Shortcutter interface {
+	// Shortcut makes a server-side shortcut or link to src at
+	// remote on this remote, replacing any existing object there.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantShortcut
+	Shortcut(ctx context.Context, src Object, remote string) (Object, error)
+}
+
 // Mover is an optional interface for Fs
 type Mover interface {
 	// Move src to this remote using server-side move operations.
@@ -623,6 +720,39 @@ type OpenWriterAter interface {
 	OpenWriterAt(ctx context.Context, remote string, size int64) (WriterAtCloser, error)
 }
 
+// HoleWriterAt is an optional interface for the WriterAtCloser
+// returned by OpenWriterAt
+type HoleWriterAt interface {
+	// SetHoles is called before anything is written with the ranges
+	// of the source which hold no data so they can be left as holes
+	SetHoles(holes []ranges.Range)
+}
+
+// HoleFinder is an optional interface for Object
+type HoleFinder interface {
+	// Holes returns the ranges of the object which hold no data in
+	// order, or nil if there are none or they can't be found
+	Holes(ctx context.Context) []ranges.Range
+}
+
+// DirSetModTimer is an optional interface for Fs
+type DirSetModTimer interface {
+	// DirSetModTime sets the modification time of the directory dir
+	DirSetModTime(ctx context.Context, dir string, modTime time.Time) error
+}
+
+// DirMetadataer is an optional interface for Fs
+type DirMetadataer interface {
+	// DirMetadata returns the metadata of the directory dir
+	DirMetadata(ctx context.Context, dir string) (Metadata, error)
+}
+
+// DirSetMetadataer is an optional interface for Fs
+type DirSetMetadataer interface {
+	// DirSetMetadata sets metadata on the directory dir
+	DirSetMetadata(ctx context.Context, dir string, metadata Metadata) error
+}
+
 // UserInfoer is an optional interface for Fs
 type UserInfoer interface {
 	// UserInfo returns info about the connected user
@@ -0,0 +1,550 @@
+// Filter expression language for --filter-expr
+
+package filter
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// ExprError is an error found when parsing a filter expression. It
+// points at the column of the expression where the error is.
+type ExprError struct {
+	Expr   string // the expression being parsed
+	Column int    // 1 based column in runes of the error
+	Msg    string // description of the error
+}
+
+// Error formats the error with a pointer to the offending column
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("filter expression: %s at column %d\n  %s\n  %s^", e.Msg, e.Column, e.Expr, strings.Repeat(" ", e.Column-1))
+}
+
+// exprTokenKind is the kind of a token in a filter expression
+type exprTokenKind byte
+
+// Kinds of token
+const (
+	tokenEOF    exprTokenKind = iota // end of the expression
+	tokenWord                        // unquoted word, e.g. size or 1G
+	tokenString                      // quoted string
+	tokenOp                          // operator, e.g. <= or &&
+	tokenOpen                        // (
+	tokenClose                       // )
+)
+
+// exprToken is a token in a filter expression
+type exprToken struct {
+	kind exprTokenKind
+	text string // text of the token, unquoted for strings
+	pos  int    // byte offset in the expression
+}
+
+// is returns true if the token is the word or operator given,
+// comparing words case insensitively
+func (t exprToken) is(words ...string) bool {
+	if t.kind != tokenWord && t.kind != tokenOp {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// exprOps are the operators longest first so they match greedily
+var exprOps = []string{"=~", "!~", "!=", "<=", ">=", "&&", "||", "=", "<", ">", "~", "!"}
+
+// exprSpecial are the characters which end an unquoted word
+const exprSpecial = "()\"'=!<>~&| \t\r\n"
+
+// exprLexer splits a filter expression into tokens
+type exprLexer struct {
+	expr   string
+	tokens []exprToken
+}
+
+// lex the expression into tokens
+func (l *exprLexer) lex() error {
+	s := l.expr
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			l.tokens = append(l.tokens, exprToken{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case c == ')':
+			l.tokens = append(l.tokens, exprToken{kind: tokenClose, text: ")", pos: i})
+			i++
+		case c == '"' || c == '\'':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				text.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return l.errorf(i, "unterminated string")
+			}
+			l.tokens = append(l.tokens, exprToken{kind: tokenString, text: text.String(), pos: i})
+			i = j + 1
+		case strings.IndexByte(exprSpecial, c) >= 0:
+			op := ""
+			for _, try := range exprOps {
+				if strings.HasPrefix(s[i:], try) {
+					op = try
+					break
+				}
+			}
+			if op == "" {
+				return l.errorf(i, "unexpected %q", string(c))
+			}
+			l.tokens = append(l.tokens, exprToken{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(exprSpecial, s[j]) < 0 {
+				j++
+			}
+			l.tokens = append(l.tokens, exprToken{kind: tokenWord, text: s[i:j], pos: i})
+			i = j
+		}
+	}
+	l.tokens = append(l.tokens, exprToken{kind: tokenEOF, pos: len(s)})
+	return nil
+}
+
+// errorf makes an ExprError pointing at byte offset pos
+func (l *exprLexer) errorf(pos int, format string, a ...interface{}) error {
+	return &ExprError{
+		Expr:   l.expr,
+		Column: utf8.RuneCountInString(l.expr[:pos]) + 1,
+		Msg:    fmt.Sprintf(format, a...),
+	}
+}
+
+// exprObject is the object an expression is being evaluated on. It
+// reads the expensive properties on demand.
+type exprObject struct {
+	ctx          context.Context
+	o            fs.Object
+	now          time.Time
+	metadata     fs.Metadata
+	metadataRead bool
+}
+
+// getMetadata returns the metadata of the object, reading it once
+func (eo *exprObject) getMetadata() fs.Metadata {
+	if !eo.metadataRead {
+		var err error
+		eo.metadata, err = fs.GetMetadata(eo.ctx, eo.o)
+		if err != nil {
+			fs.Errorf(eo.o, "Failed to read metadata: %v", err)
+		}
+		eo.metadataRead = true
+	}
+	return eo.metadata
+}
+
+// exprNode is a node of a parsed filter expression
+type exprNode interface {
+	// eval returns whether the node is true for the object
+	eval(eo *exprObject) bool
+	// dump writes the node and its children to out
+	dump(out *strings.Builder, indent string)
+}
+
+// exprAnd is true if all its children are
+type exprAnd []exprNode
+
+func (e exprAnd) eval(eo *exprObject) bool {
+	for _, child := range e {
+		if !child.eval(eo) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e exprAnd) dump(out *strings.Builder, indent string) {
+	out.WriteString(indent + "and\n")
+	for _, child := range e {
+		child.dump(out, indent+"  ")
+	}
+}
+
+// exprOr is true if any of its children are
+type exprOr []exprNode
+
+func (e exprOr) eval(eo *exprObject) bool {
+	for _, child := range e {
+		if child.eval(eo) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e exprOr) dump(out *strings.Builder, indent string) {
+	out.WriteString(indent + "or\n")
+	for _, child := range e {
+		child.dump(out, indent+"  ")
+	}
+}
+
+// exprNot inverts its child
+type exprNot struct {
+	child exprNode
+}
+
+func (e exprNot) eval(eo *exprObject) bool {
+	return !e.child.eval(eo)
+}
+
+func (e exprNot) dump(out *strings.Builder, indent string) {
+	out.WriteString(indent + "not\n")
+	e.child.dump(out, indent+"  ")
+}
+
+// exprFieldType is the type of the value of a field
+type exprFieldType byte
+
+// Types of field
+const (
+	fieldString   exprFieldType = iota // compared as a string or with ~ and =~
+	fieldSize                          // compared as a size, e.g. 1G
+	fieldDuration                      // compared as a duration, e.g. 30d
+	fieldTime                          // compared as a time, e.g. 2023-01-01
+)
+
+// exprCompare compares a field of the object with a value
+type exprCompare struct {
+	field     string        // name of the field as written
+	fieldType exprFieldType // type of the field
+	op        string        // comparison operator
+	text      string        // value as written
+	str       func(eo *exprObject) string
+	size      int64
+	duration  time.Duration
+	time      time.Time
+	re        *regexp.Regexp // for ~, !~ and =~
+}
+
+func (e *exprCompare) dump(out *strings.Builder, indent string) {
+	fmt.Fprintf(out, "%s%s %s %q\n", indent, e.field, e.op, e.text)
+}
+
+// compareResult returns the result of op for a comparison which
+// gave cmp (-1, 0 or +1)
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compareInt returns -1, 0 or +1 depending on whether a is less
+// than, equal to or greater than b
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (e *exprCompare) eval(eo *exprObject) bool {
+	switch e.fieldType {
+	case fieldSize:
+		return compareResult(e.op, compareInt(eo.o.Size(), e.size))
+	case fieldDuration:
+		age := eo.now.Sub(eo.o.ModTime(eo.ctx))
+		return compareResult(e.op, compareInt(int64(age), int64(e.duration)))
+	case fieldTime:
+		return compareResult(e.op, compareInt(eo.o.ModTime(eo.ctx).UnixNano(), e.time.UnixNano()))
+	}
+	value := e.str(eo)
+	switch e.op {
+	case "~", "=~":
+		return e.re.MatchString(value)
+	case "!~":
+		return !e.re.MatchString(value)
+	}
+	return compareResult(e.op, strings.Compare(value, e.text))
+}
+
+// exprParser parses a filter expression
+type exprParser struct {
+	exprLexer
+	i          int // index of the current token
+	ignoreCase bool
+}
+
+// peek returns the current token
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+// next returns the current token and moves on to the next one
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// describe a token for an error message
+func (t exprToken) describe() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// parseOr parses: and { ("or" | "||") and }
+func (p *exprParser) parseOr() (exprNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := exprOr{node}
+	for p.peek().is("or", "||") {
+		p.next()
+		node, err = p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, node)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+// parseAnd parses: not { ("and" | "&&") not }
+func (p *exprParser) parseAnd() (exprNode, error) {
+	node, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	and := exprAnd{node}
+	for p.peek().is("and", "&&") {
+		p.next()
+		node, err = p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, node)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+// parseNot parses: ("not" | "!") not | primary
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.peek().is("not", "!") {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{child: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses: "(" or ")" | field op value
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closeToken := p.next(); closeToken.kind != tokenClose {
+			return nil, p.errorf(closeToken.pos, "expecting \")\" but got %s", closeToken.describe())
+		}
+		return node, nil
+	case tokenWord:
+		return p.parseCompare(t)
+	}
+	return nil, p.errorf(t.pos, "expecting field name or \"(\" but got %s", t.describe())
+}
+
+// exprStringFields are the fields which are strings
+var exprStringFields = map[string]func(eo *exprObject) string{
+	"name": func(eo *exprObject) string {
+		return path.Base(eo.o.Remote())
+	},
+	"path": func(eo *exprObject) string {
+		return eo.o.Remote()
+	},
+	"ext": func(eo *exprObject) string {
+		return strings.TrimPrefix(path.Ext(eo.o.Remote()), ".")
+	},
+	"mime": func(eo *exprObject) string {
+		return fs.MimeType(eo.ctx, eo.o)
+	},
+}
+
+// lookupField finds the field called name setting the field
+// accessors in e
+func (p *exprParser) lookupField(e *exprCompare, name string) bool {
+	lowerName := strings.ToLower(name)
+	switch lowerName {
+	case "size":
+		e.fieldType = fieldSize
+		return true
+	case "age":
+		e.fieldType = fieldDuration
+		return true
+	case "modtime":
+		e.fieldType = fieldTime
+		return true
+	}
+	if str, ok := exprStringFields[lowerName]; ok {
+		e.str = str
+		return true
+	}
+	if key, ok := cutPrefixFold(name, "meta."); ok && key != "" {
+		key = strings.ToLower(key)
+		e.str = func(eo *exprObject) string {
+			return eo.getMetadata()[key]
+		}
+		return true
+	}
+	if hashName, ok := cutPrefixFold(name, "hash."); ok {
+		var ht hash.Type
+		if ht.Set(hashName) != nil {
+			return false
+		}
+		e.str = func(eo *exprObject) string {
+			sum, err := eo.o.Hash(eo.ctx, ht)
+			if err != nil {
+				fs.Debugf(eo.o, "Failed to read %v hash: %v", ht, err)
+			}
+			return sum
+		}
+		return true
+	}
+	return false
+}
+
+// cutPrefixFold is strings.CutPrefix but case insensitive
+func cutPrefixFold(s, prefix string) (after string, found bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// parseCompare parses: op value having read the field
+func (p *exprParser) parseCompare(fieldToken exprToken) (exprNode, error) {
+	e := &exprCompare{field: fieldToken.text}
+	if !p.lookupField(e, fieldToken.text) {
+		return nil, p.errorf(fieldToken.pos, "unknown field %q", fieldToken.text)
+	}
+	opToken := p.next()
+	if opToken.kind != tokenOp || opToken.is("&&", "||", "!") {
+		return nil, p.errorf(opToken.pos, "expecting comparison operator after %q but got %s", fieldToken.text, opToken.describe())
+	}
+	e.op = opToken.text
+	if e.fieldType != fieldString && strings.Contains(e.op, "~") {
+		return nil, p.errorf(opToken.pos, "can't use %q with %q", e.op, fieldToken.text)
+	}
+	valueToken := p.next()
+	if valueToken.kind != tokenWord && valueToken.kind != tokenString {
+		return nil, p.errorf(valueToken.pos, "expecting value after %q but got %s", e.op, valueToken.describe())
+	}
+	e.text = valueToken.text
+	var err error
+	switch e.fieldType {
+	case fieldSize:
+		var size fs.SizeSuffix
+		err = size.Set(e.text)
+		e.size = int64(size)
+	case fieldDuration:
+		e.duration, err = fs.ParseDuration(e.text)
+	case fieldTime:
+		e.time, err = fs.ParseTime(e.text)
+	case fieldString:
+		switch e.op {
+		case "~", "!~":
+			glob := e.text
+			if e.field != "path" {
+				// Match the whole value for everything but paths
+				glob = "/" + glob
+			}
+			e.re, err = GlobToRegexp(glob, p.ignoreCase)
+		case "=~":
+			re := e.text
+			if p.ignoreCase {
+				re = "(?i)" + re
+			}
+			e.re, err = regexp.Compile(re)
+		}
+	}
+	if err != nil {
+		return nil, p.errorf(valueToken.pos, "bad value for %q: %v", e.field, err)
+	}
+	return e, nil
+}
+
+// parseExpr parses a filter expression
+func parseExpr(expr string, ignoreCase bool) (exprNode, error) {
+	p := &exprParser{
+		exprLexer:  exprLexer{expr: expr},
+		ignoreCase: ignoreCase,
+	}
+	err := p.lex()
+	if err != nil {
+		return nil, err
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t.pos, "expecting \"and\", \"or\" or end of expression but got %s", t.describe())
+	}
+	return node, nil
+}
+
+// dumpExpr returns the parsed expression as an indented tree
+func dumpExpr(node exprNode) string {
+	var out strings.Builder
+	node.dump(&out, "")
+	return strings.TrimSuffix(out.String(), "\n")
+}
@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpr(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{`size > 1G`, `size > "1G"`},
+		{`name ~ "*.mp4" and size>1G or age >= 30d and not path ~ /keep/**`, `or
+  and
+    name ~ "*.mp4"
+    size > "1G"
+  and
+    age >= "30d"
+    not
+      path ~ "/keep/**"`},
+		{`(ext = mp4 || ext = mkv) && !(meta.owner != 'bob')`, `and
+  or
+    ext = "mp4"
+    ext = "mkv"
+  not
+    meta.owner != "bob"`},
+		{`NOT NOT modtime < 2020-01-01`, `not
+  not
+    modtime < "2020-01-01"`},
+		{`hash.md5 = "abc" OR mime =~ "^video/"`, `or
+  hash.md5 = "abc"
+  mime =~ "^video/"`},
+		{`name = "a \"quoted\" name"`, `name = "a \"quoted\" name"`},
+	} {
+		node, err := parseExpr(test.in, false)
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, dumpExpr(node), test.in)
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		column int
+		msg    string
+	}{
+		{``, 1, `expecting field name or "(" but got end of expression`},
+		{`size > 1G and`, 14, `expecting field name or "(" but got end of expression`},
+		{`(size > 1G`, 11, `expecting ")" but got end of expression`},
+		{`size > 1G)`, 10, `expecting "and", "or" or end of expression but got ")"`},
+		{`colour = red`, 1, `unknown field "colour"`},
+		{`hash.potato = 1`, 1, `unknown field "hash.potato"`},
+		{`size 1G`, 6, `expecting comparison operator after "size" but got "1G"`},
+		{`size ~ 1G`, 6, `can't use "~" with "size"`},
+		{`size > 1Q`, 8, `bad value for "size"`},
+		{`age > soon`, 7, `bad value for "age"`},
+		{`path =~ "("`, 9, `bad value for "path"`},
+		{`name = "open`, 8, `unterminated string`},
+		{`size > 1G & age < 1d`, 11, `unexpected "&"`},
+		{`name = "ä" and ä`, 16, `unknown field "ä"`},
+	} {
+		_, err := parseExpr(test.in, false)
+		require.Error(t, err, test.in)
+		var exprErr *ExprError
+		require.True(t, errors.As(err, &exprErr), test.in)
+		assert.Equal(t, test.column, exprErr.Column, test.in)
+		assert.Contains(t, exprErr.Msg, test.msg, test.in)
+	}
+
+	_, err := parseExpr(`size > 1G and`, false)
+	require.Error(t, err)
+	assert.True(t, strings.HasSuffix(err.Error(), "\n  size > 1G and\n               ^"), err.Error())
+}
+
+func TestExprEval(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	video := object.NewMemoryObject("media/film.MP4", now.Add(-time.Hour), make([]byte, 2048)).WithMetadata(fs.Metadata{"owner": "bob"})
+	old := object.NewMemoryObject("keep/old.txt", now.Add(-60*24*time.Hour), []byte("hello"))
+	oldNotKept := object.NewMemoryObject("docs/old.txt", now.Add(-60*24*time.Hour), []byte("hello"))
+	for _, test := range []struct {
+		expr       string
+		ignoreCase bool
+		o          fs.Object
+		want       bool
+	}{
+		{`size > 1k`, false, video, true},
+		{`size > 1k`, false, old, false},
+		{`size <= 5B`, false, old, true},
+		{`size < 1`, false, old, true},
+		{`size = 5B`, false, old, true},
+		{`age < 1d`, false, video, true},
+		{`age > 30d`, false, old, true},
+		{`modtime < 2000-01-01`, false, old, false},
+		{`modtime > 2000-01-01`, false, old, true},
+		{`name = film.MP4`, false, video, true},
+		{`name ~ *.mp4`, false, video, false},
+		{`name ~ *.mp4`, true, video, true},
+		{`ext = MP4`, false, video, true},
+		{`ext =~ "(?i)^mp4$"`, false, video, true},
+		{`path ~ media/**`, false, video, true},
+		{`path !~ media/**`, false, video, false},
+		{`path ~ /keep/**`, false, old, true},
+		{`path ~ /keep/**`, false, oldNotKept, false},
+		{`meta.owner = bob`, false, video, true},
+		{`meta.owner = bob`, false, old, false},
+		{`meta.owner = ""`, false, old, true},
+		{`mime = "text/plain; charset=utf-8"`, false, old, true},
+		{`hash.md5 = 5d41402abc4b2a76b9719d911017c592`, false, old, true},
+		{`(name ~ "*.MP4" and size > 1k) or (age > 30d and not path ~ /keep/**)`, false, video, true},
+		{`(name ~ "*.MP4" and size > 1k) or (age > 30d and not path ~ /keep/**)`, false, old, false},
+		{`(name ~ "*.MP4" and size > 1k) or (age > 30d and not path ~ /keep/**)`, false, oldNotKept, true},
+	} {
+		node, err := parseExpr(test.expr, test.ignoreCase)
+		require.NoError(t, err, test.expr)
+		eo := &exprObject{ctx: ctx, o: test.o, now: now}
+		assert.Equal(t, test.want, node.eval(eo), test.expr+" on "+test.o.Remote())
+	}
+}
+
+func TestNewFilterExpr(t *testing.T) {
+	ctx := context.Background()
+	opt := DefaultOpt
+	opt.FilterExpr = `size > 3B and name !~ "*.bak"`
+	f, err := NewFilter(&opt)
+	require.NoError(t, err)
+	assert.False(t, f.InActive())
+	assert.Contains(t, f.DumpFilters(), "--- Filter expression ---\nand\n  size > \"3B\"\n  name !~ \"*.bak\"")
+
+	now := time.Now()
+	assert.True(t, f.IncludeObject(ctx, object.NewMemoryObject("file.txt", now, []byte("hello"))))
+	assert.False(t, f.IncludeObject(ctx, object.NewMemoryObject("file.bak", now, []byte("hello"))))
+	assert.False(t, f.IncludeObject(ctx, object.NewMemoryObject("small.txt", now, []byte("hi"))))
+
+	opt.FilterExpr = `size >`
+	_, err = NewFilter(&opt)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "column 7")
+}
@@ -24,6 +24,7 @@ type Opt struct {
 	DeleteExcluded bool
 	RulesOpt       // embedded so we don't change the JSON API
 	ExcludeFile    []string
+	IgnoreFileName string
 	FilesFrom      []string
 	FilesFromRaw   []string
 	MetaRules      RulesOpt
@@ -32,6 +33,7 @@ type Opt struct {
 	MinSize        fs.SizeSuffix
 	MaxSize        fs.SizeSuffix
 	IgnoreCase     bool
+	FilterExpr     string
 }
 
 // DefaultOpt is the default config for the filter
@@ -53,8 +55,10 @@ type Filter struct {
 	fileRules   rules
 	dirRules    rules
 	metaRules   rules
-	files       FilesMap // files if filesFrom
-	dirs        FilesMap // dirs from filesFrom
+	files       FilesMap  // files if filesFrom
+	dirs        FilesMap  // dirs from filesFrom
+	expr        exprNode  // parsed --filter-expr if set
+	exprNow     time.Time // time to measure ages in --filter-expr from
 }
 
 // NewFilter parses the command line options and creates a Filter
@@ -92,6 +96,14 @@ func NewFilter(opt *Opt) (f *Filter, err error) {
 		return nil, err
 	}
 
+	if f.Opt.FilterExpr != "" {
+		f.expr, err = parseExpr(f.Opt.FilterExpr, f.Opt.IgnoreCase)
+		if err != nil {
+			return nil, err
+		}
+		f.exprNow = time.Now()
+	}
+
 	inActive := f.InActive()
 
 	for _, rule := range f.Opt.FilesFrom {
@@ -254,7 +266,9 @@ func (f *Filter) InActive() bool {
 		f.fileRules.len() == 0 &&
 		f.dirRules.len() == 0 &&
 		f.metaRules.len() == 0 &&
-		len(f.Opt.ExcludeFile) == 0)
+		len(f.Opt.ExcludeFile) == 0 &&
+		f.Opt.IgnoreFileName == "" &&
+		f.expr == nil)
 }
 
 // IncludeRemote returns whether this remote passes the filter rules.
@@ -387,7 +401,20 @@ func (f *Filter) IncludeObject(ctx context.Context, o fs.Object) bool {
 		}
 
 	}
-	return f.Include(o.Remote(), o.Size(), modTime, metadata)
+	if !f.Include(o.Remote(), o.Size(), modTime, metadata) {
+		return false
+	}
+	if f.expr != nil {
+		eo := &exprObject{
+			ctx:          ctx,
+			o:            o,
+			now:          f.exprNow,
+			metadata:     metadata,
+			metadataRead: metadata != nil,
+		}
+		return f.expr.eval(eo)
+	}
+	return true
 }
 
 // DumpFilters dumps the filters in textual form, 1 per line
@@ -413,6 +440,13 @@ func (f *Filter) DumpFilters() string {
 			rules = append(rules, metaRule.String())
 		}
 	}
+	if f.expr != nil {
+		rules = append(rules, "--- Filter expression ---")
+		rules = append(rules, dumpExpr(f.expr))
+	}
+	if f.Opt.IgnoreFileName != "" {
+		rules = append(rules, fmt.Sprintf("--- Rules read from %q in each directory ---", f.Opt.IgnoreFileName))
+	}
 	return strings.Join(rules, "\n")
 }
 
@@ -48,6 +48,7 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	AddRuleFlags(flagSet, &Opt.RulesOpt, "file", "")
 	AddRuleFlags(flagSet, &Opt.MetaRules, "metadata", "metadata-")
 	flags.StringArrayVarP(flagSet, &Opt.ExcludeFile, "exclude-if-present", "", nil, "Exclude directories if filename is present")
+	flags.StringVarP(flagSet, &Opt.IgnoreFileName, "ignore-file-name", "", "", "Read gitignore style exclude rules from files with this name in each directory")
 	flags.StringArrayVarP(flagSet, &Opt.FilesFrom, "files-from", "", nil, "Read list of source-file names from file (use - to read from stdin)")
 	flags.StringArrayVarP(flagSet, &Opt.FilesFromRaw, "files-from-raw", "", nil, "Read list of source-file names from file without any processing of lines (use - to read from stdin)")
 	flags.FVarP(flagSet, &Opt.MinAge, "min-age", "", "Only transfer files older than this in s or suffix ms|s|m|h|d|w|M|y")
@@ -55,5 +56,6 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.FVarP(flagSet, &Opt.MinSize, "min-size", "", "Only transfer files bigger than this in KiB or suffix B|K|M|G|T|P")
 	flags.FVarP(flagSet, &Opt.MaxSize, "max-size", "", "Only transfer files smaller than this in KiB or suffix B|K|M|G|T|P")
 	flags.BoolVarP(flagSet, &Opt.IgnoreCase, "ignore-case", "", false, "Ignore case in filters (case insensitive)")
+	flags.StringVarP(flagSet, &Opt.FilterExpr, "filter-expr", "", "", "Only include files for which this expression is true, e.g. 'size > 1G and ext = mp4'")
 	//cvsExclude     = BoolP("cvs-exclude", "C", false, "Exclude files in the same way CVS does")
 }
@@ -0,0 +1,243 @@
+// Per directory ignore files with gitignore semantics
+
+package filter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// maxIgnoreFileSize is the largest ignore file which will be read
+const maxIgnoreFileSize = 1024 * 1024
+
+// ignoreRule is one pattern from an ignore file
+type ignoreRule struct {
+	negate  bool           // pattern started with ! so re-includes
+	dirOnly bool           // pattern ended with / so only matches directories
+	re      *regexp.Regexp // pattern to match the path relative to the ignore file
+}
+
+// Ignore is the rules from the ignore files read in a directory and
+// its parents.
+//
+// A nil *Ignore is valid and ignores nothing.
+type Ignore struct {
+	parent *Ignore      // rules from the parent directories
+	dir    string       // directory the ignore file was read from
+	rules  []ignoreRule // rules in the order they were read
+}
+
+// ignoreGlobToRegexp converts a gitignore style pattern into a
+// regexp which matches paths relative to the ignore file.
+//
+// Patterns without a / match at any depth, patterns with one are
+// anchored to the directory of the ignore file. A leading **/
+// matches in all directories, a trailing /** matches everything
+// inside and /**/ matches zero or more directories.
+func ignoreGlobToRegexp(glob string, ignoreCase bool) (*regexp.Regexp, error) {
+	var re strings.Builder
+	if ignoreCase {
+		re.WriteString("(?i)")
+	}
+	re.WriteString("^")
+	if !strings.Contains(glob, "/") {
+		re.WriteString("(?:.*/)?")
+	}
+	glob = strings.TrimPrefix(glob, "/")
+	for i := 0; i < len(glob); {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			re.WriteString("(?:.*/)?")
+			i += 3
+		case glob[i:] == "/**":
+			re.WriteString("/.*")
+			i += 3
+		case glob[i] == '*':
+			re.WriteString("[^/]*")
+			for i < len(glob) && glob[i] == '*' {
+				i++
+			}
+		case glob[i] == '?':
+			re.WriteString("[^/]")
+			i++
+		case glob[i] == '[':
+			// Find the end of the character class allowing a ] as
+			// the first character
+			j := i + 1
+			if j < len(glob) && (glob[j] == '!' || glob[j] == '^') {
+				j++
+			}
+			if j < len(glob) && glob[j] == ']' {
+				j++
+			}
+			for j < len(glob) && glob[j] != ']' {
+				j++
+			}
+			if j >= len(glob) {
+				return nil, fmt.Errorf("mismatched '[' and ']' in pattern %q", glob)
+			}
+			class := glob[i+1 : j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = j + 1
+		case glob[i] == '\\' && i+1 < len(glob):
+			r, size := utf8.DecodeRuneInString(glob[i+1:])
+			re.WriteString(regexp.QuoteMeta(string(r)))
+			i += 1 + size
+		default:
+			r, size := utf8.DecodeRuneInString(glob[i:])
+			re.WriteString(regexp.QuoteMeta(string(r)))
+			i += size
+		}
+	}
+	re.WriteString("$")
+	result, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, fmt.Errorf("bad pattern %q (regexp %q): %w", glob, re.String(), err)
+	}
+	return result, nil
+}
+
+// parseIgnoreLine parses a line of an ignore file returning ok false
+// if it doesn't contain a pattern.
+func parseIgnoreLine(line string, ignoreCase bool) (rule ignoreRule, ok bool, err error) {
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || line[0] == '#' {
+		return rule, false, nil
+	}
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false, nil
+	}
+	rule.re, err = ignoreGlobToRegexp(line, ignoreCase)
+	if err != nil {
+		return rule, false, err
+	}
+	return rule, true, nil
+}
+
+// ParseIgnore parses the ignore file read from in which was found in
+// directory dir, adding its rules to those in parent.
+//
+// It returns parent if the file has no rules in.
+func ParseIgnore(parent *Ignore, dir string, in io.Reader, ignoreCase bool) (*Ignore, error) {
+	ig := &Ignore{
+		parent: parent,
+		dir:    dir,
+	}
+	scanner := bufio.NewScanner(in)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		rule, ok, err := parseIgnoreLine(scanner.Text(), ignoreCase)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if ok {
+			ig.rules = append(ig.rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ig.rules) == 0 {
+		return parent, nil
+	}
+	return ig, nil
+}
+
+// Ignored returns true if remote should be ignored.
+//
+// The rules from the deepest ignore file are checked first and within
+// a file the last matching pattern wins.
+func (ig *Ignore) Ignored(remote string, isDir bool) bool {
+	for ; ig != nil; ig = ig.parent {
+		rel := remote
+		if ig.dir != "" {
+			rel = strings.TrimPrefix(remote, ig.dir+"/")
+			if rel == remote {
+				continue // not below this ignore file
+			}
+		}
+		for i := len(ig.rules) - 1; i >= 0; i-- {
+			rule := &ig.rules[i]
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.re.MatchString(rel) {
+				return !rule.negate
+			}
+		}
+	}
+	return false
+}
+
+// Filter returns entries with the ignored entries removed. It
+// modifies entries in place.
+func (ig *Ignore) Filter(entries fs.DirEntries) fs.DirEntries {
+	if ig == nil {
+		return entries
+	}
+	newEntries := entries[:0]
+	for _, entry := range entries {
+		_, isDir := entry.(fs.Directory)
+		if ig.Ignored(entry.Remote(), isDir) {
+			fs.Debugf(entry, "Excluded by ignore file")
+			continue
+		}
+		newEntries = append(newEntries, entry)
+	}
+	return newEntries
+}
+
+// DirIgnore reads the --ignore-file-name file from entries, the
+// listing of directory dir, and returns its rules added to parent.
+//
+// If --ignore-file-name isn't in use or there is no ignore file in
+// entries it returns parent.
+func (f *Filter) DirIgnore(ctx context.Context, parent *Ignore, dir string, entries fs.DirEntries) (ig *Ignore, err error) {
+	if f.Opt.IgnoreFileName == "" {
+		return parent, nil
+	}
+	for _, entry := range entries {
+		o, ok := entry.(fs.Object)
+		if !ok || path.Base(o.Remote()) != f.Opt.IgnoreFileName {
+			continue
+		}
+		in, err := o.Open(ctx)
+		if err != nil {
+			return parent, fmt.Errorf("failed to open ignore file: %w", err)
+		}
+		defer fs.CheckClose(in, &err)
+		ig, err = ParseIgnore(parent, dir, io.LimitReader(in, maxIgnoreFileSize), f.Opt.IgnoreCase)
+		if err != nil {
+			return parent, fmt.Errorf("failed to parse ignore file %q: %w", o.Remote(), err)
+		}
+		fs.Debugf(o, "Read ignore file")
+		return ig, nil
+	}
+	return parent, nil
+}
@@ -0,0 +1,150 @@
+package filter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockdir"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreGlobToRegexp(t *testing.T) {
+	for _, test := range []struct {
+		in    string
+		want  string
+		error string
+	}{
+		{`potato`, `^(?:.*/)?potato$`, ``},
+		{`/potato`, `^potato$`, ``},
+		{`a/potato`, `^a/potato$`, ``},
+		{`*.jpg`, `^(?:.*/)?[^/]*\.jpg$`, ``},
+		{`potato?`, `^(?:.*/)?potato[^/]$`, ``},
+		{`**/potato`, `^(?:.*/)?potato$`, ``},
+		{`potato/**`, `^potato/.*$`, ``},
+		{`a/**/b`, `^a/(?:.*/)?b$`, ``},
+		{`a**b`, `^(?:.*/)?a[^/]*b$`, ``},
+		{`[!a-c]x`, `^(?:.*/)?[^a-c]x$`, ``},
+		{`[]a]`, `^(?:.*/)?[]a]$`, ``},
+		{`a\*b`, `^(?:.*/)?a\*b$`, ``},
+		{`a.b+c`, `^(?:.*/)?a\.b\+c$`, ``},
+		{`ab[c`, ``, `mismatched '[' and ']'`},
+	} {
+		gotRe, err := ignoreGlobToRegexp(test.in, false)
+		if test.error == "" {
+			require.NoError(t, err, test.in)
+			assert.Equal(t, test.want, gotRe.String(), test.in)
+		} else {
+			require.Error(t, err, test.in)
+			assert.Contains(t, err.Error(), test.error, test.in)
+		}
+	}
+}
+
+func TestParseIgnoreEmpty(t *testing.T) {
+	parent := &Ignore{}
+	ig, err := ParseIgnore(parent, "dir", strings.NewReader("# comment\n\n   \n"), false)
+	require.NoError(t, err)
+	assert.True(t, ig == parent)
+
+	ig, err = ParseIgnore(nil, "dir", strings.NewReader("[oops\n"), false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 1")
+	assert.Nil(t, ig)
+}
+
+func TestIgnored(t *testing.T) {
+	root, err := ParseIgnore(nil, "", strings.NewReader(`
+# Comments and blank lines are ignored
+*.tmp
+!keep.tmp
+/build
+cache/
+docs/**/*.pdf
+\#hash
+\!bang
+trailing
+`), false)
+	require.NoError(t, err)
+	sub, err := ParseIgnore(root, "sub", strings.NewReader(`
+!*.tmp
+/local
+`), false)
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		ig    *Ignore
+		in    string
+		isDir bool
+		want  bool
+	}{
+		{nil, "file.tmp", false, false},
+		{root, "file.tmp", false, true},
+		{root, "a/b/file.tmp", false, true},
+		{root, "keep.tmp", false, false},
+		{root, "a/keep.tmp", false, false},
+		{root, "file.txt", false, false},
+		{root, "build", true, true},
+		{root, "build", false, true},
+		{root, "a/build", true, false},
+		{root, "cache", true, true},
+		{root, "a/cache", true, true},
+		{root, "cache", false, false},
+		{root, "docs/a.pdf", false, true},
+		{root, "docs/a/b/c.pdf", false, true},
+		{root, "a/docs/c.pdf", false, false},
+		{root, "#hash", false, true},
+		{root, "!bang", false, true},
+		{root, "trailing", false, true},
+		{sub, "file.tmp", false, true},
+		{sub, "sub/file.tmp", false, false},
+		{sub, "sub/a/file.tmp", false, false},
+		{sub, "sub/local", true, true},
+		{sub, "sub/a/local", true, false},
+		{sub, "local", true, false},
+		{sub, "sub/cache", true, true},
+	} {
+		got := test.ig.Ignored(test.in, test.isDir)
+		assert.Equal(t, test.want, got, test.in)
+	}
+
+	ig, err := ParseIgnore(nil, "", strings.NewReader("*.JPG\n"), true)
+	require.NoError(t, err)
+	assert.True(t, ig.Ignored("a/b.jpg", false))
+}
+
+func TestDirIgnore(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFilter(nil)
+	require.NoError(t, err)
+	assert.True(t, f.InActive())
+
+	ignoreFile := mockobject.New("dir/.rcloneignore").WithContent([]byte("*.tmp\nsecret/\n"), mockobject.SeekModeNone)
+	entries := fs.DirEntries{
+		ignoreFile,
+		mockobject.Object("dir/a.tmp"),
+		mockobject.Object("dir/b.txt"),
+		mockdir.New("dir/secret"),
+		mockdir.New("dir/public"),
+	}
+
+	// Without --ignore-file-name nothing happens
+	ig, err := f.DirIgnore(ctx, nil, "dir", entries)
+	require.NoError(t, err)
+	assert.Nil(t, ig)
+
+	f.Opt.IgnoreFileName = ".rcloneignore"
+	assert.False(t, f.InActive())
+	ig, err = f.DirIgnore(ctx, nil, "dir", entries)
+	require.NoError(t, err)
+	require.NotNil(t, ig)
+
+	var got []string
+	for _, entry := range ig.Filter(entries) {
+		got = append(got, entry.Remote())
+	}
+	assert.Equal(t, []string{"dir/.rcloneignore", "dir/b.txt", "dir/public"}, got)
+}
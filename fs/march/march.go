@@ -12,8 +12,10 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/dirtree"
 	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/transform"
 	"golang.org/x/text/unicode/norm"
 )
 
@@ -21,16 +23,17 @@ import (
 // calling Callback for each match
 type March struct {
 	// parameters
-	Ctx                    context.Context // context for background goroutines
-	Fdst                   fs.Fs           // source Fs
-	Fsrc                   fs.Fs           // dest Fs
-	Dir                    string          // directory
-	NoTraverse             bool            // don't traverse the destination
-	SrcIncludeAll          bool            // don't include all files in the src
-	DstIncludeAll          bool            // don't include all files in the destination
-	Callback               Marcher         // object to call with results
-	NoCheckDest            bool            // transfer all objects regardless without checking dst
-	NoUnicodeNormalization bool            // don't normalize unicode characters in filenames
+	Ctx                    context.Context      // context for background goroutines
+	Fdst                   fs.Fs                // source Fs
+	Fsrc                   fs.Fs                // dest Fs
+	Dir                    string               // directory
+	NoTraverse             bool                 // don't traverse the destination
+	SrcIncludeAll          bool                 // don't include all files in the src
+	DstIncludeAll          bool                 // don't include all files in the destination
+	Callback               Marcher              // object to call with results
+	NoCheckDest            bool                 // transfer all objects regardless without checking dst
+	NoUnicodeNormalization bool                 // don't normalize unicode characters in filenames
+	NameTransform          *transform.Transform // transform applied to source names to find destination names
 	// internal state
 	srcListDir listDirFn // function to call to list a directory in the src
 	dstListDir listDirFn // function to call to list a directory in the dst
@@ -80,7 +83,8 @@ type listDirFn func(dir string) (entries fs.DirEntries, err error)
 func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listDirFn {
 	ci := fs.GetConfig(ctx)
 	fi := filter.GetConfig(ctx)
-	if !(ci.UseListR && f.Features().ListR != nil) && // !--fast-list active and
+	if (!(ci.UseListR && f.Features().ListR != nil) || // !--fast-list active or
+		fi.Opt.IgnoreFileName != "") && // --ignore-file-name active and
 		!(ci.NoTraverse && fi.HaveFilesFrom()) { // !(--files-from and --no-traverse)
 		return func(dir string) (entries fs.DirEntries, err error) {
 			dirCtx := filter.SetUseFilter(m.Ctx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
@@ -117,6 +121,46 @@ func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listD
 	}
 }
 
+// removeStoredHashSidecars removes the sidecar files used by
+// --store-hash from entries, logging them if logSkipped is set
+func removeStoredHashSidecars(ctx context.Context, entries fs.DirEntries, logSkipped bool) fs.DirEntries {
+	ci := fs.GetConfig(ctx)
+	if ci.StoreHash == hash.None {
+		return entries
+	}
+	newEntries := entries[:0]
+	for _, entry := range entries {
+		if _, isObject := entry.(fs.Object); isObject && fs.IsStoredHashSidecar(ctx, entry.Remote()) {
+			if logSkipped {
+				fs.Logf(entry, "Skipping as the name ends with the suffix used to store hashes with --store-hash")
+			}
+			continue
+		}
+		newEntries = append(newEntries, entry)
+	}
+	return newEntries
+}
+
+// removeUntransformable removes the entries whose names can't be
+// transformed by nameTransform from entries, counting an error for
+// each
+func removeUntransformable(entries fs.DirEntries, nameTransform *transform.Transform) fs.DirEntries {
+	if nameTransform == nil {
+		return entries
+	}
+	newEntries := entries[:0]
+	for _, entry := range entries {
+		_, isDir := entry.(fs.Directory)
+		if _, err := nameTransform.Leaf(path.Base(entry.Remote()), isDir); err != nil {
+			err = fs.CountError(err)
+			fs.Errorf(entry, "Skipping: %v", err)
+			continue
+		}
+		newEntries = append(newEntries, entry)
+	}
+	return newEntries
+}
+
 // listDirJob describe a directory listing that needs to be done
 type listDirJob struct {
 	srcRemote string
@@ -125,6 +169,7 @@ type listDirJob struct {
 	dstDepth  int
 	noSrc     bool
 	noDst     bool
+	ignore    *filter.Ignore // rules from the ignore files in the parents
 }
 
 // Run starts the matching process off
@@ -272,12 +317,21 @@ func (es matchEntries) sort() {
 }
 
 // make a matchEntries from a newMatch entries
-func newMatchEntries(entries fs.DirEntries, transforms []matchTransformFn) matchEntries {
+//
+// The names are transformed with nameTransform (which may be nil)
+// then with transforms. Entries which nameTransform can't transform
+// should have been removed with removeUntransformable already, or
+// they are left as they are.
+func newMatchEntries(entries fs.DirEntries, nameTransform *transform.Transform, transforms []matchTransformFn) matchEntries {
 	es := make(matchEntries, len(entries))
 	for i := range es {
 		es[i].entry = entries[i]
 		name := path.Base(entries[i].Remote())
 		es[i].leaf = name
+		_, isDir := entries[i].(fs.Directory)
+		if newName, err := nameTransform.Leaf(name, isDir); err == nil {
+			name = newName
+		}
 		for _, transform := range transforms {
 			name = transform(name)
 		}
@@ -297,16 +351,17 @@ type matchPair struct {
 type matchTransformFn func(name string) string
 
 // Process the two listings, matching up the items in the two slices
-// using the transform function on each name first.
+// using the transform function on each name first. The source names
+// are transformed with nameTransform (which may be nil) before that.
 //
 // Into srcOnly go Entries which only exist in the srcList
 // Into dstOnly go Entries which only exist in the dstList
 // Into matches go matchPair's of src and dst which have the same name
 //
 // This checks for duplicates and checks the list is sorted.
-func matchListings(srcListEntries, dstListEntries fs.DirEntries, transforms []matchTransformFn) (srcOnly fs.DirEntries, dstOnly fs.DirEntries, matches []matchPair) {
-	srcList := newMatchEntries(srcListEntries, transforms)
-	dstList := newMatchEntries(dstListEntries, transforms)
+func matchListings(srcListEntries, dstListEntries fs.DirEntries, nameTransform *transform.Transform, transforms []matchTransformFn) (srcOnly fs.DirEntries, dstOnly fs.DirEntries, matches []matchPair) {
+	srcList := newMatchEntries(srcListEntries, nameTransform, transforms)
+	dstList := newMatchEntries(dstListEntries, nil, transforms)
 
 	for iSrc, iDst := 0, 0; ; iSrc, iDst = iSrc+1, iDst+1 {
 		var src, dst fs.DirEntry
@@ -427,6 +482,26 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 		return nil, dstListErr
 	}
 
+	// Ignore the sidecar files used to store hashes
+	srcList = removeStoredHashSidecars(m.Ctx, srcList, true)
+	dstList = removeStoredHashSidecars(m.Ctx, dstList, false)
+
+	// Skip the source entries which can't be renamed
+	srcList = removeUntransformable(srcList, m.NameTransform)
+
+	// Read the rules from any --ignore-file-name file in the source,
+	// or the destination if there is no source, and apply them
+	ignore, err := m.readIgnore(job, srcList, dstList)
+	if err != nil {
+		return nil, err
+	}
+	if !m.SrcIncludeAll {
+		srcList = ignore.Filter(srcList)
+	}
+	if !m.DstIncludeAll {
+		dstList = ignore.Filter(dstList)
+	}
+
 	// If NoTraverse is set, then try to find a matching object
 	// for each item in the srcList to head dst object
 	ci := fs.GetConfig(m.Ctx)
@@ -438,12 +513,15 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 			go func(limiter chan struct{}, src fs.DirEntry) {
 				defer wg.Done()
 				if srcObj, ok := src.(fs.Object); ok {
-					leaf := path.Base(srcObj.Remote())
-					dstObj, err := m.Fdst.NewObject(m.Ctx, path.Join(job.dstRemote, leaf))
+					leaf, err := m.NameTransform.Leaf(path.Base(srcObj.Remote()), false)
 					if err == nil {
-						mu.Lock()
-						dstList = append(dstList, dstObj)
-						mu.Unlock()
+						var dstObj fs.Object
+						dstObj, err = m.Fdst.NewObject(m.Ctx, path.Join(job.dstRemote, leaf))
+						if err == nil {
+							mu.Lock()
+							dstList = append(dstList, dstObj)
+							mu.Unlock()
+						}
 					}
 				}
 				<-limiter
@@ -453,18 +531,25 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 	}
 
 	// Work out what to do and do it
-	srcOnly, dstOnly, matches := matchListings(srcList, dstList, m.transforms)
+	srcOnly, dstOnly, matches := matchListings(srcList, dstList, m.NameTransform, m.transforms)
 	for _, src := range srcOnly {
 		if m.aborting() {
 			return nil, m.Ctx.Err()
 		}
 		recurse := m.Callback.SrcOnly(src)
 		if recurse && job.srcDepth > 0 {
+			dstRemote, err := m.NameTransform.Path(src.Remote(), true)
+			if err != nil {
+				err = fs.CountError(err)
+				fs.Errorf(src, "Skipping directory: %v", err)
+				continue
+			}
 			jobs = append(jobs, listDirJob{
 				srcRemote: src.Remote(),
-				dstRemote: src.Remote(),
+				dstRemote: dstRemote,
 				srcDepth:  job.srcDepth - 1,
 				noDst:     true,
+				ignore:    ignore,
 			})
 		}
 
@@ -480,6 +565,7 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 				dstRemote: dst.Remote(),
 				dstDepth:  job.dstDepth - 1,
 				noSrc:     true,
+				ignore:    ignore,
 			})
 		}
 	}
@@ -494,8 +580,25 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 				dstRemote: match.dst.Remote(),
 				srcDepth:  job.srcDepth - 1,
 				dstDepth:  job.dstDepth - 1,
+				ignore:    ignore,
 			})
 		}
 	}
 	return jobs, nil
 }
+
+// readIgnore reads the --ignore-file-name file for the directory in
+// job returning the rules to apply to it and its children.
+func (m *March) readIgnore(job listDirJob, srcList, dstList fs.DirEntries) (*filter.Ignore, error) {
+	fi := filter.GetConfig(m.Ctx)
+	dir, entries := job.srcRemote, srcList
+	if job.noSrc {
+		dir, entries = job.dstRemote, dstList
+	}
+	ignore, err := fi.DirIgnore(m.Ctx, job.ignore, dir, entries)
+	if err != nil {
+		fs.Errorf(dir, "error reading ignore file: %v", err)
+		return nil, fs.CountError(err)
+	}
+	return ignore, nil
+}
@@ -66,12 +66,28 @@ func GetMetadata(ctx context.Context, o ObjectInfo) (metadata Metadata, err erro
 	return do.Metadata(ctx)
 }
 
+// MapMetadata runs the --metadata-mapper program, if set, on the
+// metadata of o which is being copied from srcFs to dstFs and returns
+// the metadata it outputs.
+//
+// If --metadata-mapper isn't in use it returns metadata unchanged.
+func MapMetadata(ctx context.Context, srcFs, dstFs Info, o DirEntry, metadata Metadata) (Metadata, error) {
+	ci := GetConfig(ctx)
+	if len(ci.MetadataMapper) == 0 {
+		return metadata, nil
+	}
+	return metadataMapper(ctx, ci.MetadataMapper, srcFs, dstFs, o, metadata)
+}
+
 // GetMetadataOptions from an ObjectInfo and merge it with any in options
 //
 // If --metadata isn't in use it will return nil
 //
+// If --metadata-mapper is in use then the merged metadata is passed
+// through it as it is being written to dstFs.
+//
 // If the object has no metadata then metadata will be nil
-func GetMetadataOptions(ctx context.Context, o ObjectInfo, options []OpenOption) (metadata Metadata, err error) {
+func GetMetadataOptions(ctx context.Context, dstFs Info, o ObjectInfo, options []OpenOption) (metadata Metadata, err error) {
 	ci := GetConfig(ctx)
 	if !ci.Metadata {
 		return nil, nil
@@ -81,5 +97,5 @@ func GetMetadataOptions(ctx context.Context, o ObjectInfo, options []OpenOption)
 		return nil, err
 	}
 	metadata.MergeOptions(options)
-	return metadata, nil
+	return MapMetadata(ctx, o.Fs(), dstFs, o, metadata)
 }
@@ -0,0 +1,99 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// MetadataMapperIn is the input to the --metadata-mapper program
+//
+// It is passed to the program as JSON on stdin
+type MetadataMapperIn struct {
+	SrcFs     string    `json:"SrcFs"`     // the config string of the source remote
+	SrcFsType string    `json:"SrcFsType"` // the type of the source remote, e.g. "drive"
+	DstFs     string    `json:"DstFs"`     // the config string of the destination remote
+	DstFsType string    `json:"DstFsType"` // the type of the destination remote, e.g. "s3"
+	Remote    string    `json:"Remote"`    // path of the object relative to the root
+	Size      int64     `json:"Size"`      // size of the object or -1 if unknown
+	MimeType  string    `json:"MimeType"`  // MIME type of the object
+	ModTime   time.Time `json:"ModTime"`   // modification time of the object
+	IsDir     bool      `json:"IsDir"`     // set if this is a directory
+	ID        string    `json:"ID"`        // ID of the object if known
+	Metadata  Metadata  `json:"Metadata"`  // the metadata of the source object
+}
+
+// MetadataMapperOut is the output from the --metadata-mapper program
+//
+// It is read from the program as JSON on stdout
+type MetadataMapperOut struct {
+	Metadata Metadata `json:"Metadata"` // the metadata to write to the destination
+}
+
+// fsNameType returns the config string and type of f if possible
+func fsNameType(f Info) (name, typ string) {
+	if f == nil {
+		return "", ""
+	}
+	if do, ok := f.(Fs); ok {
+		return ConfigString(do), Type(do)
+	}
+	return f.Name() + ":" + f.Root(), ""
+}
+
+// metadataMapper runs the --metadata-mapper program on the metadata
+// for o which is being copied from srcFs to dstFs and returns the
+// metadata it outputs.
+func metadataMapper(ctx context.Context, cmdLine SpaceSepList, srcFs, dstFs Info, o DirEntry, metadata Metadata) (newMetadata Metadata, err error) {
+	if len(cmdLine) == 0 {
+		return nil, errors.New("--metadata-mapper is empty")
+	}
+	in := MetadataMapperIn{
+		Remote:   o.Remote(),
+		Size:     o.Size(),
+		ModTime:  o.ModTime(ctx),
+		Metadata: metadata,
+	}
+	in.SrcFs, in.SrcFsType = fsNameType(srcFs)
+	in.DstFs, in.DstFsType = fsNameType(dstFs)
+	switch x := o.(type) {
+	case Directory:
+		in.IsDir = true
+		in.MimeType = MimeTypeDirEntry(ctx, x)
+	case ObjectInfo:
+		in.MimeType = MimeType(ctx, x)
+	}
+	if do, ok := o.(IDer); ok {
+		in.ID = do.ID()
+	}
+	inBytes, err := json.Marshal(&in)
+	if err != nil {
+		return nil, fmt.Errorf("metadata mapper: failed to encode input: %w", err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, cmdLine[0], cmdLine[1:]...)
+	cmd.Stdin = bytes.NewReader(inBytes)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err = cmd.Run()
+	Debugf(o, "Calling metadata mapper %v took %v", cmdLine, time.Since(start))
+	if err != nil {
+		// One does not always get the stderr returned in the wrapped error.
+		if ers := strings.TrimSpace(stderr.String()); ers != "" {
+			Errorf(o, "Metadata mapper stderr: %s", ers)
+		}
+		return nil, fmt.Errorf("metadata mapper: failed to run %q: %w", cmdLine[0], err)
+	}
+	var out MetadataMapperOut
+	err = json.Unmarshal(stdout.Bytes(), &out)
+	if err != nil {
+		return nil, fmt.Errorf("metadata mapper: failed to decode output: %w", err)
+	}
+	return out.Metadata, nil
+}
@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metadataMapperHelperEnv = "RCLONE_TEST_METADATA_MAPPER"
+
+// TestMetadataMapperHelper isn't a real test - it is run as the
+// metadata mapper program by the tests below
+func TestMetadataMapperHelper(t *testing.T) {
+	mode, found := os.LookupEnv(metadataMapperHelperEnv)
+	if !found {
+		t.Skip("Not running as metadata mapper helper")
+	}
+	var in MetadataMapperIn
+	err := json.NewDecoder(os.Stdin).Decode(&in)
+	if err != nil {
+		os.Exit(2)
+	}
+	switch mode {
+	case "fail":
+		_, _ = os.Stderr.WriteString("mapper failed on purpose\n")
+		os.Exit(1)
+	case "garbage":
+		_, _ = os.Stdout.WriteString("not JSON")
+		os.Exit(0)
+	}
+	out := MetadataMapperOut{Metadata: Metadata{}}
+	for k, v := range in.Metadata {
+		switch k {
+		case "uid", "gid":
+			// drop these
+		case "mode":
+			out.Metadata["x-unix-mode"] = v
+		default:
+			out.Metadata[k] = v
+		}
+	}
+	out.Metadata["remote"] = in.Remote
+	out.Metadata["mime-type"] = in.MimeType
+	_ = json.NewEncoder(os.Stdout).Encode(&out)
+	os.Exit(0)
+}
+
+// a minimal ObjectInfo for testing the metadata mapper
+type mapperTestObject struct{}
+
+func (mapperTestObject) String() string                                  { return "potato.txt" }
+func (mapperTestObject) Remote() string                                  { return "dir/potato.txt" }
+func (mapperTestObject) ModTime(context.Context) time.Time               { return time.Unix(1, 0) }
+func (mapperTestObject) Size() int64                                     { return 6 }
+func (mapperTestObject) Fs() Info                                        { return nil }
+func (mapperTestObject) Hash(context.Context, hash.Type) (string, error) { return "", nil }
+func (mapperTestObject) Storable() bool                                  { return true }
+
+func TestMapMetadata(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := AddConfig(ctx)
+	o := mapperTestObject{}
+	in := Metadata{"mode": "100644", "uid": "1000", "gid": "1000", "potato": "jersey"}
+
+	// Without --metadata-mapper metadata is unchanged
+	got, err := MapMetadata(ctx, nil, nil, o, in)
+	require.NoError(t, err)
+	assert.Equal(t, in, got)
+
+	ci.MetadataMapper = SpaceSepList{os.Args[0], "-test.run=^TestMetadataMapperHelper$"}
+
+	t.Setenv(metadataMapperHelperEnv, "ok")
+	got, err = MapMetadata(ctx, nil, nil, o, in)
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{
+		"x-unix-mode": "100644",
+		"potato":      "jersey",
+		"remote":      "dir/potato.txt",
+		"mime-type":   "text/plain; charset=utf-8",
+	}, got)
+
+	t.Setenv(metadataMapperHelperEnv, "fail")
+	_, err = MapMetadata(ctx, nil, nil, o, in)
+	assert.ErrorContains(t, err, "failed to run")
+
+	t.Setenv(metadataMapperHelperEnv, "garbage")
+	_, err = MapMetadata(ctx, nil, nil, o, in)
+	assert.ErrorContains(t, err, "failed to decode output")
+}
@@ -43,6 +43,11 @@ type CheckOpt struct {
 	Match        io.Writer // matching files
 	Differ       io.Writer // differing files
 	Error        io.Writer // files with errors of some kind
+
+	// If either of these are set only a sample of the matching files is checked
+	SampleFraction float64 // check this fraction of the matching files
+	SampleBytes    int64   // check at most this many bytes of the matching files
+	SampleSeed     int64   // seed for choosing the sample
 }
 
 // checkMarch is used to march over two Fses in the same way as
@@ -57,6 +62,7 @@ type checkMarch struct {
 	dstFilesMissing int32
 	matches         int32
 	opt             CheckOpt
+	sample          *checkSample // set if only checking a sample
 }
 
 // report outputs the fileName to out if required and to the combined log
@@ -135,6 +141,42 @@ func (c *checkMarch) checkIdentical(ctx context.Context, dst, src fs.Object) (di
 	return c.opt.Check(ctx, dst, src)
 }
 
+// checkPair checks the matching pair of objects in the background
+func (c *checkMarch) checkPair(ctx context.Context, dst, src fs.Object) {
+	c.wg.Add(1)
+	c.tokens <- struct{}{} // put a token to limit concurrency
+	go func() {
+		defer func() {
+			<-c.tokens // get the token back to free up a slot
+			c.wg.Done()
+		}()
+		differ, noHash, err := c.checkIdentical(ctx, dst, src)
+		if c.sample != nil {
+			c.sample.done(src, differ, err)
+		}
+		if err != nil {
+			fs.Errorf(src, "%v", err)
+			_ = fs.CountError(err)
+			c.report(src, c.opt.Error, '!')
+		} else if differ {
+			atomic.AddInt32(&c.differences, 1)
+			err := errors.New("files differ")
+			// the checkFn has already logged the reason
+			_ = fs.CountError(err)
+			c.report(src, c.opt.Differ, '*')
+		} else {
+			atomic.AddInt32(&c.matches, 1)
+			c.report(src, c.opt.Match, '=')
+			if noHash {
+				atomic.AddInt32(&c.noHashes, 1)
+				fs.Debugf(dst, "OK - could not check hash")
+			} else {
+				fs.Debugf(dst, "OK")
+			}
+		}
+	}()
+}
+
 // Match is called when src and dst are present, so sync src to dst
 func (c *checkMarch) Match(ctx context.Context, dst, src fs.DirEntry) (recurse bool) {
 	switch srcX := src.(type) {
@@ -144,35 +186,11 @@ func (c *checkMarch) Match(ctx context.Context, dst, src fs.DirEntry) (recurse b
 			if SkipDestructive(ctx, src, "check") {
 				return false
 			}
-			c.wg.Add(1)
-			c.tokens <- struct{}{} // put a token to limit concurrency
-			go func() {
-				defer func() {
-					<-c.tokens // get the token back to free up a slot
-					c.wg.Done()
-				}()
-				differ, noHash, err := c.checkIdentical(ctx, dstX, srcX)
-				if err != nil {
-					fs.Errorf(src, "%v", err)
-					_ = fs.CountError(err)
-					c.report(src, c.opt.Error, '!')
-				} else if differ {
-					atomic.AddInt32(&c.differences, 1)
-					err := errors.New("files differ")
-					// the checkFn has already logged the reason
-					_ = fs.CountError(err)
-					c.report(src, c.opt.Differ, '*')
-				} else {
-					atomic.AddInt32(&c.matches, 1)
-					c.report(src, c.opt.Match, '=')
-					if noHash {
-						atomic.AddInt32(&c.noHashes, 1)
-						fs.Debugf(dstX, "OK - could not check hash")
-					} else {
-						fs.Debugf(dstX, "OK")
-					}
-				}
-			}()
+			if c.sample != nil && !c.sample.add(dstX, srcX) {
+				fs.Debugf(src, "Not checking as not in sample")
+				return false
+			}
+			c.checkPair(ctx, dstX, srcX)
 		} else {
 			err := fmt.Errorf("is file on %v but directory on %v", c.opt.Fsrc, c.opt.Fdst)
 			fs.Errorf(src, "%v", err)
@@ -215,6 +233,7 @@ func CheckFn(ctx context.Context, opt *CheckOpt) error {
 	c := &checkMarch{
 		tokens: make(chan struct{}, ci.Checkers),
 		opt:    *opt,
+		sample: newCheckSample(opt),
 	}
 
 	// set up a march over fdst and fsrc
@@ -229,6 +248,12 @@ func CheckFn(ctx context.Context, opt *CheckOpt) error {
 	}
 	fs.Debugf(c.opt.Fdst, "Waiting for checks to finish")
 	err := m.Run(ctx)
+	if c.sample != nil && err == nil {
+		// check the sample chosen within the byte budget
+		for _, pair := range c.sample.chosen() {
+			c.checkPair(ctx, pair.dst, pair.src)
+		}
+	}
 	c.wg.Wait() // wait for background go-routines
 
 	return c.reportResults(ctx, err)
@@ -256,6 +281,9 @@ func (c *checkMarch) reportResults(ctx context.Context, err error) error {
 	if c.matches > 0 {
 		fs.Logf(c.opt.Fdst, "%d matching files", c.matches)
 	}
+	if c.sample != nil {
+		c.sample.report(c.opt.Fdst)
+	}
 	if err != nil {
 		return err
 	}
@@ -269,8 +297,15 @@ func (c *checkMarch) reportResults(ctx context.Context, err error) error {
 }
 
 // Check the files in fsrc and fdst according to Size and hash
+//
+// If only a sample is being checked then the hashes of the files in
+// the sample are recomputed by downloading them from fdst.
 func Check(ctx context.Context, opt *CheckOpt) error {
 	optCopy := *opt
+	if newCheckSample(opt) != nil {
+		optCopy.Check = CheckRecomputeHash
+		return CheckFn(ctx, &optCopy)
+	}
 	optCopy.Check = func(ctx context.Context, dst, src fs.Object) (differ bool, noHash bool, err error) {
 		same, ht, err := CheckHashes(ctx, src, dst)
 		if err != nil {
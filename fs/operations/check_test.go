@@ -214,6 +214,64 @@ func TestCheckSizeOnly(t *testing.T) {
 	TestCheck(t)
 }
 
+func TestCheckSample(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+
+	const n = 40
+	var items []fstest.Item
+	for i := 0; i < n; i++ {
+		remote := fmt.Sprintf("file%02d.txt", i)
+		r.WriteFile(remote, "0123456789", t1)
+		items = append(items, r.WriteObject(ctx, remote, "0123456789", t1))
+	}
+	// corrupt one file keeping the same size
+	items[7] = r.WriteObject(ctx, "file07.txt", "9876543210", t1)
+	r.CheckRemoteItems(t, items...)
+
+	check := func(fraction float64, budget int64, seed int64) (match, differ []string, err error) {
+		var matchBuf, differBuf bytes.Buffer
+		opt := operations.CheckOpt{
+			Fdst:           r.Fremote,
+			Fsrc:           r.Flocal,
+			Match:          &matchBuf,
+			Differ:         &differBuf,
+			SampleFraction: fraction,
+			SampleBytes:    budget,
+			SampleSeed:     seed,
+		}
+		accounting.GlobalStats().ResetCounters()
+		err = operations.Check(ctx, &opt)
+		match = strings.Fields(matchBuf.String())
+		differ = strings.Fields(differBuf.String())
+		sort.Strings(match)
+		sort.Strings(differ)
+		return match, differ, err
+	}
+
+	// Sampling everything finds the corrupted file
+	match, differ, err := check(1, 0, 1)
+	require.Error(t, err)
+	assert.Equal(t, []string{"file07.txt"}, differ)
+	assert.Equal(t, n-1, len(match))
+
+	// A fraction checks some of the files reproducibly
+	match, differ, _ = check(0.25, 0, 42)
+	checked := len(match) + len(differ)
+	assert.True(t, checked > 0 && checked < n, "checked %d", checked)
+	match2, differ2, _ := check(0.25, 0, 42)
+	assert.Equal(t, match, match2)
+	assert.Equal(t, differ, differ2)
+
+	// A different seed chooses different files
+	match3, differ3, _ := check(0.25, 0, 43)
+	assert.NotEqual(t, append(match, differ...), append(match3, differ3...))
+
+	// A byte budget limits the bytes checked
+	match, differ, _ = check(0, 55, 42)
+	assert.Equal(t, 5, len(match)+len(differ))
+}
+
 func TestCheckEqualReaders(t *testing.T) {
 	b65a := make([]byte, 65*1024)
 	b65b := make([]byte, 65*1024)
@@ -0,0 +1,232 @@
+// Sampling for check
+
+package operations
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// checkSamplePair is a pair of matching files which may be checked
+type checkSamplePair struct {
+	dst, src fs.Object
+	score    float64
+}
+
+// checkSampleHeap is a max heap of pairs ordered by score
+type checkSampleHeap []checkSamplePair
+
+func (h checkSampleHeap) Len() int            { return len(h) }
+func (h checkSampleHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h checkSampleHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *checkSampleHeap) Push(x interface{}) { *h = append(*h, x.(checkSamplePair)) }
+func (h *checkSampleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// checkSample chooses a reproducible random sample of the matching
+// files to check.
+//
+// Each file is given a score in [0, 1) from a hash of the seed and
+// its path so the same seed always chooses the same files however
+// the listing is ordered. Files with a score below the fraction are
+// sampled. If there is a byte budget, the files with the lowest
+// scores which fit in it are sampled.
+type checkSample struct {
+	fraction float64 // fraction of the files to sample
+	budget   int64   // maximum bytes to sample or 0 for no limit
+	seed     int64   // seed for the scores
+
+	mu           sync.Mutex
+	total        int64           // number of matching files seen
+	totalBytes   int64           // size of matching files seen
+	pending      checkSampleHeap // files chosen within the budget
+	pendingLen   int64           // size of the files in pending
+	checked      int64           // number of sampled files checked without error
+	checkedBytes int64           // size of the files in checked
+	differ       int64           // number of the checked files which differ
+}
+
+// newCheckSample makes a checkSample from opt or returns nil if
+// sampling isn't in use
+func newCheckSample(opt *CheckOpt) *checkSample {
+	if opt.SampleFraction <= 0 && opt.SampleBytes <= 0 {
+		return nil
+	}
+	s := &checkSample{
+		fraction: opt.SampleFraction,
+		budget:   opt.SampleBytes,
+		seed:     opt.SampleSeed,
+	}
+	if s.fraction <= 0 || s.fraction > 1 {
+		s.fraction = 1
+	}
+	return s
+}
+
+// score returns a number in [0, 1) for remote which depends only on
+// remote and the seed
+func (s *checkSample) score(remote string) float64 {
+	h := sha256.New()
+	_ = binary.Write(h, binary.LittleEndian, s.seed)
+	_, _ = io.WriteString(h, remote)
+	sum := h.Sum(nil)
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
+
+// add considers the matching pair for the sample. It returns true if
+// the pair should be checked now. If there is a budget the pair may
+// be kept to be checked once all the files have been seen.
+func (s *checkSample) add(dst, src fs.Object) (checkNow bool) {
+	score := s.score(src.Remote())
+	size := src.Size()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	if size > 0 {
+		s.totalBytes += size
+	}
+	if score >= s.fraction {
+		return false
+	}
+	if s.budget <= 0 {
+		return true
+	}
+	heap.Push(&s.pending, checkSamplePair{dst: dst, src: src, score: score})
+	if size > 0 {
+		s.pendingLen += size
+	}
+	// Drop the highest scores until we are within the budget
+	for s.pendingLen > s.budget && len(s.pending) > 0 {
+		dropped := heap.Pop(&s.pending).(checkSamplePair)
+		if size := dropped.src.Size(); size > 0 {
+			s.pendingLen -= size
+		}
+	}
+	return false
+}
+
+// chosen returns the pairs kept within the budget to check
+func (s *checkSample) chosen() []checkSamplePair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pairs := s.pending
+	s.pending = nil
+	return pairs
+}
+
+// wilsonUpper returns the upper bound of the 95% Wilson score
+// interval for the proportion of failures given failures out of n
+// trials.
+func wilsonUpper(failures, n int64) float64 {
+	if n <= 0 {
+		return 1
+	}
+	const z = 1.959963984540054 // 97.5% quantile of the normal distribution
+	p := float64(failures) / float64(n)
+	nf := float64(n)
+	centre := p + z*z/(2*nf)
+	spread := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf))
+	return math.Min(1, (centre+spread)/(1+z*z/nf))
+}
+
+// done records the result of checking a sampled pair. Pairs which
+// couldn't be checked because of an error aren't counted.
+func (s *checkSample) done(src fs.Object, differ bool, err error) {
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checked++
+	if size := src.Size(); size > 0 {
+		s.checkedBytes += size
+	}
+	if differ {
+		s.differ++
+	}
+}
+
+// report logs how much was sampled and the confidence in the result
+func (s *checkSample) report(f fs.Info) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs.Logf(f, "Checked a sample of %d of %d matching files, %v of %v (seed %d)", s.checked, s.total, fs.SizeSuffix(s.checkedBytes), fs.SizeSuffix(s.totalBytes), s.seed)
+	if s.checked > 0 {
+		fs.Logf(f, "%d files in the sample differ: estimate %.4g%% of files differ, at most %.4g%% with 95%% confidence",
+			s.differ, 100*float64(s.differ)/float64(s.checked), 100*wilsonUpper(s.differ, s.checked))
+	}
+}
+
+// CheckRecomputeHash checks dst against src by downloading dst and
+// computing its hash, rather than trusting the hash dst reports.
+//
+// If src doesn't have a hash it compares the content of the files
+// instead.
+func CheckRecomputeHash(ctx context.Context, dst, src fs.Object) (differ bool, noHash bool, err error) {
+	ht := src.Fs().Hashes().GetOne()
+	srcHash := ""
+	if ht != hash.None {
+		srcHash, err = src.Hash(ctx, ht)
+		if err != nil {
+			return true, false, fmt.Errorf("failed to read source hash: %w", err)
+		}
+	}
+	if srcHash == "" {
+		differ, err = CheckIdenticalDownload(ctx, dst, src)
+		if err != nil {
+			return true, true, fmt.Errorf("failed to download: %w", err)
+		}
+		return differ, false, nil
+	}
+	ci := fs.GetConfig(ctx)
+	var dstHash string
+	err = Retry(ctx, dst, ci.LowLevelRetries, func() error {
+		dstHash, err = recomputeHash(ctx, dst, ht)
+		return err
+	})
+	if err != nil {
+		return true, false, fmt.Errorf("failed to download: %w", err)
+	}
+	if dstHash != srcHash {
+		fs.Errorf(src, "%v differ when recomputed from download", ht)
+		return true, false, nil
+	}
+	return false, false, nil
+}
+
+// recomputeHash downloads o and returns its hash of type ht
+func recomputeHash(ctx context.Context, o fs.Object, ht hash.Type) (sum string, err error) {
+	in, err := Open(ctx, o)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %q: %w", o, err)
+	}
+	tr := accounting.Stats(ctx).NewTransfer(o)
+	defer func() {
+		tr.Done(ctx, nil) // error handling is done by the caller
+	}()
+	in = tr.Account(ctx, in).WithBuffer() // account and buffer the transfer
+	hasher, err := hash.NewMultiHasherTypes(hash.NewHashSet(ht))
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(hasher, in)
+	if err != nil {
+		return "", err
+	}
+	return hasher.Sums()[ht], nil
+}
@@ -1,7 +1,11 @@
 package operations_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -16,8 +20,11 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-// Check flag satisfies the interface
-var _ pflag.Value = (*operations.DeduplicateMode)(nil)
+// Check flags satisfy the interface
+var (
+	_ pflag.Value = (*operations.DeduplicateMode)(nil)
+	_ pflag.Value = (*operations.DedupeAction)(nil)
+)
 
 func skipIfCantDedupe(t *testing.T, f fs.Fs) {
 	if !f.Features().DuplicateFiles {
@@ -246,6 +253,89 @@ func TestDeduplicateRename(t *testing.T) {
 	}))
 }
 
+// dedupeContent runs DeduplicateContent on the remote then the local
+// and returns the groups found
+func dedupeContent(t *testing.T, r *fstest.Run, mode operations.DeduplicateMode, action operations.DedupeAction) (groups []operations.DedupeGroup) {
+	var out bytes.Buffer
+	err := operations.DeduplicateContent(context.Background(), []fs.Fs{r.Fremote, r.Flocal}, &operations.DedupeContentOpt{
+		Mode:   mode,
+		Action: action,
+		Out:    &out,
+	})
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(out.Bytes(), &groups), out.String())
+	return groups
+}
+
+// groupPaths returns the paths and actions of the files in group
+func groupPaths(group operations.DedupeGroup) (paths []string) {
+	for _, file := range group.Files {
+		paths = append(paths, file.Path+" "+file.Action)
+	}
+	return paths
+}
+
+func TestDeduplicateContent(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	if r.Fremote.Hashes().Overlap(r.Flocal.Hashes()).GetOne() == hash.None {
+		t.Skip("Can't run this test without a common hash")
+	}
+	skipIfNoModTime(t, r.Fremote)
+
+	file1 := r.WriteObject(ctx, "a/one.txt", "hello world", t1)
+	file2 := r.WriteObject(ctx, "b/one-copy.txt", "hello world", t3)
+	file3 := r.WriteObject(ctx, "c/other.txt", "other world", t1)
+	file4 := r.WriteObject(ctx, "empty.txt", "", t1)
+	r.CheckRemoteItems(t, file1, file2, file3, file4)
+	file5 := r.WriteFile("x/one.txt", "hello world", t2)
+	file6 := r.WriteFile("empty.txt", "", t1)
+	r.CheckLocalItems(t, file5, file6)
+
+	groups := dedupeContent(t, r, operations.DeduplicateList, operations.DedupeActionDelete)
+	require.Equal(t, 1, len(groups))
+	assert.Equal(t, int64(11), groups[0].Size)
+	assert.Equal(t, []string{"a/one.txt ", "b/one-copy.txt ", "x/one.txt "}, groupPaths(groups[0]))
+	r.CheckRemoteItems(t, file1, file2, file3, file4)
+	r.CheckLocalItems(t, file5, file6)
+
+	groups = dedupeContent(t, r, operations.DeduplicateNewest, operations.DedupeActionDelete)
+	require.Equal(t, 1, len(groups))
+	assert.Equal(t, []string{"a/one.txt delete", "b/one-copy.txt keep", "x/one.txt delete"}, groupPaths(groups[0]))
+	r.CheckRemoteItems(t, file2, file3, file4)
+	r.CheckLocalItems(t, file6)
+
+	groups = dedupeContent(t, r, operations.DeduplicateFirst, operations.DedupeActionDelete)
+	assert.Equal(t, 0, len(groups))
+}
+
+func TestDeduplicateContentLink(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	if r.Fremote.Features().HardLink == nil || r.Fremote.Name() != r.Flocal.Name() {
+		t.Skip("Can't run this test without hard links")
+	}
+
+	file1 := r.WriteObject(ctx, "one.txt", "hello world", t1)
+	file2 := r.WriteObject(ctx, "dir/one-copy.txt", "hello world", t2)
+	r.CheckRemoteItems(t, file1, file2)
+	file3 := r.WriteFile("one.txt", "hello world", t3)
+	r.CheckLocalItems(t, file3)
+
+	groups := dedupeContent(t, r, operations.DeduplicateOldest, operations.DedupeActionLink)
+	require.Equal(t, 1, len(groups))
+	assert.Equal(t, []string{"dir/one-copy.txt hardlink", "one.txt keep", "one.txt hardlink"}, groupPaths(groups[0]))
+
+	// All the files should now be the same file
+	keep, err := os.Stat(filepath.Join(r.Fremote.Root(), "one.txt"))
+	require.NoError(t, err)
+	for _, name := range []string{filepath.Join(r.Fremote.Root(), "dir", "one-copy.txt"), filepath.Join(r.Flocal.Root(), "one.txt")} {
+		fi, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(keep, fi), name)
+	}
+}
+
 // This should really be a unit test, but the test framework there
 // doesn't have enough tools to make it easy
 func TestMergeDirs(t *testing.T) {
@@ -0,0 +1,407 @@
+// dedupe by content - finds files with identical content anywhere in one or more remotes
+
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// DedupeAction is what DeduplicateContent does with the extra copies
+// of a file
+type DedupeAction int
+
+// Dedupe actions
+const (
+	DedupeActionDelete DedupeAction = iota // delete the extra copies
+	DedupeActionLink                       // replace the extra copies with hard links or shortcuts
+)
+
+func (x DedupeAction) String() string {
+	switch x {
+	case DedupeActionDelete:
+		return "delete"
+	case DedupeActionLink:
+		return "link"
+	}
+	return "unknown"
+}
+
+// Set a DedupeAction from a string
+func (x *DedupeAction) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "delete":
+		*x = DedupeActionDelete
+	case "link":
+		*x = DedupeActionLink
+	default:
+		return fmt.Errorf("unknown action for dedupe %q", s)
+	}
+	return nil
+}
+
+// Type of the value
+func (x *DedupeAction) Type() string {
+	return "string"
+}
+
+// DedupeContentOpt configures DeduplicateContent
+type DedupeContentOpt struct {
+	Mode     DeduplicateMode // which copy to keep - first, newest or oldest - or list or skip to change nothing
+	Action   DedupeAction    // what to do with the extra copies
+	HashType hash.Type       // hash to compare or hash.None to choose one common to all the remotes
+	Out      io.Writer       // the groups of duplicates are written here as JSON
+}
+
+// DedupeGroup is a group of files with identical content as
+// reported by DeduplicateContent
+type DedupeGroup struct {
+	Size   int64
+	Hashes map[string]string
+	Files  []DedupeFile
+}
+
+// DedupeFile is one of the files in a DedupeGroup
+type DedupeFile struct {
+	Fs      string    // the remote the file was found in
+	Path    string    // the path of the file relative to Fs
+	ModTime time.Time // the modification time of the file
+	ID      string    `json:",omitempty"`
+	Action  string    `json:",omitempty"` // keep, delete, hardlink or shortcut if any action was taken
+	Error   string    `json:",omitempty"` // the error if the action failed
+}
+
+// dedupeEntry is a file found by DeduplicateContent
+type dedupeEntry struct {
+	f     fs.Fs     // the Fs the file was found in
+	index int       // index of f in the remotes passed in
+	o     fs.Object // the file
+	hash  string    // the hash of the file once read
+}
+
+// dedupeCommonHash returns the hash type to use for fses
+func dedupeCommonHash(fses []fs.Fs, ht hash.Type) (hash.Type, error) {
+	common := hash.Supported()
+	for _, f := range fses {
+		common = common.Overlap(f.Hashes())
+	}
+	if ht != hash.None {
+		if !common.Contains(ht) {
+			return hash.None, fmt.Errorf("not all the remotes support the %v hash", ht)
+		}
+		return ht, nil
+	}
+	ht = common.GetOne()
+	if ht == hash.None {
+		return hash.None, errors.New("the remotes have no hash in common - try wrapping them in a hasher remote")
+	}
+	return ht, nil
+}
+
+// dedupeReadHashes reads the hash of type ht for each entry in
+// entries using --checkers goroutines. Entries which couldn't be
+// hashed are left with an empty hash.
+func dedupeReadHashes(ctx context.Context, ht hash.Type, entries []*dedupeEntry) {
+	ci := fs.GetConfig(ctx)
+	in := make(chan *dedupeEntry, ci.Checkers)
+	var wg sync.WaitGroup
+	for i := 0; i < ci.Checkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range in {
+				tr := accounting.Stats(ctx).NewCheckingTransfer(e.o, "hashing")
+				sum, err := e.o.Hash(ctx, ht)
+				if err != nil {
+					fs.Errorf(e.o, "Failed to hash: %v", err)
+				} else if sum == "" {
+					fs.Debugf(e.o, "No %v hash so ignoring", ht)
+				}
+				e.hash = sum
+				tr.Done(ctx, err)
+			}
+		}()
+	}
+	for _, e := range entries {
+		in <- e
+	}
+	close(in)
+	wg.Wait()
+}
+
+// sortDedupeEntries sorts entries by the order of their remotes then
+// by path, so the first one doesn't depend on the listing order.
+//
+// Some remotes allow files with the same path so these are sorted by
+// ID if they have one.
+func sortDedupeEntries(entries []*dedupeEntry) {
+	id := func(o fs.Object) string {
+		if do, ok := o.(fs.IDer); ok {
+			return do.ID()
+		}
+		return ""
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.index != b.index {
+			return a.index < b.index
+		}
+		if a.o.Remote() != b.o.Remote() {
+			return a.o.Remote() < b.o.Remote()
+		}
+		return id(a.o) < id(b.o)
+	})
+}
+
+// dedupeRemoveSameID removes entries which are the same file as an
+// earlier entry as deleting them would delete the original too.
+func dedupeRemoveSameID(entries []*dedupeEntry) []*dedupeEntry {
+	seen := make(map[string]struct{}, len(entries))
+	newEntries := entries[:0]
+	for _, e := range entries {
+		if do, ok := e.o.(fs.IDer); ok {
+			if ID := do.ID(); ID != "" {
+				key := e.f.Name() + ":" + ID
+				if _, found := seen[key]; found {
+					fs.Logf(e.o, "Ignoring as it is the same file as another in the listing and deleting would lead to data loss")
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+		}
+		newEntries = append(newEntries, e)
+	}
+	return newEntries
+}
+
+// dedupeLink replaces the duplicate e with a link to keep, returning
+// the kind of link made.
+func dedupeLink(ctx context.Context, keep, e *dedupeEntry) (action string, err error) {
+	if keep.f.Name() != e.f.Name() {
+		return "", errors.New("can't link to a file on a different remote")
+	}
+	features := e.f.Features()
+	if features.HardLink == nil && features.Shortcut == nil {
+		return "", errors.New("remote doesn't support hard links or shortcuts")
+	}
+	if features.HardLink != nil {
+		if SkipDestructive(ctx, e.o, "replace with hard link") {
+			return "hardlink", nil
+		}
+		_, err = features.HardLink(ctx, keep.o, e.o.Remote())
+		if err == nil {
+			fs.Infof(e.o, "Replaced with hard link to %v", keep.o)
+			return "hardlink", nil
+		}
+		if !errors.Is(err, fs.ErrorCantHardLink) || features.Shortcut == nil {
+			return "", err
+		}
+	}
+	if SkipDestructive(ctx, e.o, "replace with shortcut") {
+		return "shortcut", nil
+	}
+	_, err = features.Shortcut(ctx, keep.o, e.o.Remote())
+	if err != nil {
+		return "", err
+	}
+	fs.Infof(e.o, "Replaced with shortcut to %v", keep.o)
+	return "shortcut", nil
+}
+
+// dedupeGroup chooses the file to keep from the group of duplicates
+// according to mode and acts on the rest.
+//
+// dupes must be sorted with sortDedupeEntries so that the file kept
+// is the same whatever order they were listed in.
+func dedupeGroup(ctx context.Context, opt *DedupeContentOpt, ht hash.Type, dupes []*dedupeEntry) (group DedupeGroup, err error) {
+	keep := -1
+	switch opt.Mode {
+	case DeduplicateFirst:
+		keep = 0
+	case DeduplicateNewest, DeduplicateOldest:
+		keep = 0
+		for i, e := range dupes {
+			modTime, keepModTime := e.o.ModTime(ctx), dupes[keep].o.ModTime(ctx)
+			if (opt.Mode == DeduplicateNewest && modTime.After(keepModTime)) ||
+				(opt.Mode == DeduplicateOldest && modTime.Before(keepModTime)) {
+				keep = i
+			}
+		}
+	}
+	group = DedupeGroup{
+		Size:   dupes[0].o.Size(),
+		Hashes: map[string]string{ht.String(): dupes[0].hash},
+		Files:  make([]DedupeFile, len(dupes)),
+	}
+	count := 0
+	for i, e := range dupes {
+		file := &group.Files[i]
+		file.Fs = fs.ConfigString(e.f)
+		file.Path = e.o.Remote()
+		file.ModTime = e.o.ModTime(ctx)
+		if do, ok := e.o.(fs.IDer); ok {
+			file.ID = do.ID()
+		}
+		if keep < 0 {
+			continue
+		}
+		if i == keep {
+			file.Action = "keep"
+			continue
+		}
+		var actionErr error
+		switch opt.Action {
+		case DedupeActionDelete:
+			file.Action = "delete"
+			actionErr = DeleteFile(ctx, e.o)
+		case DedupeActionLink:
+			file.Action, actionErr = dedupeLink(ctx, dupes[keep], e)
+		}
+		if actionErr != nil {
+			fs.Errorf(e.o, "Failed to %v duplicate: %v", opt.Action, actionErr)
+			file.Error = actionErr.Error()
+			err = actionErr
+		} else {
+			count++
+		}
+	}
+	if count > 0 {
+		fs.Logf(dupes[keep].o, "Kept and dealt with %d/%d identical copies (%v %s)", count, len(dupes)-1, ht, dupes[0].hash)
+	}
+	return group, err
+}
+
+// DeduplicateContent finds files with identical content anywhere in
+// the remotes in fses by comparing their size and then their hash.
+//
+// Each group of identical files is written to opt.Out as JSON and
+// then, depending on opt.Mode, all but one file in each group are
+// deleted or replaced with links according to opt.Action.
+//
+// Empty files and files of unknown size are ignored.
+func DeduplicateContent(ctx context.Context, fses []fs.Fs, opt *DedupeContentOpt) error {
+	ci := fs.GetConfig(ctx)
+	switch opt.Mode {
+	case DeduplicateList, DeduplicateSkip, DeduplicateFirst, DeduplicateNewest, DeduplicateOldest:
+	default:
+		return fmt.Errorf("can't use dedupe mode %v when deduping by content", opt.Mode)
+	}
+	ht, err := dedupeCommonHash(fses, opt.HashType)
+	if err != nil {
+		return err
+	}
+	for _, f := range fses {
+		fs.Infof(f, "Looking for files with duplicate content using %v hashes in %v mode.", ht, opt.Mode)
+	}
+
+	// Find the files grouped by size, ignoring any seen more than
+	// once because the remotes overlap
+	bySize := map[int64][]*dedupeEntry{}
+	seen := map[string]struct{}{}
+	for i, f := range fses {
+		err := walk.ListR(ctx, f, "", false, ci.MaxDepth, walk.ListObjects, func(entries fs.DirEntries) error {
+			entries.ForObject(func(o fs.Object) {
+				size := o.Size()
+				if size <= 0 {
+					return
+				}
+				key := f.Name() + ":" + path.Join(f.Root(), o.Remote())
+				if _, found := seen[key]; found {
+					return
+				}
+				seen[key] = struct{}{}
+				bySize[size] = append(bySize[size], &dedupeEntry{f: f, index: i, o: o})
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only hash the files which share their size with another
+	var toHash []*dedupeEntry
+	for size, entries := range bySize {
+		if len(entries) <= 1 {
+			delete(bySize, size)
+			continue
+		}
+		toHash = append(toHash, entries...)
+	}
+	dedupeReadHashes(ctx, ht, toHash)
+
+	// Group the files by size and hash
+	type groupKey struct {
+		size int64
+		hash string
+	}
+	groups := map[groupKey][]*dedupeEntry{}
+	var keys []groupKey
+	for _, e := range toHash {
+		if e.hash == "" {
+			continue
+		}
+		key := groupKey{size: e.o.Size(), hash: e.hash}
+		if _, found := groups[key]; !found {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], e)
+	}
+
+	// Deal with the largest groups of bytes first
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].size != keys[j].size {
+			return keys[i].size > keys[j].size
+		}
+		return keys[i].hash < keys[j].hash
+	})
+
+	var errCount int
+	var lastErr error
+	_, _ = io.WriteString(opt.Out, "[\n")
+	first := true
+	for _, key := range keys {
+		dupes := groups[key]
+		sortDedupeEntries(dupes)
+		dupes = dedupeRemoveSameID(dupes)
+		if len(dupes) <= 1 {
+			continue
+		}
+		fs.Infof(dupes[0].o, "Found %d files with %v %s", len(dupes), ht, key.hash)
+		group, err := dedupeGroup(ctx, opt, ht, dupes)
+		if err != nil {
+			errCount++
+			lastErr = err
+		}
+		out, err := json.Marshal(group)
+		if err != nil {
+			return fmt.Errorf("failed to marshal duplicates: %w", err)
+		}
+		if !first {
+			_, _ = io.WriteString(opt.Out, ",\n")
+		}
+		first = false
+		_, _ = opt.Out.Write(out)
+	}
+	if !first {
+		_, _ = io.WriteString(opt.Out, "\n")
+	}
+	_, _ = io.WriteString(opt.Out, "]\n")
+	if errCount > 0 {
+		return fmt.Errorf("failed to dedupe %d groups of files: last error: %w", errCount, lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+)
+
+// Error classes recorded in the --error-report
+//
+// These mirror the way accounting classifies errors when deciding
+// whether to retry a sync. Errors which aren't known to be worth
+// retrying are unknown.
+const (
+	ErrorClassRetriable = "retriable"
+	ErrorClassFatal     = "fatal"
+	ErrorClassNoRetry   = "no-retry"
+	ErrorClassUnknown   = "unknown"
+)
+
+// Operations recorded in the --error-report
+const (
+	ErrorReportCopy   = "copy"
+	ErrorReportMove   = "move"
+	ErrorReportDelete = "delete"
+)
+
+// ErrorReportEntry describes a single object which failed
+type ErrorReportEntry struct {
+	Operation string    `json:"operation"`           // one of copy, move, delete
+	Src       string    `json:"src,omitempty"`       // source remote, empty for deletes
+	Dst       string    `json:"dst"`                 // destination remote
+	Remote    string    `json:"remote"`              // path of the object relative to Src (or Dst for deletes)
+	DstRemote string    `json:"dstRemote,omitempty"` // path relative to Dst if different from Remote
+	Class     string    `json:"class"`               // one of retriable, fatal, no-retry, unknown
+	Error     string    `json:"error"`               // text of the last error
+	Attempts  int       `json:"attempts"`            // number of times the operation failed
+	Time      time.Time `json:"time"`                // time of the last failure
+}
+
+// errorReportKey identifies an entry in the report
+type errorReportKey struct {
+	operation string
+	src       string
+	dst       string
+	remote    string
+	dstRemote string
+}
+
+// ErrorReport accumulates objects which failed for --error-report
+type ErrorReport struct {
+	mu      sync.Mutex
+	entries map[errorReportKey]*ErrorReportEntry
+}
+
+// NewErrorReport makes a new empty ErrorReport
+func NewErrorReport() *ErrorReport {
+	return &ErrorReport{
+		entries: make(map[errorReportKey]*ErrorReportEntry),
+	}
+}
+
+// globalErrorReport is the report used for --error-report
+var globalErrorReport = NewErrorReport()
+
+// GlobalErrorReport returns the report used for --error-report
+func GlobalErrorReport() *ErrorReport {
+	return globalErrorReport
+}
+
+// ErrorClass returns the class of err as used in the --error-report
+func ErrorClass(err error) string {
+	switch {
+	case fserrors.IsFatalError(err):
+		return ErrorClassFatal
+	case fserrors.IsNoRetryError(err):
+		return ErrorClassNoRetry
+	case fserrors.IsRetryError(err), fserrors.ShouldRetry(err):
+		return ErrorClassRetriable
+	default:
+		return ErrorClassUnknown
+	}
+}
+
+// fsString returns the config string of f or "" if f is nil
+func fsString(f fs.Info) string {
+	if f == nil {
+		return ""
+	}
+	if ff, ok := f.(fs.Fs); ok {
+		return fs.ConfigStringFull(ff)
+	}
+	return f.Name() + ":" + f.Root()
+}
+
+// Record records the outcome of op on the object.
+//
+// If err is nil then any previous failure of the object is forgotten
+// as it has now succeeded, otherwise its attempts are incremented.
+func (r *ErrorReport) Record(op string, fsrc, fdst fs.Info, remote, dstRemote string, err error) {
+	if dstRemote == remote {
+		dstRemote = ""
+	}
+	key := errorReportKey{
+		operation: op,
+		src:       fsString(fsrc),
+		dst:       fsString(fdst),
+		remote:    remote,
+		dstRemote: dstRemote,
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		delete(r.entries, key)
+		return
+	}
+	entry, ok := r.entries[key]
+	if !ok {
+		entry = &ErrorReportEntry{
+			Operation: op,
+			Src:       key.src,
+			Dst:       key.dst,
+			Remote:    remote,
+			DstRemote: dstRemote,
+		}
+		r.entries[key] = entry
+	}
+	entry.Class = ErrorClass(err)
+	entry.Error = err.Error()
+	entry.Attempts++
+	entry.Time = time.Now()
+}
+
+// Entries returns the entries in the report sorted by destination,
+// source and path
+func (r *ErrorReport) Entries() []ErrorReportEntry {
+	r.mu.Lock()
+	entries := make([]ErrorReportEntry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, *entry)
+	}
+	r.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Dst != b.Dst {
+			return a.Dst < b.Dst
+		}
+		if a.Src != b.Src {
+			return a.Src < b.Src
+		}
+		if a.Remote != b.Remote {
+			return a.Remote < b.Remote
+		}
+		return a.Operation < b.Operation
+	})
+	return entries
+}
+
+// WriteFile writes the report as JSON to the file name given
+func (r *ErrorReport) WriteFile(name string) error {
+	out, err := json.MarshalIndent(r.Entries(), "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode error report: %w", err)
+	}
+	out = append(out, '\n')
+	err = os.WriteFile(name, out, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to write error report: %w", err)
+	}
+	return nil
+}
+
+// ReadErrorReport reads a report written by --error-report
+func ReadErrorReport(name string) (entries []ErrorReportEntry, err error) {
+	in, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error report: %w", err)
+	}
+	err = json.Unmarshal(in, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode error report %q: %w", name, err)
+	}
+	return entries, nil
+}
+
+// RecordError records the outcome of op on the object in the
+// --error-report if it is in use.
+//
+// remote is the path of the object in fsrc and dstRemote its path in
+// fdst. For deletes fsrc should be nil and remote the path in fdst.
+func RecordError(ctx context.Context, op string, fsrc, fdst fs.Info, remote, dstRemote string, err error) {
+	ci := fs.GetConfig(ctx)
+	if ci.ErrorReport == "" {
+		return
+	}
+	globalErrorReport.Record(op, fsrc, fdst, remote, dstRemote, err)
+}
@@ -0,0 +1,67 @@
+package operations
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorClass(t *testing.T) {
+	err := errors.New("potato")
+	assert.Equal(t, ErrorClassUnknown, ErrorClass(err))
+	assert.Equal(t, ErrorClassRetriable, ErrorClass(fserrors.RetryError(err)))
+	assert.Equal(t, ErrorClassRetriable, ErrorClass(io.ErrUnexpectedEOF))
+	assert.Equal(t, ErrorClassFatal, ErrorClass(fserrors.FatalError(err)))
+	assert.Equal(t, ErrorClassNoRetry, ErrorClass(fserrors.NoRetryError(err)))
+}
+
+func TestErrorReport(t *testing.T) {
+	r := NewErrorReport()
+	assert.Equal(t, []ErrorReportEntry{}, r.Entries())
+
+	// Record a failure twice and another once
+	r.Record(ErrorReportCopy, nil, nil, "file1", "file1", errors.New("first"))
+	r.Record(ErrorReportCopy, nil, nil, "file1", "file1", fserrors.NoRetryError(errors.New("second")))
+	r.Record(ErrorReportCopy, nil, nil, "file2", "file2.renamed", errors.New("boom"))
+	r.Record(ErrorReportDelete, nil, nil, "file3", "", fserrors.FatalError(errors.New("fatal")))
+
+	entries := r.Entries()
+	require.Equal(t, 3, len(entries))
+	assert.Equal(t, "file1", entries[0].Remote)
+	assert.Equal(t, "", entries[0].DstRemote)
+	assert.Equal(t, 2, entries[0].Attempts)
+	assert.Equal(t, "second", entries[0].Error)
+	assert.Equal(t, ErrorClassNoRetry, entries[0].Class)
+	assert.Equal(t, "file2", entries[1].Remote)
+	assert.Equal(t, "file2.renamed", entries[1].DstRemote)
+	assert.Equal(t, 1, entries[1].Attempts)
+	assert.Equal(t, ErrorClassUnknown, entries[1].Class)
+	assert.Equal(t, ErrorReportDelete, entries[2].Operation)
+	assert.Equal(t, ErrorClassFatal, entries[2].Class)
+
+	// A success removes the entry
+	r.Record(ErrorReportCopy, nil, nil, "file1", "file1", nil)
+	entries = r.Entries()
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, "file2", entries[0].Remote)
+
+	// Round trip through a file
+	name := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, r.WriteFile(name))
+	got, err := ReadErrorReport(name)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(got))
+	for i := range got {
+		assert.True(t, got[i].Time.Equal(entries[i].Time))
+		got[i].Time = entries[i].Time
+	}
+	assert.Equal(t, entries, got)
+
+	_, err = ReadErrorReport(filepath.Join(t.TempDir(), "notfound.json"))
+	assert.Error(t, err)
+}
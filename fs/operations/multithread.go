@@ -9,6 +9,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/lib/ranges"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -64,13 +65,23 @@ func doMultiThreadCopy(ctx context.Context, f fs.Fs, src fs.Object) bool {
 		return false
 	}
 	// ...if --multi-thread-streams not in use and source and
-	// destination are both local
-	if !ci.MultiThreadSet && dstFeatures.IsLocal && src.Fs().Features().IsLocal {
+	// destination are both local, unless the source has holes to
+	// keep
+	if !ci.MultiThreadSet && dstFeatures.IsLocal && src.Fs().Features().IsLocal && len(srcHoles(ctx, src)) == 0 {
 		return false
 	}
 	return true
 }
 
+// srcHoles returns the ranges of src which hold no data if it can
+// find them
+func srcHoles(ctx context.Context, src fs.Object) []ranges.Range {
+	if do, ok := src.(fs.HoleFinder); ok {
+		return do.Holes(ctx)
+	}
+	return nil
+}
+
 // state for a multi-thread copy
 type multiThreadCopyState struct {
 	ctx      context.Context
@@ -210,6 +221,12 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 	if err != nil {
 		return nil, fmt.Errorf("multipart copy: failed to open destination: %w", err)
 	}
+	// Tell the destination where the holes in the source are
+	if do, ok := mc.wc.(fs.HoleWriterAt); ok {
+		if holes := srcHoles(ctx, src); len(holes) > 0 {
+			do.SetHoles(holes)
+		}
+	}
 
 	fs.Debugf(src, "Starting multi-thread copy with %d parts of size %v", mc.streams, fs.SizeSuffix(mc.partSize))
 	for stream := 0; stream < mc.streams; stream++ {
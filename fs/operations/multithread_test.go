@@ -9,6 +9,7 @@ import (
 	"github.com/rclone/rclone/fstest/mockfs"
 	"github.com/rclone/rclone/fstest/mockobject"
 	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/lib/ranges"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fstest"
@@ -16,6 +17,16 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// holeObject is an object with a hole at the start
+type holeObject struct {
+	fs.Object
+}
+
+// Holes returns the hole at the start
+func (o holeObject) Holes(ctx context.Context) []ranges.Range {
+	return []ranges.Range{{Pos: 0, Size: 10}}
+}
+
 func TestDoMultiThreadCopy(t *testing.T) {
 	ctx := context.Background()
 	ci := fs.GetConfig(ctx)
@@ -71,6 +82,7 @@ func TestDoMultiThreadCopy(t *testing.T) {
 	assert.True(t, doMultiThreadCopy(ctx, f, src))
 	ci.MultiThreadSet = false
 	assert.False(t, doMultiThreadCopy(ctx, f, src))
+	assert.True(t, doMultiThreadCopy(ctx, f, holeObject{src}))
 	srcFs.Features().IsLocal = false
 	assert.True(t, doMultiThreadCopy(ctx, f, src))
 	srcFs.Features().IsLocal = true
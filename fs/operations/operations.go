@@ -54,7 +54,7 @@ import (
 //
 // If an error is returned it will return equal as false
 func CheckHashes(ctx context.Context, src fs.ObjectInfo, dst fs.Object) (equal bool, ht hash.Type, err error) {
-	common := src.Fs().Hashes().Overlap(dst.Fs().Hashes())
+	common := hashesWithStored(ctx, src.Fs()).Overlap(hashesWithStored(ctx, dst.Fs()))
 	// fs.Debugf(nil, "Shared hashes: %v", common)
 	if common.Count() == 0 {
 		return true, hash.None, nil
@@ -72,7 +72,7 @@ func checkHashes(ctx context.Context, src fs.ObjectInfo, dst fs.Object, ht hash.
 	g, ctx := errgroup.WithContext(ctx)
 	var srcErr, dstErr error
 	g.Go(func() (err error) {
-		srcHash, srcErr = src.Hash(ctx, ht)
+		srcHash, srcErr = objectHash(ctx, src, ht)
 		if srcErr != nil {
 			return srcErr
 		}
@@ -83,7 +83,7 @@ func checkHashes(ctx context.Context, src fs.ObjectInfo, dst fs.Object, ht hash.
 		return nil
 	})
 	g.Go(func() (err error) {
-		dstHash, dstErr = dst.Hash(ctx, ht)
+		dstHash, dstErr = objectHash(ctx, dst, ht)
 		if dstErr != nil {
 			return dstErr
 		}
@@ -133,6 +133,9 @@ func checkHashes(ctx context.Context, src fs.ObjectInfo, dst fs.Object, ht hash.
 // considered to be equal.  In this case the mtime on the dst is
 // updated if --checksum is not set.
 //
+// If the files are considered equal and --metadata is set then the
+// metadata on the dst is updated if it differs from the src.
+//
 // Otherwise the file is considered to be not equal including if there
 // were errors reading info.
 func Equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object) bool {
@@ -157,6 +160,7 @@ type equalOpt struct {
 	checkSum          bool // if set check checksum+size instead of modtime+size
 	updateModTime     bool // if set update the modtime if hashes identical and checking with modtime+size
 	forceModTimeMatch bool // if set assume modtimes match
+	updateMetadata    bool // if set update the metadata if it differs and the data is identical
 }
 
 // default set of options for equal()
@@ -167,6 +171,7 @@ func defaultEqualOpt(ctx context.Context) equalOpt {
 		checkSum:          ci.CheckSum,
 		updateModTime:     !ci.NoUpdateModTime,
 		forceModTimeMatch: false,
+		updateMetadata:    ci.Metadata,
 	}
 }
 
@@ -180,6 +185,18 @@ func logModTimeUpload(dst fs.Object) {
 }
 
 func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt) bool {
+	if !equalData(ctx, src, dst, opt) {
+		return false
+	}
+	if opt.updateMetadata {
+		return updateMetadata(ctx, src, dst)
+	}
+	return true
+}
+
+// equalData checks whether the data in src and dst is the same,
+// updating the modtime on dst if required
+func equalData(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt) bool {
 	ci := fs.GetConfig(ctx)
 	if sizeDiffers(ctx, src, dst) {
 		fs.Debugf(src, "Sizes differ (src %d vs dst %d)", src.Size(), dst.Size())
@@ -281,6 +298,106 @@ func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt)
 	return true
 }
 
+// metadataDiffers returns true if any of the metadata in src is
+// different in dst.
+//
+// The time based keys are ignored as the modification time is
+// handled separately and the access and birth times are not stable.
+func metadataDiffers(src, dst fs.Metadata) bool {
+	for k, v := range src {
+		switch k {
+		case "mtime", "atime", "btime":
+			continue
+		}
+		if dstV, ok := dst[k]; !ok || dstV != v {
+			return true
+		}
+	}
+	return false
+}
+
+// updateMetadata updates the metadata on dst from src if it differs
+//
+// It does this with SetMetadata if available, otherwise by server-side
+// copying dst onto itself with the new metadata.
+//
+// It returns false if the metadata couldn't be updated and the file
+// should be transferred again.
+func updateMetadata(ctx context.Context, src fs.ObjectInfo, dst fs.Object) bool {
+	ci := fs.GetConfig(ctx)
+	features := dst.Fs().Features()
+	if !features.ReadMetadata || !features.WriteMetadata {
+		return true
+	}
+	srcMeta, err := fs.GetMetadata(ctx, src)
+	if err != nil {
+		fs.Errorf(src, "Failed to read metadata: %v", err)
+		return true
+	}
+	srcMeta.Merge(ci.MetadataSet)
+	srcMeta, err = fs.MapMetadata(ctx, src.Fs(), dst.Fs(), src, srcMeta)
+	if err != nil {
+		err = fs.CountError(err)
+		fs.Errorf(src, "Failed to map metadata: %v", err)
+		return true
+	}
+	if len(srcMeta) == 0 {
+		return true
+	}
+	dstMeta, err := fs.GetMetadata(ctx, dst)
+	if err != nil {
+		fs.Errorf(dst, "Failed to read metadata: %v", err)
+		return true
+	}
+	if !metadataDiffers(srcMeta, dstMeta) {
+		return true
+	}
+	fs.Debugf(src, "Metadata differs")
+	if SkipDestructive(ctx, src, "update metadata") {
+		return true
+	}
+	// Error if objects are treated as immutable
+	if ci.Immutable {
+		fs.Errorf(dst, "Metadata mismatch between immutable objects")
+		return false
+	}
+	if do, ok := dst.(fs.SetMetadataer); ok {
+		err = do.SetMetadata(ctx, srcMeta)
+		if err == nil {
+			fs.Infof(src, "Updated metadata in destination")
+			return true
+		}
+		if !errors.Is(err, fs.ErrorNotImplemented) {
+			err = fs.CountError(err)
+			fs.Errorf(dst, "Failed to set metadata: %v", err)
+			return true
+		}
+	}
+	// Fall back to a server-side copy of dst onto itself using the
+	// --metadata-set mechanism to supply the new metadata
+	fdst, ok := dst.Fs().(fs.Fs)
+	if doCopy := features.Copy; ok && doCopy != nil {
+		newCtx, newCi := fs.AddConfig(ctx)
+		newCi.MetadataSet = srcMeta
+		var newDst fs.Object
+		newDst, err = doCopy(newCtx, dst, dst.Remote())
+		if err == nil {
+			// Not all backends apply the metadata on a server-side copy
+			dstMeta, err = fs.GetMetadata(ctx, newDst)
+			if err == nil && metadataDiffers(srcMeta, dstMeta) {
+				err = errors.New("metadata not applied")
+			}
+		}
+		if err == nil {
+			fs.Infof(src, "Updated metadata in destination using server-side copy")
+			return true
+		}
+		fs.Debugf(fdst, "Server-side copy to update metadata failed: %v", err)
+	}
+	fs.Infof(dst, "src and dst identical but can't set metadata without re-uploading")
+	return false
+}
+
 // Used to remove a failed copy
 //
 // Returns whether the file was successfully removed or not
@@ -349,6 +466,8 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 	tries := 0
 	doUpdate := dst != nil
 	hashType, hashOption := CommonHash(ctx, f, src.Fs())
+	storeHT := storeHashType(ctx, f)
+	var storeHasher *hash.MultiHasher
 
 	if dst != nil {
 		remote = dst.Remote()
@@ -410,6 +529,8 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 		}
 		// If can't server-side copy, do it manually
 		if errors.Is(err, fs.ErrorCantCopy) {
+			// Abort the attempt if it stalls
+			ctx, stopWatching := tr.WatchStall(ctx)
 			// Remove partial files on premature exit
 			var atexitRemovePartial atexit.FnHandle
 			if !inplace {
@@ -466,33 +587,45 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 						dst, err = Rcat(ctx, f, remotePartial, in0, src.ModTime(ctx), meta)
 						newDst = dst
 					} else {
-						in := tr.Account(ctx, in0).WithBuffer() // account and buffer the transfer
-						var wrappedSrc fs.ObjectInfo = src
-						// We try to pass the original object if possible
-						if src.Remote() != remotePartial {
-							wrappedSrc = fs.NewOverrideRemote(src, remotePartial)
-						}
-						options := []fs.OpenOption{hashOption}
-						for _, option := range ci.UploadHeaders {
-							options = append(options, option)
-						}
-						if ci.MetadataSet != nil {
-							options = append(options, fs.MetadataOption(ci.MetadataSet))
-						}
-						if doUpdate && inplace {
-							err = dst.Update(ctx, in, wrappedSrc, options...)
-						} else {
-							dst, err = f.Put(ctx, in, wrappedSrc, options...)
+						if storeHT != hash.None {
+							// Calculate the hash to store while streaming
+							storeHasher, err = hash.NewMultiHasherTypes(hash.NewHashSet(storeHT))
+							if err == nil {
+								in0 = hashReadCloser(in0, storeHasher)
+							}
 						}
-						if doUpdate {
-							actionTaken = "Copied (replaced existing)"
+						if err != nil {
+							_ = in0.Close()
+							err = fmt.Errorf("failed to make %v hasher to store: %w", storeHT, err)
 						} else {
-							actionTaken = "Copied (new)"
-						}
-						closeErr := in.Close()
-						if err == nil {
-							newDst = dst
-							err = closeErr
+							in := tr.Account(ctx, in0).WithBuffer() // account and buffer the transfer
+							var wrappedSrc fs.ObjectInfo = src
+							// We try to pass the original object if possible
+							if src.Remote() != remotePartial {
+								wrappedSrc = fs.NewOverrideRemote(src, remotePartial)
+							}
+							options := []fs.OpenOption{hashOption}
+							for _, option := range ci.UploadHeaders {
+								options = append(options, option)
+							}
+							if ci.MetadataSet != nil {
+								options = append(options, fs.MetadataOption(ci.MetadataSet))
+							}
+							if doUpdate && inplace {
+								err = dst.Update(ctx, in, wrappedSrc, options...)
+							} else {
+								dst, err = f.Put(ctx, in, wrappedSrc, options...)
+							}
+							if doUpdate {
+								actionTaken = "Copied (replaced existing)"
+							} else {
+								actionTaken = "Copied (new)"
+							}
+							closeErr := in.Close()
+							if err == nil {
+								newDst = dst
+								err = closeErr
+							}
 						}
 					}
 				}
@@ -500,7 +633,10 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 			if !inplace {
 				atexit.Unregister(atexitRemovePartial)
 			}
-
+			stopWatching()
+			if err != nil && tr.Stalled() {
+				err = accounting.ErrorStalledRetry
+			}
 		}
 		tries++
 		if tries >= maxTries {
@@ -575,6 +711,28 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 		actionTaken = fmt.Sprintf("%s to: %s", actionTaken, newDst.String())
 	}
 	fs.Infof(src, "%s%s", actionTaken, fs.LogValueHide("size", fs.SizeSuffix(src.Size())))
+
+	// Store the source hash if the destination can't provide it
+	if storeHT != hash.None && newDst != nil {
+		var sum string
+		// Only use the streamed hash if it saw the whole file exactly once
+		if storeHasher != nil && storeHasher.Size() == src.Size() {
+			sum, _ = storeHasher.SumString(storeHT, false)
+		} else if hashesWithStored(ctx, src.Fs()).Contains(storeHT) {
+			sum, err = objectHash(ctx, src, storeHT)
+			if err != nil {
+				fs.Errorf(src, "Failed to read %v hash to store: %v", storeHT, err)
+				sum, err = "", nil
+			}
+		}
+		if sum != "" {
+			err = storeHash(ctx, f, newDst, storeHT, sum)
+			if err != nil {
+				err = fs.CountError(err)
+				fs.Errorf(newDst, "%v", err)
+			}
+		}
+	}
 	return newDst, err
 }
 
@@ -628,6 +786,14 @@ func Move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 		in.DryRun(src.Size())
 		return newDst, nil
 	}
+	// Take any hash stored with --store-hash along with the file
+	if moved := readMovedHash(ctx, src); moved != nil {
+		defer func() {
+			if err == nil {
+				moved.move(ctx, fdst, newDst)
+			}
+		}()
+	}
 	// See if we have Move available
 	if doMove := fdst.Features().Move; doMove != nil && (SameConfig(src.Fs(), fdst) || (SameRemoteType(src.Fs(), fdst) && (fdst.Features().ServerSideAcrossConfigs || ci.ServerSideAcrossConfigs))) {
 		// Delete destination if it exists and is not the same file as src (could be same file while seemingly different if the remote is case insensitive)
@@ -743,6 +909,10 @@ func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs
 		err = fs.CountError(err)
 	} else if !skip {
 		fs.Infof(dst, actioned)
+		// MoveBackupDir takes the stored hash with the file
+		if f, ok := dst.Fs().(fs.Fs); ok && backupDir == nil {
+			removeStoredHash(ctx, f, dst.Remote())
+		}
 	}
 	return err
 }
@@ -772,6 +942,7 @@ func DeleteFilesWithBackupDir(ctx context.Context, toBeDeleted fs.ObjectsChan, b
 			defer wg.Done()
 			for dst := range toBeDeleted {
 				err := DeleteFileWithBackupDir(ctx, dst, backupDir)
+				RecordError(ctx, ErrorReportDelete, nil, dst.Fs(), dst.Remote(), "", err)
 				if err != nil {
 					atomic.AddInt32(&errorCount, 1)
 					if fserrors.IsFatalError(err) {
@@ -1213,6 +1384,83 @@ func Mkdir(ctx context.Context, f fs.Fs, dir string) error {
 	return nil
 }
 
+// canCopyDirModTime returns true if the directory modification time
+// can be copied from fsrc to fdst.
+//
+// Only sources with real directories are used as otherwise the
+// modification time is just the current time.
+func canCopyDirModTime(ctx context.Context, fdst, fsrc fs.Fs) bool {
+	ci := fs.GetConfig(ctx)
+	return !ci.NoUpdateModTime && fdst.Features().DirSetModTime != nil && fsrc.Features().CanHaveEmptyDirectories
+}
+
+// canCopyDirMetadata returns true if the directory metadata can be
+// copied from fsrc to fdst.
+func canCopyDirMetadata(ctx context.Context, fdst, fsrc fs.Fs) bool {
+	ci := fs.GetConfig(ctx)
+	return ci.Metadata && fdst.Features().DirSetMetadata != nil && fsrc.Features().DirMetadata != nil
+}
+
+// CanCopyDirMetadata returns true if CopyDirMetadata can copy
+// anything from directories in fsrc to directories in fdst.
+func CanCopyDirMetadata(ctx context.Context, fdst, fsrc fs.Fs) bool {
+	return canCopyDirModTime(ctx, fdst, fsrc) || canCopyDirMetadata(ctx, fdst, fsrc)
+}
+
+// CopyDirMetadata makes the directory dir in fdst match the directory
+// src in fsrc by setting its modification time and, if --metadata is
+// in use, its metadata.
+//
+// It only sets what both fsrc and fdst support and doesn't set the
+// modification time if --no-update-modtime is in use. It does nothing
+// if dir doesn't exist or --dry-run is in use. This should be called
+// after the contents of dir have been written as writing them may
+// change its modification time.
+func CopyDirMetadata(ctx context.Context, fdst fs.Fs, dir string, fsrc fs.Fs, src fs.Directory) (err error) {
+	ci := fs.GetConfig(ctx)
+	if ci.DryRun {
+		return nil
+	}
+	logName := fs.LogDirName(fdst, dir)
+	defer func() {
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			fs.Debugf(logName, "Not setting directory metadata as directory not found")
+			err = nil
+		} else if err != nil {
+			err = fs.CountError(err)
+			fs.Errorf(logName, "Failed to set directory metadata: %v", err)
+		}
+	}()
+	if canCopyDirMetadata(ctx, fdst, fsrc) {
+		metadata, err := fsrc.Features().DirMetadata(ctx, src.Remote())
+		if err != nil {
+			fs.Errorf(src, "Failed to read directory metadata: %v", err)
+		} else {
+			metadata.Merge(ci.MetadataSet)
+			metadata, err = fs.MapMetadata(ctx, fsrc, fdst, src, metadata)
+			if err != nil {
+				return err
+			}
+			if len(metadata) > 0 {
+				err = fdst.Features().DirSetMetadata(ctx, dir, metadata)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if !canCopyDirModTime(ctx, fdst, fsrc) {
+		return nil
+	}
+	modTime := src.ModTime(ctx)
+	err = fdst.Features().DirSetModTime(ctx, dir, modTime)
+	if err != nil {
+		return err
+	}
+	fs.Debugf(logName, "Set directory modification time to %v", modTime)
+	return nil
+}
+
 // TryRmdir removes a container but not if not empty.  It doesn't
 // count errors but may return one.
 func TryRmdir(ctx context.Context, f fs.Fs, dir string) error {
@@ -1327,6 +1575,23 @@ type readCloser struct {
 	io.Closer
 }
 
+// recoverReadCloser is a readCloser which passes stall recovery on
+// to the reader it was made from
+type recoverReadCloser struct {
+	readCloser
+	accounting.StallRecoverer
+}
+
+// hashReadCloser returns in with the data read from it written to
+// hasher, keeping the ability of in to recover from stalls
+func hashReadCloser(in io.ReadCloser, hasher io.Writer) io.ReadCloser {
+	rc := readCloser{Reader: io.TeeReader(in, hasher), Closer: in}
+	if recoverer, ok := in.(accounting.StallRecoverer); ok {
+		return recoverReadCloser{readCloser: rc, StallRecoverer: recoverer}
+	}
+	return rc
+}
+
 // Cat any files to the io.Writer
 //
 // if offset == 0 it will be ignored
@@ -1422,6 +1687,7 @@ func Rcat(ctx context.Context, fdst fs.Fs, dstFileName string, in io.ReadCloser,
 	compare := func(dst fs.Object) error {
 		var sums map[hash.Type]string
 		opt := defaultEqualOpt(ctx)
+		opt.updateMetadata = false
 		if hasher != nil {
 			// force --checksum on if we have hashes
 			opt.checkSum = true
@@ -1597,11 +1863,8 @@ func GetCompareDest(ctx context.Context) (CompareDest []fs.Fs, err error) {
 // be copied
 //
 // Returns True if src is in --compare-dest
-func compareDest(ctx context.Context, dst, src fs.Object, CompareDest fs.Fs) (NoNeedTransfer bool, err error) {
-	var remote string
-	if dst == nil {
-		remote = src.Remote()
-	} else {
+func compareDest(ctx context.Context, dst, src fs.Object, remote string, CompareDest fs.Fs) (NoNeedTransfer bool, err error) {
+	if dst != nil {
 		remote = dst.Remote()
 	}
 	CompareDestFile, err := CompareDest.NewObject(ctx, remote)
@@ -1615,6 +1878,7 @@ func compareDest(ctx context.Context, dst, src fs.Object, CompareDest fs.Fs) (No
 	}
 	opt := defaultEqualOpt(ctx)
 	opt.updateModTime = false
+	opt.updateMetadata = false
 	if equal(ctx, src, CompareDestFile, opt) {
 		fs.Debugf(src, "Destination found in --compare-dest, skipping")
 		return true, nil
@@ -1645,11 +1909,8 @@ func GetCopyDest(ctx context.Context, fdst fs.Fs) (CopyDest []fs.Fs, err error)
 // be copied
 //
 // Returns True if src was copied from --copy-dest
-func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
-	var remote string
-	if dst == nil {
-		remote = src.Remote()
-	} else {
+func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, remote string, CopyDest, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
+	if dst != nil {
 		remote = dst.Remote()
 	}
 	CopyDestFile, err := CopyDest.NewObject(ctx, remote)
@@ -1663,6 +1924,7 @@ func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, bac
 	}
 	opt := defaultEqualOpt(ctx)
 	opt.updateModTime = false
+	opt.updateMetadata = false
 	if equal(ctx, src, CopyDestFile, opt) {
 		if dst == nil || !Equal(ctx, src, dst) {
 			if dst != nil && backupDir != nil {
@@ -1688,22 +1950,100 @@ func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, bac
 	return false, nil
 }
 
-// CompareOrCopyDest checks --compare-dest and --copy-dest to see if src
-// does not need to be copied
+// GetLinkDest sets up --link-dest
+func GetLinkDest(ctx context.Context, fdst fs.Fs) (LinkDest []fs.Fs, err error) {
+	ci := fs.GetConfig(ctx)
+	LinkDest, err = cache.GetArr(ctx, ci.LinkDest)
+	if err != nil {
+		return nil, fserrors.FatalError(fmt.Errorf("failed to make fs for --link-dest %q: %w", ci.LinkDest, err))
+	}
+	if !SameConfigArr(fdst, LinkDest) {
+		return nil, fserrors.FatalError(errors.New("parameter to --link-dest has to be on the same remote as destination"))
+	}
+	if fdst.Features().HardLink == nil {
+		return nil, fserrors.FatalError(errors.New("can't use --link-dest on a remote which doesn't support hard links"))
+	}
+	return LinkDest, nil
+}
+
+// linkDest checks to see if src is the same as the file in LinkDest
+// and if so makes a hard link to it in fdst instead of copying src.
+//
+// Returns true if src does not need to be copied
+func linkDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, remote string, LinkDest, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
+	if dst != nil {
+		remote = dst.Remote()
+	}
+	LinkDestFile, err := LinkDest.NewObject(ctx, remote)
+	switch err {
+	case fs.ErrorObjectNotFound:
+		return false, nil
+	case nil:
+		break
+	default:
+		return false, err
+	}
+	opt := defaultEqualOpt(ctx)
+	opt.updateModTime = false
+	opt.updateMetadata = false
+	if !equal(ctx, src, LinkDestFile, opt) {
+		fs.Debugf(src, "Destination not found in --link-dest")
+		return false, nil
+	}
+	if dst != nil && Equal(ctx, src, dst) {
+		fs.Debugf(src, "Unchanged skipping")
+		return true, nil
+	}
+	if SkipDestructive(ctx, src, "hard link from --link-dest") {
+		return true, nil
+	}
+	if dst != nil && backupDir != nil {
+		err = MoveBackupDir(ctx, backupDir, dst)
+		if err != nil {
+			return false, fmt.Errorf("moving to --backup-dir failed: %w", err)
+		}
+		// If successful zero out the dstObj as it is no longer there
+		dst = nil
+	}
+	_, err = fdst.Features().HardLink(ctx, LinkDestFile, remote)
+	if err == nil {
+		fs.Infof(src, "Hard linked from --link-dest")
+		return true, nil
+	}
+	fs.Debugf(src, "Destination found in --link-dest, can't hard link so copying it: %v", err)
+	_, err = Copy(ctx, fdst, dst, remote, LinkDestFile)
+	if err != nil {
+		fs.Errorf(src, "Destination found in --link-dest, error copying")
+		return false, nil
+	}
+	return true, nil
+}
+
+// CompareOrCopyDest checks --compare-dest, --copy-dest and
+// --link-dest to see if src does not need to be copied
+//
+// remote is the name src would be copied to in fdst if dst is nil.
 //
 // Returns True if src does not need to be copied
-func CompareOrCopyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CompareOrCopyDest []fs.Fs, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
+func CompareOrCopyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, remote string, CompareOrCopyDest []fs.Fs, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
 	ci := fs.GetConfig(ctx)
 	if len(ci.CompareDest) > 0 {
 		for _, compareF := range CompareOrCopyDest {
-			NoNeedTransfer, err := compareDest(ctx, dst, src, compareF)
+			NoNeedTransfer, err := compareDest(ctx, dst, src, remote, compareF)
 			if NoNeedTransfer || err != nil {
 				return NoNeedTransfer, err
 			}
 		}
 	} else if len(ci.CopyDest) > 0 {
 		for _, copyF := range CompareOrCopyDest {
-			NoNeedTransfer, err := copyDest(ctx, fdst, dst, src, copyF, backupDir)
+			NoNeedTransfer, err := copyDest(ctx, fdst, dst, src, remote, copyF, backupDir)
+			if NoNeedTransfer || err != nil {
+				return NoNeedTransfer, err
+			}
+		}
+	} else if len(ci.LinkDest) > 0 {
+		for _, linkF := range CompareOrCopyDest {
+			NoNeedTransfer, err := linkDest(ctx, fdst, dst, src, remote, linkF, backupDir)
 			if NoNeedTransfer || err != nil {
 				return NoNeedTransfer, err
 			}
@@ -1885,9 +2225,10 @@ func CopyURLToWriter(ctx context.Context, url string, out io.Writer) (err error)
 func BackupDir(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, srcFileName string) (backupDir fs.Fs, err error) {
 	ci := fs.GetConfig(ctx)
 	if ci.BackupDir != "" {
-		backupDir, err = cache.Get(ctx, ci.BackupDir)
+		backupDirPath := backupDirPath(ctx)
+		backupDir, err = cache.Get(ctx, backupDirPath)
 		if err != nil {
-			return nil, fserrors.FatalError(fmt.Errorf("failed to make fs for --backup-dir %q: %w", ci.BackupDir, err))
+			return nil, fserrors.FatalError(fmt.Errorf("failed to make fs for --backup-dir %q: %w", backupDirPath, err))
 		}
 		if !SameConfig(fdst, backupDir) {
 			return nil, fserrors.FatalError(errors.New("parameter to --backup-dir has to be on the same remote as destination"))
@@ -1945,6 +2286,15 @@ func moveOrCopyFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName str
 		Op = Copy
 	}
 
+	// Record the result in the --error-report if required
+	defer func() {
+		op := ErrorReportMove
+		if cp {
+			op = ErrorReportCopy
+		}
+		RecordError(ctx, op, fsrc, fdst, srcFileName, dstFileName, err)
+	}()
+
 	// Find src object
 	srcObj, err := fsrc.NewObject(ctx, srcFileName)
 	if err != nil {
@@ -2006,10 +2356,15 @@ func moveOrCopyFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName str
 		if err != nil {
 			return err
 		}
+	} else if len(ci.LinkDest) > 0 {
+		copyDestDir, err = GetLinkDest(ctx, fdst)
+		if err != nil {
+			return err
+		}
 	}
 	needTransfer := NeedTransfer(ctx, dstObj, srcObj)
 	if needTransfer {
-		NoNeedTransfer, err := CompareOrCopyDest(ctx, fdst, dstObj, srcObj, copyDestDir, backupDir)
+		NoNeedTransfer, err := CompareOrCopyDest(ctx, fdst, dstObj, srcObj, dstFileName, copyDestDir, backupDir)
 		if err != nil {
 			return err
 		}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest/mockobject"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,3 +42,66 @@ func TestSizeDiffers(t *testing.T) {
 		assert.Equal(t, test.want, got, fmt.Sprintf("ignoreSize=%v, srcSize=%v, dstSize=%v", test.ignoreSize, test.srcSize, test.dstSize))
 	}
 }
+
+func TestWilsonUpper(t *testing.T) {
+	assert.Equal(t, 1.0, wilsonUpper(0, 0))
+	assert.InDelta(t, 0.00128, wilsonUpper(0, 3000), 0.00001)
+	assert.InDelta(t, 0.0183, wilsonUpper(10, 1000), 0.0001)
+	assert.Equal(t, 1.0, wilsonUpper(5, 5))
+}
+
+func TestCheckSampleScore(t *testing.T) {
+	s := &checkSample{seed: 1}
+	a := s.score("a")
+	assert.True(t, a >= 0 && a < 1)
+	assert.Equal(t, a, s.score("a"))
+	assert.NotEqual(t, a, s.score("b"))
+	s.seed = 2
+	assert.NotEqual(t, a, s.score("a"))
+}
+
+func TestBackupDirPathSnapshot(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.BackupDir = "remote:backup"
+	assert.Equal(t, "remote:backup", backupDirPath(ctx))
+
+	ci.BackupSnapshot = true
+	assert.Regexp(t, `^remote:backup/\d{4}-\d\d-\d\dT\d{6}Z$`, backupDirPath(ctx))
+
+	// The snapshot is fixed by the context for each run
+	start := time.Date(2024, 3, 5, 6, 7, 8, 0, time.UTC)
+	runCtx := WithBackupSnapshot(ctx, start)
+	assert.Equal(t, "remote:backup/2024-03-05T060708Z", backupDirPath(runCtx))
+	otherCtx := WithBackupSnapshot(ctx, start.Add(time.Hour))
+	assert.Equal(t, "remote:backup/2024-03-05T070708Z", backupDirPath(otherCtx))
+	assert.Equal(t, "remote:backup/2024-03-05T060708Z", backupDirPath(runCtx))
+}
+
+// idObject is a mock object with an ID
+type idObject struct {
+	mockobject.Object
+	id string
+}
+
+func (o idObject) ID() string { return o.id }
+
+func TestSortDedupeEntries(t *testing.T) {
+	entry := func(index int, remote, id string) *dedupeEntry {
+		return &dedupeEntry{index: index, o: idObject{Object: mockobject.New(remote), id: id}}
+	}
+	want := []*dedupeEntry{
+		entry(0, "a", "2"),
+		entry(0, "b", "1"),
+		entry(0, "b", "3"),
+		entry(1, "a", "0"),
+	}
+	// Every listing order gives the same result
+	for _, order := range [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}, {2, 3, 0, 1}, {1, 0, 3, 2}} {
+		entries := make([]*dedupeEntry, len(order))
+		for i, j := range order {
+			entries[i] = want[j]
+		}
+		sortDedupeEntries(entries)
+		assert.Equal(t, want, entries, order)
+	}
+}
@@ -1860,6 +1860,54 @@ func TestRcatSizeMetadata(t *testing.T) {
 	}
 }
 
+func TestEqualUpdateMetadata(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	if !r.Flocal.Features().UserMetadata || !r.Fremote.Features().UserMetadata {
+		t.Skip("Skipping as src or dst doesn't support user metadata")
+	}
+
+	file1 := r.WriteFile("file1", "metadata only", t1)
+	r.WriteObject(ctx, "file1", "metadata only", t1)
+	r.CheckRemoteItems(t, file1)
+
+	src, err := r.Flocal.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	setter, ok := src.(fs.SetMetadataer)
+	if !ok {
+		t.Skip("Skipping as src doesn't support SetMetadata")
+	}
+	require.NoError(t, setter.SetMetadata(ctx, fs.Metadata{"potato": "jersey"}))
+
+	getDstMeta := func() fs.Metadata {
+		dst, err := r.Fremote.NewObject(ctx, "file1")
+		require.NoError(t, err)
+		meta, err := fs.GetMetadata(ctx, dst)
+		require.NoError(t, err)
+		return meta
+	}
+
+	// Without --metadata the metadata is left alone
+	dst, err := r.Fremote.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	assert.True(t, operations.Equal(ctx, src, dst))
+	assert.Equal(t, "", getDstMeta()["potato"])
+
+	// With --metadata and --dry-run the metadata is left alone
+	ci.Metadata = true
+	ci.DryRun = true
+	assert.True(t, operations.Equal(ctx, src, dst))
+	assert.Equal(t, "", getDstMeta()["potato"])
+
+	// With --metadata the metadata is updated without a transfer
+	ci.DryRun = false
+	assert.True(t, operations.Equal(ctx, src, dst))
+	assert.Equal(t, "jersey", getDstMeta()["potato"])
+	assert.False(t, operations.NeedTransfer(ctx, dst, src))
+	r.CheckRemoteItems(t, file1)
+}
+
 func TestCopyFileMaxTransfer(t *testing.T) {
 	ctx := context.Background()
 	ctx, ci := fs.AddConfig(ctx)
@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/fserrors"
 )
 
@@ -22,6 +23,11 @@ type ReOpen struct {
 	tries    int             // number of retries we've had so far in this stream
 	err      error           // if this is set then Read/Close calls will return it
 	opened   bool            // if set then rc is valid and needs closing
+
+	stallMu   sync.Mutex // mutex to protect the below which are used while Read is blocked
+	cancel    func()     // cancel the context rc was opened with
+	reading   bool       // set while a Read of rc is in progress
+	cancelled bool       // set if RecoverStall has cancelled rc
 }
 
 var (
@@ -113,7 +119,18 @@ func (h *ReOpen) open() error {
 	if h.tries > h.maxTries {
 		h.err = errorTooManyTries
 	} else {
-		h.rc, h.err = h.src.Open(h.ctx, opts...)
+		// Open with a context we can cancel if the stream stalls
+		ctx, cancel := context.WithCancel(h.ctx)
+		h.rc, h.err = h.src.Open(ctx, opts...)
+		h.stallMu.Lock()
+		if h.err != nil {
+			cancel()
+			h.cancel = nil
+		} else {
+			h.cancel = cancel
+		}
+		h.cancelled = false
+		h.stallMu.Unlock()
 	}
 	if h.err != nil {
 		if h.tries > 1 {
@@ -133,15 +150,19 @@ func (h *ReOpen) Read(p []byte) (n int, err error) {
 		// return a previous error if there is one
 		return n, h.err
 	}
+	h.setReading(true)
 	n, err = h.rc.Read(p)
+	stalled := h.setReading(false)
+	if stalled && err == nil {
+		err = accounting.ErrorStalled
+	}
 	if err != nil {
 		h.err = err
 	}
 	h.read += int64(n)
-	if err != nil && err != io.EOF && !fserrors.IsNoLowLevelRetryError(err) {
+	if err != nil && err != io.EOF && !fserrors.IsNoLowLevelRetryError(err) && h.ctx.Err() == nil {
 		// close underlying stream
-		h.opened = false
-		_ = h.rc.Close()
+		h.close()
 		// reopen stream, clearing error if successful
 		fs.Debugf(h.src, "Reopening on read failure after %d bytes: retry %d/%d: %v", h.read, h.tries, h.maxTries, err)
 		if h.open() == nil {
@@ -151,6 +172,45 @@ func (h *ReOpen) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
+// setReading marks whether a Read of the underlying stream is in
+// progress, returning whether the stream was cancelled by
+// RecoverStall.
+func (h *ReOpen) setReading(reading bool) (cancelled bool) {
+	h.stallMu.Lock()
+	defer h.stallMu.Unlock()
+	h.reading = reading
+	return h.cancelled
+}
+
+// RecoverStall is called by accounting if the transfer has stalled.
+//
+// If a Read of the underlying stream is blocked then it cancels the
+// stream so the Read reopens it at the current offset, and returns
+// true. Otherwise it returns false as the stall must be elsewhere.
+func (h *ReOpen) RecoverStall() bool {
+	h.stallMu.Lock()
+	defer h.stallMu.Unlock()
+	if !h.reading || h.cancelled || h.cancel == nil {
+		return false
+	}
+	h.cancelled = true
+	h.cancel()
+	return true
+}
+
+// close the underlying stream - call with lock held
+func (h *ReOpen) close() error {
+	h.opened = false
+	err := h.rc.Close()
+	h.stallMu.Lock()
+	if h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+	h.stallMu.Unlock()
+	return err
+}
+
 // Close the stream
 func (h *ReOpen) Close() error {
 	h.mu.Lock()
@@ -158,7 +218,6 @@ func (h *ReOpen) Close() error {
 	if !h.opened {
 		return errorFileClosed
 	}
-	h.opened = false
 	h.err = errorFileClosed
-	return h.rc.Close()
+	return h.close()
 }
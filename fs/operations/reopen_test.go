@@ -5,16 +5,22 @@ import (
 	"errors"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fstest/mockobject"
 	"github.com/rclone/rclone/lib/readers"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-// check interface
-var _ io.ReadCloser = (*ReOpen)(nil)
+// check interfaces
+var (
+	_ io.ReadCloser             = (*ReOpen)(nil)
+	_ accounting.StallRecoverer = (*ReOpen)(nil)
+)
 
 var errorTestError = errors.New("test error")
 
@@ -147,3 +153,79 @@ func TestReOpen(t *testing.T) {
 		})
 	}
 }
+
+// this is a wrapper for a mockobject whose first Open stalls after
+// reading stallAfter bytes until its context is cancelled
+type reOpenStallObject struct {
+	fs.Object
+	stallAfter int64
+	opens      int
+}
+
+// stallReader blocks until ctx is cancelled
+type stallReader struct {
+	ctx context.Context
+}
+
+func (r stallReader) Read(p []byte) (int, error) {
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+func (o *reOpenStallObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	rc, err := o.Object.Open(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	o.opens++
+	if o.opens == 1 {
+		r := io.MultiReader(&io.LimitedReader{R: rc, N: o.stallAfter}, stallReader{ctx: ctx})
+		rc = readCloser{Reader: r, Closer: rc}
+	}
+	return rc, nil
+}
+
+func TestReOpenRecoverStall(t *testing.T) {
+	contents := []byte("0123456789")
+	src := &reOpenStallObject{
+		Object:     mockobject.New("potato").WithContent(contents, mockobject.SeekModeNone),
+		stallAfter: 3,
+	}
+	rc, err := NewReOpen(context.Background(), src, 10)
+	require.NoError(t, err)
+	h := rc.(*ReOpen)
+
+	// Not reading yet so can't recover
+	assert.False(t, h.RecoverStall())
+
+	type result struct {
+		got []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		got, err := io.ReadAll(h)
+		done <- result{got: got, err: err}
+	}()
+
+	// Wait for the read to block then recover it
+	recovered := false
+	for i := 0; i < 1000 && !recovered; i++ {
+		recovered = h.RecoverStall()
+		if !recovered {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	require.True(t, recovered)
+
+	select {
+	case res := <-done:
+		require.NoError(t, res.err)
+		assert.Equal(t, contents, res.got)
+	case <-time.After(10 * time.Second):
+		t.Fatal("read didn't recover from stall")
+	}
+	assert.Equal(t, 2, src.opens)
+	assert.NoError(t, h.Close())
+}
@@ -0,0 +1,56 @@
+// Timestamped backup directories for --backup-snapshot
+
+package operations
+
+import (
+	"context"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fspath"
+)
+
+// BackupSnapshotFormat is the time format used to name the
+// directories made in --backup-dir when --backup-snapshot is set.
+//
+// It sorts in time order and doesn't contain any characters which
+// are invalid on common file systems.
+const BackupSnapshotFormat = "2006-01-02T150405Z"
+
+// BackupSnapshotName returns the name of the --backup-snapshot
+// directory for a run started at t
+func BackupSnapshotName(t time.Time) string {
+	return t.UTC().Format(BackupSnapshotFormat)
+}
+
+// ParseBackupSnapshotName returns the time the run which made the
+// --backup-snapshot directory called name started
+func ParseBackupSnapshotName(name string) (time.Time, error) {
+	return time.Parse(BackupSnapshotFormat, name)
+}
+
+// backupSnapshotKey is the context key for the --backup-snapshot
+// directory name
+type backupSnapshotKey struct{}
+
+// WithBackupSnapshot returns a copy of ctx in which --backup-snapshot
+// uses the directory for a run started at t, so all the backups made
+// with it go into the same one.
+func WithBackupSnapshot(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, backupSnapshotKey{}, BackupSnapshotName(t))
+}
+
+// backupDirPath returns the path to use for --backup-dir. If
+// --backup-snapshot is set this is the snapshot directory inside it
+// set with WithBackupSnapshot, or one for now if there isn't one.
+func backupDirPath(ctx context.Context) string {
+	ci := fs.GetConfig(ctx)
+	if !ci.BackupSnapshot {
+		return ci.BackupDir
+	}
+	name, ok := ctx.Value(backupSnapshotKey{}).(string)
+	if !ok {
+		name = BackupSnapshotName(time.Now())
+	}
+	return fspath.JoinRootPath(ci.BackupDir, name)
+}
@@ -0,0 +1,186 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+)
+
+// maxStoredHashSize is the largest sidecar file we will read a hash from
+const maxStoredHashSize = 1024
+
+// storeHashType returns the hash type which should be stored for
+// objects on f because of --store-hash, or hash.None if there isn't
+// one or f supports it natively.
+func storeHashType(ctx context.Context, f fs.Info) hash.Type {
+	ci := fs.GetConfig(ctx)
+	ht := ci.StoreHash
+	if ht == hash.None || f.Hashes().Contains(ht) {
+		return hash.None
+	}
+	return ht
+}
+
+// hashesWithStored returns the hashes f supports including any
+// stored with --store-hash
+func hashesWithStored(ctx context.Context, f fs.Info) hash.Set {
+	hashes := f.Hashes()
+	if ht := storeHashType(ctx, f); ht != hash.None {
+		hashes.Add(ht)
+	}
+	return hashes
+}
+
+// storeHash stores sum as the hash of type ht for dst on f
+//
+// It is stored as user metadata if the object can set it, otherwise
+// in a sidecar file next to the object.
+func storeHash(ctx context.Context, f fs.Fs, dst fs.Object, ht hash.Type, sum string) error {
+	if SkipDestructive(ctx, dst, "store hash") {
+		return nil
+	}
+	if f.Features().UserMetadata {
+		if do, ok := dst.(fs.SetMetadataer); ok {
+			err := do.SetMetadata(ctx, fs.Metadata{fs.StoredHashKey(ht): sum})
+			if err == nil {
+				fs.Debugf(dst, "Stored %v hash in metadata", ht)
+				return nil
+			}
+			if !errors.Is(err, fs.ErrorNotImplemented) {
+				return fmt.Errorf("failed to store %v hash in metadata: %w", ht, err)
+			}
+		}
+	}
+	remote := fs.StoredHashSidecar(dst.Remote(), ht)
+	info := object.NewStaticObjectInfo(remote, dst.ModTime(ctx), int64(len(sum)), true, nil, f)
+	_, err := f.Put(ctx, strings.NewReader(sum), info)
+	if err != nil {
+		return fmt.Errorf("failed to store %v hash in %q: %w", ht, remote, err)
+	}
+	fs.Debugf(dst, "Stored %v hash in %q", ht, remote)
+	return nil
+}
+
+// StoredHash returns the hash of type ht stored for o with
+// --store-hash or "" if there isn't one.
+//
+// The hash is read from the user metadata if present otherwise from
+// the sidecar file. A sidecar file with a different modification time
+// to o is ignored as o has been changed since it was written.
+func StoredHash(ctx context.Context, o fs.Object, ht hash.Type) (sum string, err error) {
+	f := o.Fs()
+	if f.Features().ReadMetadata {
+		metadata, err := fs.GetMetadata(ctx, o)
+		if err != nil {
+			return "", err
+		}
+		if sum, found := metadata[fs.StoredHashKey(ht)]; found {
+			return sum, nil
+		}
+	}
+	fdst, ok := f.(fs.Fs)
+	if !ok {
+		return "", nil
+	}
+	sidecar, err := fdst.NewObject(ctx, fs.StoredHashSidecar(o.Remote(), ht))
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorIsDir) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	dt := sidecar.ModTime(ctx).Sub(o.ModTime(ctx))
+	modifyWindow := fs.GetModifyWindow(ctx, fdst)
+	if modifyWindow != fs.ModTimeNotSupported && (dt >= modifyWindow || dt <= -modifyWindow) {
+		fs.Debugf(o, "Ignoring stale %v hash in %q", ht, sidecar.Remote())
+		return "", nil
+	}
+	in, err := Open(ctx, sidecar)
+	if err != nil {
+		return "", err
+	}
+	defer fs.CheckClose(in, &err)
+	data, err := io.ReadAll(io.LimitReader(in, maxStoredHashSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// objectHash returns the hash of type ht for o, using any stored with
+// --store-hash if o's backend doesn't support ht natively.
+func objectHash(ctx context.Context, o fs.ObjectInfo, ht hash.Type) (string, error) {
+	if storeHashType(ctx, o.Fs()) == ht {
+		if obj, ok := o.(fs.Object); ok {
+			return StoredHash(ctx, obj, ht)
+		}
+	}
+	return o.Hash(ctx, ht)
+}
+
+// removeStoredHash removes any sidecar file storing a hash for the
+// object at remote on f.
+func removeStoredHash(ctx context.Context, f fs.Fs, remote string) {
+	ht := storeHashType(ctx, f)
+	if ht == hash.None {
+		return
+	}
+	sidecar, err := f.NewObject(ctx, fs.StoredHashSidecar(remote, ht))
+	if err != nil {
+		return
+	}
+	err = sidecar.Remove(ctx)
+	if err != nil {
+		fs.Errorf(sidecar, "Failed to remove stored hash: %v", err)
+	}
+}
+
+// movedHash is a hash stored in a sidecar file for an object which is
+// being moved, so the sidecar can follow the object
+type movedHash struct {
+	sidecar fs.Object
+	ht      hash.Type
+	sum     string
+}
+
+// readMovedHash reads any hash stored in a sidecar file for o before o
+// is moved, returning nil if there isn't one.
+func readMovedHash(ctx context.Context, o fs.Object) *movedHash {
+	f, ok := o.Fs().(fs.Fs)
+	if !ok || fs.IsStoredHashSidecar(ctx, o.Remote()) {
+		return nil
+	}
+	ht := storeHashType(ctx, f)
+	if ht == hash.None {
+		return nil
+	}
+	sidecar, err := f.NewObject(ctx, fs.StoredHashSidecar(o.Remote(), ht))
+	if err != nil {
+		return nil
+	}
+	sum, err := StoredHash(ctx, o, ht)
+	if err != nil {
+		fs.Errorf(sidecar, "Failed to read stored hash: %v", err)
+	}
+	return &movedHash{sidecar: sidecar, ht: ht, sum: sum}
+}
+
+// move stores the hash for the moved object newDst on fdst if it
+// needs it and removes the old sidecar file
+func (m *movedHash) move(ctx context.Context, fdst fs.Fs, newDst fs.Object) {
+	if m.sum != "" && newDst != nil && storeHashType(ctx, fdst) == m.ht {
+		err := storeHash(ctx, fdst, newDst, m.ht, m.sum)
+		if err != nil {
+			fs.Errorf(newDst, "Failed to keep stored hash: %v", err)
+		}
+	}
+	err := m.sidecar.Remove(ctx)
+	if err != nil {
+		fs.Errorf(m.sidecar, "Failed to remove stored hash: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package operations_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreHash(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	// chunker without hashes has no hashes and no user metadata so
+	// the hash is stored in a sidecar
+	fdst, err := fs.NewFs(ctx, ":chunker,remote=':memory:store-hash',hash_type=none:")
+	require.NoError(t, err)
+	require.Equal(t, hash.Set(hash.None), fdst.Hashes())
+	ci.StoreHash = hash.SHA1
+
+	const contents = "hello hash"
+	file1 := r.WriteFile("file1", contents, t1)
+	src, err := r.Flocal.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	wantSum, err := src.Hash(ctx, hash.SHA1)
+	require.NoError(t, err)
+
+	dst, err := operations.Copy(ctx, fdst, nil, "file1", src)
+	require.NoError(t, err)
+
+	sidecarName := fs.StoredHashSidecar("file1", hash.SHA1)
+	assert.Equal(t, "file1.rclone-sha1", sidecarName)
+	_, err = fdst.NewObject(ctx, sidecarName)
+	require.NoError(t, err)
+
+	gotSum, err := operations.StoredHash(ctx, dst, hash.SHA1)
+	require.NoError(t, err)
+	assert.Equal(t, wantSum, gotSum)
+
+	// The stored hash is used for comparisons
+	equal, ht, err := operations.CheckHashes(ctx, src, dst)
+	require.NoError(t, err)
+	assert.True(t, equal)
+	assert.Equal(t, hash.SHA1, ht)
+
+	// check ignores the sidecar and finds no differences
+	require.NoError(t, operations.Check(ctx, &operations.CheckOpt{
+		Fdst:   fdst,
+		Fsrc:   r.Flocal,
+		OneWay: false,
+	}))
+
+	// Moving the file takes the stored hash with it
+	moved, err := operations.Move(ctx, fdst, nil, "file2", dst)
+	require.NoError(t, err)
+	_, err = fdst.NewObject(ctx, sidecarName)
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+	gotSum, err = operations.StoredHash(ctx, moved, hash.SHA1)
+	require.NoError(t, err)
+	assert.Equal(t, wantSum, gotSum)
+	dst, err = operations.Move(ctx, fdst, nil, "file1", moved)
+	require.NoError(t, err)
+
+	// A corrupted stored hash is detected
+	badSum := strings.Repeat("0", len(wantSum))
+	_, err = operations.Rcat(ctx, fdst, sidecarName, io.NopCloser(strings.NewReader(badSum)), dst.ModTime(ctx), nil)
+	require.NoError(t, err)
+	equal, ht, err = operations.CheckHashes(ctx, src, dst)
+	require.NoError(t, err)
+	assert.False(t, equal)
+	assert.Equal(t, hash.SHA1, ht)
+
+	// Deleting the file removes the sidecar
+	require.NoError(t, operations.DeleteFile(ctx, dst))
+	_, err = fdst.NewObject(ctx, sidecarName)
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+	r.CheckLocalItems(t, file1)
+}
+
+// stallObject is an object whose first Open stalls after reading
+// stallAfter bytes until its context is cancelled. It records the
+// offset each Open starts at.
+type stallObject struct {
+	fs.Object
+	stallAfter int64
+	offsets    []int64
+}
+
+// stallReader blocks until ctx is cancelled
+type stallReader struct {
+	ctx context.Context
+}
+
+func (r stallReader) Read(p []byte) (int, error) {
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+func (o *stallObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	rc, err := o.Object.Open(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	for _, option := range options {
+		if seek, ok := option.(*fs.SeekOption); ok {
+			offset = seek.Offset
+		}
+	}
+	o.offsets = append(o.offsets, offset)
+	if len(o.offsets) == 1 {
+		r := io.MultiReader(&io.LimitedReader{R: rc, N: o.stallAfter}, stallReader{ctx: ctx})
+		rc = struct {
+			io.Reader
+			io.Closer
+		}{r, rc}
+	}
+	return rc, nil
+}
+
+func TestStoreHashRecoverStall(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	fdst, err := fs.NewFs(ctx, ":chunker,remote=':memory:store-hash-stall',hash_type=none:")
+	require.NoError(t, err)
+	ci.StoreHash = hash.SHA1
+	ci.StallTimeout = 100 * time.Millisecond
+
+	const contents = "hello stalled hash"
+	file1 := r.WriteFile("file1", contents, t1)
+	obj, err := r.Flocal.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	wantSum, err := obj.Hash(ctx, hash.SHA1)
+	require.NoError(t, err)
+
+	// The source is reopened where it stalled rather than the
+	// transfer being aborted and started again
+	src := &stallObject{Object: obj, stallAfter: 5}
+	dst, err := operations.Copy(ctx, fdst, nil, "file1", src)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{0, 5}, src.offsets)
+
+	gotSum, err := operations.StoredHash(ctx, dst, hash.SHA1)
+	require.NoError(t, err)
+	assert.Equal(t, wantSum, gotSum)
+
+	r.CheckLocalItems(t, file1)
+}
@@ -0,0 +1,31 @@
+package fs
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// StoredHashKey returns the user metadata key used to store hashes of
+// type ht set with --store-hash, e.g. "rclone-md5"
+func StoredHashKey(ht hash.Type) string {
+	return "rclone-" + ht.String()
+}
+
+// StoredHashSidecar returns the name of the sidecar file used to
+// store hashes of type ht for remote on backends without user
+// metadata, e.g. "file.txt.rclone-md5"
+func StoredHashSidecar(remote string, ht hash.Type) string {
+	return remote + "." + StoredHashKey(ht)
+}
+
+// IsStoredHashSidecar returns true if remote is the name of a sidecar
+// file storing a hash for --store-hash
+func IsStoredHashSidecar(ctx context.Context, remote string) bool {
+	ci := GetConfig(ctx)
+	if ci.StoreHash == hash.None {
+		return false
+	}
+	return strings.HasSuffix(remote, "."+StoredHashKey(ci.StoreHash))
+}
@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// retryGroup is a set of objects from an error report which can be
+// retried with a single sync
+type retryGroup struct {
+	operation string
+	src       string
+	dst       string
+	remotes   []string
+}
+
+// retryGroupKey identifies a retryGroup
+type retryGroupKey struct {
+	operation string
+	src       string
+	dst       string
+}
+
+// getFs makes an Fs from a remote in an error report
+func getFs(ctx context.Context, remote string) (fs.Fs, error) {
+	f, err := cache.Get(ctx, remote)
+	if err == fs.ErrorIsFile {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file system for %q: %w", remote, err)
+	}
+	return f, nil
+}
+
+// retryDeletes deletes the remotes in fdst which still exist, moving
+// them to the --backup-dir if set as a sync would
+func retryDeletes(ctx context.Context, fdst fs.Fs, remotes []string) error {
+	ci := fs.GetConfig(ctx)
+	var backupDir fs.Fs
+	if ci.BackupDir != "" || ci.Suffix != "" {
+		var err error
+		backupDir, err = operations.BackupDir(ctx, fdst, fdst, "")
+		if err != nil {
+			err = fs.CountError(err)
+			fs.Errorf(fdst, "%v", err)
+			return err
+		}
+	}
+	var errCount int
+	for _, remote := range remotes {
+		o, err := fdst.NewObject(ctx, remote)
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			fs.Debugf(fs.LogDirName(fdst, remote), "Not deleting as it no longer exists")
+			operations.RecordError(ctx, operations.ErrorReportDelete, nil, fdst, remote, "", nil)
+			continue
+		}
+		if err == nil {
+			err = operations.DeleteFileWithBackupDir(ctx, o, backupDir)
+		} else {
+			err = fs.CountError(err)
+		}
+		operations.RecordError(ctx, operations.ErrorReportDelete, nil, fdst, remote, "", err)
+		if err != nil {
+			errCount++
+		}
+	}
+	if errCount > 0 {
+		return fmt.Errorf("failed to delete %d files", errCount)
+	}
+	return nil
+}
+
+// retrySync copies or moves the remotes from fsrc to fdst
+func retrySync(ctx context.Context, fdst, fsrc fs.Fs, operation string, remotes []string) error {
+	fi, err := filter.NewFilter(nil)
+	if err != nil {
+		return err
+	}
+	for _, remote := range remotes {
+		err = fi.AddFile(remote)
+		if err != nil {
+			return err
+		}
+	}
+	ctx = filter.ReplaceConfig(ctx, fi)
+	if operation == operations.ErrorReportMove {
+		return moveDir(ctx, fdst, fsrc, false, false)
+	}
+	return CopyDir(ctx, fdst, fsrc, false)
+}
+
+// RetryErrorReport runs the failed operations from an --error-report
+// again with the same source and destination.
+//
+// Objects copied or moved to the same name are retried with a sync
+// limited to those objects, so they are transferred in parallel and
+// still skipped if they no longer need transferring. Objects copied or
+// moved to a different name are retried one at a time.
+func RetryErrorReport(ctx context.Context, entries []operations.ErrorReportEntry) error {
+	var (
+		groups   []*retryGroup
+		groupMap = map[retryGroupKey]*retryGroup{}
+		lastErr  error
+	)
+	for _, entry := range entries {
+		switch entry.Operation {
+		case operations.ErrorReportCopy, operations.ErrorReportMove, operations.ErrorReportDelete:
+		default:
+			err := fs.CountError(fmt.Errorf("unknown operation %q in error report", entry.Operation))
+			fs.Errorf(entry.Remote, "%v", err)
+			lastErr = err
+			continue
+		}
+		if entry.Operation != operations.ErrorReportDelete && entry.DstRemote != "" {
+			err := retryFile(ctx, entry)
+			if err != nil {
+				lastErr = err
+			}
+			continue
+		}
+		key := retryGroupKey{operation: entry.Operation, src: entry.Src, dst: entry.Dst}
+		group, ok := groupMap[key]
+		if !ok {
+			group = &retryGroup{operation: entry.Operation, src: entry.Src, dst: entry.Dst}
+			groupMap[key] = group
+			groups = append(groups, group)
+		}
+		group.remotes = append(group.remotes, entry.Remote)
+	}
+	for _, group := range groups {
+		fs.Infof(nil, "Retrying %d %s operations to %q", len(group.remotes), group.operation, group.dst)
+		fdst, err := getFs(ctx, group.dst)
+		if err != nil {
+			lastErr = fs.CountError(err)
+			fs.Errorf(nil, "%v", lastErr)
+			continue
+		}
+		if group.operation == operations.ErrorReportDelete {
+			err = retryDeletes(ctx, fdst, group.remotes)
+		} else {
+			var fsrc fs.Fs
+			fsrc, err = getFs(ctx, group.src)
+			if err != nil {
+				err = fs.CountError(err)
+				fs.Errorf(nil, "%v", err)
+			} else {
+				err = retrySync(ctx, fdst, fsrc, group.operation, group.remotes)
+			}
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// retryFile copies or moves a single object to a different name
+func retryFile(ctx context.Context, entry operations.ErrorReportEntry) error {
+	fdst, err := getFs(ctx, entry.Dst)
+	if err != nil {
+		err = fs.CountError(err)
+		fs.Errorf(nil, "%v", err)
+		return err
+	}
+	fsrc, err := getFs(ctx, entry.Src)
+	if err != nil {
+		err = fs.CountError(err)
+		fs.Errorf(nil, "%v", err)
+		return err
+	}
+	if entry.Operation == operations.ErrorReportMove {
+		return operations.MoveFile(ctx, fdst, fsrc, entry.DstRemote, entry.Remote)
+	}
+	return operations.CopyFile(ctx, fdst, fsrc, entry.DstRemote, entry.Remote)
+}
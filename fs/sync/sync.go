@@ -18,6 +18,7 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/march"
 	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/transform"
 )
 
 type syncCopyMove struct {
@@ -39,6 +40,7 @@ type syncCopyMove struct {
 	noTraverse             bool                   // if set don't traverse the dst
 	noCheckDest            bool                   // if set transfer all objects regardless without checking dst
 	noUnicodeNormalization bool                   // don't normalize unicode characters in filenames
+	nameTransform          *transform.Transform   // transform src names into dst names - nil if not in use
 	deletersWg             sync.WaitGroup         // for delete before go routine
 	deleteFilesCh          chan fs.Object         // channel to receive deletes if delete before
 	trackRenames           bool                   // set if we should do server-side renames
@@ -53,10 +55,14 @@ type syncCopyMove struct {
 	dstEmptyDirs           map[string]fs.DirEntry // potentially empty directories
 	srcEmptyDirsMu         sync.Mutex             // protect srcEmptyDirs
 	srcEmptyDirs           map[string]fs.DirEntry // potentially empty directories
+	copyDirMetadata        bool                   // set if we should copy directory modtimes and metadata
+	srcDirsMu              sync.Mutex             // protect srcDirs
+	srcDirs                map[string]fs.DirEntry // src directories to copy modtimes and metadata from - only used if copyDirMetadata
 	checkerWg              sync.WaitGroup         // wait for checkers
 	toBeChecked            *pipe                  // checkers channel
 	transfersWg            sync.WaitGroup         // wait for transfers
 	toBeUploaded           *pipe                  // copiers channel
+	toBeUploadedLarge      *pipe                  // copiers channel for the large file lane - nil if not in use
 	errorMu                sync.Mutex             // Mutex covering the errors variables
 	err                    error                  // normal error from copy process
 	noRetryErr             error                  // error with NoRetry set
@@ -70,7 +76,7 @@ type syncCopyMove struct {
 	trackRenamesWg         sync.WaitGroup         // wg for background track renames
 	trackRenamesCh         chan fs.Object         // objects are pumped in here
 	renameCheck            []fs.Object            // accumulate files to check for rename here
-	compareCopyDest        []fs.Fs                // place to check for files to server side copy
+	compareCopyDest        []fs.Fs                // place to check for files to server side copy or hard link
 	backupDir              fs.Fs                  // place to store overwrites/deletes
 	checkFirst             bool                   // if set run all the checkers before starting transfers
 	maxDurationEndTime     time.Time              // end time if --max-duration is set
@@ -102,6 +108,19 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	}
 	ci := fs.GetConfig(ctx)
 	fi := filter.GetConfig(ctx)
+	if ci.BackupSnapshot {
+		// All the backups from this sync go in the same snapshot
+		ctx = operations.WithBackupSnapshot(ctx, time.Now())
+	}
+	nameTransform, err := transform.New(ci.NameTransform)
+	if err != nil {
+		return nil, fserrors.FatalError(err)
+	}
+	if nameTransform.UsesTime() {
+		// The names would be different on each run so nothing
+		// would ever match the destination
+		return nil, fserrors.FatalError(errors.New("--name-transform date can't be used with sync, copy or move"))
+	}
 	s := &syncCopyMove{
 		ci:                     ci,
 		fi:                     fi,
@@ -117,9 +136,12 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		dstFilesResult:         make(chan error, 1),
 		dstEmptyDirs:           make(map[string]fs.DirEntry),
 		srcEmptyDirs:           make(map[string]fs.DirEntry),
+		copyDirMetadata:        operations.CanCopyDirMetadata(ctx, fdst, fsrc),
+		srcDirs:                make(map[string]fs.DirEntry),
 		noTraverse:             ci.NoTraverse,
 		noCheckDest:            ci.NoCheckDest,
 		noUnicodeNormalization: ci.NoUnicodeNormalization,
+		nameTransform:          nameTransform,
 		deleteFilesCh:          make(chan fs.Object, ci.Checkers),
 		trackRenames:           ci.TrackRenames,
 		commonHash:             fsrc.Hashes().Overlap(fdst.Hashes()).GetOne(),
@@ -132,7 +154,6 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		fs.Infof(s.fdst, "Running all checks before starting transfers")
 		backlog = -1
 	}
-	var err error
 	s.toBeChecked, err = newPipe(ci.OrderBy, accounting.Stats(ctx).SetCheckQueue, backlog)
 	if err != nil {
 		return nil, err
@@ -141,6 +162,13 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	if err != nil {
 		return nil, err
 	}
+	if ci.LargeFileCutoff >= 0 {
+		fs.Infof(s.fdst, "Transferring files of %v or larger with %d separate transfers", ci.LargeFileCutoff, s.largeTransfers())
+		s.toBeUploadedLarge, err = newPipe(ci.OrderBy, accounting.Stats(ctx).SetLargeTransferQueue, backlog)
+		if err != nil {
+			return nil, err
+		}
+	}
 	s.toBeRenamed, err = newPipe(ci.OrderBy, accounting.Stats(ctx).SetRenameQueue, backlog)
 	if err != nil {
 		return nil, err
@@ -240,6 +268,12 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		if err != nil {
 			return nil, err
 		}
+	} else if len(ci.LinkDest) > 0 {
+		var err error
+		s.compareCopyDest, err = operations.GetLinkDest(ctx, fdst)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return s, nil
 }
@@ -317,10 +351,44 @@ func (s *syncCopyMove) currentError() error {
 	return s.noRetryErr
 }
 
-// pairChecker reads Objects~s on in send to out if they need transferring.
+// largeTransfers returns the number of transfers to use in the large
+// file lane
+func (s *syncCopyMove) largeTransfers() int {
+	if s.ci.LargeTransfers < 1 {
+		return 1
+	}
+	return s.ci.LargeTransfers
+}
+
+// putTransfer queues pair for transfer in the small or large file
+// lane as appropriate.
+//
+// Files of unknown size go in the small file lane.
+//
+// It returns ok = false if the context was cancelled
+func (s *syncCopyMove) putTransfer(pair fs.ObjectPair) (ok bool) {
+	out := s.toBeUploaded
+	if s.toBeUploadedLarge != nil && pair.Src != pair.Dst && pair.Src.Size() >= int64(s.ci.LargeFileCutoff) {
+		out = s.toBeUploadedLarge
+	}
+	return out.Put(s.ctx, pair)
+}
+
+// compareOrCopyDest checks --compare-dest and --copy-dest for src
+// using its name on the destination
+func (s *syncCopyMove) compareOrCopyDest(dst, src fs.Object) (NoNeedTransfer bool, err error) {
+	dstRemote, err := s.nameTransform.Path(src.Remote(), false)
+	if err != nil {
+		return false, err
+	}
+	return operations.CompareOrCopyDest(s.ctx, s.fdst, dst, src, dstRemote, s.compareCopyDest, s.backupDir)
+}
+
+// pairChecker reads Objects~s on in and queues them for transfer if
+// they need transferring.
 //
 // FIXME potentially doing lots of hashes at once
-func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.WaitGroup) {
+func (s *syncCopyMove) pairChecker(in *pipe, fraction int, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
 		pair, ok := in.GetMax(s.inCtx, fraction)
@@ -334,7 +402,7 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 		if src.Storable() {
 			needTransfer := operations.NeedTransfer(s.ctx, pair.Dst, pair.Src)
 			if needTransfer {
-				NoNeedTransfer, err := operations.CompareOrCopyDest(s.ctx, s.fdst, pair.Dst, pair.Src, s.compareCopyDest, s.backupDir)
+				NoNeedTransfer, err := s.compareOrCopyDest(pair.Dst, pair.Src)
 				if err != nil {
 					s.processError(err)
 				}
@@ -357,13 +425,13 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 						} else {
 							// If successful zero out the dst as it is no longer there and copy the file
 							pair.Dst = nil
-							ok = out.Put(s.ctx, pair)
+							ok = s.putTransfer(pair)
 							if !ok {
 								return
 							}
 						}
 					} else {
-						ok = out.Put(s.ctx, pair)
+						ok = s.putTransfer(pair)
 						if !ok {
 							return
 						}
@@ -381,12 +449,14 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 						// If we want perfect ordering then use the transfers to delete the file
 						//
 						// We send src == dst, to say we want the src deleted
-						ok = out.Put(s.ctx, fs.ObjectPair{Src: src, Dst: src})
+						ok = s.putTransfer(fs.ObjectPair{Src: src, Dst: src})
 						if !ok {
 							return
 						}
 					} else {
-						s.processError(operations.DeleteFile(s.ctx, src))
+						err := operations.DeleteFile(s.ctx, src)
+						operations.RecordError(s.ctx, operations.ErrorReportDelete, nil, s.fsrc, src.Remote(), "", err)
+						s.processError(err)
 					}
 				}
 			}
@@ -396,8 +466,8 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 }
 
 // pairRenamer reads Objects~s on in and attempts to rename them,
-// otherwise it sends them out if they need transferring.
-func (s *syncCopyMove) pairRenamer(in *pipe, out *pipe, fraction int, wg *sync.WaitGroup) {
+// otherwise it queues them for transfer.
+func (s *syncCopyMove) pairRenamer(in *pipe, fraction int, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
 		pair, ok := in.GetMax(s.inCtx, fraction)
@@ -408,7 +478,7 @@ func (s *syncCopyMove) pairRenamer(in *pipe, out *pipe, fraction int, wg *sync.W
 		if !s.tryRename(src) {
 			// pass on if not renamed
 			fs.Debugf(src, "Need to transfer - No matching file found at Destination")
-			ok = out.Put(s.ctx, pair)
+			ok = s.putTransfer(pair)
 			if !ok {
 				return
 			}
@@ -429,13 +499,24 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 		dst := pair.Dst
 		if s.DoMove {
 			if src != dst {
-				_, err = operations.Move(ctx, fdst, dst, src.Remote(), src)
+				var dstRemote string
+				dstRemote, err = s.nameTransform.Path(src.Remote(), false)
+				if err == nil {
+					_, err = operations.Move(ctx, fdst, dst, dstRemote, src)
+				}
+				operations.RecordError(ctx, operations.ErrorReportMove, s.fsrc, fdst, src.Remote(), dstRemote, err)
 			} else {
 				// src == dst signals delete the src
 				err = operations.DeleteFile(ctx, src)
+				operations.RecordError(ctx, operations.ErrorReportDelete, nil, s.fsrc, src.Remote(), "", err)
 			}
 		} else {
-			_, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+			var dstRemote string
+			dstRemote, err = s.nameTransform.Path(src.Remote(), false)
+			if err == nil {
+				_, err = operations.Copy(ctx, fdst, dst, dstRemote, src)
+			}
+			operations.RecordError(ctx, operations.ErrorReportCopy, s.fsrc, fdst, src.Remote(), dstRemote, err)
 		}
 		s.processError(err)
 	}
@@ -446,7 +527,7 @@ func (s *syncCopyMove) startCheckers() {
 	s.checkerWg.Add(s.ci.Checkers)
 	for i := 0; i < s.ci.Checkers; i++ {
 		fraction := (100 * i) / s.ci.Checkers
-		go s.pairChecker(s.toBeChecked, s.toBeUploaded, fraction, &s.checkerWg)
+		go s.pairChecker(s.toBeChecked, fraction, &s.checkerWg)
 	}
 }
 
@@ -464,11 +545,22 @@ func (s *syncCopyMove) startTransfers() {
 		fraction := (100 * i) / s.ci.Transfers
 		go s.pairCopyOrMove(s.ctx, s.toBeUploaded, s.fdst, fraction, &s.transfersWg)
 	}
+	if s.toBeUploadedLarge != nil {
+		largeTransfers := s.largeTransfers()
+		s.transfersWg.Add(largeTransfers)
+		for i := 0; i < largeTransfers; i++ {
+			fraction := (100 * i) / largeTransfers
+			go s.pairCopyOrMove(s.ctx, s.toBeUploadedLarge, s.fdst, fraction, &s.transfersWg)
+		}
+	}
 }
 
 // This stops the background transfers
 func (s *syncCopyMove) stopTransfers() {
 	s.toBeUploaded.Close()
+	if s.toBeUploadedLarge != nil {
+		s.toBeUploadedLarge.Close()
+	}
 	fs.Debugf(s.fdst, "Waiting for transfers to finish")
 	s.transfersWg.Wait()
 }
@@ -481,7 +573,7 @@ func (s *syncCopyMove) startRenamers() {
 	s.renamerWg.Add(s.ci.Checkers)
 	for i := 0; i < s.ci.Checkers; i++ {
 		fraction := (100 * i) / s.ci.Checkers
-		go s.pairRenamer(s.toBeRenamed, s.toBeUploaded, fraction, &s.renamerWg)
+		go s.pairRenamer(s.toBeRenamed, fraction, &s.renamerWg)
 	}
 }
 
@@ -621,27 +713,38 @@ func (s *syncCopyMove) deleteEmptyDirectories(ctx context.Context, f fs.Fs, entr
 }
 
 // This copies the empty directories in the slice passed in and logs
-// any errors copying the directories
-func copyEmptyDirectories(ctx context.Context, f fs.Fs, entries map[string]fs.DirEntry) error {
+// any errors copying the directories. Their names are transformed
+// with nameTransform which may be nil.
+func copyEmptyDirectories(ctx context.Context, f fs.Fs, fsrc fs.Fs, entries map[string]fs.DirEntry, nameTransform *transform.Transform) error {
 	if len(entries) == 0 {
 		return nil
 	}
 
 	var okCount int
+	made := make(map[string]fs.DirEntry, len(entries))
 	for _, entry := range entries {
 		dir, ok := entry.(fs.Directory)
 		if ok {
-			err := operations.Mkdir(ctx, f, dir.Remote())
+			dstRemote, err := nameTransform.Path(dir.Remote(), true)
+			if err == nil {
+				err = operations.Mkdir(ctx, f, dstRemote)
+			}
 			if err != nil {
-				fs.Errorf(fs.LogDirName(f, dir.Remote()), "Failed to Mkdir: %v", err)
+				fs.Errorf(fs.LogDirName(f, dstRemote), "Failed to Mkdir: %v", err)
 			} else {
 				okCount++
+				made[dir.Remote()] = dir
 			}
 		} else {
 			fs.Errorf(f, "Not a directory: %v", entry)
 		}
 	}
 
+	// The directories are empty so they are finished already
+	if operations.CanCopyDirMetadata(ctx, f, fsrc) {
+		_ = copyDirMetadata(ctx, f, fsrc, made, nameTransform)
+	}
+
 	if accounting.Stats(ctx).Errored() {
 		fs.Debugf(f, "failed to copy %d directories", accounting.Stats(ctx).GetErrors())
 	}
@@ -652,6 +755,48 @@ func copyEmptyDirectories(ctx context.Context, f fs.Fs, entries map[string]fs.Di
 	return nil
 }
 
+// copyDirMetadata copies the modification times and metadata of the
+// src directories in entries to fdst, transforming their names with
+// nameTransform which may be nil.
+//
+// Subdirectories are done before their parents in case setting them
+// changes their parents. It returns the last error.
+func copyDirMetadata(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, entries map[string]fs.DirEntry, nameTransform *transform.Transform) (err error) {
+	dirs := make([]string, 0, len(entries))
+	for dir := range entries {
+		dirs = append(dirs, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		src, ok := entries[dir].(fs.Directory)
+		if !ok {
+			continue
+		}
+		dstRemote, dirErr := nameTransform.Path(dir, true)
+		if dirErr == nil {
+			dirErr = operations.CopyDirMetadata(ctx, fdst, dstRemote, fsrc, src)
+		}
+		if dirErr != nil {
+			err = dirErr
+		}
+	}
+	return err
+}
+
+// recordSrcDir records a src directory to copy its modification time
+// and metadata when the sync has finished
+func (s *syncCopyMove) recordSrcDir(src fs.DirEntry) {
+	if !s.copyDirMetadata || s.deleteMode == fs.DeleteModeOnly {
+		return
+	}
+	s.srcDirsMu.Lock()
+	s.srcDirs[src.Remote()] = src
+	s.srcDirsMu.Unlock()
+}
+
 func (s *syncCopyMove) srcParentDirCheck(entry fs.DirEntry) {
 	// If we are moving files then we don't want to remove directories with files in them
 	// from the srcEmptyDirs as we are about to move them making the directory empty.
@@ -827,10 +972,15 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 	}
 
 	// Find dst object we are about to overwrite if it exists
-	dstOverwritten, _ := s.fdst.NewObject(s.ctx, src.Remote())
+	dstRemote, err := s.nameTransform.Path(src.Remote(), false)
+	if err != nil {
+		fs.Debugf(src, "Failed to rename: %v", err)
+		return false
+	}
+	dstOverwritten, _ := s.fdst.NewObject(s.ctx, dstRemote)
 
-	// Rename dst to have name src.Remote()
-	_, err := operations.Move(s.ctx, s.fdst, dstOverwritten, src.Remote(), dst)
+	// Rename dst to have name dstRemote
+	_, err = operations.Move(s.ctx, s.fdst, dstOverwritten, dstRemote, dst)
 	if err != nil {
 		fs.Debugf(src, "Failed to rename to %q: %v", dst.Remote(), err)
 		return false
@@ -884,6 +1034,7 @@ func (s *syncCopyMove) run() error {
 		DstIncludeAll:          s.fi.Opt.DeleteExcluded,
 		NoCheckDest:            s.noCheckDest,
 		NoUnicodeNormalization: s.noUnicodeNormalization,
+		NameTransform:          s.nameTransform,
 	}
 	s.processError(m.Run(s.ctx))
 
@@ -911,7 +1062,7 @@ func (s *syncCopyMove) run() error {
 	s.stopDeleters()
 
 	if s.copyEmptySrcDirs {
-		s.processError(copyEmptyDirectories(s.ctx, s.fdst, s.srcEmptyDirs))
+		s.processError(copyEmptyDirectories(s.ctx, s.fdst, s.fsrc, s.srcEmptyDirs, s.nameTransform))
 	}
 
 	// Delete files after
@@ -932,6 +1083,12 @@ func (s *syncCopyMove) run() error {
 		}
 	}
 
+	// Copy the directory modification times and metadata now the
+	// contents of the directories are finished
+	if s.copyDirMetadata {
+		s.processError(copyDirMetadata(s.ctx, s.fdst, s.fsrc, s.srcDirs, s.nameTransform))
+	}
+
 	// Delete empty fsrc subdirectories
 	// if DoMove and --delete-empty-src-dirs flag is set
 	if s.DoMove && s.deleteEmptySrcDirs {
@@ -1021,14 +1178,14 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 			}
 		} else {
 			// Check CompareDest && CopyDest
-			NoNeedTransfer, err := operations.CompareOrCopyDest(s.ctx, s.fdst, nil, x, s.compareCopyDest, s.backupDir)
+			NoNeedTransfer, err := s.compareOrCopyDest(nil, x)
 			if err != nil {
 				s.processError(err)
 			}
 			if !NoNeedTransfer {
 				// No need to check since doesn't exist
 				fs.Debugf(src, "Need to transfer - File not found at Destination")
-				ok := s.toBeUploaded.Put(s.ctx, fs.ObjectPair{Src: x, Dst: nil})
+				ok := s.putTransfer(fs.ObjectPair{Src: x, Dst: nil})
 				if !ok {
 					return
 				}
@@ -1041,6 +1198,7 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 		s.srcParentDirCheck(src)
 		s.srcEmptyDirs[src.Remote()] = src
 		s.srcEmptyDirsMu.Unlock()
+		s.recordSrcDir(src)
 		return true
 	default:
 		panic("Bad object in DirEntries")
@@ -1083,7 +1241,7 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 				s.srcEmptyDirs[src.Remote()] = src
 				s.srcEmptyDirsMu.Unlock()
 			}
-
+			s.recordSrcDir(src)
 			return true
 		}
 		// FIXME src is dir, dst is file
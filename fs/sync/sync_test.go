@@ -6,6 +6,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -114,6 +117,65 @@ func TestCopyCheckFirst(t *testing.T) {
 	r.CheckRemoteItems(t, file1)
 }
 
+// Now with --large-file-cutoff
+func TestCopyLargeFileLanes(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	ci.LargeFileCutoff = 10
+	ci.LargeTransfers = 1
+	ci.OrderBy = "size,descending"
+
+	file1 := r.WriteFile("small", "hello", t1)
+	file2 := r.WriteFile("sub dir/large", "hello world", t1)
+	file3 := r.WriteFile("cutoff", "0123456789", t2)
+
+	err := CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+
+	r.CheckLocalItems(t, file1, file2, file3)
+	r.CheckRemoteItems(t, file1, file2, file3)
+}
+
+func TestPutTransferLanes(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	small := r.WriteObject(ctx, "small", "hello", t1)
+	large := r.WriteObject(ctx, "large", "hello world", t1)
+	smallObj, err := r.Fremote.NewObject(ctx, small.Path)
+	require.NoError(t, err)
+	largeObj, err := r.Fremote.NewObject(ctx, large.Path)
+	require.NoError(t, err)
+
+	// Without --large-file-cutoff there is only one lane
+	s, err := newSyncCopyMove(ctx, r.Flocal, r.Fremote, fs.DeleteModeOff, false, false, false)
+	require.NoError(t, err)
+	assert.Nil(t, s.toBeUploadedLarge)
+
+	ci.LargeFileCutoff = 10
+	ci.LargeTransfers = 0
+	s, err = newSyncCopyMove(ctx, r.Flocal, r.Fremote, fs.DeleteModeOff, false, false, false)
+	require.NoError(t, err)
+	require.NotNil(t, s.toBeUploadedLarge)
+	assert.Equal(t, 1, s.largeTransfers())
+
+	assert.True(t, s.putTransfer(fs.ObjectPair{Src: smallObj}))
+	assert.True(t, s.putTransfer(fs.ObjectPair{Src: largeObj}))
+	// src == dst to delete the source always goes in the small lane
+	assert.True(t, s.putTransfer(fs.ObjectPair{Src: largeObj, Dst: largeObj}))
+
+	items, size := s.toBeUploaded.Stats()
+	assert.Equal(t, 2, items)
+	assert.Equal(t, int64(5), size)
+	items, size = s.toBeUploadedLarge.Stats()
+	assert.Equal(t, 1, items)
+	assert.Equal(t, int64(11), size)
+	s.cancel()
+}
+
 // Now with --no-traverse
 func TestSyncNoTraverse(t *testing.T) {
 	ctx := context.Background()
@@ -150,6 +212,60 @@ func TestCopyWithDepth(t *testing.T) {
 	r.CheckRemoteItems(t, file2)
 }
 
+// Test sync with --name-transform
+func TestSyncNameTransform(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("Sub Dir/Hello World.TXT", "hello world", t1)
+	file2 := r.WriteFile("Hello World2", "hello world2", t2)
+
+	ci.NameTransform = []string{"all,lowercase", "file,suffix_keep_extension=_x"}
+
+	err := Sync(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+
+	r.CheckLocalItems(t, file1, file2)
+	want1 := fstest.NewItem("sub dir/hello world_x.txt", "hello world", t1)
+	want2 := fstest.NewItem("hello world2_x", "hello world2", t2)
+	r.CheckRemoteItems(t, want1, want2)
+
+	// A second sync finds the transformed files and does nothing
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, want1, want2)
+}
+
+// Test sync with --name-transform making invalid names
+func TestSyncNameTransformInvalid(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("a_b", "slash", t1)
+	file2 := r.WriteFile("dots", "dots", t1)
+	file3 := r.WriteFile("ok", "ok", t2)
+	r.Mkdir(ctx, r.Fremote)
+
+	// Names with "/" in or which are "." or ".." are skipped
+	ci.NameTransform = []string{"replace=_:/", "regex=^dots$/.."}
+	accounting.GlobalStats().ResetCounters()
+	err := Sync(ctx, r.Fremote, r.Flocal, false)
+	require.Error(t, err)
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetErrors())
+	accounting.GlobalStats().ResetErrors()
+	r.CheckLocalItems(t, file1, file2, file3)
+	r.CheckRemoteItems(t, file3)
+
+	// The date changes every run so can't be used with sync
+	ci.NameTransform = []string{"date=2006-01-02_"}
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	require.Error(t, err)
+	assert.True(t, fserrors.IsFatalError(err))
+	r.CheckRemoteItems(t, file3)
+}
+
 // Test copy with files from
 func testCopyWithFilesFrom(t *testing.T, noTraverse bool) {
 	ctx := context.Background()
@@ -178,6 +294,55 @@ func testCopyWithFilesFrom(t *testing.T, noTraverse bool) {
 func TestCopyWithFilesFrom(t *testing.T)              { testCopyWithFilesFrom(t, false) }
 func TestCopyWithFilesFromAndNoTraverse(t *testing.T) { testCopyWithFilesFrom(t, true) }
 
+// dirModTime reads the modification time of dir in f
+func dirModTime(ctx context.Context, t *testing.T, f fs.Fs, dir string) time.Time {
+	parent := path.Dir(dir)
+	if parent == "." {
+		parent = ""
+	}
+	entries, err := f.List(ctx, parent)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if d, ok := entry.(fs.Directory); ok && d.Remote() == dir {
+			return d.ModTime(ctx)
+		}
+	}
+	t.Fatalf("directory %q not found", dir)
+	return time.Time{}
+}
+
+// Test directory modification times are copied
+func TestCopyDirModTime(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	if r.Fremote.Features().DirSetModTime == nil || !r.Flocal.Features().CanHaveEmptyDirectories {
+		t.Skip("Skipping test as remote can't set directory modification times")
+	}
+	r.WriteFile("sub dir/sub sub dir/hello world", "hello world", t1)
+	require.NoError(t, operations.Mkdir(ctx, r.Flocal, "empty dir"))
+	setModTime := r.Flocal.Features().DirSetModTime
+	require.NoError(t, setModTime(ctx, "sub dir/sub sub dir", t2))
+	require.NoError(t, setModTime(ctx, "sub dir", t3))
+	require.NoError(t, setModTime(ctx, "empty dir", t2))
+	r.Mkdir(ctx, r.Fremote)
+
+	err := CopyDir(ctx, r.Fremote, r.Flocal, true)
+	require.NoError(t, err)
+
+	precision := fs.GetModifyWindow(ctx, r.Fremote)
+	fstest.AssertTimeEqualWithPrecision(t, "sub dir/sub sub dir", t2, dirModTime(ctx, t, r.Fremote, "sub dir/sub sub dir"), precision)
+	fstest.AssertTimeEqualWithPrecision(t, "sub dir", t3, dirModTime(ctx, t, r.Fremote, "sub dir"), precision)
+	fstest.AssertTimeEqualWithPrecision(t, "empty dir", t2, dirModTime(ctx, t, r.Fremote, "empty dir"), precision)
+
+	// Not copied with --no-update-modtime
+	ctx, ci := fs.AddConfig(ctx)
+	ci.NoUpdateModTime = true
+	require.NoError(t, setModTime(ctx, "sub dir", t1))
+	err = CopyDir(ctx, r.Fremote, r.Flocal, true)
+	require.NoError(t, err)
+	fstest.AssertTimeEqualWithPrecision(t, "sub dir", t3, dirModTime(ctx, t, r.Fremote, "sub dir"), precision)
+}
+
 // Test copy empty directories
 func TestCopyEmptyDirectories(t *testing.T) {
 	ctx := context.Background()
@@ -925,6 +1090,35 @@ func TestSyncWithExcludeAndDeleteExcluded(t *testing.T) {
 	r.CheckLocalItems(t, file2)
 }
 
+// Test with --ignore-file-name
+func TestSyncWithIgnoreFileName(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	rootIgnore := r.WriteFile(".rcloneignore", "# root rules\n*.log\n!keep.log\n/build/\ndocs/**/*.pdf\n", t1)
+	subIgnore := r.WriteFile("sub/.rcloneignore", "!*.log\n", t1)
+	file1 := r.WriteFile("a.txt", "a", t1)
+	file2 := r.WriteFile("a.log", "a log", t1)
+	file3 := r.WriteFile("keep.log", "keep", t1)
+	file4 := r.WriteFile("build/out.bin", "out", t1)
+	file5 := r.WriteFile("sub/build/out.bin", "sub out", t1)
+	file6 := r.WriteFile("sub/b.log", "b log", t1)
+	file7 := r.WriteFile("docs/x/y/z.pdf", "pdf", t1)
+	file8 := r.WriteFile("docs/x/y/z.txt", "txt", t1)
+	r.CheckLocalItems(t, rootIgnore, subIgnore, file1, file2, file3, file4, file5, file6, file7, file8)
+	excludedDst := r.WriteObject(ctx, "build/old.bin", "old", t1)
+	r.CheckRemoteItems(t, excludedDst)
+
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	fi.Opt.IgnoreFileName = ".rcloneignore"
+	ctx = filter.ReplaceConfig(ctx, fi)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, rootIgnore, subIgnore, file1, file3, file5, file6, file8, excludedDst)
+}
+
 // Test with UpdateOlder set
 func TestSyncWithUpdateOlder(t *testing.T) {
 	ctx := context.Background()
@@ -1716,6 +1910,100 @@ func TestSyncCopyDest(t *testing.T) {
 	r.CheckRemoteItems(t, file2, file2dst, file3, file4, file4dst, file6, file7dst)
 }
 
+// Test with LinkDest set
+func TestSyncLinkDest(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	if r.Fremote.Features().HardLink == nil {
+		t.Skip("Skipping test as remote does not support hard links")
+	}
+
+	ci.LinkDest = []string{r.FremoteName + "/LinkDest"}
+
+	fdst, err := fs.NewFs(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+
+	// one is the same as in the link dest, two is changed and
+	// three is new
+	file1 := r.WriteObject(ctx, "LinkDest/one", "one", t1)
+	file2 := r.WriteObject(ctx, "LinkDest/two", "two", t1)
+	file1src := r.WriteFile("one", "one", t1)
+	file2src := r.WriteFile("two", "twot2", t2)
+	file3src := r.WriteFile("three", "three", t2)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+	// one is hard linked so isn't transferred or copied from --link-dest
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetTransfers())
+
+	file1dst := file1src
+	file1dst.Path = "dst/one"
+	file2dst := file2src
+	file2dst.Path = "dst/two"
+	file3dst := file3src
+	file3dst.Path = "dst/three"
+	r.CheckRemoteItems(t, file1, file2, file1dst, file2dst, file3dst)
+
+	// Check dst/one is a hard link to LinkDest/one
+	if r.Fremote.Features().IsLocal {
+		assert.True(t, sameLocalFile(t, r.Fremote, "LinkDest/one", "dst/one"))
+		assert.False(t, sameLocalFile(t, r.Fremote, "LinkDest/two", "dst/two"))
+	}
+
+	// Nothing changes on a second sync
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, file1, file2, file1dst, file2dst, file3dst)
+}
+
+// Test with LinkDest and NameTransform set
+func TestSyncLinkDestNameTransform(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	if r.Fremote.Features().HardLink == nil {
+		t.Skip("Skipping test as remote does not support hard links")
+	}
+
+	ci.LinkDest = []string{r.FremoteName + "/LinkDest"}
+	ci.NameTransform = []string{"all,lowercase"}
+
+	fdst, err := fs.NewFs(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+
+	// ONE is found in the link dest under its transformed name
+	file1 := r.WriteObject(ctx, "LinkDest/one", "one", t1)
+	file1src := r.WriteFile("ONE", "one", t1)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+
+	file1dst := file1src
+	file1dst.Path = "dst/one"
+	r.CheckRemoteItems(t, file1, file1dst)
+	if r.Fremote.Features().IsLocal {
+		assert.True(t, sameLocalFile(t, r.Fremote, "LinkDest/one", "dst/one"))
+	}
+}
+
+// sameLocalFile returns true if a and b in the local f are the same
+// file, for example hard links to each other
+func sameLocalFile(t *testing.T, f fs.Fs, a, b string) bool {
+	aInfo, err := os.Stat(filepath.Join(f.Root(), a))
+	require.NoError(t, err)
+	bInfo, err := os.Stat(filepath.Join(f.Root(), b))
+	require.NoError(t, err)
+	return os.SameFile(aInfo, bInfo)
+}
+
 // Test with BackupDir set
 func testSyncBackupDir(t *testing.T, backupDir string, suffix string, suffixKeepExtension bool) {
 	ctx := context.Background()
@@ -1813,6 +2101,50 @@ func TestSyncBackupDirSuffixOnly(t *testing.T) {
 	testSyncBackupDir(t, "", ".bak", false)
 }
 
+// Test with BackupSnapshot set
+func TestSyncBackupSnapshot(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	if !operations.CanServerSideMove(r.Fremote) {
+		t.Skip("Skipping test as remote does not support server-side move")
+	}
+	r.Mkdir(ctx, r.Fremote)
+	ci.BackupDir = r.FremoteName + "/backup"
+	ci.BackupSnapshot = true
+
+	file1 := r.WriteObject(ctx, "dst/one", "one", t1)
+	file2 := r.WriteObject(ctx, "dst/two", "two", t1)
+	file1a := r.WriteFile("one", "oneA", t2)
+	r.CheckRemoteItems(t, file1, file2)
+	r.CheckLocalItems(t, file1a)
+
+	fdst, err := fs.NewFs(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+
+	before := time.Now().Add(-time.Second)
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+	after := time.Now()
+
+	// Find the snapshot directory
+	entries, err := r.Fremote.List(ctx, "backup")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	snapshot := path.Base(entries[0].Remote())
+	snapshotTime, err := operations.ParseBackupSnapshotName(snapshot)
+	require.NoError(t, err)
+	assert.True(t, snapshotTime.After(before) && snapshotTime.Before(after), snapshot)
+
+	// one and two should be moved to the snapshot
+	file1.Path = "backup/" + snapshot + "/one"
+	file2.Path = "backup/" + snapshot + "/two"
+	file1a.Path = "dst/one"
+	r.CheckRemoteItems(t, file1, file2, file1a)
+}
+
 // Test with Suffix set
 func testSyncSuffix(t *testing.T, suffix string, suffixKeepExtension bool) {
 	ctx := context.Background()
@@ -2082,3 +2414,69 @@ func TestSyncConcurrentDelete(t *testing.T) {
 func TestSyncConcurrentTruncate(t *testing.T) {
 	testSyncConcurrent(t, "truncate")
 }
+
+// Test retrying the operations from an --error-report
+func TestRetryErrorReport(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("sub dir/file1", "file1 contents", t1)
+	file2 := r.WriteFile("file2", "file2 contents", t2)
+	file3 := r.WriteObject(ctx, "file3", "file3 contents", t3)
+	r.CheckRemoteItems(t, file3)
+
+	entries := []operations.ErrorReportEntry{
+		{
+			Operation: operations.ErrorReportCopy,
+			Src:       fs.ConfigStringFull(r.Flocal),
+			Dst:       fs.ConfigStringFull(r.Fremote),
+			Remote:    file1.Path,
+		},
+		{
+			Operation: operations.ErrorReportDelete,
+			Dst:       fs.ConfigStringFull(r.Fremote),
+			Remote:    file3.Path,
+		},
+		{
+			Operation: operations.ErrorReportDelete,
+			Dst:       fs.ConfigStringFull(r.Fremote),
+			Remote:    "not found",
+		},
+	}
+	err := RetryErrorReport(ctx, entries)
+	require.NoError(t, err)
+
+	r.CheckLocalItems(t, file1, file2)
+	r.CheckRemoteItems(t, file1)
+
+	// Unknown operations are an error
+	accounting.GlobalStats().ResetCounters()
+	err = RetryErrorReport(ctx, []operations.ErrorReportEntry{{Operation: "potato"}})
+	assert.Error(t, err)
+	accounting.GlobalStats().ResetCounters()
+}
+
+func TestRetryErrorReportBackupDir(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	if !operations.CanServerSideMove(r.Fremote) {
+		t.Skip("Skipping test as remote does not support server-side move")
+	}
+	file1 := r.WriteObject(ctx, "dst/file1", "file1 contents", t1)
+	r.CheckRemoteItems(t, file1)
+
+	fdst, err := fs.NewFs(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+	ci.BackupDir = r.FremoteName + "/backup"
+
+	err = RetryErrorReport(ctx, []operations.ErrorReportEntry{{
+		Operation: operations.ErrorReportDelete,
+		Dst:       fs.ConfigStringFull(fdst),
+		Remote:    "file1",
+	}})
+	require.NoError(t, err)
+
+	// The deleted file is in the backup dir
+	file1.Path = "backup/file1"
+	r.CheckRemoteItems(t, file1)
+}
@@ -191,6 +191,17 @@ type Metadataer interface {
 	Metadata(ctx context.Context) (Metadata, error)
 }
 
+// SetMetadataer is an optional interface for Object
+type SetMetadataer interface {
+	// SetMetadata updates the metadata of the object without
+	// re-uploading its contents.
+	//
+	// The metadata passed in is merged into the existing
+	// metadata. It should return ErrorNotImplemented if the
+	// metadata can't be set on this object.
+	SetMetadata(ctx context.Context, metadata Metadata) error
+}
+
 // FullObjectInfo contains all the read-only optional interfaces
 //
 // Use for checking making wrapping ObjectInfos implement everything
@@ -214,6 +225,7 @@ type FullObject interface {
 	GetTierer
 	SetTierer
 	Metadataer
+	SetMetadataer
 }
 
 // ObjectOptionalInterfaces returns the names of supported and
@@ -245,6 +257,9 @@ func ObjectOptionalInterfaces(o Object) (supported, unsupported []string) {
 	_, ok = o.(Metadataer)
 	store(ok, "Metadata")
 
+	_, ok = o.(SetMetadataer)
+	store(ok, "SetMetadata")
+
 	return supported, unsupported
 }
 
@@ -69,7 +69,7 @@ func Walk(ctx context.Context, f fs.Fs, path string, includeAll bool, maxLevel i
 		return walkR(ctx, f, path, includeAll, maxLevel, fn, fi.MakeListR(ctx, f.NewObject))
 	}
 	// FIXME should this just be maxLevel < 0 - why the maxLevel > 1
-	if (maxLevel < 0 || maxLevel > 1) && ci.UseListR && f.Features().ListR != nil {
+	if (maxLevel < 0 || maxLevel > 1) && ci.UseListR && f.Features().ListR != nil && fi.Opt.IgnoreFileName == "" {
 		return walkListR(ctx, f, path, includeAll, maxLevel, fn)
 	}
 	return walkListDirSorted(ctx, f, path, includeAll, maxLevel, fn)
@@ -155,6 +155,7 @@ func ListR(ctx context.Context, f fs.Fs, path string, includeAll bool, maxLevel
 		fi.HaveFilesFrom() || // ...using --files-from
 		maxLevel >= 0 || // ...using bounded recursion
 		len(fi.Opt.ExcludeFile) > 0 || // ...using --exclude-file
+		fi.Opt.IgnoreFileName != "" || // ...using --ignore-file-name
 		fi.UsesDirectoryFilters() { // ...using any directory filters
 		return listRwalk(ctx, f, path, includeAll, maxLevel, listType, fn)
 	}
@@ -370,11 +371,13 @@ func walk(ctx context.Context, f fs.Fs, path string, includeAll bool, maxLevel i
 		doClose    sync.Once           // close the channel once
 		mu         sync.Mutex          // stop fn being called concurrently
 		ci         = fs.GetConfig(ctx) // current config
+		fi         = filter.GetConfig(ctx)
 	)
 	// listJob describe a directory listing that needs to be done
 	type listJob struct {
 		remote string
 		depth  int
+		ignore *filter.Ignore // rules from the ignore files in the parents
 	}
 
 	in := make(chan listJob, ci.Checkers)
@@ -401,6 +404,12 @@ func walk(ctx context.Context, f fs.Fs, path string, includeAll bool, maxLevel i
 						return
 					}
 					entries, err := listDir(ctx, f, includeAll, job.remote)
+					ignore := job.ignore
+					if err == nil && !includeAll {
+						// Apply any --ignore-file-name rules so excluded directories are never listed
+						ignore, err = fi.DirIgnore(ctx, ignore, job.remote, entries)
+						entries = ignore.Filter(entries)
+					}
 					var jobs []listJob
 					if err == nil && job.depth != 0 {
 						entries.ForDir(func(dir fs.Directory) {
@@ -408,6 +417,7 @@ func walk(ctx context.Context, f fs.Fs, path string, includeAll bool, maxLevel i
 							jobs = append(jobs, listJob{
 								remote: dir.Remote(),
 								depth:  job.depth - 1,
+								ignore: ignore,
 							})
 						})
 					}
@@ -591,8 +601,8 @@ func NewDirTree(ctx context.Context, f fs.Fs, path string, includeAll bool, maxL
 	if ci.NoTraverse && fi.HaveFilesFrom() {
 		return walkRDirTree(ctx, f, path, includeAll, maxLevel, fi.MakeListR(ctx, f.NewObject))
 	}
-	// if have ListR; and recursing; and not using --files-from; then build a DirTree with ListR
-	if ListR := f.Features().ListR; (maxLevel < 0 || maxLevel > 1) && ListR != nil && !fi.HaveFilesFrom() {
+	// if have ListR; and recursing; and not using --files-from or --ignore-file-name; then build a DirTree with ListR
+	if ListR := f.Features().ListR; (maxLevel < 0 || maxLevel > 1) && ListR != nil && !fi.HaveFilesFrom() && fi.Opt.IgnoreFileName == "" {
 		return walkRDirTree(ctx, f, path, includeAll, maxLevel, ListR)
 	}
 	// otherwise just use List
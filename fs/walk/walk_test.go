@@ -296,6 +296,39 @@ a/b/c/d/
 `, entries.String())
 }
 
+func TestWalkIgnoreFileName(t *testing.T) {
+	ctx := context.Background()
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	fi.Opt.IgnoreFileName = ".rcloneignore"
+	ctx = filter.ReplaceConfig(ctx, fi)
+
+	ignoreA := mockobject.New("a/.rcloneignore").WithContent([]byte("secret/\n*.tmp\n"), mockobject.SeekModeNone)
+	ignoreB := mockobject.New("a/b/.rcloneignore").WithContent([]byte("!*.tmp\n"), mockobject.SeekModeNone)
+	// a/secret must never be listed
+	ls := newListDirs(t, nil, false,
+		listResults{
+			"":    {entries: fs.DirEntries{mockdir.New("a")}, err: nil},
+			"a":   {entries: fs.DirEntries{ignoreA, mockobject.Object("a/x.tmp"), mockobject.Object("a/y"), mockdir.New("a/secret"), mockdir.New("a/b")}, err: nil},
+			"a/b": {entries: fs.DirEntries{ignoreB, mockobject.Object("a/b/z.tmp"), mockdir.New("a/b/secret")}, err: nil},
+		},
+		errorMap{},
+		nil,
+	)
+	entries, err := walkNDirTree(ctx, nil, "", ls.includeAll, ls.maxLevel, ls.ListDir)
+	require.NoError(t, err)
+	assert.Equal(t, `/
+  a/
+a/
+  .rcloneignore
+  y
+  b/
+a/b/
+  .rcloneignore
+  z.tmp
+`, entries.String())
+}
+
 func testWalkLevelsNoRecursive(t *testing.T) *listDirs {
 	da := mockdir.New("a")
 	oA := mockobject.Object("A")
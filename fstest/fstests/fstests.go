@@ -785,6 +785,56 @@ func Run(t *testing.T, opt *Opt) {
 			assert.NoError(t, f.Rmdir(ctx, "writer-at-subdir"))
 		})
 
+		// TestFsDirSetModTime tests setting the modification time
+		// and metadata of directories
+		t.Run("FsDirSetModTime", func(t *testing.T) {
+			skipIfNotOk(t)
+			features := f.Features()
+			if features.DirSetModTime == nil && features.DirSetMetadata == nil {
+				t.Skip("FS has no DirSetModTime or DirSetMetadata interface")
+			}
+			const dir = "dir-set-modtime"
+			file := fstest.Item{
+				ModTime: fstest.Time("2001-02-03T04:05:06.499999999Z"),
+				Path:    dir + "/file",
+			}
+			obj := PutTestContents(ctx, t, f, &file, "dir modtime", true)
+			defer func() {
+				assert.NoError(t, obj.Remove(ctx))
+				_ = f.Rmdir(ctx, dir)
+			}()
+
+			// Setting a missing directory should fail
+			if features.DirSetModTime != nil {
+				err := features.DirSetModTime(ctx, "dir-set-modtime-missing", time.Now())
+				assert.True(t, errors.Is(err, fs.ErrorDirNotFound), "expecting ErrorDirNotFound but got %v", err)
+			}
+
+			if features.DirSetMetadata != nil && features.DirMetadata != nil {
+				require.NoError(t, features.DirSetMetadata(ctx, dir, fs.Metadata{"mtime": "2003-04-05T06:07:08Z"}))
+				metadata, err := features.DirMetadata(ctx, dir)
+				require.NoError(t, err)
+				mtime, err := time.Parse(time.RFC3339Nano, metadata["mtime"])
+				require.NoError(t, err)
+				assert.True(t, mtime.Equal(fstest.Time("2003-04-05T06:07:08Z")), "wrong mtime %v", mtime)
+			}
+
+			if features.DirSetModTime != nil {
+				modTime := fstest.Time("2002-03-04T05:06:07.123456789Z")
+				require.NoError(t, features.DirSetModTime(ctx, dir, modTime))
+				entries, err := f.List(ctx, "")
+				require.NoError(t, err)
+				found := false
+				for _, entry := range entries {
+					if d, ok := entry.(fs.Directory); ok && d.Remote() == dir {
+						found = true
+						fstest.AssertTimeEqualWithPrecision(t, dir, modTime, d.ModTime(ctx), f.Precision())
+					}
+				}
+				assert.True(t, found, "directory not found in listing")
+			}
+		})
+
 		// TestFsChangeNotify tests that changes are properly
 		// propagated
 		//
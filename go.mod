@@ -4,6 +4,7 @@ go 1.18
 
 require (
 	bazil.org/fuse v0.0.0-20221209211307-2abb8038c751
+	filippo.io/age v1.0.0
 	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.6.0
 	github.com/Azure/azure-sdk-for-go/sdk/azidentity v1.3.0
 	github.com/Azure/azure-sdk-for-go/sdk/storage/azblob v1.0.0
@@ -0,0 +1,365 @@
+// Package transform implements the --name-transform pipeline which
+// changes file and directory names as they are copied.
+//
+// Unlike lib/encoder these transformations aren't reversible.
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rclone/rclone/lib/encoder"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// scope is which kind of names a step is applied to
+type scope int
+
+const (
+	scopeFile scope = 1 << iota // apply to file names
+	scopeDir                    // apply to directory names
+	scopeAll  = scopeFile | scopeDir
+)
+
+// step is a single transformation in the pipeline
+type step struct {
+	scope scope
+	fn    func(name string) string
+}
+
+// Transform is a parsed --name-transform pipeline
+//
+// A nil *Transform is valid and leaves names unchanged.
+type Transform struct {
+	steps    []step
+	usesTime bool // set if any step depends on the time
+}
+
+// command describes a transformation which can be used
+type command struct {
+	name     string
+	help     string
+	hasArg   bool
+	usesTime bool // set if the result depends on the time
+	make     func(arg string, now time.Time) (func(string) string, error)
+}
+
+// noArg makes a command maker for a transformation with no argument
+func noArg(fn func(string) string) func(string, time.Time) (func(string) string, error) {
+	return func(string, time.Time) (func(string) string, error) {
+		return fn, nil
+	}
+}
+
+// splitExt splits name into base and extension including the "."
+func splitExt(name string) (base, ext string) {
+	ext = path.Ext(name)
+	return name[:len(name)-len(ext)], ext
+}
+
+var commands = []command{
+	{
+		name: "lowercase",
+		help: "Convert the name to lower case.",
+		make: noArg(strings.ToLower),
+	}, {
+		name: "uppercase",
+		help: "Convert the name to upper case.",
+		make: noArg(strings.ToUpper),
+	}, {
+		name: "titlecase",
+		help: "Convert the name to title case.",
+		make: noArg(cases.Title(language.Und, cases.NoLower).String),
+	}, {
+		name: "nfc",
+		help: "Convert the name to Unicode NFC form.",
+		make: noArg(norm.NFC.String),
+	}, {
+		name: "nfd",
+		help: "Convert the name to Unicode NFD form.",
+		make: noArg(norm.NFD.String),
+	}, {
+		name: "nfkc",
+		help: "Convert the name to Unicode NFKC form.",
+		make: noArg(norm.NFKC.String),
+	}, {
+		name: "nfkd",
+		help: "Convert the name to Unicode NFKD form.",
+		make: noArg(norm.NFKD.String),
+	}, {
+		name: "ascii",
+		help: "Remove any characters which aren't printable ASCII.",
+		make: noArg(func(name string) string {
+			return strings.Map(func(r rune) rune {
+				if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+					return -1
+				}
+				return r
+			}, name)
+		}),
+	}, {
+		name:   "strip",
+		help:   "Remove all of the characters in the argument from the name.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			return func(name string) string {
+				return strings.Map(func(r rune) rune {
+					if strings.ContainsRune(arg, r) {
+						return -1
+					}
+					return r
+				}, name)
+			}, nil
+		},
+	}, {
+		name:   "prefix",
+		help:   "Add the argument to the start of the name.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			return func(name string) string { return arg + name }, nil
+		},
+	}, {
+		name:   "suffix",
+		help:   "Add the argument to the end of the name.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			return func(name string) string { return name + arg }, nil
+		},
+	}, {
+		name:   "suffix_keep_extension",
+		help:   "Add the argument to the end of the name before the extension.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			return func(name string) string {
+				base, ext := splitExt(name)
+				return base + arg + ext
+			}, nil
+		},
+	}, {
+		name:   "trimprefix",
+		help:   "Remove the argument from the start of the name if present.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			return func(name string) string { return strings.TrimPrefix(name, arg) }, nil
+		},
+	}, {
+		name:   "trimsuffix",
+		help:   "Remove the argument from the end of the name if present.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			return func(name string) string { return strings.TrimSuffix(name, arg) }, nil
+		},
+	}, {
+		name:   "replace",
+		help:   "Replace all occurrences of OLD with NEW, given as OLD:NEW.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			oldNew := strings.SplitN(arg, ":", 2)
+			if len(oldNew) != 2 || oldNew[0] == "" {
+				return nil, errors.New("argument must be OLD:NEW")
+			}
+			return func(name string) string { return strings.ReplaceAll(name, oldNew[0], oldNew[1]) }, nil
+		},
+	}, {
+		name:   "regex",
+		help:   "Replace matches of a regular expression, given as PATTERN/REPLACEMENT. The replacement may use $1 etc.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			slash := strings.IndexRune(arg, '/')
+			if slash < 0 {
+				return nil, errors.New("argument must be PATTERN/REPLACEMENT")
+			}
+			re, err := regexp.Compile(arg[:slash])
+			if err != nil {
+				return nil, err
+			}
+			replacement := arg[slash+1:]
+			return func(name string) string { return re.ReplaceAllString(name, replacement) }, nil
+		},
+	}, {
+		name:   "ext",
+		help:   "Change the extension of the name to the argument, e.g. ext=.md. An empty argument removes it.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			if arg != "" && !strings.HasPrefix(arg, ".") {
+				arg = "." + arg
+			}
+			return func(name string) string {
+				base, _ := splitExt(name)
+				return base + arg
+			}, nil
+		},
+	}, {
+		name:     "date",
+		help:     "Add the date the command was started to the start of the name, formatted with the Go time layout given, e.g. date=2006-01-02_. This can't be used with sync, copy or move.",
+		hasArg:   true,
+		usesTime: true,
+		make: func(arg string, now time.Time) (func(string) string, error) {
+			if arg == "" {
+				return nil, errors.New("argument must be a time layout")
+			}
+			date := now.Format(arg)
+			return func(name string) string { return date + name }, nil
+		},
+	}, {
+		name:   "encoder",
+		help:   "Encode the name with the encodings listed, e.g. encoder=Colon,Question.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			var enc encoder.MultiEncoder
+			err := enc.Set(arg)
+			if err != nil {
+				return nil, err
+			}
+			return enc.Encode, nil
+		},
+	}, {
+		name:   "decoder",
+		help:   "Decode the name with the encodings listed, e.g. decoder=Colon,Question.",
+		hasArg: true,
+		make: func(arg string, _ time.Time) (func(string) string, error) {
+			var enc encoder.MultiEncoder
+			err := enc.Set(arg)
+			if err != nil {
+				return nil, err
+			}
+			return enc.Decode, nil
+		},
+	},
+}
+
+// Help returns a description of the transformations available
+func Help() string {
+	var out strings.Builder
+	for _, cmd := range commands {
+		name := cmd.name
+		if cmd.hasArg {
+			name += "=ARG"
+		}
+		_, _ = fmt.Fprintf(&out, "- `%s` - %s\n", name, cmd.help)
+	}
+	return out.String()
+}
+
+// parseScope removes any file, dir or all prefix from spec
+func parseScope(spec string) (scope, string) {
+	for _, prefix := range []struct {
+		name  string
+		scope scope
+	}{
+		{"file,", scopeFile},
+		{"dir,", scopeDir},
+		{"all,", scopeAll},
+	} {
+		if strings.HasPrefix(spec, prefix.name) {
+			return prefix.scope, spec[len(prefix.name):]
+		}
+	}
+	return scopeFile, spec
+}
+
+// New parses the --name-transform specifications in specs
+//
+// Each spec is [file,|dir,|all,]command[=argument]. The scope says
+// whether the command applies to file names (the default), directory
+// names or both.
+//
+// It returns nil if there are no specs.
+func New(specs []string) (*Transform, error) {
+	return newAt(specs, time.Now())
+}
+
+// newAt parses specs using now for any date transformations
+func newAt(specs []string, now time.Time) (*Transform, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	t := &Transform{}
+	for _, spec := range specs {
+		sc, rest := parseScope(spec)
+		name, arg, hasArg := strings.Cut(rest, "=")
+		var found *command
+		for i := range commands {
+			if commands[i].name == name {
+				found = &commands[i]
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("name transform %q: unknown command %q", spec, name)
+		}
+		if hasArg != found.hasArg {
+			if found.hasArg {
+				return nil, fmt.Errorf("name transform %q: %q needs an argument", spec, name)
+			}
+			return nil, fmt.Errorf("name transform %q: %q doesn't take an argument", spec, name)
+		}
+		fn, err := found.make(arg, now)
+		if err != nil {
+			return nil, fmt.Errorf("name transform %q: %w", spec, err)
+		}
+		t.steps = append(t.steps, step{scope: sc, fn: fn})
+		t.usesTime = t.usesTime || found.usesTime
+	}
+	return t, nil
+}
+
+// UsesTime returns true if the transformed names depend on the time
+// the Transform was made, so they are different each run.
+func (t *Transform) UsesTime() bool {
+	return t != nil && t.usesTime
+}
+
+// Leaf transforms a single file or directory name
+//
+// If the transformations would leave the name empty then it is
+// returned unchanged. It returns an error if they would make a name
+// which isn't a single path element.
+func (t *Transform) Leaf(name string, isDir bool) (string, error) {
+	if t == nil {
+		return name, nil
+	}
+	want := scopeFile
+	if isDir {
+		want = scopeDir
+	}
+	newName := name
+	for _, s := range t.steps {
+		if s.scope&want != 0 {
+			newName = s.fn(newName)
+		}
+	}
+	switch {
+	case newName == "":
+		return name, nil
+	case newName == "." || newName == ".." || strings.ContainsRune(newName, '/'):
+		return "", fmt.Errorf("name transform of %q gives invalid name %q", name, newName)
+	}
+	return newName, nil
+}
+
+// Path transforms each element of the "/" separated remote
+//
+// The last element is transformed as a directory if isDir is set,
+// otherwise as a file. All the other elements are directories.
+func (t *Transform) Path(remote string, isDir bool) (string, error) {
+	if t == nil || remote == "" {
+		return remote, nil
+	}
+	elements := strings.Split(remote, "/")
+	for i, element := range elements {
+		newElement, err := t.Leaf(element, isDir || i < len(elements)-1)
+		if err != nil {
+			return "", err
+		}
+		elements[i] = newElement
+	}
+	return strings.Join(elements, "/"), nil
+}
@@ -0,0 +1,127 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewErrors(t *testing.T) {
+	for _, spec := range []string{
+		"potato",
+		"lowercase=1",
+		"prefix",
+		"replace=nocolon",
+		"regex=noslash",
+		"regex=[/x",
+		"encoder=Potato",
+		"date=",
+	} {
+		_, err := New([]string{spec})
+		assert.Error(t, err, spec)
+	}
+	tr, err := New(nil)
+	require.NoError(t, err)
+	assert.Nil(t, tr)
+}
+
+func TestLeaf(t *testing.T) {
+	now := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		specs []string
+		in    string
+		isDir bool
+		want  string
+	}{
+		{[]string{"lowercase"}, "Hello.TXT", false, "hello.txt"},
+		{[]string{"lowercase"}, "Hello", true, "Hello"},
+		{[]string{"dir,lowercase"}, "Hello", true, "hello"},
+		{[]string{"dir,lowercase"}, "Hello", false, "Hello"},
+		{[]string{"all,uppercase"}, "Hello", true, "HELLO"},
+		{[]string{"titlecase"}, "hello world", false, "Hello World"},
+		{[]string{"nfc"}, "é", false, "é"},
+		{[]string{"nfd"}, "é", false, "é"},
+		{[]string{"ascii"}, "café.txt", false, "caf.txt"},
+		{[]string{"strip=- "}, "a-b c.txt", false, "abc.txt"},
+		{[]string{"prefix=old_"}, "file.txt", false, "old_file.txt"},
+		{[]string{"suffix=.bak"}, "file.txt", false, "file.txt.bak"},
+		{[]string{"suffix_keep_extension=_v2"}, "file.txt", false, "file_v2.txt"},
+		{[]string{"trimprefix=old_"}, "old_file.txt", false, "file.txt"},
+		{[]string{"trimsuffix=.bak"}, "file.txt.bak", false, "file.txt"},
+		{[]string{"replace=a:b"}, "banana", false, "bbnbnb"},
+		{[]string{"regex=^(\\d+)-(.*)$/$2-$1"}, "01-track.mp3", false, "track.mp3-01"},
+		{[]string{"ext=.md"}, "notes.txt", false, "notes.md"},
+		{[]string{"ext=md"}, "notes", false, "notes.md"},
+		{[]string{"ext="}, "notes.txt", false, "notes"},
+		{[]string{"date=2006-01-02_"}, "file.txt", false, "2024-03-05_file.txt"},
+		{[]string{"encoder=Colon"}, "a:b", false, "a：b"},
+		{[]string{"decoder=Colon"}, "a：b", false, "a:b"},
+		{[]string{"lowercase", "replace= :_"}, "My File.TXT", false, "my_file.txt"},
+		{[]string{"ascii"}, "éé", false, "éé"},
+	} {
+		tr, err := newAt(test.specs, now)
+		require.NoError(t, err)
+		got, err := tr.Leaf(test.in, test.isDir)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, got, test.specs)
+	}
+}
+
+func TestLeafInvalid(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		in   string
+	}{
+		{"replace=_:/", "a_b"},
+		{"regex=.*/.", "file"},
+		{"regex=.*/..", "file"},
+		{"prefix=dir/", "file"},
+		{"decoder=Slash", "a／b"},
+	} {
+		tr, err := New([]string{test.spec})
+		require.NoError(t, err)
+		_, err = tr.Leaf(test.in, false)
+		assert.Error(t, err, test.spec)
+		_, err = tr.Path("dir/"+test.in, false)
+		assert.Error(t, err, test.spec)
+	}
+}
+
+func TestUsesTime(t *testing.T) {
+	tr, err := New([]string{"lowercase"})
+	require.NoError(t, err)
+	assert.False(t, tr.UsesTime())
+	tr, err = New([]string{"lowercase", "date=2006-01-02_"})
+	require.NoError(t, err)
+	assert.True(t, tr.UsesTime())
+	var nilTr *Transform
+	assert.False(t, nilTr.UsesTime())
+}
+
+func TestPath(t *testing.T) {
+	tr, err := New([]string{"file,uppercase", "dir,lowercase"})
+	require.NoError(t, err)
+	for _, test := range []struct {
+		in    string
+		isDir bool
+		want  string
+	}{
+		{"", false, ""},
+		{"A/B/file.txt", false, "a/b/FILE.TXT"},
+		{"A/B/C", true, "a/b/c"},
+	} {
+		got, err := tr.Path(test.in, test.isDir)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, got)
+	}
+
+	var nilTr *Transform
+	got, err := nilTr.Path("A/b", false)
+	require.NoError(t, err)
+	assert.Equal(t, "A/b", got)
+	got, err = nilTr.Leaf("A", true)
+	require.NoError(t, err)
+	assert.Equal(t, "A", got)
+}